@@ -62,7 +62,7 @@ func (m *Webmentiond) BuildBinaries(ctx context.Context, rootDir *dagger.Directo
 			WithDirectory("/src/frontend", builtFrontend).
 			WithWorkdir("/src/cmd/webmentiond").
 			WithEnvVariable("GOARCH", config.arch).
-			WithExec([]string{"go", "build", "-o", "../../webmentiond", "-ldflags", finalFlags})
+			WithExec([]string{"go", "build", "-tags", "sqlite_fts5", "-o", "../../webmentiond", "-ldflags", finalFlags})
 		updated.file = container.File("/src/webmentiond")
 		output[name] = updated
 	}
@@ -60,7 +60,7 @@ func (m *Webmentiond) TestBackend(ctx context.Context, rootDir *dagger.Directory
 		WithExec([]string{"touch", "frontend/demo.html"}).
 		WithExec([]string{"touch", "frontend/dist/empty"}).
 		WithExec([]string{"touch", "frontend/css/empty"}).
-		WithExec([]string{"go", "test", "./..."}).Sync(ctx)
+		WithExec([]string{"go", "test", "-tags", "sqlite_fts5", "./..."}).Sync(ctx)
 }
 
 func (m *Webmentiond) AttachBinaries(ctx context.Context, token *dagger.Secret, uploadURL string, binaries *dagger.Directory) error {
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/zerok/webmentiond/pkg/server"
+)
+
+func newBackupCmd() Command {
+	var to string
+	var backupCmd = &cobra.Command{
+		Use:   "backup",
+		Short: "Create a consistent copy of the SQLite database",
+		Long: `Create a copy of the SQLite database using SQLite's online backup API.
+This is safe while the server is running and writing to the database, unlike
+copying the database file.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := logger.WithContext(context.Background())
+			if to == "" {
+				return fmt.Errorf("no backup destination specified")
+			}
+			path, err := sqliteDatabasePath()
+			if err != nil {
+				return err
+			}
+			// Opening a database that doesn't exist would create an
+			// empty one:
+			if !strings.HasPrefix(path, "file:") {
+				if _, err := os.Stat(path); err != nil {
+					return fmt.Errorf("database not found: %w", err)
+				}
+			}
+			db, err := server.OpenSQLite(path, server.SQLiteOptions{
+				BusyTimeout: cfg.GetDuration("database.busy_timeout"),
+				MaxReaders:  1,
+			})
+			if err != nil {
+				return fmt.Errorf("failed to open %s: %w", path, err)
+			}
+			defer db.Close()
+			if err := server.BackupSQLite(ctx, db.Reader, to); err != nil {
+				return err
+			}
+			logger.Info().Msgf("Created backup %s", to)
+			return nil
+		},
+	}
+	backupCmd.Flags().StringVar(&to, "to", "", "Path the backup is written to")
+	addDatabaseFlags(backupCmd)
+	return newBaseCommand(backupCmd)
+}
+
+func newRestoreCmd() Command {
+	var restoreCmd = &cobra.Command{
+		Use:   "restore FILE",
+		Short: "Replace the SQLite database with a backup",
+		Long: `Replace the SQLite database with a backup created by the backup command or
+the scheduled backups of the server. The backup is validated and migrated to
+the latest schema version before the database is replaced. The previous
+database is kept with the suffix .pre-restore.
+
+Stop the server before restoring a backup.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := logger.WithContext(context.Background())
+			path, err := sqliteDatabasePath()
+			if err != nil {
+				return err
+			}
+			if strings.HasPrefix(path, "file:") || strings.Contains(path, "?") {
+				return fmt.Errorf("restoring requires the path of the database file instead of %s", path)
+			}
+			migrationsFolder, err := databaseMigrationsFolder()
+			if err != nil {
+				return err
+			}
+			if err := server.RestoreSQLite(ctx, args[0], path, migrationsFolder); err != nil {
+				return err
+			}
+			logger.Info().Msgf("Restored %s from %s", path, args[0])
+			return nil
+		},
+	}
+	addDatabaseFlags(restoreCmd)
+	return newBaseCommand(restoreCmd)
+}
+
+// sqliteDatabasePath returns the path of the configured SQLite
+// database. Backups are not supported for PostgreSQL, which comes with
+// pg_dump for that.
+func sqliteDatabasePath() (string, error) {
+	if driver := cfg.GetString("database.driver"); driver != server.DatabaseDriverSQLite && driver != "" {
+		return "", fmt.Errorf("backups are only supported for sqlite3, use pg_dump for postgres")
+	}
+	path := databaseURL(cfg)
+	if path == "" {
+		return "", fmt.Errorf("no database specified")
+	}
+	return path, nil
+}
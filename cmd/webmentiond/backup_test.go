@@ -0,0 +1,44 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBackupRestore(t *testing.T) {
+	dir := t.TempDir()
+	database := filepath.Join(dir, "webmentiond.sqlite")
+	backup := filepath.Join(dir, "backup.sqlite")
+	migrations := filepath.Join("..", "..", "pkg", "server", "migrations")
+	input := filepath.Join("..", "..", "pkg", "server", "testdata", "webmentionio.jf2")
+
+	run := func(cmd Command, args ...string) error {
+		t.Helper()
+		c := cmd.Cmd()
+		c.SetArgs(append(args, "--database", database, "--database-migrations", migrations))
+		return c.Execute()
+	}
+	// Backing up a database that doesn't exist must not create it:
+	require.Error(t, run(newBackupCmd(), "--to", backup))
+	require.NoFileExists(t, database)
+	require.NoFileExists(t, backup)
+
+	require.NoError(t, run(newImportCmd(), "--from", "webmention.io", input))
+	require.NoError(t, run(newBackupCmd(), "--to", backup))
+	require.FileExists(t, backup)
+	require.Error(t, run(newBackupCmd()))
+
+	require.NoError(t, run(newRestoreCmd(), backup))
+	require.FileExists(t, database+".pre-restore")
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "invalid.sqlite"), []byte("invalid"), 0o600))
+	require.Error(t, run(newRestoreCmd(), filepath.Join(dir, "invalid.sqlite")))
+
+	report := filepath.Join(dir, "report.json")
+	require.NoError(t, run(newImportCmd(), "--from", "webmention.io", "--report", report, input))
+	data, err := os.ReadFile(report)
+	require.NoError(t, err)
+	require.Contains(t, string(data), `"unchanged": 3`)
+}
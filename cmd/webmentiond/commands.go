@@ -42,5 +42,10 @@ func buildCmd() Command {
 	root.AddCommand("send", sendCmd)
 	root.AddCommand("verify", verifyCmd)
 	root.AddCommand("config", newConfigCmd())
+	root.AddCommand("export", newExportCmd())
+	root.AddCommand("import", newImportCmd())
+	root.AddCommand("backup", newBackupCmd())
+	root.AddCommand("restore", newRestoreCmd())
+	root.AddCommand("db", newDBCmd())
 	return root
 }
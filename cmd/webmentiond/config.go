@@ -6,6 +6,7 @@ import (
 
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
+	"github.com/zerok/webmentiond/pkg/server"
 )
 
 func newConfigCmd() Command {
@@ -38,10 +39,34 @@ func validateConfig(cfg *viper.Viper) error {
 	requireConfigStringSliceSet(t, cfg, "server.auth_admin_emails", "", "--auth-admin-emails")
 	requireConfigStringSliceSet(t, cfg, "server.allowed_target_domains", "", "--allowed-target-domains")
 	requireConfigSet(t, cfg, "server.auth_jwt_secret", "SERVER_AUTH_JWT_SECRET", "--auth-jwt-secret")
-	requireConfigSet(t, cfg, "database.path", "", "--database")
+	switch cfg.GetString("database.driver") {
+	case server.DatabaseDriverPostgres:
+		requireConfigSet(t, cfg, "database.url", "DATABASE_URL", "--database-url")
+		if cfg.GetString("backup.dir") != "" {
+			t.Fail(fmt.Errorf("scheduled backups are only supported for sqlite3"))
+		}
+	case server.DatabaseDriverSQLite, "":
+		if cfg.GetString("database.url") == "" {
+			requireConfigSet(t, cfg, "database.path", "", "--database")
+		}
+	default:
+		t.Fail(fmt.Errorf("unsupported database driver %s", cfg.GetString("database.driver")))
+	}
 	return t.Error()
 }
 
+// databaseURL returns the data source name passed to sql.Open. For
+// SQLite, database.path is used unless database.url is set.
+func databaseURL(cfg *viper.Viper) string {
+	if u := cfg.GetString("database.url"); u != "" {
+		return u
+	}
+	if cfg.GetString("database.driver") == server.DatabaseDriverPostgres {
+		return ""
+	}
+	return cfg.GetString("database.path")
+}
+
 func requireConfigSet(fs *failState, cfg *viper.Viper, field string, env string, flag string) {
 	if fs.Failed() {
 		return
@@ -28,3 +28,27 @@ func TestConfig(t *testing.T) {
 	// Now we're complete!
 	require.NoError(t, validateConfig(cfg))
 }
+
+func TestDatabaseConfig(t *testing.T) {
+	cfg := viper.New()
+	cfg.Set("email.host", "somehost")
+	cfg.Set("email.port", "25")
+	cfg.Set("email.from", "somefrom")
+	cfg.Set("server.auth_admin_emails", []string{"test@zerokspot.com"})
+	cfg.Set("server.auth_jwt_secret", "secret")
+	cfg.Set("server.allowed_target_domains", []string{"zerokspot.com"})
+	cfg.Set("database.path", "webmentiond.sqlite")
+	require.NoError(t, validateConfig(cfg))
+	require.Equal(t, "webmentiond.sqlite", databaseURL(cfg))
+
+	// PostgreSQL requires a URL:
+	cfg.Set("database.driver", "postgres")
+	require.Error(t, validateConfig(cfg))
+	require.Empty(t, databaseURL(cfg))
+	cfg.Set("database.url", "postgres://localhost/webmentiond")
+	require.NoError(t, validateConfig(cfg))
+	require.Equal(t, "postgres://localhost/webmentiond", databaseURL(cfg))
+
+	cfg.Set("database.driver", "mysql")
+	require.Error(t, validateConfig(cfg))
+}
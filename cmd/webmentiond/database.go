@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+	"github.com/zerok/webmentiond/pkg/server"
+)
+
+// databaseFlags maps the flags added by addDatabaseFlags to their
+// configuration keys.
+var databaseFlags = map[string]string{
+	"database":              "database.path",
+	"database-driver":       "database.driver",
+	"database-url":          "database.url",
+	"database-busy-timeout": "database.busy_timeout",
+	"database-max-readers":  "database.max_readers",
+	"database-migrations":   "database.migrations",
+}
+
+// addDatabaseFlags adds the flags for selecting the database to cmd. As
+// several commands share the same configuration keys, the flags are only
+// bound to them once cmd is actually run.
+func addDatabaseFlags(cmd *cobra.Command) {
+	flags := cmd.Flags()
+	flags.String("database", "./webmentiond.sqlite", "Path to a SQLite database file")
+	flags.String("database-driver", server.DatabaseDriverSQLite, "Database driver to use: sqlite3 or postgres")
+	flags.String("database-url", "", "Database connection URL (required for postgres; overrides --database for sqlite3)")
+	flags.Duration("database-busy-timeout", server.DefaultSQLiteBusyTimeout, "How long SQLite waits for a locked database")
+	flags.Int("database-max-readers", 0, "Maximum number of read-only SQLite connections (default: number of CPUs, at least 4)")
+	flags.String("database-migrations", "", "Path to the database migrations")
+	cfg.BindEnv("database.url", "DATABASE_URL")
+	bindFlagsOnRun(cmd, databaseFlags)
+}
+
+// bindFlagsOnRun binds the given flags of cmd to their configuration
+// keys right before cmd is run. This allows several commands to have
+// flags for the same key.
+func bindFlagsOnRun(cmd *cobra.Command, flags map[string]string) {
+	preRun := cmd.PreRunE
+	cmd.PreRunE = func(cmd *cobra.Command, args []string) error {
+		for flag, key := range flags {
+			if err := cfg.BindPFlag(key, cmd.Flags().Lookup(flag)); err != nil {
+				return err
+			}
+		}
+		if preRun != nil {
+			return preRun(cmd, args)
+		}
+		return nil
+	}
+}
+
+// databaseMigrationsFolder returns the absolute path of the configured
+// migrations folder or an empty string for the embedded migrations.
+func databaseMigrationsFolder() (string, error) {
+	folder := cfg.GetString("database.migrations")
+	if folder == "" {
+		return "", nil
+	}
+	return filepath.Abs(folder)
+}
+
+// openDatabase returns the pool used for writing and the one used for
+// reading. For SQLite these are separate pools as created by
+// server.OpenSQLite, for PostgreSQL both are the same.
+func openDatabase(driver string, dsn string, sqliteOpts server.SQLiteOptions) (*sql.DB, *sql.DB, error) {
+	if driver == server.DatabaseDriverPostgres {
+		db, err := sql.Open(driver, dsn)
+		return db, db, err
+	}
+	sqliteDB, err := server.OpenSQLite(dsn, sqliteOpts)
+	if err != nil {
+		return nil, nil, err
+	}
+	return sqliteDB.Writer, sqliteDB.Reader, nil
+}
+
+// openStore opens the configured database, migrates it to the latest
+// version and returns a store for it. The returned function closes the
+// database.
+func openStore(ctx context.Context) (*server.SQLStore, func(), error) {
+	driver := cfg.GetString("database.driver")
+	dsn := databaseURL(cfg)
+	if dsn == "" {
+		return nil, nil, fmt.Errorf("no database specified")
+	}
+	migrationsFolder, err := databaseMigrationsFolder()
+	if err != nil {
+		return nil, nil, err
+	}
+	db, readDB, err := openDatabase(driver, dsn, server.SQLiteOptions{
+		BusyTimeout: cfg.GetDuration("database.busy_timeout"),
+		MaxReaders:  cfg.GetInt("database.max_readers"),
+	})
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to open %s database: %w", driver, err)
+	}
+	closeFn := func() {
+		readDB.Close()
+		db.Close()
+	}
+	srv := server.New(func(c *server.Configuration) {
+		c.Context = ctx
+		c.Database = db
+		c.DatabaseDriver = driver
+		c.MigrationsFolder = migrationsFolder
+	})
+	if err := srv.MigrateDatabase(ctx); err != nil {
+		closeFn()
+		return nil, nil, err
+	}
+	store, err := server.NewSQLStore(db, driver)
+	if err != nil {
+		closeFn()
+		return nil, nil, err
+	}
+	return store.WithReader(readDB), closeFn, nil
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/zerok/webmentiond/pkg/server"
+)
+
+func newDBCmd() Command {
+	var dbCmd = &cobra.Command{
+		Use:   "db",
+		Short: "Maintain the database",
+	}
+	cmd := newBaseCommand(dbCmd)
+	cmd.AddCommand("prune", newDBPruneCmd())
+	return cmd
+}
+
+func newDBPruneCmd() Command {
+	var dryRun bool
+	var pruneCmd = &cobra.Command{
+		Use:   "prune",
+		Short: "Remove mentions that are older than the retention period of their status",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := logger.WithContext(context.Background())
+			periods, err := retentionPeriods()
+			if err != nil {
+				return err
+			}
+			if len(periods) == 0 {
+				return fmt.Errorf("no retention period configured")
+			}
+			store, closeStore, err := openStore(ctx)
+			if err != nil {
+				return err
+			}
+			defer closeStore()
+			srv := server.New(func(c *server.Configuration) {
+				c.Context = ctx
+				c.MentionStore = store
+				c.Retention.Periods = periods
+			})
+			pruned, err := srv.PruneMentions(ctx, dryRun)
+			if err != nil {
+				return err
+			}
+			statuses := make([]string, 0, len(pruned))
+			for status := range pruned {
+				statuses = append(statuses, status)
+			}
+			sort.Strings(statuses)
+			verb := "Pruned"
+			if dryRun {
+				verb = "Would prune"
+			}
+			for _, status := range statuses {
+				logger.Info().Msgf("%s %d %s mentions", verb, pruned[status], status)
+			}
+			return nil
+		},
+	}
+	pruneCmd.Flags().BoolVar(&dryRun, "dry-run", false, "Only count the mentions that would be removed")
+	addRetentionFlag(pruneCmd)
+	addDatabaseFlags(pruneCmd)
+	return newBaseCommand(pruneCmd)
+}
+
+// addRetentionFlag adds the --retention flag shared by serve and db
+// prune.
+func addRetentionFlag(cmd *cobra.Command) {
+	cmd.Flags().StringToString("retention", map[string]string{}, "How long mentions are kept per status, e.g. invalid=30d,rejected=90d")
+	bindFlagsOnRun(cmd, map[string]string{"retention": "retention.periods"})
+}
+
+// retentionPeriods returns the configured retention periods per
+// mention status.
+func retentionPeriods() (map[string]time.Duration, error) {
+	periods := make(map[string]time.Duration)
+	for status, raw := range cfg.GetStringMapString("retention.periods") {
+		period, err := parseRetentionPeriod(raw)
+		if err != nil {
+			return nil, fmt.Errorf("invalid retention period for %s mentions: %w", status, err)
+		}
+		periods[status] = period
+	}
+	if err := server.ValidateRetention(periods); err != nil {
+		return nil, err
+	}
+	return periods, nil
+}
+
+// parseRetentionPeriod parses a duration that may also be given in
+// days (e.g. 30d) as time.ParseDuration doesn't support these.
+func parseRetentionPeriod(raw string) (time.Duration, error) {
+	if days, ok := strings.CutSuffix(raw, "d"); ok {
+		num, err := strconv.Atoi(days)
+		if err != nil {
+			return 0, fmt.Errorf("invalid number of days: %s", raw)
+		}
+		return time.Duration(num) * 24 * time.Hour, nil
+	}
+	return time.ParseDuration(raw)
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/zerok/webmentiond/pkg/server"
+)
+
+func TestParseRetentionPeriod(t *testing.T) {
+	for raw, expected := range map[string]time.Duration{
+		"30d": 30 * 24 * time.Hour,
+		"12h": 12 * time.Hour,
+	} {
+		period, err := parseRetentionPeriod(raw)
+		require.NoError(t, err)
+		require.Equal(t, expected, period)
+	}
+	for _, raw := range []string{"", "d", "xd", "30"} {
+		_, err := parseRetentionPeriod(raw)
+		require.Error(t, err, raw)
+	}
+}
+
+func TestDBPrune(t *testing.T) {
+	dir := t.TempDir()
+	database := filepath.Join(dir, "webmentiond.sqlite")
+	migrations := filepath.Join("..", "..", "pkg", "server", "migrations")
+	input := filepath.Join(dir, "input.json")
+	require.NoError(t, os.WriteFile(input, []byte(`{
+		"type": "feed",
+		"wmd-version": 1,
+		"children": [
+			{"type": "entry", "wm-source": "https://a.com/", "wm-target": "https://target.com/", "wm-received": "2024-01-01T00:00:00Z", "wmd-status": "invalid"},
+			{"type": "entry", "wm-source": "https://b.com/", "wm-target": "https://target.com/", "wm-received": "2024-01-01T00:00:00Z", "wmd-status": "approved"}
+		]
+	}`), 0600))
+	run := func(cmd Command, args ...string) error {
+		t.Helper()
+		c := cmd.Cmd()
+		c.SetArgs(append(args, "--database", database, "--database-migrations", migrations))
+		return c.Execute()
+	}
+	countMentions := func() int {
+		t.Helper()
+		output := filepath.Join(dir, "output.json")
+		require.NoError(t, run(newExportCmd(), "--output", output))
+		data, err := os.ReadFile(output)
+		require.NoError(t, err)
+		doc := server.ExportDocument{}
+		require.NoError(t, json.Unmarshal(data, &doc))
+		return len(doc.Children)
+	}
+	require.NoError(t, run(newImportCmd(), input))
+
+	require.NoError(t, run(newDBPruneCmd(), "--dry-run", "--retention", "invalid=30d"))
+	require.Equal(t, 2, countMentions())
+	require.NoError(t, run(newDBPruneCmd(), "--retention", "invalid=30d"))
+	require.Equal(t, 1, countMentions())
+
+	require.Error(t, run(newDBPruneCmd(), "--retention", "unknown=30d"))
+	require.Error(t, run(newDBPruneCmd(), "--retention", "invalid=soon"))
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/spf13/cobra"
+	"github.com/zerok/webmentiond/pkg/server"
+)
+
+func newExportCmd() Command {
+	var output string
+	var exportCmd = &cobra.Command{
+		Use:   "export",
+		Short: "Export all mentions and policies as JSON",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := logger.WithContext(context.Background())
+			store, closeStore, err := openStore(ctx)
+			if err != nil {
+				return err
+			}
+			defer closeStore()
+			doc, err := server.Export(ctx, store, store)
+			if err != nil {
+				return err
+			}
+			out, err := openReport(output)
+			if err != nil {
+				return err
+			}
+			enc := json.NewEncoder(out)
+			enc.SetIndent("", "  ")
+			if err := enc.Encode(doc); err != nil {
+				out.Close()
+				return err
+			}
+			if err := out.Close(); err != nil {
+				return err
+			}
+			logger.Info().Msgf("Exported %d mentions and %d policies.", len(doc.Children), len(doc.Policies))
+			return nil
+		},
+	}
+	exportCmd.Flags().StringVarP(&output, "output", "o", "-", "File the export is written to (- for stdout)")
+	addDatabaseFlags(exportCmd)
+	return newBaseCommand(exportCmd)
+}
+
+// Formats supported by the import command.
+const (
+	importFormatWebmentiond  = "webmentiond"
+	importFormatWebmentionIO = "webmention.io"
+)
+
+func newImportCmd() Command {
+	var dryRun bool
+	var from string
+	var initialStatus string
+	var reportPath string
+	var importCmd = &cobra.Command{
+		Use:   "import FILE",
+		Short: "Import mentions and policies from a JSON export",
+		Long: `Import mentions and policies from a file created by the export command (- for stdin).
+Mentions with the same source and target as an existing one replace it.
+
+With --from webmention.io, a jf2 export of webmention.io is imported instead.
+Mentions that exist already are left untouched in that case so that the import
+can be repeated safely.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := logger.WithContext(context.Background())
+			var doc *server.ExportDocument
+			opts := server.ImportOptions{DryRun: dryRun}
+			switch from {
+			case importFormatWebmentiond:
+				doc = &server.ExportDocument{}
+				if err := readJSONFile(args[0], doc); err != nil {
+					return err
+				}
+			case importFormatWebmentionIO:
+				var err error
+				doc, err = readWebmentionIOFile(args[0], initialStatus)
+				if err != nil {
+					return err
+				}
+				opts.KeepExisting = true
+			default:
+				return fmt.Errorf("unsupported import format: %s", from)
+			}
+			store, closeStore, err := openStore(ctx)
+			if err != nil {
+				return err
+			}
+			defer closeStore()
+			summary, err := server.Import(ctx, store, store, doc, opts)
+			if err != nil {
+				return err
+			}
+			logImportSummary(summary)
+			if reportPath != "" {
+				return writeImportReport(reportPath, summary)
+			}
+			return nil
+		},
+	}
+	importCmd.Flags().BoolVar(&dryRun, "dry-run", false, "Only show what would be imported")
+	importCmd.Flags().StringVar(&from, "from", importFormatWebmentiond, "Format of the file: webmentiond or webmention.io")
+	importCmd.Flags().StringVar(&initialStatus, "initial-status", server.MentionStatusNew, "Status of mentions imported from webmention.io: approved or new (verify again)")
+	importCmd.Flags().StringVar(&reportPath, "report", "", "Write a summary of the import as JSON to this file (- for stdout)")
+	addDatabaseFlags(importCmd)
+	return newBaseCommand(importCmd)
+}
+
+func readWebmentionIOFile(path string, status string) (*server.ExportDocument, error) {
+	var in io.Reader = os.Stdin
+	if path != "-" {
+		fp, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer fp.Close()
+		in = fp
+	}
+	doc, err := server.ParseWebmentionIOExport(in, status)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	return doc, nil
+}
+
+func writeImportReport(path string, summary *server.ImportSummary) error {
+	out, err := openReport(path)
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(out)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(summary); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// readJSONFile decodes the JSON file at path into v. - stands for
+// stdin.
+func readJSONFile(path string, v any) error {
+	var in io.Reader = os.Stdin
+	if path != "-" {
+		fp, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer fp.Close()
+		in = fp
+	}
+	if err := json.NewDecoder(in).Decode(v); err != nil {
+		return fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	return nil
+}
+
+func logImportSummary(summary *server.ImportSummary) {
+	prefix := "Imported"
+	if summary.DryRun {
+		prefix = "Dry run: Would import"
+	}
+	logger.Info().Msgf("%s mentions: %d created, %d updated, %d unchanged.", prefix, summary.Created, summary.Updated, summary.Unchanged)
+	logger.Info().Msgf("%s policies: %d created, %d unchanged.", prefix, summary.PoliciesCreated, summary.PoliciesUnchanged)
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/zerok/webmentiond/pkg/server"
+)
+
+func TestExportImport(t *testing.T) {
+	dir := t.TempDir()
+	input := filepath.Join(dir, "input.json")
+	require.NoError(t, os.WriteFile(input, []byte(`{
+		"type": "feed",
+		"wmd-version": 1,
+		"children": [
+			{"type": "entry", "wm-source": "https://a.com/post", "wm-target": "https://target.com/", "wm-property": "like-of", "wm-received": "2024-01-01T00:00:00Z", "wmd-status": "approved", "author": {"type": "card", "name": "Author"}}
+		],
+		"wmd-policies": [
+			{"url_pattern": "^https://a.com", "policy": "approve", "weight": 1}
+		]
+	}`), 0600))
+	database := filepath.Join(dir, "webmentiond.sqlite")
+	migrations := filepath.Join("..", "..", "pkg", "server", "migrations")
+
+	run := func(cmd Command, args ...string) {
+		t.Helper()
+		c := cmd.Cmd()
+		c.SetArgs(append(args, "--database", database, "--database-migrations", migrations))
+		require.NoError(t, c.Execute())
+	}
+
+	run(newImportCmd(), "--dry-run", input)
+	output := filepath.Join(dir, "output.json")
+	run(newExportCmd(), "--output", output)
+	doc := server.ExportDocument{}
+	data, err := os.ReadFile(output)
+	require.NoError(t, err)
+	require.NoError(t, json.Unmarshal(data, &doc))
+	require.Len(t, doc.Children, 0)
+
+	run(newImportCmd(), input)
+	run(newImportCmd(), input)
+	run(newExportCmd(), "--output", output)
+	data, err = os.ReadFile(output)
+	require.NoError(t, err)
+	require.NoError(t, json.Unmarshal(data, &doc))
+	require.Len(t, doc.Children, 1)
+	require.Equal(t, "like-of", doc.Children[0].Property)
+	require.Equal(t, "Author", doc.Children[0].Author.Name)
+	require.Equal(t, server.MentionStatusApproved, doc.Children[0].Status)
+	require.Len(t, doc.Policies, 1)
+}
+
+func TestImportFromWebmentionIO(t *testing.T) {
+	dir := t.TempDir()
+	database := filepath.Join(dir, "webmentiond.sqlite")
+	report := filepath.Join(dir, "report.json")
+	input := filepath.Join("..", "..", "pkg", "server", "testdata", "webmentionio.jf2")
+	migrations := filepath.Join("..", "..", "pkg", "server", "migrations")
+	run := func() server.ImportSummary {
+		t.Helper()
+		c := newImportCmd().Cmd()
+		c.SetArgs([]string{"--from", "webmention.io", "--initial-status", "approved", "--report", report, "--database", database, "--database-migrations", migrations, input})
+		require.NoError(t, c.Execute())
+		summary := server.ImportSummary{}
+		data, err := os.ReadFile(report)
+		require.NoError(t, err)
+		require.NoError(t, json.Unmarshal(data, &summary))
+		return summary
+	}
+	require.Equal(t, server.ImportSummary{Created: 3}, run())
+	require.Equal(t, server.ImportSummary{Unchanged: 3}, run())
+
+	c := newImportCmd().Cmd()
+	c.SetArgs([]string{"--from", "webmention.io", "--initial-status", "rejected", "--database", database, input})
+	require.Error(t, c.Execute())
+}
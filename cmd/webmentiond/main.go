@@ -1,6 +1,7 @@
 package main
 
 import (
+	"errors"
 	"fmt"
 	"os"
 
@@ -55,8 +56,37 @@ func init() {
 	cfg = viper.New()
 }
 
+const (
+	// exitCodeSomeFailed is used if at least one operation of a bulk
+	// command failed.
+	exitCodeSomeFailed = 2
+	// exitCodeNothingFound is used if a bulk command didn't find
+	// anything to work on.
+	exitCodeNothingFound = 3
+)
+
+// exitError lets a command terminate the process with a specific exit
+// code.
+type exitError struct {
+	code int
+	err  error
+}
+
+func (e *exitError) Error() string {
+	return e.err.Error()
+}
+
+func (e *exitError) Unwrap() error {
+	return e.err
+}
+
 func main() {
 	if err := buildCmd().Execute(); err != nil {
+		var ee *exitError
+		if errors.As(err, &ee) {
+			logger.Error().Msg(err.Error())
+			os.Exit(ee.code)
+		}
 		logger.Fatal().Msg(err.Error())
 	}
 }
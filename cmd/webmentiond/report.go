@@ -0,0 +1,124 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+)
+
+const (
+	reportFormatJSON   = "json"
+	reportFormatNDJSON = "ndjson"
+)
+
+// resultReport collects the results of sending mentions and writes
+// them either as a single JSON array or as newline-delimited JSON
+// with one record per target.
+type resultReport struct {
+	lock    sync.Mutex
+	format  string
+	out     io.WriteCloser
+	enc     *json.Encoder
+	results []sendResult
+}
+
+func newResultReport(path string, format string) (*resultReport, error) {
+	if format != reportFormatJSON && format != reportFormatNDJSON {
+		return nil, fmt.Errorf("unsupported report format: %s", format)
+	}
+	r := &resultReport{
+		format:  format,
+		results: make([]sendResult, 0, 50),
+	}
+	if path == "" {
+		return r, nil
+	}
+	out, err := openReport(path)
+	if err != nil {
+		return nil, err
+	}
+	r.out = out
+	r.enc = json.NewEncoder(out)
+	return r, nil
+}
+
+// Add records a result. In NDJSON mode it is written right away.
+func (r *resultReport) Add(res sendResult) error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.results = append(r.results, res)
+	if r.enc != nil && r.format == reportFormatNDJSON {
+		return r.enc.Encode(res)
+	}
+	return nil
+}
+
+// Results returns all results recorded so far.
+func (r *resultReport) Results() []sendResult {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return append(make([]sendResult, 0, len(r.results)), r.results...)
+}
+
+func (r *resultReport) Close() error {
+	if r.out == nil {
+		return nil
+	}
+	if r.format == reportFormatJSON {
+		r.enc.SetIndent("", "  ")
+		if err := r.enc.Encode(r.results); err != nil {
+			r.out.Close()
+			return err
+		}
+	}
+	return r.out.Close()
+}
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error {
+	return nil
+}
+
+// openReport opens the given path for writing. - stands for stdout.
+func openReport(path string) (io.WriteCloser, error) {
+	if path == "-" {
+		return nopWriteCloser{os.Stdout}, nil
+	}
+	return os.Create(path)
+}
+
+// writeSiteReport writes the report of a --site-dir run. In NDJSON
+// mode only the per-target records are written.
+func writeSiteReport(path string, format string, report siteReport) error {
+	if format == reportFormatNDJSON {
+		r, err := newResultReport(path, format)
+		if err != nil {
+			return err
+		}
+		for _, page := range report.Pages {
+			for _, res := range page.Results {
+				if err := r.Add(res); err != nil {
+					r.Close()
+					return err
+				}
+			}
+		}
+		return r.Close()
+	}
+	out, err := openReport(path)
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(out)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(report); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
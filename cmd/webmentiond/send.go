@@ -2,56 +2,93 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
 
 	"github.com/spf13/cobra"
 	"github.com/zerok/webmentiond/pkg/webmention"
 )
 
+const (
+	sendStatusSent       = "sent"
+	sendStatusFailed     = "failed"
+	sendStatusNoEndpoint = "no-endpoint"
+	sendStatusSkipped    = "skipped"
+)
+
+// sendResult describes the outcome of sending a single mention.
+type sendResult struct {
+	Source   string `json:"source"`
+	Target   string `json:"target"`
+	Endpoint string `json:"endpoint,omitempty"`
+	Protocol string `json:"protocol,omitempty"`
+	Status   string `json:"status"`
+	Error    string `json:"error,omitempty"`
+}
+
 func newSendCmd() Command {
 	var sendCmd = &cobra.Command{
 		Use:   "send SOURCE [TARGET]",
 		Short: "Send a mention from source to target",
 		RunE: func(cmd *cobra.Command, args []string) error {
 			ctx := logger.WithContext(context.Background())
+			if siteDir, _ := cmd.Flags().GetString("site-dir"); siteDir != "" {
+				return sendForSiteDir(ctx, cmd, siteDir)
+			}
+			if sitemapURL, _ := cmd.Flags().GetString("sitemap"); sitemapURL != "" {
+				return sendForSitemap(ctx, cmd, sitemapURL)
+			}
 			failed := false
 			if len(args) < 1 {
 				return fmt.Errorf("source is required")
 			}
-			doc, err := webmention.DocumentFromURL(ctx, args[0])
+			deleted, _ := cmd.Flags().GetBool("deleted")
+			stateFile, _ := cmd.Flags().GetString("state-file")
+			var snapshots webmention.TargetSnapshotStore
+			if stateFile != "" {
+				snapshots = webmention.NewFileTargetSnapshotStore(stateFile)
+			}
+			current := []string{}
+			if !deleted {
+				doc, err := webmention.DocumentFromURL(ctx, args[0])
+				if err != nil && !errors.Is(err, webmention.ErrGone) {
+					return fmt.Errorf("failed to load document from URL: %w", err)
+				}
+				if doc != nil {
+					current = doc.Targets(targetSelectionFromFlags(cmd))
+				} else {
+					logger.Info().Msgf("%s is gone. Notifying all previous targets.", args[0])
+					deleted = true
+				}
+			}
+			// The targets of a deleted source are only known from the
+			// state file:
+			if deleted && snapshots == nil && len(args) < 2 {
+				return fmt.Errorf("%s has been deleted but without --state-file there are no previous targets to notify", args[0])
+			}
+			targets, err := webmention.ResolveTargets(ctx, snapshots, args[0], current)
 			if err != nil {
-				return fmt.Errorf("failed to load document from URL: %w", err)
+				return fmt.Errorf("failed to load previous targets: %w", err)
 			}
-			targets := doc.ExternalLinks()
 			if len(args) >= 2 {
 				targets = []string{args[1]}
 			}
+			retry := []string{}
 			for _, target := range targets {
-				mention := webmention.Mention{
-					Source: args[0],
-					Target: target,
-				}
-				ep, err := cmd.Flags().GetString("endpoint")
-				if err != nil {
-					return fmt.Errorf("failed to parse endpoint from flag: %w", err)
+				res := sendMention(ctx, cmd, args[0], target)
+				switch res.Status {
+				case sendStatusNoEndpoint:
+					failed = true
+				case sendStatusFailed:
+					retry = append(retry, target)
 				}
-				if ep == "" {
-					disc := webmention.NewEndpointDiscoverer()
-					ep, err = disc.DiscoverEndpoint(ctx, mention.Target)
-					if err != nil {
-						logger.Warn().Err(err).Msgf("error while looking up endpoint for %s", target)
-						continue
-					}
-					if ep == "" {
-						logger.Warn().Err(err).Msgf("%s doesn't expose webmention endpoint", target)
-						failed = true
-						continue
-					}
-				}
-				sender := webmention.NewSender()
-				logger.Info().Msgf("Endpoint: %s", ep)
-				if err := sender.Send(ctx, ep, mention); err != nil {
-					logger.Error().Err(err).Msgf("Failed to send webmention to %s", target)
+			}
+			// Only a run covering all targets of the source is allowed to
+			// update its snapshot. Removed targets that couldn't be
+			// notified are kept so that the next run tries again.
+			if snapshots != nil && len(args) < 2 {
+				if err := snapshots.SaveTargets(ctx, args[0], webmention.MergeTargets(current, retry)); err != nil {
+					return fmt.Errorf("failed to update state file: %w", err)
 				}
 			}
 
@@ -65,5 +102,72 @@ func newSendCmd() Command {
 
 	sendCmd.Flags().String("endpoint", "", "Endpoint to send the mention to")
 	sendCmd.Flags().Bool("fail", false, "Exit with error code if sending a webmention fails")
+	sendCmd.Flags().Bool("deleted", false, "Source has been deleted: notify all targets it linked to previously")
+	sendCmd.Flags().String("state-file", "", "Path to a file remembering the targets each source linked to")
+	sendCmd.Flags().Bool("entry-only", false, "Only send mentions for links inside the h-entry of the source")
+	sendCmd.Flags().StringSlice("exclude-host", []string{}, "Never send mentions to this host (or its subdomains)")
+	sendCmd.Flags().String("site-dir", "", "Send mentions for all new or changed pages inside this locally built site")
+	sendCmd.Flags().String("base-url", "", "URL under which the site passed with --site-dir is published")
+	sendCmd.Flags().Bool("dry-run", false, "Only report which mentions would be sent")
+	sendCmd.Flags().String("report", "", "Write a JSON report to this file (- for stdout)")
+	sendCmd.Flags().String("report-format", reportFormatJSON, "Format of the report: json or ndjson (one line per target)")
+	sendCmd.Flags().String("sitemap", "", "Send mentions for all pages listed in this sitemap")
+	sendCmd.Flags().String("since", "", "Only process sitemap pages modified since this date (RFC3339, YYYY-MM-DD or a duration like 72h)")
+	sendCmd.Flags().Int("concurrency", 4, "Maximum number of requests running in parallel")
+	sendCmd.Flags().Int("per-host-concurrency", 1, "Maximum number of requests running in parallel against a single host")
 	return newBaseCommand(sendCmd)
 }
+
+func targetSelectionFromFlags(cmd *cobra.Command) webmention.TargetSelectionConfigurator {
+	entryOnly, _ := cmd.Flags().GetBool("entry-only")
+	excludeHosts, _ := cmd.Flags().GetStringSlice("exclude-host")
+	return func(o *webmention.TargetSelectionOptions) {
+		o.EntryOnly = entryOnly
+		o.ExcludeHosts = excludeHosts
+	}
+}
+
+// sendMention discovers the endpoints of the given target (unless one
+// was passed with --endpoint) and sends the mention to it. If the target
+// only supports Pingback, a pingback is sent instead.
+func sendMention(ctx context.Context, cmd *cobra.Command, source string, target string) sendResult {
+	res := sendResult{
+		Source: source,
+		Target: target,
+	}
+	mention := webmention.Mention{
+		Source: source,
+		Target: target,
+	}
+	endpoints := webmention.Endpoints{}
+	endpoints.Webmention, _ = cmd.Flags().GetString("endpoint")
+	if endpoints.Webmention == "" {
+		var err error
+		disc := webmention.NewEndpointDiscoverer()
+		endpoints, err = disc.DiscoverEndpoints(ctx, mention.Target)
+		if err != nil {
+			logger.Warn().Err(err).Msgf("error while looking up endpoint for %s", target)
+			res.Status = sendStatusFailed
+			res.Error = err.Error()
+			return res
+		}
+		if endpoints.Empty() {
+			logger.Warn().Msgf("%s doesn't expose webmention endpoint", target)
+			res.Status = sendStatusNoEndpoint
+			return res
+		}
+	}
+	sender := webmention.NewSender()
+	protocol, ep, err := webmention.SendWithFallback(ctx, sender, endpoints, mention)
+	res.Endpoint = ep
+	res.Protocol = protocol
+	logger.Info().Msgf("Endpoint: %s (%s)", ep, protocol)
+	if err != nil {
+		logger.Error().Err(err).Msgf("Failed to send %s to %s", protocol, target)
+		res.Status = sendStatusFailed
+		res.Error = err.Error()
+		return res
+	}
+	res.Status = sendStatusSent
+	return res
+}
@@ -0,0 +1,245 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/zerok/webmentiond/pkg/webmention"
+)
+
+const defaultSiteStateFile = ".webmentiond-state.json"
+
+// pageHashPrefix marks hashes that only cover the h-entry of a page.
+// Older state files contain hashes of the whole file which are replaced
+// without marking the page as changed.
+const pageHashPrefix = "entry-sha256:"
+
+const (
+	pageStatusNew       = "new"
+	pageStatusChanged   = "changed"
+	pageStatusUnchanged = "unchanged"
+	pageStatusDeleted   = "deleted"
+)
+
+type siteReport struct {
+	DryRun bool             `json:"dry_run"`
+	Pages  []siteReportPage `json:"pages"`
+}
+
+type siteReportPage struct {
+	File    string       `json:"file"`
+	Source  string       `json:"source"`
+	Status  string       `json:"status"`
+	Results []sendResult `json:"results"`
+}
+
+// sendForSiteDir parses every HTML file inside siteDir and sends
+// mentions for all pages that are new, changed or have been deleted
+// since the last run.
+func sendForSiteDir(ctx context.Context, cmd *cobra.Command, siteDir string) error {
+	baseURL, _ := cmd.Flags().GetString("base-url")
+	if baseURL == "" {
+		return fmt.Errorf("--base-url is required when using --site-dir")
+	}
+	base, err := url.Parse(baseURL)
+	if err != nil {
+		return fmt.Errorf("invalid base URL: %w", err)
+	}
+	dryRun, _ := cmd.Flags().GetBool("dry-run")
+	reportPath, _ := cmd.Flags().GetString("report")
+	reportFormat, _ := cmd.Flags().GetString("report-format")
+	stateFile, _ := cmd.Flags().GetString("state-file")
+	if stateFile == "" {
+		stateFile = defaultSiteStateFile
+	}
+	state, err := loadSiteState(stateFile)
+	if err != nil {
+		return fmt.Errorf("failed to load state: %w", err)
+	}
+	selection := targetSelectionFromFlags(cmd)
+
+	files, err := findHTMLFiles(siteDir)
+	if err != nil {
+		return err
+	}
+	report := siteReport{
+		DryRun: dryRun,
+		Pages:  make([]siteReportPage, 0, 10),
+	}
+	failed := false
+	// process sends mentions for a single page and updates its state.
+	process := func(file string, source string, previous sitePage, current sitePage) error {
+		status := pageStatus(previous, current)
+		if status == pageStatusUnchanged {
+			logger.Debug().Msgf("%s unchanged", source)
+			// Pages recorded before hashes of their h-entry were stored
+			// only get their hash updated:
+			if !dryRun && previous.Hash != current.Hash {
+				return state.Save(source, current)
+			}
+			return nil
+		}
+		page := siteReportPage{
+			File:    file,
+			Source:  source,
+			Status:  status,
+			Results: make([]sendResult, 0, len(current.Targets)),
+		}
+		retry := []string{}
+		for _, target := range webmention.MergeTargets(previous.Targets, current.Targets) {
+			if dryRun {
+				logger.Info().Msgf("Would send %s -> %s", source, target)
+				page.Results = append(page.Results, sendResult{Source: source, Target: target, Status: sendStatusSkipped})
+				continue
+			}
+			res := sendMention(ctx, cmd, source, target)
+			if res.Status == sendStatusFailed {
+				failed = true
+				retry = append(retry, target)
+			}
+			page.Results = append(page.Results, res)
+		}
+		report.Pages = append(report.Pages, page)
+		if dryRun {
+			return nil
+		}
+		// Removed targets that couldn't be notified are kept and the
+		// page is sent again with the next run:
+		if len(retry) > 0 {
+			current.Targets = webmention.MergeTargets(current.Targets, retry)
+			current.Retry = true
+		}
+		return state.Save(source, current)
+	}
+
+	seen := make(map[string]struct{})
+	for _, file := range files {
+		source := pageURL(base, file)
+		seen[source] = struct{}{}
+		content, err := os.ReadFile(filepath.Join(siteDir, file))
+		if err != nil {
+			return err
+		}
+		doc, err := webmention.DocumentFromReader(ctx, bytes.NewReader(content), source)
+		if err != nil {
+			return fmt.Errorf("failed to parse %s: %w", file, err)
+		}
+		hash, err := pageHash(doc)
+		if err != nil {
+			return fmt.Errorf("failed to hash %s: %w", file, err)
+		}
+		current := sitePage{
+			Targets: doc.Targets(selection),
+			Hash:    hash,
+		}
+		if err := process(file, source, state.Page(source), current); err != nil {
+			return fmt.Errorf("failed to update state file: %w", err)
+		}
+	}
+	// Pages of this site that are still in the state file but no longer
+	// inside siteDir have been deleted. All of their targets have to be
+	// notified:
+	prefix := pageURL(base, "")
+	for _, source := range state.Sources() {
+		if _, ok := seen[source]; ok || !strings.HasPrefix(source, prefix) {
+			continue
+		}
+		if err := process("", source, state.Page(source), sitePage{}); err != nil {
+			return fmt.Errorf("failed to update state file: %w", err)
+		}
+	}
+	logger.Info().Msgf("%d of %d pages new, changed or deleted", len(report.Pages), len(files))
+	if reportPath != "" {
+		if err := writeSiteReport(reportPath, reportFormat, report); err != nil {
+			return fmt.Errorf("failed to write report: %w", err)
+		}
+	}
+	if exitOnFailure, _ := cmd.Flags().GetBool("fail"); failed && exitOnFailure {
+		return fmt.Errorf("sending webmentions failed")
+	}
+	return nil
+}
+
+// pageStatus compares the state of a page from the last run with the
+// current one.
+func pageStatus(previous, current sitePage) string {
+	if len(previous.Targets) == 0 {
+		if len(current.Targets) == 0 {
+			return pageStatusUnchanged
+		}
+		return pageStatusNew
+	}
+	if len(current.Targets) == 0 && current.Hash == "" {
+		return pageStatusDeleted
+	}
+	if previous.Retry {
+		return pageStatusChanged
+	}
+	a := append(make([]string, 0, len(previous.Targets)), previous.Targets...)
+	b := append(make([]string, 0, len(current.Targets)), current.Targets...)
+	sort.Strings(a)
+	sort.Strings(b)
+	if strings.Join(a, "\n") != strings.Join(b, "\n") {
+		return pageStatusChanged
+	}
+	// Updating the content of a page without changing its links still
+	// requires sending mentions again:
+	if strings.HasPrefix(previous.Hash, pageHashPrefix) && previous.Hash != current.Hash {
+		return pageStatusChanged
+	}
+	return pageStatusUnchanged
+}
+
+// pageHash returns a checksum of the h-entry of a page. Changes to the
+// layout of a site, like a new footer or fingerprinted assets, therefore
+// don't mark every page as changed. Pages without an h-entry are only
+// compared by their targets.
+func pageHash(doc *webmention.Document) (string, error) {
+	data, err := json.Marshal(doc.HEntry())
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s%x", pageHashPrefix, sha256.Sum256(data)), nil
+}
+
+func findHTMLFiles(dir string) ([]string, error) {
+	files := make([]string, 0, 50)
+	err := filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || !strings.HasSuffix(d.Name(), ".html") {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		files = append(files, filepath.ToSlash(rel))
+		return nil
+	})
+	return files, err
+}
+
+// pageURL maps the path of a generated file to the URL it is published
+// under. index.html files are served as their parent folder.
+func pageURL(base *url.URL, file string) string {
+	p := "/" + file
+	if path.Base(p) == "index.html" {
+		p = strings.TrimSuffix(p, "index.html")
+	}
+	u := *base
+	u.Path = strings.TrimSuffix(base.Path, "/") + p
+	return u.String()
+}
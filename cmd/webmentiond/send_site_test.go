@@ -0,0 +1,142 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPageURL(t *testing.T) {
+	base, _ := url.Parse("https://example.com/blog/")
+	require.Equal(t, "https://example.com/blog/", pageURL(base, "index.html"))
+	require.Equal(t, "https://example.com/blog/posts/1/", pageURL(base, "posts/1/index.html"))
+	require.Equal(t, "https://example.com/blog/about.html", pageURL(base, "about.html"))
+}
+
+func TestPageStatus(t *testing.T) {
+	page := func(hash string, targets ...string) sitePage {
+		if hash != "" {
+			hash = pageHashPrefix + hash
+		}
+		return sitePage{Targets: targets, Hash: hash}
+	}
+	require.Equal(t, pageStatusUnchanged, pageStatus(page(""), page("1")))
+	require.Equal(t, pageStatusNew, pageStatus(page(""), page("1", "a")))
+	require.Equal(t, pageStatusUnchanged, pageStatus(page("1", "b", "a"), page("1", "a", "b")))
+	require.Equal(t, pageStatusChanged, pageStatus(page("1", "a"), page("1", "a", "b")))
+	require.Equal(t, pageStatusChanged, pageStatus(page("1", "a"), page("1")))
+	require.Equal(t, pageStatusChanged, pageStatus(page("1", "a"), page("2", "a")))
+	require.Equal(t, pageStatusChanged, pageStatus(sitePage{Targets: []string{"a"}, Hash: pageHashPrefix + "1", Retry: true}, page("1", "a")))
+	require.Equal(t, pageStatusDeleted, pageStatus(page("1", "a"), sitePage{}))
+	// State files without hashes only compare the targets:
+	require.Equal(t, pageStatusUnchanged, pageStatus(page("", "a"), page("1", "a")))
+	// ... and so do state files with hashes of the whole file:
+	require.Equal(t, pageStatusUnchanged, pageStatus(sitePage{Targets: []string{"a"}, Hash: "sha256:1"}, page("1", "a")))
+}
+
+func TestSendForSiteDir(t *testing.T) {
+	received := 0
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost {
+			received++
+			w.WriteHeader(http.StatusAccepted)
+			return
+		}
+		w.Header().Set("Link", `</endpoint>; rel="webmention"`)
+	}))
+	defer target.Close()
+
+	dir := t.TempDir()
+	siteDir := filepath.Join(dir, "public")
+	require.NoError(t, os.MkdirAll(filepath.Join(siteDir, "posts", "1"), 0700))
+	require.NoError(t, os.WriteFile(filepath.Join(siteDir, "index.html"), []byte(`<a href="/posts/1/">Post</a>`), 0600))
+	writePost := func(layout string, content string) {
+		t.Helper()
+		post := fmt.Sprintf(`<article class="h-entry"><div class="e-content">%s<a href="%s/page">Target</a></div></article>%s`, content, target.URL, layout)
+		require.NoError(t, os.WriteFile(filepath.Join(siteDir, "posts", "1", "index.html"), []byte(post), 0600))
+	}
+	writePost("", "")
+	stateFile := filepath.Join(dir, "state.json")
+	reportFile := filepath.Join(dir, "report.json")
+
+	run := func(extraArgs ...string) siteReport {
+		t.Helper()
+		cmd := newSendCmd().Cmd()
+		cmd.SetArgs(append([]string{"--site-dir", siteDir, "--base-url", "https://example.com", "--state-file", stateFile, "--report", reportFile}, extraArgs...))
+		require.NoError(t, cmd.Execute())
+		report := siteReport{}
+		data, err := os.ReadFile(reportFile)
+		require.NoError(t, err)
+		require.NoError(t, json.Unmarshal(data, &report))
+		return report
+	}
+
+	// A dry-run must neither send anything nor update the state:
+	report := run("--dry-run")
+	require.True(t, report.DryRun)
+	require.Len(t, report.Pages, 1)
+	require.Equal(t, "https://example.com/posts/1/", report.Pages[0].Source)
+	require.Equal(t, pageStatusNew, report.Pages[0].Status)
+	require.Equal(t, sendStatusSkipped, report.Pages[0].Results[0].Status)
+	require.Equal(t, 0, received)
+
+	report = run()
+	require.Len(t, report.Pages, 1)
+	require.Equal(t, sendStatusSent, report.Pages[0].Results[0].Status)
+	require.Equal(t, target.URL+"/endpoint", report.Pages[0].Results[0].Endpoint)
+	require.Equal(t, 1, received)
+
+	// Nothing changed, so nothing should be sent:
+	report = run()
+	require.Len(t, report.Pages, 0)
+	require.Equal(t, 1, received)
+
+	// Changing only the layout of the site doesn't change the page:
+	writePost(`<footer>New footer</footer><script src="/app.123.js"></script>`, "")
+	report = run()
+	require.Len(t, report.Pages, 0)
+	require.Equal(t, 1, received)
+
+	// Updating the content without changing the links sends mentions as
+	// well:
+	writePost(`<footer>New footer</footer>`, "<p>Updated</p>")
+	report = run()
+	require.Len(t, report.Pages, 1)
+	require.Equal(t, pageStatusChanged, report.Pages[0].Status)
+	require.Equal(t, 2, received)
+
+	// Deleted pages notify all of their previous targets once:
+	require.NoError(t, os.RemoveAll(filepath.Join(siteDir, "posts")))
+	report = run()
+	require.Len(t, report.Pages, 1)
+	require.Equal(t, pageStatusDeleted, report.Pages[0].Status)
+	require.Equal(t, "https://example.com/posts/1/", report.Pages[0].Source)
+	require.Equal(t, sendStatusSent, report.Pages[0].Results[0].Status)
+	require.Equal(t, 3, received)
+	report = run()
+	require.Len(t, report.Pages, 0)
+	require.Equal(t, 3, received)
+}
+
+func TestSiteState(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	// State files written by send --state-file only contain targets:
+	require.NoError(t, os.WriteFile(path, []byte(`{"https://example.com/": ["https://b.com", "https://a.com"]}`), 0600))
+	state, err := loadSiteState(path)
+	require.NoError(t, err)
+	require.Equal(t, sitePage{Targets: []string{"https://b.com", "https://a.com"}}, state.Page("https://example.com/"))
+
+	require.NoError(t, state.Save("https://example.com/other", sitePage{Targets: []string{"https://c.com"}, Hash: "sha256:1"}))
+	require.NoError(t, state.Save("https://example.com/", sitePage{}))
+	state, err = loadSiteState(path)
+	require.NoError(t, err)
+	require.Equal(t, []string{"https://example.com/other"}, state.Sources())
+	require.Equal(t, sitePage{Targets: []string{"https://c.com"}, Hash: "sha256:1"}, state.Page("https://example.com/other"))
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/zerok/webmentiond/pkg/sitemap"
+	"github.com/zerok/webmentiond/pkg/webmention"
+)
+
+// sendForSitemap sends mentions for all pages listed in the given
+// sitemap. Pages are fetched and mentions are sent concurrently.
+func sendForSitemap(ctx context.Context, cmd *cobra.Command, sitemapURL string) error {
+	sinceValue, _ := cmd.Flags().GetString("since")
+	since, err := parseSince(sinceValue, time.Now())
+	if err != nil {
+		return err
+	}
+	concurrency, _ := cmd.Flags().GetInt("concurrency")
+	perHostConcurrency, _ := cmd.Flags().GetInt("per-host-concurrency")
+	dryRun, _ := cmd.Flags().GetBool("dry-run")
+	reportPath, _ := cmd.Flags().GetString("report")
+	reportFormat, _ := cmd.Flags().GetString("report-format")
+	stateFile, _ := cmd.Flags().GetString("state-file")
+	var snapshots webmention.TargetSnapshotStore
+	if stateFile != "" {
+		snapshots = webmention.NewFileTargetSnapshotStore(stateFile)
+	}
+	selection := targetSelectionFromFlags(cmd)
+
+	pages, err := sitemap.Fetch(ctx, sitemapURL, func(o *sitemap.Options) {
+		o.Since = since
+	})
+	if err != nil {
+		return fmt.Errorf("failed to fetch sitemap: %w", err)
+	}
+	logger.Info().Msgf("Processing %d pages from %s", len(pages), sitemapURL)
+
+	report, err := newResultReport(reportPath, reportFormat)
+	if err != nil {
+		return err
+	}
+	dispatcher := webmention.NewDispatcher(func(c *webmention.DispatcherConfiguration) {
+		c.Concurrency = concurrency
+		c.PerHostConcurrency = perHostConcurrency
+	})
+	process := func(page string) error {
+		current := []string{}
+		doc, err := webmention.DocumentFromURL(ctx, page)
+		if err != nil && !errors.Is(err, webmention.ErrGone) {
+			logger.Warn().Err(err).Msgf("Failed to load %s", page)
+			return report.Add(sendResult{Source: page, Status: sendStatusFailed, Error: err.Error()})
+		}
+		if doc != nil {
+			current = doc.Targets(selection)
+		}
+		targets, err := webmention.ResolveTargets(ctx, snapshots, page, current)
+		if err != nil {
+			return fmt.Errorf("failed to load previous targets: %w", err)
+		}
+		mentions := make([]webmention.Mention, 0, len(targets))
+		for _, target := range targets {
+			if dryRun {
+				logger.Info().Msgf("Would send %s -> %s", page, target)
+				if err := report.Add(sendResult{Source: page, Target: target, Status: sendStatusSkipped}); err != nil {
+					return err
+				}
+				continue
+			}
+			mentions = append(mentions, webmention.Mention{Source: page, Target: target})
+		}
+		retry := []string{}
+		for _, res := range dispatcher.Dispatch(ctx, mentions) {
+			result := dispatchResultToSendResult(res)
+			if result.Status == sendStatusFailed {
+				retry = append(retry, result.Target)
+			}
+			if err := report.Add(result); err != nil {
+				return err
+			}
+		}
+		if snapshots != nil && !dryRun {
+			if err := snapshots.SaveTargets(ctx, page, webmention.MergeTargets(current, retry)); err != nil {
+				return fmt.Errorf("failed to update state file: %w", err)
+			}
+		}
+		return nil
+	}
+
+	queue := make(chan string)
+	errs := make(chan error, 1)
+	var wg sync.WaitGroup
+	for i := 0; i < max(concurrency, 1); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for page := range queue {
+				if err := process(page); err != nil {
+					select {
+					case errs <- err:
+					default:
+					}
+				}
+			}
+		}()
+	}
+	for _, page := range pages {
+		queue <- page.Loc
+	}
+	close(queue)
+	wg.Wait()
+	if err := report.Close(); err != nil {
+		return fmt.Errorf("failed to write report: %w", err)
+	}
+	select {
+	case err := <-errs:
+		return err
+	default:
+	}
+	return sitemapOutcome(report.Results(), dryRun)
+}
+
+// sitemapOutcome summarizes the results of a sitemap run and turns
+// them into an exitError if something failed or nothing was sent.
+func sitemapOutcome(results []sendResult, dryRun bool) error {
+	counts := make(map[string]int)
+	for _, res := range results {
+		counts[res.Status]++
+	}
+	logger.Info().Msgf("%d sent, %d failed, %d without endpoint, %d skipped", counts[sendStatusSent], counts[sendStatusFailed], counts[sendStatusNoEndpoint], counts[sendStatusSkipped])
+	if counts[sendStatusFailed] > 0 {
+		return &exitError{code: exitCodeSomeFailed, err: fmt.Errorf("sending %d webmentions failed", counts[sendStatusFailed])}
+	}
+	if counts[sendStatusSent] == 0 && (!dryRun || counts[sendStatusSkipped] == 0) {
+		return &exitError{code: exitCodeNothingFound, err: fmt.Errorf("no targets with webmention endpoints found")}
+	}
+	return nil
+}
+
+func dispatchResultToSendResult(res webmention.DispatchResult) sendResult {
+	out := sendResult{
+		Source:   res.Mention.Source,
+		Target:   res.Mention.Target,
+		Endpoint: res.Endpoint,
+		Protocol: res.Protocol,
+		Status:   sendStatusSent,
+	}
+	switch {
+	case errors.Is(res.Err, webmention.ErrNoEndpoint):
+		logger.Warn().Msgf("%s doesn't expose webmention endpoint", out.Target)
+		out.Status = sendStatusNoEndpoint
+	case res.Err != nil:
+		logger.Error().Err(res.Err).Msgf("Failed to send webmention to %s", out.Target)
+		out.Status = sendStatusFailed
+		out.Error = res.Err.Error()
+	default:
+		logger.Info().Msgf("Sent %s -> %s (%s)", out.Source, out.Target, out.Protocol)
+	}
+	return out
+}
+
+// parseSince accepts either a timestamp (RFC3339 or YYYY-MM-DD) or a
+// duration relative to now.
+func parseSince(value string, now time.Time) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if d, err := time.ParseDuration(value); err == nil {
+		return now.Add(-d), nil
+	}
+	for _, layout := range []string{time.RFC3339, "2006-01-02"} {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid value for --since: %s", value)
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseSince(t *testing.T) {
+	now := time.Date(2024, 5, 10, 12, 0, 0, 0, time.UTC)
+	since, err := parseSince("", now)
+	require.NoError(t, err)
+	require.True(t, since.IsZero())
+	since, err = parseSince("48h", now)
+	require.NoError(t, err)
+	require.Equal(t, time.Date(2024, 5, 8, 12, 0, 0, 0, time.UTC), since)
+	since, err = parseSince("2024-01-02", now)
+	require.NoError(t, err)
+	require.Equal(t, time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC), since)
+	_, err = parseSince("yesterday", now)
+	require.Error(t, err)
+}
+
+func TestSendForSitemap(t *testing.T) {
+	var received int32
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost {
+			atomic.AddInt32(&received, 1)
+			w.WriteHeader(http.StatusAccepted)
+			return
+		}
+		if r.URL.Path != "/no-endpoint" {
+			w.Header().Set("Link", `</endpoint>; rel="webmention"`)
+		}
+	}))
+	defer target.Close()
+
+	var site *httptest.Server
+	site = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/sitemap.xml":
+			fmt.Fprintf(w, `<urlset xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">
+<url><loc>%[1]s/new</loc><lastmod>2024-05-01</lastmod></url>
+<url><loc>%[1]s/old</loc><lastmod>2020-01-01</lastmod></url>
+</urlset>`, site.URL)
+		case "/new":
+			fmt.Fprintf(w, `<a href="%[1]s/a">A</a><a href="%[1]s/b">B</a><a href="%[1]s/no-endpoint">C</a>`, target.URL)
+		case "/old":
+			fmt.Fprintf(w, `<a href="%s/old">A</a>`, target.URL)
+		}
+	}))
+	defer site.Close()
+
+	reportFile := filepath.Join(t.TempDir(), "report.ndjson")
+	cmd := newSendCmd().Cmd()
+	cmd.SetArgs([]string{"--sitemap", site.URL + "/sitemap.xml", "--since", "2024-01-01", "--report", reportFile, "--report-format", "ndjson"})
+	require.NoError(t, cmd.Execute())
+	require.Equal(t, int32(2), atomic.LoadInt32(&received))
+
+	fp, err := os.Open(reportFile)
+	require.NoError(t, err)
+	defer fp.Close()
+	statuses := make(map[string]string)
+	scanner := bufio.NewScanner(fp)
+	for scanner.Scan() {
+		res := sendResult{}
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &res))
+		require.Equal(t, site.URL+"/new", res.Source)
+		statuses[res.Target] = res.Status
+	}
+	require.Equal(t, map[string]string{
+		target.URL + "/a":           sendStatusSent,
+		target.URL + "/b":           sendStatusSent,
+		target.URL + "/no-endpoint": sendStatusNoEndpoint,
+	}, statuses)
+
+	// No page modified after the given date results in a dedicated exit
+	// code:
+	cmd = newSendCmd().Cmd()
+	cmd.SetArgs([]string{"--sitemap", site.URL + "/sitemap.xml", "--since", "2025-01-01"})
+	err = cmd.Execute()
+	var ee *exitError
+	require.ErrorAs(t, err, &ee)
+	require.Equal(t, exitCodeNothingFound, ee.code)
+}
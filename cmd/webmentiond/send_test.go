@@ -0,0 +1,62 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSendDeleted(t *testing.T) {
+	failing := true
+	received := make([]string, 0, 2)
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost {
+			if failing {
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+			r.ParseForm()
+			received = append(received, r.Form.Get("target"))
+			w.WriteHeader(http.StatusAccepted)
+			return
+		}
+		w.Header().Set("Link", `</endpoint>; rel="webmention"`)
+	}))
+	defer target.Close()
+	source := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "Gone", http.StatusGone)
+	}))
+	defer source.Close()
+
+	// Without a state file there is nothing to notify:
+	cmd := newSendCmd().Cmd()
+	cmd.SetArgs([]string{source.URL})
+	require.Error(t, cmd.Execute())
+	cmd = newSendCmd().Cmd()
+	cmd.SetArgs([]string{"--deleted", source.URL})
+	require.Error(t, cmd.Execute())
+
+	stateFile := filepath.Join(t.TempDir(), "state.json")
+	data, _ := json.Marshal(map[string][]string{source.URL: {target.URL + "/a"}})
+	require.NoError(t, os.WriteFile(stateFile, data, 0600))
+	send := func() {
+		t.Helper()
+		cmd := newSendCmd().Cmd()
+		cmd.SetArgs([]string{"--state-file", stateFile, source.URL})
+		require.NoError(t, cmd.Execute())
+	}
+
+	// Targets that couldn't be notified are kept in the state file:
+	send()
+	require.Empty(t, received)
+	failing = false
+	send()
+	require.Equal(t, []string{target.URL + "/a"}, received)
+	send()
+	require.Len(t, received, 1)
+}
@@ -3,17 +3,16 @@ package main
 import (
 	"context"
 	"crypto/tls"
-	"database/sql"
 	"fmt"
 	"io/fs"
 	"net/http"
 	"net/smtp"
 	"os"
 	"path/filepath"
-	"regexp"
 	"time"
 
 	"github.com/go-chi/chi/v5"
+	_ "github.com/lib/pq"
 	_ "github.com/mattn/go-sqlite3"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/spf13/cobra"
@@ -23,44 +22,12 @@ import (
 	"github.com/zerok/webmentiond/pkg/server"
 )
 
-type dbPolicyLoader struct {
-	db *sql.DB
-}
-
-func (l *dbPolicyLoader) Load(ctx context.Context) ([]policies.URLPolicy, error) {
-	result, err := l.db.QueryContext(ctx, "SELECT id, url_pattern, policy, weight FROM url_policies ORDER BY weight ASC")
-	if err != nil {
-		return nil, err
-	}
-	defer result.Close()
-	pols := make([]policies.URLPolicy, 0, 10)
-	for result.Next() {
-		var id int
-		var pat string
-		var pol string
-		var weight int
-		if err := result.Scan(&id, &pat, &pol, &weight); err != nil {
-			return nil, err
-		}
-		urlp, err := regexp.Compile(pat)
-		if err != nil {
-			return nil, err
-		}
-		pols = append(pols, policies.URLPolicy{
-			ID:         id,
-			URLPattern: urlp,
-			Policy:     policies.Policy(pol),
-			Weight:     weight,
-		})
-	}
-	return pols, nil
-}
-
 func newServeCmd() Command {
 	var tokenTTL time.Duration
 	var accessKeyTokenTTL time.Duration
 	var verificationTimeoutDur time.Duration
 	var verificationMaxRedirects int
+	var feedPollInterval time.Duration
 	var notify bool
 	var serveCmd = &cobra.Command{
 		Use:   "serve",
@@ -91,16 +58,14 @@ func newServeCmd() Command {
 
 			allowedTargetDomains := cfg.GetStringSlice("server.allowed_target_domains")
 			allowedOrigins := cfg.GetStringSlice("server.allowed_origin")
-			dbpath := cfg.GetString("database.path")
-			if dbpath == "" {
+			dbDriver := cfg.GetString("database.driver")
+			dbURL := databaseURL(cfg)
+			if dbURL == "" {
 				return fmt.Errorf("no database specified")
 			}
-			migrationsFolder := cfg.GetString("database.migrations")
-			if migrationsFolder != "" {
-				migrationsFolder, err = filepath.Abs(migrationsFolder)
-				if err != nil {
-					return err
-				}
+			migrationsFolder, err := databaseMigrationsFolder()
+			if err != nil {
+				return err
 			}
 			authAdminEmails := cfg.GetStringSlice("server.auth_admin_emails")
 			authJWTSecret := cfg.GetString("server.auth_jwt_secret")
@@ -119,14 +84,30 @@ func newServeCmd() Command {
 			if err := validateConfig(cfg); err != nil {
 				return fmt.Errorf("configuration invalid: %w", err)
 			}
+			retention, err := retentionPeriods()
+			if err != nil {
+				return fmt.Errorf("configuration invalid: %w", err)
+			}
+			trashRetention, err := parseRetentionPeriod(cfg.GetString("retention.trash"))
+			if err != nil || trashRetention < 0 {
+				return fmt.Errorf("configuration invalid: invalid trash retention: %s", cfg.GetString("retention.trash"))
+			}
 
-			db, err := sql.Open("sqlite3", dbpath)
+			db, readDB, err := openDatabase(dbDriver, dbURL, server.SQLiteOptions{
+				BusyTimeout: cfg.GetDuration("database.busy_timeout"),
+				MaxReaders:  cfg.GetInt("database.max_readers"),
+			})
 			if err != nil {
-				return fmt.Errorf("failed to open %s: %w", dbpath, err)
+				return fmt.Errorf("failed to open %s database: %w", dbDriver, err)
 			}
-			pol := policies.NewRegistry(policies.DEFAULT)
-			policyLoader := &dbPolicyLoader{db: db}
 			defer db.Close()
+			defer readDB.Close()
+			pol := policies.NewRegistry(policies.DEFAULT)
+			store, err := server.NewSQLStore(db, dbDriver)
+			if err != nil {
+				return err
+			}
+			store = store.WithReader(readDB)
 			metricsAddr := cfg.GetString("server.metrics_addr")
 			exposeMetrics := metricsAddr == addr
 			srv := server.New(func(c *server.Configuration) {
@@ -137,6 +118,11 @@ func newServeCmd() Command {
 				c.Auth.AdminAccessKeyJWTTL = accessKeyTokenTTL
 				c.Context = ctx
 				c.Database = db
+				c.ReadDatabase = readDB
+				c.DatabaseDriver = dbDriver
+				c.MentionStore = store
+				c.PolicyStore = store
+				c.SendStore = store
 				c.MigrationsFolder = migrationsFolder
 				c.Receiver.TargetPolicy = server.RequestPolicyAllowHost(allowedTargetDomains...)
 				c.MailFrom = mailFrom
@@ -146,14 +132,28 @@ func newServeCmd() Command {
 				c.UIFileSystem = uiFileSystem
 				c.NotifyOnVerification = notify
 				c.Policies = pol
-				c.PolicyLoader = policyLoader
+				c.PolicyLoader = store
 				c.VerificationMaxRedirects = verificationMaxRedirects
 				c.ExposeMetrics = exposeMetrics
+				c.GetCacheSize = cfg.GetInt("server.get_cache_size")
+				c.GetCacheTTL = cfg.GetDuration("server.get_cache_ttl")
+				c.GetMaxAge = cfg.GetDuration("server.get_max_age")
+				c.Sender.Feeds = cfg.GetStringSlice("sending.feeds")
+				c.Sender.FeedPollInterval = feedPollInterval
+				c.Sender.FeedBackfill = cfg.GetBool("sending.feed_backfill")
+				c.Sender.EntryOnly = cfg.GetBool("sending.entry_only")
+				c.Sender.ExcludeHosts = cfg.GetStringSlice("sending.exclude_hosts")
+				c.Backup.Dir = cfg.GetString("backup.dir")
+				c.Backup.Interval = cfg.GetDuration("backup.interval")
+				c.Backup.Retain = cfg.GetInt("backup.retain")
+				c.Retention.Periods = retention
+				c.Retention.Interval = cfg.GetDuration("retention.interval")
+				c.Retention.Trash = trashRetention
 			})
 			if err := srv.MigrateDatabase(ctx); err != nil {
 				return err
 			}
-			if err := pol.Load(ctx, policyLoader); err != nil {
+			if err := pol.Load(ctx, store); err != nil {
 				return err
 			}
 			go func() {
@@ -166,7 +166,7 @@ func newServeCmd() Command {
 					case <-ticker.C:
 						break
 					}
-					if err := pol.Load(ctx, policyLoader); err != nil {
+					if err := pol.Load(ctx, store); err != nil {
 						logger.Error().Err(err).Msg("Failed to load policies")
 					}
 				}
@@ -183,6 +183,9 @@ func newServeCmd() Command {
 			httpSrv.Addr = addr
 			httpSrv.Handler = srv
 			srv.StartVerifier(ctx)
+			srv.StartFeedPoller(ctx)
+			srv.StartBackups(ctx)
+			srv.StartJanitor(ctx)
 			if err := srv.UpdateGlobalMetrics(ctx); err != nil {
 				return err
 			}
@@ -200,10 +203,7 @@ func newServeCmd() Command {
 	cfg.BindEnv("email.use_starttls", "MAIL_USE_STARTTLS")
 	cfg.BindEnv("server.auth_jwt_secret", "SERVER_AUTH_JWT_SECRET")
 
-	serveCmd.Flags().String("database", "./webmentiond.sqlite", "Path to a SQLite database file")
-	cfg.BindPFlag("database.path", serveCmd.Flags().Lookup("database"))
-	serveCmd.Flags().String("database-migrations", "", "Path to the database migrations")
-	cfg.BindPFlag("database.migrations", serveCmd.Flags().Lookup("database-migrations"))
+	addDatabaseFlags(serveCmd)
 
 	serveCmd.Flags().String("addr", "127.0.0.1:8080", "Address to listen on for HTTP requests")
 	serveCmd.Flags().String("metrics-addr", "", "Address where metrics are exposed")
@@ -213,6 +213,13 @@ func newServeCmd() Command {
 	serveCmd.Flags().String("public-url", "http://127.0.0.1:8080", "URL used as base for generating links")
 	cfg.BindPFlag("server.public_url", serveCmd.Flags().Lookup("public-url"))
 
+	serveCmd.Flags().Int("get-cache-size", server.DefaultGetCacheSize, "Number of targets whose mentions are cached in memory (negative disables the cache)")
+	cfg.BindPFlag("server.get_cache_size", serveCmd.Flags().Lookup("get-cache-size"))
+	serveCmd.Flags().Duration("get-cache-ttl", server.DefaultGetCacheTTL, "Maximum time the mentions of a target are cached in memory")
+	cfg.BindPFlag("server.get_cache_ttl", serveCmd.Flags().Lookup("get-cache-ttl"))
+	serveCmd.Flags().Duration("get-max-age", 0, "How long clients may use a cached list of mentions without revalidating it")
+	cfg.BindPFlag("server.get_max_age", serveCmd.Flags().Lookup("get-max-age"))
+
 	serveCmd.Flags().StringSlice("allowed-target-domains", []string{}, "Domain name that are accepted as targets")
 	cfg.BindPFlag("server.allowed_target_domains", serveCmd.Flags().Lookup("allowed-target-domains"))
 	serveCmd.Flags().StringSlice("allowed-origin", []string{}, "Domain name that is allowed to contact the API (CORS)")
@@ -235,6 +242,30 @@ func newServeCmd() Command {
 	serveCmd.Flags().DurationVar(&accessKeyTokenTTL, "auth-admin-access-key-jwt-ttl", time.Minute*5, "TTL of the generated JWTs")
 	cfg.BindPFlag("server.auth_admin_access_key_jwt_ttl", serveCmd.Flags().Lookup("auth-admin-access-key-jwt-ttl"))
 
+	serveCmd.Flags().StringSlice("feed", []string{}, "RSS, Atom, JSON Feed or h-feed URL that should be polled for new entries to send mentions for")
+	cfg.BindPFlag("sending.feeds", serveCmd.Flags().Lookup("feed"))
+	serveCmd.Flags().DurationVar(&feedPollInterval, "feed-poll-interval", time.Minute*15, "Interval in which feeds are polled for new entries")
+	cfg.BindPFlag("sending.feed_poll_interval", serveCmd.Flags().Lookup("feed-poll-interval"))
+	serveCmd.Flags().Bool("feed-backfill", false, "Send mentions for all existing entries when a feed is polled for the first time")
+	cfg.BindPFlag("sending.feed_backfill", serveCmd.Flags().Lookup("feed-backfill"))
+	serveCmd.Flags().Bool("send-entry-only", false, "Only send mentions for links inside the h-entry of a source")
+	cfg.BindPFlag("sending.entry_only", serveCmd.Flags().Lookup("send-entry-only"))
+	serveCmd.Flags().StringSlice("send-exclude-hosts", []string{}, "Hosts that should never receive a mention")
+	cfg.BindPFlag("sending.exclude_hosts", serveCmd.Flags().Lookup("send-exclude-hosts"))
+
+	serveCmd.Flags().String("backup-dir", "", "Folder for scheduled SQLite backups (disabled if empty)")
+	cfg.BindPFlag("backup.dir", serveCmd.Flags().Lookup("backup-dir"))
+	serveCmd.Flags().Duration("backup-interval", server.DefaultBackupInterval, "Interval in which scheduled backups are created")
+	cfg.BindPFlag("backup.interval", serveCmd.Flags().Lookup("backup-interval"))
+	serveCmd.Flags().Int("backup-retain", server.DefaultBackupRetain, "Number of scheduled backups to keep")
+	cfg.BindPFlag("backup.retain", serveCmd.Flags().Lookup("backup-retain"))
+
+	addRetentionFlag(serveCmd)
+	serveCmd.Flags().Duration("retention-interval", server.DefaultJanitorInterval, "Interval in which mentions are pruned according to --retention")
+	cfg.BindPFlag("retention.interval", serveCmd.Flags().Lookup("retention-interval"))
+	serveCmd.Flags().String("trash-retention", "30d", "How long deleted mentions are kept in the trash (0 keeps them until purged manually)")
+	cfg.BindPFlag("retention.trash", serveCmd.Flags().Lookup("trash-retention"))
+
 	serveCmd.Flags().BoolVar(&notify, "send-notifications", false, "Send email notifications about new/updated webmentions")
 	cfg.BindPFlag("notifications.enabled", serveCmd.Flags().Lookup("send-notifications"))
 
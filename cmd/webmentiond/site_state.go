@@ -0,0 +1,101 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// sitePage is what the state file of --site-dir remembers about a page.
+type sitePage struct {
+	Targets []string `json:"targets"`
+	// Hash is the checksum of the h-entry of the page.
+	Hash string `json:"hash,omitempty"`
+	// Retry is set if sending a mention failed so that the page is
+	// processed again with the next run.
+	Retry bool `json:"retry,omitempty"`
+}
+
+// siteState keeps the pages of a site inside a single JSON file. State
+// files only containing the targets of each source, as written by send
+// --state-file, are read as well.
+type siteState struct {
+	path  string
+	pages map[string]sitePage
+}
+
+func loadSiteState(path string) (*siteState, error) {
+	state := &siteState{
+		path:  path,
+		pages: make(map[string]sitePage),
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return state, nil
+		}
+		return nil, err
+	}
+	raw := make(map[string]json.RawMessage)
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, err
+	}
+	for source, value := range raw {
+		page := sitePage{}
+		if err := json.Unmarshal(value, &page.Targets); err != nil {
+			if err := json.Unmarshal(value, &page); err != nil {
+				return nil, fmt.Errorf("invalid state of %s: %w", source, err)
+			}
+		}
+		state.pages[source] = page
+	}
+	return state, nil
+}
+
+// Page returns the state of the given source or an empty one if the
+// source isn't known.
+func (s *siteState) Page(source string) sitePage {
+	return s.pages[source]
+}
+
+// Sources returns all known sources in alphabetical order.
+func (s *siteState) Sources() []string {
+	result := make([]string, 0, len(s.pages))
+	for source := range s.pages {
+		result = append(result, source)
+	}
+	sort.Strings(result)
+	return result
+}
+
+// Save updates the state of a single page and writes the whole state
+// file. Pages without any targets are removed.
+func (s *siteState) Save(source string, page sitePage) error {
+	if len(page.Targets) == 0 {
+		delete(s.pages, source)
+	} else {
+		page.Targets = append(make([]string, 0, len(page.Targets)), page.Targets...)
+		sort.Strings(page.Targets)
+		s.pages[source] = page
+	}
+	// Write into a temporary file first so that an interrupted run
+	// doesn't leave a broken state file behind.
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	enc := json.NewEncoder(tmp)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(s.pages); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), s.path)
+}
@@ -10,6 +10,7 @@ require (
 	github.com/golang-jwt/jwt/v5 v5.3.1
 	github.com/golang-migrate/migrate/v4 v4.19.1
 	github.com/jordan-wright/email v4.0.1-0.20210109023952-943e75fe5223+incompatible
+	github.com/lib/pq v1.10.9
 	github.com/mattn/go-sqlite3 v1.14.48
 	github.com/prometheus/client_golang v1.24.1
 	github.com/rs/xid v1.6.0
@@ -0,0 +1,340 @@
+// Package feeds parses RSS 2.0, Atom, JSON Feed and h-feed documents
+// into a common list of entries.
+package feeds
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"willnorris.com/go/microformats"
+)
+
+// ErrUnsupportedFormat is returned by Parse if the given document is
+// neither an RSS, Atom, JSON Feed nor an HTML document.
+var ErrUnsupportedFormat = errors.New("unsupported feed format")
+
+// ErrNotModified is returned by Fetch if the server indicated that
+// the feed has not changed since the last request.
+var ErrNotModified = errors.New("feed not modified")
+
+// Entry is a single item inside a feed.
+type Entry struct {
+	// ID is a stable identifier of the entry (e.g. a GUID). If the feed
+	// doesn't provide one, the URL of the entry is used instead.
+	ID  string
+	URL string
+	// Updated is the last time the entry was updated or published. It
+	// is the zero time if the feed doesn't contain that information.
+	Updated time.Time
+}
+
+// Feed is the format-independent representation of a feed.
+type Feed struct {
+	Entries      []Entry
+	ETag         string
+	LastModified string
+}
+
+// FetchOptions allow to configure the Fetch function.
+type FetchOptions struct {
+	HTTPClient   *http.Client
+	ETag         string
+	LastModified string
+}
+
+// Fetch requests the given feed URL and parses the response. If an
+// ETag or Last-Modified value is passed in the options, a conditional
+// request is sent and ErrNotModified is returned if the feed hasn't
+// changed.
+func Fetch(ctx context.Context, u string, configurators ...func(*FetchOptions)) (*Feed, error) {
+	opts := &FetchOptions{
+		HTTPClient: &http.Client{},
+	}
+	for _, c := range configurators {
+		c(opts)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/feed+json, application/atom+xml, application/rss+xml, application/xml;q=0.9, text/html;q=0.8")
+	if opts.ETag != "" {
+		req.Header.Set("If-None-Match", opts.ETag)
+	}
+	if opts.LastModified != "" {
+		req.Header.Set("If-Modified-Since", opts.LastModified)
+	}
+	resp, err := opts.HTTPClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotModified {
+		return nil, ErrNotModified
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status code returned: %v", resp.StatusCode)
+	}
+	feed, err := Parse(ctx, resp.Body, resp.Request.URL.String())
+	if err != nil {
+		return nil, err
+	}
+	feed.ETag = resp.Header.Get("ETag")
+	feed.LastModified = resp.Header.Get("Last-Modified")
+	return feed, nil
+}
+
+// Parse detects the format of the given document and extracts all
+// entries from it. Relative entry URLs are resolved against u.
+func Parse(ctx context.Context, r io.Reader, u string) (*Feed, error) {
+	base, err := url.Parse(u)
+	if err != nil {
+		return nil, err
+	}
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	trimmed := bytes.TrimSpace(data)
+	if len(trimmed) == 0 {
+		return nil, ErrUnsupportedFormat
+	}
+	var entries []Entry
+	switch {
+	case trimmed[0] == '{':
+		entries, err = parseJSONFeed(trimmed)
+	case isHTML(trimmed):
+		entries = parseHFeed(trimmed, base)
+	case trimmed[0] == '<':
+		entries, err = parseXMLFeed(trimmed)
+	default:
+		return nil, ErrUnsupportedFormat
+	}
+	if err != nil {
+		return nil, err
+	}
+	feed := &Feed{
+		Entries: make([]Entry, 0, len(entries)),
+	}
+	for _, e := range entries {
+		if e.URL == "" {
+			continue
+		}
+		ref, err := url.Parse(e.URL)
+		if err != nil {
+			continue
+		}
+		e.URL = base.ResolveReference(ref).String()
+		if e.ID == "" {
+			e.ID = e.URL
+		}
+		feed.Entries = append(feed.Entries, e)
+	}
+	return feed, nil
+}
+
+func isHTML(data []byte) bool {
+	prefix := strings.ToLower(string(data[:min(len(data), 512)]))
+	return strings.HasPrefix(prefix, "<!doctype html") || strings.Contains(prefix, "<html")
+}
+
+type rssDocument struct {
+	Items []struct {
+		GUID    string `xml:"guid"`
+		Link    string `xml:"link"`
+		PubDate string `xml:"pubDate"`
+		Updated string `xml:"http://purl.org/dc/elements/1.1/ date"`
+	} `xml:"channel>item"`
+}
+
+type atomLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr"`
+}
+
+type atomDocument struct {
+	Entries []struct {
+		ID        string     `xml:"id"`
+		Links     []atomLink `xml:"link"`
+		Updated   string     `xml:"updated"`
+		Published string     `xml:"published"`
+	} `xml:"entry"`
+}
+
+func parseXMLFeed(data []byte) ([]Entry, error) {
+	var root struct {
+		XMLName xml.Name
+	}
+	if err := xml.Unmarshal(data, &root); err != nil {
+		return nil, err
+	}
+	switch root.XMLName.Local {
+	case "rss":
+		doc := rssDocument{}
+		if err := xml.Unmarshal(data, &doc); err != nil {
+			return nil, err
+		}
+		entries := make([]Entry, 0, len(doc.Items))
+		for _, item := range doc.Items {
+			updated := parseTime(item.Updated)
+			if updated.IsZero() {
+				updated = parseTime(item.PubDate)
+			}
+			entries = append(entries, Entry{
+				ID:      strings.TrimSpace(item.GUID),
+				URL:     strings.TrimSpace(item.Link),
+				Updated: updated,
+			})
+		}
+		return entries, nil
+	case "feed":
+		doc := atomDocument{}
+		if err := xml.Unmarshal(data, &doc); err != nil {
+			return nil, err
+		}
+		entries := make([]Entry, 0, len(doc.Entries))
+		for _, item := range doc.Entries {
+			var link string
+			for _, l := range item.Links {
+				if l.Rel == "" || l.Rel == "alternate" {
+					link = l.Href
+					break
+				}
+			}
+			updated := parseTime(item.Updated)
+			if updated.IsZero() {
+				updated = parseTime(item.Published)
+			}
+			entries = append(entries, Entry{
+				ID:      strings.TrimSpace(item.ID),
+				URL:     strings.TrimSpace(link),
+				Updated: updated,
+			})
+		}
+		return entries, nil
+	}
+	return nil, ErrUnsupportedFormat
+}
+
+type jsonFeedDocument struct {
+	Version string `json:"version"`
+	Items   []struct {
+		ID            any    `json:"id"`
+		URL           string `json:"url"`
+		DatePublished string `json:"date_published"`
+		DateModified  string `json:"date_modified"`
+	} `json:"items"`
+}
+
+func parseJSONFeed(data []byte) ([]Entry, error) {
+	doc := jsonFeedDocument{}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	if !strings.HasPrefix(doc.Version, "https://jsonfeed.org/version/") {
+		return nil, ErrUnsupportedFormat
+	}
+	entries := make([]Entry, 0, len(doc.Items))
+	for _, item := range doc.Items {
+		updated := parseTime(item.DateModified)
+		if updated.IsZero() {
+			updated = parseTime(item.DatePublished)
+		}
+		var id string
+		if item.ID != nil {
+			// Version 1.0 of the spec allowed numeric IDs.
+			id = fmt.Sprint(item.ID)
+		}
+		entries = append(entries, Entry{
+			ID:      id,
+			URL:     item.URL,
+			Updated: updated,
+		})
+	}
+	return entries, nil
+}
+
+func parseHFeed(data []byte, base *url.URL) []Entry {
+	mf := microformats.Parse(bytes.NewReader(data), base)
+	entries := make([]Entry, 0, 10)
+	var collect func(items []*microformats.Microformat)
+	collect = func(items []*microformats.Microformat) {
+		for _, item := range items {
+			if hasType(item, "h-feed") {
+				collect(item.Children)
+				continue
+			}
+			if !hasType(item, "h-entry") {
+				continue
+			}
+			updated := parseTime(firstString(item, "updated"))
+			if updated.IsZero() {
+				updated = parseTime(firstString(item, "published"))
+			}
+			entries = append(entries, Entry{
+				ID:      firstString(item, "uid"),
+				URL:     firstString(item, "url"),
+				Updated: updated,
+			})
+		}
+	}
+	collect(mf.Items)
+	return entries
+}
+
+func hasType(mf *microformats.Microformat, typ string) bool {
+	for _, t := range mf.Type {
+		if t == typ {
+			return true
+		}
+	}
+	return false
+}
+
+func firstString(mf *microformats.Microformat, property string) string {
+	values, ok := mf.Properties[property]
+	if !ok || len(values) == 0 {
+		return ""
+	}
+	if s, ok := values[0].(string); ok {
+		return strings.TrimSpace(s)
+	}
+	return ""
+}
+
+var timeLayouts = []string{
+	time.RFC3339,
+	time.RFC3339Nano,
+	time.RFC1123Z,
+	time.RFC1123,
+	time.RFC822Z,
+	time.RFC822,
+	"Mon, 2 Jan 2006 15:04:05 -0700",
+	"Mon, 2 Jan 2006 15:04:05 MST",
+	"2006-01-02T15:04:05-0700",
+	"2006-01-02 15:04:05-07:00",
+	"2006-01-02T15:04:05",
+	"2006-01-02",
+}
+
+func parseTime(value string) time.Time {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return time.Time{}
+	}
+	for _, layout := range timeLayouts {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t
+		}
+	}
+	return time.Time{}
+}
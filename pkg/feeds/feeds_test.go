@@ -0,0 +1,87 @@
+package feeds_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/zerok/webmentiond/pkg/feeds"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		file    string
+		ids     []string
+		updated []time.Time
+	}{
+		{
+			file:    "testdata/rss.xml",
+			ids:     []string{"https://example.com/posts/2/", "post-1"},
+			updated: []time.Time{time.Date(2020, 3, 3, 10, 0, 0, 0, time.UTC), time.Date(2020, 3, 2, 10, 0, 0, 0, time.UTC)},
+		},
+		{
+			file:    "testdata/atom.xml",
+			ids:     []string{"tag:example.com,2020:2", "tag:example.com,2020:1"},
+			updated: []time.Time{time.Date(2020, 3, 3, 10, 0, 0, 0, time.UTC), time.Date(2020, 3, 2, 10, 0, 0, 0, time.UTC)},
+		},
+		{
+			file:    "testdata/feed.json",
+			ids:     []string{"2", "1"},
+			updated: []time.Time{time.Date(2020, 3, 3, 10, 0, 0, 0, time.UTC), time.Date(2020, 3, 2, 10, 0, 0, 0, time.UTC)},
+		},
+		{
+			file:    "testdata/hfeed.html",
+			ids:     []string{"https://example.com/posts/2/", "https://example.com/posts/1/"},
+			updated: []time.Time{time.Date(2020, 3, 3, 10, 0, 0, 0, time.UTC), time.Date(2020, 3, 2, 10, 0, 0, 0, time.UTC)},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.file, func(t *testing.T) {
+			fp, err := os.Open(test.file)
+			require.NoError(t, err)
+			defer fp.Close()
+			feed, err := feeds.Parse(context.Background(), fp, "https://example.com/feed")
+			require.NoError(t, err)
+			require.Len(t, feed.Entries, 2)
+			require.Equal(t, "https://example.com/posts/2/", feed.Entries[0].URL)
+			require.Equal(t, "https://example.com/posts/1/", feed.Entries[1].URL)
+			for idx, e := range feed.Entries {
+				require.Equal(t, test.ids[idx], e.ID)
+				require.True(t, test.updated[idx].Equal(e.Updated), "%s != %s", test.updated[idx], e.Updated)
+			}
+		})
+	}
+
+	t.Run("unsupported", func(t *testing.T) {
+		_, err := feeds.Parse(context.Background(), strings.NewReader("just some text"), "https://example.com/feed")
+		require.ErrorIs(t, err, feeds.ErrUnsupportedFormat)
+	})
+}
+
+func TestFetch(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", `"v1"`)
+		http.ServeFile(w, r, "testdata/atom.xml")
+	}))
+	defer srv.Close()
+	ctx := context.Background()
+	feed, err := feeds.Fetch(ctx, srv.URL)
+	require.NoError(t, err)
+	require.Len(t, feed.Entries, 2)
+	require.Equal(t, srv.URL+"/posts/1/", feed.Entries[1].URL)
+	require.Equal(t, `"v1"`, feed.ETag)
+
+	_, err = feeds.Fetch(ctx, srv.URL, func(o *feeds.FetchOptions) {
+		o.ETag = feed.ETag
+	})
+	require.ErrorIs(t, err, feeds.ErrNotModified)
+}
@@ -0,0 +1,94 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+// audit records a change made through the admin API by the subject of
+// the current request. Failures are only logged as the change has
+// already happened at this point.
+func (srv *Server) audit(ctx context.Context, action string, targets ...AuditTarget) {
+	e := AuditEntry{
+		CreatedAt: formatTimestamp(time.Now()),
+		Actor:     Subject(ctx),
+		Action:    action,
+		Targets:   targets,
+	}
+	if err := srv.cfg.AuditStore.RecordAuditEntry(ctx, e); err != nil {
+		zerolog.Ctx(ctx).Error().Err(err).Msgf("Failed to record %s in the audit log", action)
+	}
+}
+
+// handleListAudit lists the audit log starting with the latest entry.
+func (srv *Server) handleListAudit(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	filter, err := parseAuditFilter(r.URL.Query())
+	if err != nil {
+		srv.sendError(ctx, w, &HTTPError{StatusCode: http.StatusBadRequest, Err: err})
+		return
+	}
+	if filter.Limit <= 0 {
+		filter.Limit = 50
+	}
+	result := PagedAuditLog{}
+	if result.Total, err = srv.cfg.AuditStore.CountAuditEntries(ctx, filter); err != nil {
+		srv.sendError(ctx, w, err)
+		return
+	}
+	limit := filter.Limit
+	filter.Limit++
+	if result.Items, err = srv.cfg.AuditStore.ListAuditEntries(ctx, filter); err != nil {
+		srv.sendError(ctx, w, err)
+		return
+	}
+	if len(result.Items) > limit {
+		result.Items = result.Items[:limit]
+		v := r.URL.Query()
+		v.Set("offset", strconv.Itoa(filter.Offset+limit))
+		result.Next = strings.TrimSuffix(srv.cfg.PublicURL, "/") + r.URL.Path + "?" + v.Encode()
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
+
+// parseAuditFilter creates a filter from the query parameters of the
+// audit log endpoint.
+func parseAuditFilter(v url.Values) (AuditFilter, error) {
+	var err error
+	filter := AuditFilter{
+		Actor:    v.Get("actor"),
+		Action:   v.Get("action"),
+		TargetID: v.Get("target"),
+	}
+	if raw := v.Get("limit"); raw != "" {
+		if filter.Limit, err = strconv.Atoi(raw); err != nil {
+			return filter, fmt.Errorf("invalid limit: %s", raw)
+		}
+	}
+	if raw := v.Get("offset"); raw != "" {
+		if filter.Offset, err = strconv.Atoi(raw); err != nil {
+			return filter, fmt.Errorf("invalid offset: %s", raw)
+		}
+		filter.Offset = max(0, filter.Offset)
+	}
+	for param, t := range map[string]*time.Time{
+		"created_after":  &filter.CreatedAfter,
+		"created_before": &filter.CreatedBefore,
+	} {
+		if raw := v.Get(param); raw != "" {
+			if *t, err = parseFilterTime(raw); err != nil {
+				return filter, fmt.Errorf("invalid %s: %s", param, raw)
+			}
+		}
+	}
+	return filter, nil
+}
@@ -0,0 +1,79 @@
+package server_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/zerok/webmentiond/pkg/server"
+)
+
+func TestAuditLog(t *testing.T) {
+	db := setupDatabase(t)
+	defer db.Close()
+	srv := setupServer(t, db)
+	createMention(t, db, "a", "https://a.com/", "https://target.com/")
+	createMention(t, db, "b", "https://b.com/", "https://target.com/")
+	setMentionStatus(t, db, "a", server.MentionStatusVerified)
+	setMentionStatus(t, db, "b", server.MentionStatusVerified)
+
+	send := func(actor string, method string, path string, body string, expectedStatus int) *httptest.ResponseRecorder {
+		t.Helper()
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(method, path, strings.NewReader(body))
+		srv.ServeHTTP(w, r.WithContext(server.AuthorizeContextAs(context.Background(), actor)))
+		require.Equal(t, expectedStatus, w.Code)
+		return w
+	}
+	audit := func(query string) server.PagedAuditLog {
+		t.Helper()
+		var res server.PagedAuditLog
+		w := send("alice@example.org", http.MethodGet, "/manage/audit"+query, "", http.StatusOK)
+		require.NoError(t, json.NewDecoder(w.Body).Decode(&res))
+		return res
+	}
+
+	send("alice@example.org", http.MethodPost, "/manage/mentions/a/approve", "", http.StatusOK)
+	send("key:ci", http.MethodPost, "/manage/mentions/bulk", `{"action": "reject", "ids": ["a", "b", "unknown"]}`, http.StatusOK)
+	send("bob@example.org", http.MethodDelete, "/manage/mentions/b", "", http.StatusOK)
+	send("bob@example.org", http.MethodPost, "/manage/policies", `{"url_pattern": "^https://friend.example/", "policy": "approve"}`, http.StatusOK)
+	// Failed changes are not recorded:
+	send("bob@example.org", http.MethodPost, "/manage/mentions/unknown/approve", "", http.StatusNotFound)
+
+	log := audit("")
+	require.Equal(t, 4, log.Total)
+	require.Len(t, log.Items, 4)
+	require.Equal(t, server.AuditActionCreatePolicy, log.Items[0].Action)
+	require.Equal(t, "bob@example.org", log.Items[0].Actor)
+	require.Equal(t, []server.AuditTarget{{ID: "1"}}, log.Items[0].Targets)
+	require.Equal(t, server.AuditActionDeleteMention, log.Items[1].Action)
+	require.Equal(t, []server.AuditTarget{{ID: "b", StatusBefore: server.MentionStatusRejected}}, log.Items[1].Targets)
+	require.Equal(t, server.AuditActionRejectMention, log.Items[2].Action)
+	require.Equal(t, "key:ci", log.Items[2].Actor)
+	require.Equal(t, []server.AuditTarget{
+		{ID: "a", StatusBefore: server.MentionStatusApproved, StatusAfter: server.MentionStatusRejected},
+		{ID: "b", StatusBefore: server.MentionStatusVerified, StatusAfter: server.MentionStatusRejected},
+	}, log.Items[2].Targets)
+	require.Equal(t, server.AuditActionApproveMention, log.Items[3].Action)
+	require.Equal(t, "alice@example.org", log.Items[3].Actor)
+	require.Equal(t, []server.AuditTarget{{ID: "a", StatusBefore: server.MentionStatusVerified, StatusAfter: server.MentionStatusApproved}}, log.Items[3].Targets)
+	require.NotEmpty(t, log.Items[3].CreatedAt)
+
+	log = audit("?actor=bob@example.org")
+	require.Equal(t, 2, log.Total)
+	log = audit("?target=a")
+	require.Equal(t, 2, log.Total)
+	log = audit("?action=mention.delete")
+	require.Equal(t, 1, log.Total)
+	log = audit("?limit=3")
+	require.Len(t, log.Items, 3)
+	require.Contains(t, log.Next, "offset=3")
+	log = audit("?limit=3&offset=3")
+	require.Len(t, log.Items, 1)
+	require.Empty(t, log.Next)
+	send("alice@example.org", http.MethodGet, "/manage/audit?created_after=yesterday", "", http.StatusBadRequest)
+}
@@ -22,6 +22,21 @@ func AuthorizeContext(ctx context.Context) context.Context {
 	return context.WithValue(ctx, authorizedContextKey{}, true)
 }
 
+type subjectContextKey struct{}
+
+// AuthorizeContextAs marks the current context as being authorized for
+// the given subject.
+func AuthorizeContextAs(ctx context.Context, subject string) context.Context {
+	return context.WithValue(AuthorizeContext(ctx), subjectContextKey{}, subject)
+}
+
+// Subject returns the subject of the JWT the current request was
+// authorized with, i.e. an admin email address or access key.
+func Subject(ctx context.Context) string {
+	subject, _ := ctx.Value(subjectContextKey{}).(string)
+	return subject
+}
+
 // requireAuthMiddleware ensures that a request contains a valid JWT
 // before allowing it to pass through.
 func (srv *Server) requireAuthMiddleware(handler http.Handler) http.Handler {
@@ -53,16 +68,17 @@ func (srv *Server) requireAuthMiddleware(handler http.Handler) http.Handler {
 			return
 		}
 
+		subject, _ := claims["sub"].(string)
 		for _, k := range srv.cfg.Auth.AdminAccessKeys {
-			if claims["sub"] == formatAccessKeySubject(k) {
-				handler.ServeHTTP(w, r.WithContext(AuthorizeContext(ctx)))
+			if subject == formatAccessKeySubject(k) {
+				handler.ServeHTTP(w, r.WithContext(AuthorizeContextAs(ctx, subject)))
 				return
 			}
 		}
 
 		for _, e := range srv.cfg.Auth.AdminEmails {
-			if e == claims["sub"] {
-				handler.ServeHTTP(w, r.WithContext(AuthorizeContext(ctx)))
+			if e == subject {
+				handler.ServeHTTP(w, r.WithContext(AuthorizeContextAs(ctx, subject)))
 				return
 			}
 		}
@@ -60,10 +60,13 @@ func TestAccessKeyAuthentication(t *testing.T) {
 		w = httptest.NewRecorder()
 		r = httptest.NewRequest(http.MethodPost, "/", nil)
 		r.Header.Set("Authorization", fmt.Sprintf("Bearer %s", string(jot)))
+		var subject string
 		srv.requireAuthMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			subject = Subject(r.Context())
 			w.WriteHeader(200)
 		})).ServeHTTP(w, r.WithContext(ctx))
 		require.Equal(t, w.Code, http.StatusOK)
+		require.Equal(t, "key:ci", subject)
 	})
 
 	t.Run("invalid-key", func(t *testing.T) {
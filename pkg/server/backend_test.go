@@ -0,0 +1,127 @@
+package server_test
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/url"
+	"os"
+	"sync"
+	"testing"
+
+	_ "github.com/lib/pq"
+	"github.com/rs/xid"
+	"github.com/stretchr/testify/require"
+	"github.com/testcontainers/testcontainers-go"
+	"github.com/testcontainers/testcontainers-go/wait"
+	"github.com/zerok/webmentiond/pkg/server"
+)
+
+// testBackend is a database all store-related tests are run against.
+type testBackend struct {
+	Name             string
+	Driver           string
+	MigrationsFolder string
+	Open             func(t *testing.T) *sql.DB
+}
+
+var testBackends = []testBackend{
+	{
+		Name:             "sqlite",
+		Driver:           server.DatabaseDriverSQLite,
+		MigrationsFolder: "./migrations",
+		Open: func(t *testing.T) *sql.DB {
+			db, err := sql.Open("sqlite3", fmt.Sprintf("file:%s.db?cache=shared&mode=memory", xid.New().String()))
+			require.NoError(t, err)
+			return db
+		},
+	},
+	{
+		Name:             "postgres",
+		Driver:           server.DatabaseDriverPostgres,
+		MigrationsFolder: "./migrations",
+		Open:             openPostgres,
+	},
+}
+
+var postgres struct {
+	once sync.Once
+	url  string
+	err  error
+}
+
+// postgresURL returns the URL of the database set in POSTGRES_TEST_URL
+// or starts a container if that variable is not set. Tests are skipped
+// if neither is available.
+func postgresURL(t *testing.T) string {
+	t.Helper()
+	if u := os.Getenv("POSTGRES_TEST_URL"); u != "" {
+		return u
+	}
+	testcontainers.SkipIfProviderIsNotHealthy(t)
+	postgres.once.Do(func() {
+		ctx := context.Background()
+		container, err := testcontainers.GenericContainer(ctx, testcontainers.GenericContainerRequest{
+			ContainerRequest: testcontainers.ContainerRequest{
+				Image:        "postgres:16-alpine",
+				ExposedPorts: []string{"5432/tcp"},
+				Env: map[string]string{
+					"POSTGRES_USER":     "webmentiond",
+					"POSTGRES_PASSWORD": "webmentiond",
+					"POSTGRES_DB":       "webmentiond",
+				},
+				WaitingFor: wait.ForLog("database system is ready to accept connections").WithOccurrence(2),
+			},
+			Started: true,
+		})
+		if err != nil {
+			postgres.err = err
+			return
+		}
+		endpoint, err := container.PortEndpoint(ctx, "5432/tcp", "")
+		if err != nil {
+			postgres.err = err
+			return
+		}
+		postgres.url = fmt.Sprintf("postgres://webmentiond:webmentiond@%s/webmentiond?sslmode=disable", endpoint)
+	})
+	require.NoError(t, postgres.err)
+	return postgres.url
+}
+
+// openPostgres isolates every test inside its own schema.
+func openPostgres(t *testing.T) *sql.DB {
+	t.Helper()
+	dsn := postgresURL(t)
+	admin, err := sql.Open("postgres", dsn)
+	require.NoError(t, err)
+	schema := "test_" + xid.New().String()
+	_, err = admin.Exec("CREATE SCHEMA " + schema)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		admin.Exec("DROP SCHEMA " + schema + " CASCADE")
+		admin.Close()
+	})
+	u, err := url.Parse(dsn)
+	require.NoError(t, err)
+	q := u.Query()
+	q.Set("search_path", schema)
+	u.RawQuery = q.Encode()
+	db, err := sql.Open("postgres", u.String())
+	require.NoError(t, err)
+	return db
+}
+
+// setupBackend opens a migrated database and returns a server using it.
+func setupBackend(t *testing.T, backend testBackend, configurators ...server.Configurator) (*sql.DB, *server.Server) {
+	t.Helper()
+	db := backend.Open(t)
+	t.Cleanup(func() { db.Close() })
+	srv := server.New(append([]server.Configurator{func(c *server.Configuration) {
+		c.Database = db
+		c.DatabaseDriver = backend.Driver
+		c.MigrationsFolder = backend.MigrationsFolder
+	}}, configurators...)...)
+	require.NoError(t, srv.MigrateDatabase(context.Background()))
+	return db, srv
+}
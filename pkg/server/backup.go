@@ -0,0 +1,336 @@
+package server
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/golang-migrate/migrate/v4"
+	"github.com/mattn/go-sqlite3"
+	"github.com/rs/zerolog"
+)
+
+// Defaults for the snapshots created by StartBackups.
+const (
+	DefaultBackupInterval = 24 * time.Hour
+	DefaultBackupRetain   = 7
+)
+
+// ErrInvalidBackup is returned by RestoreSQLite if the backup is not a
+// webmentiond database that this version can work with.
+var ErrInvalidBackup = errors.New("invalid backup")
+
+const (
+	snapshotPrefix     = "webmentiond-"
+	snapshotSuffix     = ".sqlite"
+	snapshotTimeFormat = "20060102T150405.000000Z"
+)
+
+// BackupSQLite copies the SQLite database behind db to dest using
+// SQLite's online backup API. Unlike copying the database file, this
+// produces a consistent copy even while other connections write to
+// the database. The copy is written to a temporary file first and only
+// moved to dest once it is complete.
+func BackupSQLite(ctx context.Context, db *sql.DB, dest string) error {
+	tmp, err := os.CreateTemp(filepath.Dir(dest), filepath.Base(dest)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	tmp.Close()
+	tmpPath := tmp.Name()
+	if err := backupSQLite(ctx, db, tmpPath); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	if err := os.Rename(tmpPath, dest); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	return nil
+}
+
+func backupSQLite(ctx context.Context, db *sql.DB, dest string) error {
+	destDB, err := sql.Open(DatabaseDriverSQLite, dest)
+	if err != nil {
+		return err
+	}
+	defer destDB.Close()
+	destConn, err := destDB.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer destConn.Close()
+	srcConn, err := db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer srcConn.Close()
+	return destConn.Raw(func(destDriverConn any) error {
+		return srcConn.Raw(func(srcDriverConn any) error {
+			destSQLite, ok := destDriverConn.(*sqlite3.SQLiteConn)
+			if !ok {
+				return fmt.Errorf("unsupported backup destination connection: %T", destDriverConn)
+			}
+			srcSQLite, ok := srcDriverConn.(*sqlite3.SQLiteConn)
+			if !ok {
+				return fmt.Errorf("backups are only supported for SQLite databases")
+			}
+			backup, err := destSQLite.Backup("main", srcSQLite, "main")
+			if err != nil {
+				return err
+			}
+			for {
+				// Copying everything in one step keeps the source
+				// locked for reading only. In WAL mode writers can
+				// continue in the meantime.
+				done, err := backup.Step(-1)
+				if err != nil {
+					backup.Finish()
+					return err
+				}
+				if done {
+					break
+				}
+				select {
+				case <-ctx.Done():
+					backup.Finish()
+					return ctx.Err()
+				case <-time.After(100 * time.Millisecond):
+				}
+			}
+			return backup.Finish()
+		})
+	})
+}
+
+// RestoreSQLite replaces the SQLite database at path with the backup
+// at src. The backup is checked for integrity and migrated to the
+// latest schema version on a temporary copy first, so that the
+// database at path is only touched if the backup can actually be
+// used. Backups created by a newer version of webmentiond are
+// rejected. The previous database is kept as path.pre-restore.
+//
+// The database must not be in use while it is restored.
+func RestoreSQLite(ctx context.Context, src string, path string, migrationsFolder string) error {
+	if _, err := os.Stat(src); err != nil {
+		return err
+	}
+	srcDB, err := sql.Open(DatabaseDriverSQLite, sqliteDSN(src, url.Values{"mode": []string{"ro"}}))
+	if err != nil {
+		return err
+	}
+	defer srcDB.Close()
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.restore")
+	if err != nil {
+		return err
+	}
+	tmp.Close()
+	tmpPath := tmp.Name()
+	defer os.Remove(tmpPath)
+	if err := backupSQLite(ctx, srcDB, tmpPath); err != nil {
+		return fmt.Errorf("%w: %s", ErrInvalidBackup, err.Error())
+	}
+	if err := prepareRestore(ctx, tmpPath, migrationsFolder); err != nil {
+		return err
+	}
+	if _, err := os.Stat(path); err == nil {
+		if err := checkpointSQLite(ctx, path); err != nil {
+			return fmt.Errorf("failed to checkpoint %s: %w", path, err)
+		}
+		if err := os.Rename(path, path+".pre-restore"); err != nil {
+			return err
+		}
+	}
+	// The WAL of the previous database must not be applied to the
+	// restored one. Anything left after the checkpoint belongs to the
+	// previous database:
+	for _, suffix := range []string{"-wal", "-shm"} {
+		if err := os.Rename(path+suffix, path+".pre-restore"+suffix); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+	return os.Rename(tmpPath, path)
+}
+
+// checkpointSQLite moves all transactions from the WAL of the database
+// at path into the database file itself.
+func checkpointSQLite(ctx context.Context, path string) error {
+	db, err := sql.Open(DatabaseDriverSQLite, sqliteDSN(path, url.Values{}))
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	var busy, log, checkpointed int
+	if err := db.QueryRowContext(ctx, "PRAGMA wal_checkpoint(TRUNCATE)").Scan(&busy, &log, &checkpointed); err != nil {
+		return err
+	}
+	if busy != 0 {
+		return fmt.Errorf("database is in use")
+	}
+	return db.Close()
+}
+
+// prepareRestore validates the database at path and migrates it to
+// the latest version.
+func prepareRestore(ctx context.Context, path string, migrationsFolder string) error {
+	db, err := sql.Open(DatabaseDriverSQLite, path)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	var integrity string
+	if err := db.QueryRowContext(ctx, "PRAGMA integrity_check").Scan(&integrity); err != nil {
+		return fmt.Errorf("%w: %s", ErrInvalidBackup, err.Error())
+	}
+	if integrity != "ok" {
+		return fmt.Errorf("%w: integrity check failed: %s", ErrInvalidBackup, integrity)
+	}
+	latest, err := latestMigration(DatabaseDriverSQLite, migrationsFolder)
+	if err != nil {
+		return err
+	}
+	m, err := newMigrate(db, DatabaseDriverSQLite, migrationsFolder)
+	if err != nil {
+		return err
+	}
+	version, dirty, err := m.Version()
+	if errors.Is(err, migrate.ErrNilVersion) {
+		return fmt.Errorf("%w: no schema version found", ErrInvalidBackup)
+	}
+	if err != nil {
+		return err
+	}
+	if dirty {
+		return fmt.Errorf("%w: a migration to schema version %d failed", ErrInvalidBackup, version)
+	}
+	if version > latest {
+		return fmt.Errorf("%w: schema version %d is newer than the latest supported version %d", ErrInvalidBackup, version, latest)
+	}
+	if err := m.Up(); err != nil && err != migrate.ErrNoChange {
+		return fmt.Errorf("%w: failed to migrate from schema version %d: %s", ErrInvalidBackup, version, err.Error())
+	}
+	_, err = ensureSQLiteSearchIndex(ctx, db)
+	return err
+}
+
+// latestMigration returns the highest version available in the
+// migrations for the given driver.
+func latestMigration(driverName string, migrationsFolder string) (uint, error) {
+	src, err := openMigrationSource(driverName, migrationsFolder)
+	if err != nil {
+		return 0, err
+	}
+	defer src.Close()
+	version, err := src.First()
+	if err != nil {
+		return 0, err
+	}
+	for {
+		next, err := src.Next(version)
+		if errors.Is(err, os.ErrNotExist) {
+			return version, nil
+		}
+		if err != nil {
+			return 0, err
+		}
+		version = next
+	}
+}
+
+// StartBackups periodically writes a snapshot of the SQLite database
+// into the configured backup folder. It does nothing if no folder is
+// configured.
+func (srv *Server) StartBackups(ctx context.Context) {
+	if srv.cfg.Backup.Dir == "" {
+		return
+	}
+	logger := zerolog.Ctx(ctx)
+	interval := srv.cfg.Backup.Interval
+	if interval <= 0 {
+		interval = DefaultBackupInterval
+	}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if path, err := srv.Snapshot(ctx); err != nil {
+					backupFailures.Inc()
+					logger.Error().Err(err).Msg("Failed to create backup")
+				} else {
+					logger.Info().Msgf("Created backup %s", path)
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+// Snapshot writes a backup of the SQLite database into the configured
+// backup folder and removes the oldest snapshots beyond the configured
+// retention count. It returns the path of the new snapshot.
+func (srv *Server) Snapshot(ctx context.Context) (string, error) {
+	if srv.cfg.DatabaseDriver != DatabaseDriverSQLite || srv.cfg.Database == nil {
+		return "", fmt.Errorf("backups are only supported for SQLite databases")
+	}
+	dir := srv.cfg.Backup.Dir
+	if dir == "" {
+		return "", fmt.Errorf("no backup folder configured")
+	}
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return "", err
+	}
+	db := srv.cfg.Database
+	if srv.cfg.ReadDatabase != nil {
+		db = srv.cfg.ReadDatabase
+	}
+	path := filepath.Join(dir, snapshotPrefix+time.Now().UTC().Format(snapshotTimeFormat)+snapshotSuffix)
+	if err := BackupSQLite(ctx, db, path); err != nil {
+		return "", err
+	}
+	backupLastSuccess.SetToCurrentTime()
+	retain := srv.cfg.Backup.Retain
+	if retain <= 0 {
+		retain = DefaultBackupRetain
+	}
+	if err := pruneSnapshots(dir, retain); err != nil {
+		return path, fmt.Errorf("failed to remove old backups: %w", err)
+	}
+	return path, nil
+}
+
+// pruneSnapshots removes all but the newest retain snapshots in dir.
+// Other files are left alone.
+func pruneSnapshots(dir string, retain int) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	snapshots := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.Type().IsRegular() && strings.HasPrefix(name, snapshotPrefix) && strings.HasSuffix(name, snapshotSuffix) {
+			snapshots = append(snapshots, name)
+		}
+	}
+	if len(snapshots) <= retain {
+		return nil
+	}
+	// The timestamps in the names sort chronologically:
+	sort.Strings(snapshots)
+	for _, name := range snapshots[:len(snapshots)-retain] {
+		if err := os.Remove(filepath.Join(dir, name)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
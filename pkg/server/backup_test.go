@@ -0,0 +1,174 @@
+package server_test
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/zerok/webmentiond/pkg/server"
+)
+
+func openMigratedSQLite(t *testing.T, path string) *server.SQLiteDatabase {
+	t.Helper()
+	db, err := server.OpenSQLite(path, server.SQLiteOptions{})
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+	srv := server.New(func(c *server.Configuration) {
+		c.Database = db.Writer
+	})
+	require.NoError(t, srv.MigrateDatabase(context.Background()))
+	return db
+}
+
+func TestBackupSQLite(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	db := openMigratedSQLite(t, filepath.Join(dir, "webmentiond.sqlite"))
+	store := db.Store()
+	for i := 0; i < 50; i++ {
+		require.NoError(t, store.CreateMention(ctx, server.Mention{ID: fmt.Sprintf("m%d", i), Source: fmt.Sprintf("https://source.com/%d", i), Target: "https://target.com/", CreatedAt: "2024-01-01T00:00:00Z", Status: server.MentionStatusNew}))
+	}
+
+	// Writes continue while the backup is created:
+	var wg sync.WaitGroup
+	var writeErr error
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 50; i < 100 && writeErr == nil; i++ {
+			writeErr = store.CreateMention(ctx, server.Mention{ID: fmt.Sprintf("m%d", i), Source: fmt.Sprintf("https://source.com/%d", i), Target: "https://target.com/", CreatedAt: "2024-01-01T00:00:00Z", Status: server.MentionStatusNew})
+		}
+	}()
+	dest := filepath.Join(dir, "backup.sqlite")
+	require.NoError(t, server.BackupSQLite(ctx, db.Reader, dest))
+	wg.Wait()
+	require.NoError(t, writeErr)
+
+	backup := openMigratedSQLite(t, dest)
+	var integrity string
+	require.NoError(t, backup.Reader.QueryRow("PRAGMA integrity_check").Scan(&integrity))
+	require.Equal(t, "ok", integrity)
+	count, err := backup.Store().CountMentions(ctx, server.MentionFilter{})
+	require.NoError(t, err)
+	require.GreaterOrEqual(t, count, 50)
+	matches, err := filepath.Glob(filepath.Join(dir, "*.tmp"))
+	require.NoError(t, err)
+	require.Empty(t, matches)
+}
+
+func TestSnapshot(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	backupDir := filepath.Join(dir, "backups")
+	db := openMigratedSQLite(t, filepath.Join(dir, "webmentiond.sqlite"))
+	srv := server.New(func(c *server.Configuration) {
+		c.Database = db.Writer
+		c.ReadDatabase = db.Reader
+		c.Backup.Dir = backupDir
+		c.Backup.Retain = 2
+	})
+	require.NoError(t, os.MkdirAll(backupDir, 0o700))
+	require.NoError(t, os.WriteFile(filepath.Join(backupDir, "unrelated.txt"), nil, 0o600))
+
+	paths := []string{}
+	for i := 0; i < 3; i++ {
+		path, err := srv.Snapshot(ctx)
+		require.NoError(t, err)
+		require.FileExists(t, path)
+		paths = append(paths, path)
+	}
+	entries, err := os.ReadDir(backupDir)
+	require.NoError(t, err)
+	require.Len(t, entries, 3)
+	require.NoFileExists(t, paths[0])
+	require.FileExists(t, paths[1])
+	require.FileExists(t, paths[2])
+	require.FileExists(t, filepath.Join(backupDir, "unrelated.txt"))
+
+	pg := server.New(func(c *server.Configuration) {
+		c.Database = db.Writer
+		c.DatabaseDriver = server.DatabaseDriverPostgres
+		c.Backup.Dir = backupDir
+	})
+	_, err = pg.Snapshot(ctx)
+	require.Error(t, err)
+}
+
+func TestRestoreSQLite(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	path := filepath.Join(dir, "webmentiond.sqlite")
+	backupPath := filepath.Join(dir, "backup.sqlite")
+	func() {
+		db := openMigratedSQLite(t, path)
+		require.NoError(t, db.Store().CreateMention(ctx, server.Mention{ID: "a", Source: "https://source.com/", Target: "https://target.com/", CreatedAt: "2024-01-01T00:00:00Z", Status: server.MentionStatusApproved}))
+		require.NoError(t, server.BackupSQLite(ctx, db.Reader, backupPath))
+		require.NoError(t, db.Store().TrashMention(ctx, "a", ""))
+		require.NoError(t, db.Close())
+	}()
+
+	require.NoError(t, server.RestoreSQLite(ctx, backupPath, path, ""))
+	require.FileExists(t, path+".pre-restore")
+	db := openMigratedSQLite(t, path)
+	m, err := db.Store().GetMention(ctx, "a")
+	require.NoError(t, err)
+	require.Equal(t, server.MentionStatusApproved, m.Status)
+	require.NoError(t, db.Close())
+
+	// Backups of unknown or newer schema versions are rejected:
+	newer := openMigratedSQLite(t, filepath.Join(dir, "newer.sqlite"))
+	_, err = newer.Writer.Exec("UPDATE schema_migrations SET version = 9999")
+	require.NoError(t, err)
+	require.NoError(t, newer.Close())
+	require.ErrorIs(t, server.RestoreSQLite(ctx, filepath.Join(dir, "newer.sqlite"), path, ""), server.ErrInvalidBackup)
+
+	empty := filepath.Join(dir, "empty.sqlite")
+	emptyDB, err := server.OpenSQLite(empty, server.SQLiteOptions{})
+	require.NoError(t, err)
+	require.NoError(t, emptyDB.Close())
+	require.ErrorIs(t, server.RestoreSQLite(ctx, empty, path, ""), server.ErrInvalidBackup)
+
+	garbage := filepath.Join(dir, "garbage.sqlite")
+	require.NoError(t, os.WriteFile(garbage, []byte("not a database, not at all, really not a database"), 0o600))
+	require.ErrorIs(t, server.RestoreSQLite(ctx, garbage, path, ""), server.ErrInvalidBackup)
+	require.Error(t, server.RestoreSQLite(ctx, filepath.Join(dir, "missing.sqlite"), path, ""))
+
+	// The failed attempts left the restored database alone:
+	db = openMigratedSQLite(t, path)
+	_, err = db.Store().GetMention(ctx, "a")
+	require.NoError(t, err)
+	require.NoError(t, db.Close())
+}
+
+func TestRestoreSQLiteKeepsWAL(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	path := filepath.Join(dir, "webmentiond.sqlite")
+	backupPath := filepath.Join(dir, "backup.sqlite")
+	crashedPath := filepath.Join(dir, "crashed.sqlite")
+	db := openMigratedSQLite(t, path)
+	require.NoError(t, server.BackupSQLite(ctx, db.Reader, backupPath))
+	_, err := db.Writer.Exec("PRAGMA wal_autocheckpoint = 0")
+	require.NoError(t, err)
+	require.NoError(t, db.Store().CreateMention(ctx, server.Mention{ID: "a", Source: "https://source.com/", Target: "https://target.com/", CreatedAt: "2024-01-01T00:00:00Z", Status: server.MentionStatusApproved}))
+	// Copying the files while the database is open leaves the mention
+	// only inside the WAL like after a crash:
+	for _, suffix := range []string{"", "-wal"} {
+		data, err := os.ReadFile(path + suffix)
+		require.NoError(t, err)
+		require.NoError(t, os.WriteFile(crashedPath+suffix, data, 0o600))
+	}
+	require.NoError(t, db.Close())
+
+	require.NoError(t, server.RestoreSQLite(ctx, backupPath, crashedPath, ""))
+	previous := openMigratedSQLite(t, crashedPath+".pre-restore")
+	_, err = previous.Store().GetMention(ctx, "a")
+	require.NoError(t, err)
+	restored := openMigratedSQLite(t, crashedPath)
+	_, err = restored.Store().GetMention(ctx, "a")
+	require.ErrorIs(t, err, server.ErrMentionNotFound)
+}
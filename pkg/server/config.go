@@ -43,7 +43,48 @@ type ReceiverConfiguration struct {
 	TargetPolicy RequestPolicy
 }
 
-type SenderConfiguration struct{}
+type SenderConfiguration struct {
+	// Feeds is a list of RSS, Atom, JSON Feed or h-feed URLs that should
+	// be polled for new entries.
+	Feeds            []string
+	FeedPollInterval time.Duration
+	// FeedBackfill sends mentions for all entries found when a feed is
+	// polled for the first time. Otherwise, only entries that are added
+	// or updated afterwards are sent.
+	FeedBackfill bool
+	// EntryOnly restricts sending to links inside the h-entry of a
+	// source.
+	EntryOnly bool
+	// ExcludeHosts lists hosts that never receive a mention.
+	ExcludeHosts []string
+}
+
+// BackupConfiguration controls the snapshots of a SQLite database
+// created by StartBackups.
+type BackupConfiguration struct {
+	// Dir is the folder snapshots are written to. Backups are disabled
+	// if it is empty.
+	Dir string
+	// Interval defaults to DefaultBackupInterval.
+	Interval time.Duration
+	// Retain is the number of snapshots to keep. Defaults to
+	// DefaultBackupRetain.
+	Retain int
+}
+
+// RetentionConfiguration controls how long mentions are kept depending
+// on their status. See Server.PruneMentions.
+type RetentionConfiguration struct {
+	// Periods maps a mention status to how long mentions with that
+	// status are kept. Mentions with other statuses are kept forever.
+	Periods map[string]time.Duration
+	// Interval in which the janitor started by StartJanitor prunes
+	// mentions. Defaults to DefaultJanitorInterval.
+	Interval time.Duration
+	// Trash is how long deleted mentions are kept in the trash before
+	// they are purged. They are kept until purged manually if it is 0.
+	Trash time.Duration
+}
 
 type StaticAccessKey struct {
 	Key  string
@@ -60,11 +101,26 @@ type AuthConfiguration struct {
 }
 
 type Configuration struct {
-	Context                     context.Context
-	Database                    *sql.DB
+	Context context.Context
+	// Database is used by MigrateDatabase and as default backend for
+	// all stores that are not configured explicitly.
+	Database *sql.DB
+	// ReadDatabase is an optional read-only pool for Database that the
+	// default store uses for queries. See OpenSQLite.
+	ReadDatabase *sql.DB
+	// DatabaseDriver is either "sqlite3" (default) or "postgres".
+	DatabaseDriver string
+	MentionStore   MentionStore
+	PolicyStore    PolicyStore
+	SendStore      SendStore
+	AuditStore     AuditStore
+	// MigrationsFolder contains the SQLite migrations and a postgres
+	// subfolder with those for PostgreSQL.
 	MigrationsFolder            string
 	Receiver                    ReceiverConfiguration
 	Sender                      SenderConfiguration
+	Backup                      BackupConfiguration
+	Retention                   RetentionConfiguration
 	Auth                        AuthConfiguration
 	MailFrom                    string
 	Mailer                      mailer.Mailer
@@ -77,6 +133,18 @@ type Configuration struct {
 	Policies                    *policies.Registry
 	PolicyLoader                policies.Loader
 	ExposeMetrics               bool
+	// GetCacheSize is the number of targets whose /get response is
+	// kept in memory. Defaults to DefaultGetCacheSize, a negative value
+	// disables the cache.
+	GetCacheSize int
+	// GetCacheTTL is how long a /get response is cached at most so that
+	// changes made by other processes eventually show up. Defaults to
+	// DefaultGetCacheTTL.
+	GetCacheTTL time.Duration
+	// GetMaxAge is announced to clients through the Cache-Control
+	// header of /get responses. With the default of 0, clients have to
+	// revalidate their copy on every request.
+	GetMaxAge time.Duration
 }
 
 type Configurator func(c *Configuration)
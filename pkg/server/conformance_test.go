@@ -21,30 +21,27 @@ type conformanceEnvironment struct {
 	Logger zerolog.Logger
 	Ctx    context.Context
 	DB     *sql.DB
+	Store  server.MentionStore
 	Srv    *server.Server
 }
 
-func (e *conformanceEnvironment) Destroy() {
-	e.DB.Close()
-}
+// Destroy is kept for symmetry; the database is closed by a test cleanup.
+func (e *conformanceEnvironment) Destroy() {}
 
-func createConformanceEnvironment(t *testing.T) *conformanceEnvironment {
+func createConformanceEnvironment(t *testing.T, backend testBackend) *conformanceEnvironment {
 	t.Helper()
 	logger := zerolog.New(zerolog.ConsoleWriter{Out: os.Stderr}).Level(zerolog.DebugLevel)
 	ctx := logger.WithContext(context.Background())
-	db, err := sql.Open("sqlite3", "file:test.db?cache=shared&mode=memory")
-	require.NoError(t, err)
-	require.NotNil(t, db)
-	srv := server.New(func(c *server.Configuration) {
+	db, srv := setupBackend(t, backend, func(c *server.Configuration) {
 		c.Context = ctx
-		c.Database = db
-		c.MigrationsFolder = "./migrations"
 		c.Receiver.TargetPolicy = server.RequestPolicyAllowHost("allowed.com")
 		c.VerificationMaxRedirects = 1
 	})
-	require.NoError(t, srv.MigrateDatabase(ctx))
+	store, err := server.NewSQLStore(db, backend.Driver)
+	require.NoError(t, err)
 	e := conformanceEnvironment{
 		DB:     db,
+		Store:  store,
 		Srv:    srv,
 		Logger: logger,
 		Ctx:    ctx,
@@ -70,15 +67,23 @@ func (e *conformanceEnvironment) VerifyNextMention(t *testing.T) {
 }
 
 func TestConformance(t *testing.T) {
+	for _, backend := range testBackends {
+		t.Run(backend.Name, func(t *testing.T) {
+			testConformance(t, backend)
+		})
+	}
+}
+
+func testConformance(t *testing.T, backend testBackend) {
 	t.Run("request-verification/url-validation", func(t *testing.T) {
-		e := createConformanceEnvironment(t)
+		e := createConformanceEnvironment(t, backend)
 		defer e.Destroy()
 		w := e.SendMention("<>", "https://allowed.com")
 		require.Equal(t, http.StatusBadRequest, w.Code)
 	})
 
 	t.Run("request-verification/allowed-target", func(t *testing.T) {
-		e := createConformanceEnvironment(t)
+		e := createConformanceEnvironment(t, backend)
 		defer e.Destroy()
 		w := e.SendMention("https://source.com", "https://allowed.com")
 		require.Equal(t, http.StatusAccepted, w.Code)
@@ -88,7 +93,7 @@ func TestConformance(t *testing.T) {
 	})
 
 	t.Run("request-verification/allowed-target-ignore-fragment", func(t *testing.T) {
-		e := createConformanceEnvironment(t)
+		e := createConformanceEnvironment(t, backend)
 		defer e.Destroy()
 		w := e.SendMention("https://source.com", "https://allowed.com/#fragment")
 		require.Equal(t, http.StatusAccepted, w.Code)
@@ -102,7 +107,7 @@ func TestConformance(t *testing.T) {
 	})
 
 	t.Run("webmention-validation/follow-at-least-one-redirect", func(t *testing.T) {
-		e := createConformanceEnvironment(t)
+		e := createConformanceEnvironment(t, backend)
 		defer e.Destroy()
 		mux := chi.NewRouter()
 		mux.Get("/actual", func(w http.ResponseWriter, r *http.Request) {
@@ -115,13 +120,13 @@ func TestConformance(t *testing.T) {
 		})
 		src := httptest.NewServer(mux)
 		e.SendMention(src.URL+"/redirect", "https://allowed.com/")
-		requireMentionWithStatus(t, e.Ctx, e.DB, "https://allowed.com/", "new")
+		requireMentionWithStatus(t, e.Ctx, e.Store, "https://allowed.com/", "new")
 		e.VerifyNextMention(t)
-		requireMentionWithStatus(t, e.Ctx, e.DB, "https://allowed.com/", "verified")
+		requireMentionWithStatus(t, e.Ctx, e.Store, "https://allowed.com/", "verified")
 	})
 
 	t.Run("webmention-validation/stop-after-n-redirects", func(t *testing.T) {
-		e := createConformanceEnvironment(t)
+		e := createConformanceEnvironment(t, backend)
 		defer e.Destroy()
 		mux := chi.NewRouter()
 		mux.Get("/actual", func(w http.ResponseWriter, r *http.Request) {
@@ -138,13 +143,13 @@ func TestConformance(t *testing.T) {
 		})
 		src := httptest.NewServer(mux)
 		e.SendMention(src.URL+"/redirect-2", "https://allowed.com/")
-		requireMentionWithStatus(t, e.Ctx, e.DB, "https://allowed.com/", "new")
+		requireMentionWithStatus(t, e.Ctx, e.Store, "https://allowed.com/", "new")
 		e.VerifyNextMention(t)
-		requireMentionWithStatus(t, e.Ctx, e.DB, "https://allowed.com/", server.MentionStatusInvalid)
+		requireMentionWithStatus(t, e.Ctx, e.Store, "https://allowed.com/", server.MentionStatusInvalid)
 	})
 
 	t.Run("html-verification/reject-text", func(t *testing.T) {
-		e := createConformanceEnvironment(t)
+		e := createConformanceEnvironment(t, backend)
 		defer e.Destroy()
 		mux := chi.NewRouter()
 		mux.Get("/actual", func(w http.ResponseWriter, r *http.Request) {
@@ -152,13 +157,13 @@ func TestConformance(t *testing.T) {
 		})
 		src := httptest.NewServer(mux)
 		e.SendMention(src.URL+"/actual", "https://allowed.com/")
-		requireMentionWithStatus(t, e.Ctx, e.DB, "https://allowed.com/", "new")
+		requireMentionWithStatus(t, e.Ctx, e.Store, "https://allowed.com/", "new")
 		e.VerifyNextMention(t)
-		requireMentionWithStatus(t, e.Ctx, e.DB, "https://allowed.com/", server.MentionStatusInvalid)
+		requireMentionWithStatus(t, e.Ctx, e.Store, "https://allowed.com/", server.MentionStatusInvalid)
 	})
 
 	t.Run("html-verification/link-in-video", func(t *testing.T) {
-		e := createConformanceEnvironment(t)
+		e := createConformanceEnvironment(t, backend)
 		defer e.Destroy()
 		mux := chi.NewRouter()
 		mux.Get("/actual", func(w http.ResponseWriter, r *http.Request) {
@@ -166,13 +171,13 @@ func TestConformance(t *testing.T) {
 		})
 		src := httptest.NewServer(mux)
 		e.SendMention(src.URL+"/actual", "https://allowed.com/")
-		requireMentionWithStatus(t, e.Ctx, e.DB, "https://allowed.com/", "new")
+		requireMentionWithStatus(t, e.Ctx, e.Store, "https://allowed.com/", "new")
 		e.VerifyNextMention(t)
-		requireMentionWithStatus(t, e.Ctx, e.DB, "https://allowed.com/", server.MentionStatusVerified)
+		requireMentionWithStatus(t, e.Ctx, e.Store, "https://allowed.com/", server.MentionStatusVerified)
 	})
 
 	t.Run("html-verification/link-in-audio", func(t *testing.T) {
-		e := createConformanceEnvironment(t)
+		e := createConformanceEnvironment(t, backend)
 		defer e.Destroy()
 		mux := chi.NewRouter()
 		mux.Get("/actual", func(w http.ResponseWriter, r *http.Request) {
@@ -180,13 +185,13 @@ func TestConformance(t *testing.T) {
 		})
 		src := httptest.NewServer(mux)
 		e.SendMention(src.URL+"/actual", "https://allowed.com/")
-		requireMentionWithStatus(t, e.Ctx, e.DB, "https://allowed.com/", "new")
+		requireMentionWithStatus(t, e.Ctx, e.Store, "https://allowed.com/", "new")
 		e.VerifyNextMention(t)
-		requireMentionWithStatus(t, e.Ctx, e.DB, "https://allowed.com/", server.MentionStatusVerified)
+		requireMentionWithStatus(t, e.Ctx, e.Store, "https://allowed.com/", server.MentionStatusVerified)
 	})
 
 	t.Run("html-verification/reject-link-in-comment", func(t *testing.T) {
-		e := createConformanceEnvironment(t)
+		e := createConformanceEnvironment(t, backend)
 		defer e.Destroy()
 		mux := chi.NewRouter()
 		mux.Get("/actual", func(w http.ResponseWriter, r *http.Request) {
@@ -194,13 +199,13 @@ func TestConformance(t *testing.T) {
 		})
 		src := httptest.NewServer(mux)
 		e.SendMention(src.URL+"/actual", "https://allowed.com/")
-		requireMentionWithStatus(t, e.Ctx, e.DB, "https://allowed.com/", "new")
+		requireMentionWithStatus(t, e.Ctx, e.Store, "https://allowed.com/", "new")
 		e.VerifyNextMention(t)
-		requireMentionWithStatus(t, e.Ctx, e.DB, "https://allowed.com/", server.MentionStatusInvalid)
+		requireMentionWithStatus(t, e.Ctx, e.Store, "https://allowed.com/", server.MentionStatusInvalid)
 	})
 
 	t.Run("html-verification/link-in-img", func(t *testing.T) {
-		e := createConformanceEnvironment(t)
+		e := createConformanceEnvironment(t, backend)
 		defer e.Destroy()
 		mux := chi.NewRouter()
 		mux.Get("/actual", func(w http.ResponseWriter, r *http.Request) {
@@ -208,13 +213,13 @@ func TestConformance(t *testing.T) {
 		})
 		src := httptest.NewServer(mux)
 		e.SendMention(src.URL+"/actual", "https://allowed.com/")
-		requireMentionWithStatus(t, e.Ctx, e.DB, "https://allowed.com/", "new")
+		requireMentionWithStatus(t, e.Ctx, e.Store, "https://allowed.com/", "new")
 		e.VerifyNextMention(t)
-		requireMentionWithStatus(t, e.Ctx, e.DB, "https://allowed.com/", server.MentionStatusVerified)
+		requireMentionWithStatus(t, e.Ctx, e.Store, "https://allowed.com/", server.MentionStatusVerified)
 	})
 
 	t.Run("update-tests/remove-if-link-missing", func(t *testing.T) {
-		e := createConformanceEnvironment(t)
+		e := createConformanceEnvironment(t, backend)
 		defer e.Destroy()
 		mux := chi.NewRouter()
 		isPresent := true
@@ -227,19 +232,19 @@ func TestConformance(t *testing.T) {
 		})
 		src := httptest.NewServer(mux)
 		e.SendMention(src.URL+"/actual", "https://allowed.com/")
-		requireMentionWithStatus(t, e.Ctx, e.DB, "https://allowed.com/", "new")
+		requireMentionWithStatus(t, e.Ctx, e.Store, "https://allowed.com/", "new")
 		e.VerifyNextMention(t)
-		requireMentionWithStatus(t, e.Ctx, e.DB, "https://allowed.com/", server.MentionStatusVerified)
+		requireMentionWithStatus(t, e.Ctx, e.Store, "https://allowed.com/", server.MentionStatusVerified)
 
 		isPresent = false
 		e.SendMention(src.URL+"/actual", "https://allowed.com/")
-		requireMentionWithStatus(t, e.Ctx, e.DB, "https://allowed.com/", "new")
+		requireMentionWithStatus(t, e.Ctx, e.Store, "https://allowed.com/", "new")
 		e.VerifyNextMention(t)
-		requireMentionWithStatus(t, e.Ctx, e.DB, "https://allowed.com/", server.MentionStatusInvalid)
+		requireMentionWithStatus(t, e.Ctx, e.Store, "https://allowed.com/", server.MentionStatusInvalid)
 	})
 
 	t.Run("update-tests/recognize-410", func(t *testing.T) {
-		e := createConformanceEnvironment(t)
+		e := createConformanceEnvironment(t, backend)
 		defer e.Destroy()
 		mux := chi.NewRouter()
 		isPresent := true
@@ -252,14 +257,14 @@ func TestConformance(t *testing.T) {
 		})
 		src := httptest.NewServer(mux)
 		e.SendMention(src.URL+"/actual", "https://allowed.com/")
-		requireMentionWithStatus(t, e.Ctx, e.DB, "https://allowed.com/", "new")
+		requireMentionWithStatus(t, e.Ctx, e.Store, "https://allowed.com/", "new")
 		e.VerifyNextMention(t)
-		requireMentionWithStatus(t, e.Ctx, e.DB, "https://allowed.com/", server.MentionStatusVerified)
+		requireMentionWithStatus(t, e.Ctx, e.Store, "https://allowed.com/", server.MentionStatusVerified)
 
 		isPresent = false
 		e.SendMention(src.URL+"/actual", "https://allowed.com/")
-		requireMentionWithStatus(t, e.Ctx, e.DB, "https://allowed.com/", "new")
+		requireMentionWithStatus(t, e.Ctx, e.Store, "https://allowed.com/", "new")
 		e.VerifyNextMention(t)
-		requireMentionWithStatus(t, e.Ctx, e.DB, "https://allowed.com/", server.MentionStatusInvalid)
+		requireMentionWithStatus(t, e.Ctx, e.Store, "https://allowed.com/", server.MentionStatusInvalid)
 	})
 }
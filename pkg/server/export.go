@@ -0,0 +1,576 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"reflect"
+	"regexp"
+	"time"
+
+	"github.com/rs/xid"
+	"github.com/zerok/webmentiond/pkg/policies"
+)
+
+// ExportFormatVersion is increased whenever the export format changes
+// in a way that older versions cannot import. Version 2 added mentions
+// in the trash, which older versions would have restored.
+const ExportFormatVersion = 2
+
+// ErrInvalidImport is returned by Import if the document cannot be
+// imported. Nothing is written in that case.
+var ErrInvalidImport = errors.New("invalid import")
+
+// ExportDocument contains all mentions and URL policies of an instance.
+// It is a jf2 feed with one entry per mention. Properties that jf2 has
+// no equivalent for are prefixed with "wm-" if webmention.io uses them
+// as well and with "wmd-" otherwise.
+type ExportDocument struct {
+	Type     string        `json:"type"`
+	Name     string        `json:"name,omitempty"`
+	Version  int           `json:"wmd-version"`
+	Exported string        `json:"wmd-exported,omitempty"`
+	Children []ExportEntry `json:"children"`
+	Policies []policy      `json:"wmd-policies"`
+}
+
+// ExportEntry is a single mention as jf2 entry.
+type ExportEntry struct {
+	Type       string         `json:"type"`
+	ID         string         `json:"wmd-id,omitempty"`
+	Source     string         `json:"wm-source"`
+	Target     string         `json:"wm-target"`
+	Property   string         `json:"wm-property,omitempty"`
+	Received   string         `json:"wm-received,omitempty"`
+	Published  string         `json:"published,omitempty"`
+	URL        string         `json:"url,omitempty"`
+	Name       string         `json:"name,omitempty"`
+	Content    *ExportContent `json:"content,omitempty"`
+	Author     *ExportAuthor  `json:"author,omitempty"`
+	RSVP       string         `json:"rsvp,omitempty"`
+	Status     string         `json:"wmd-status,omitempty"`
+	VerifiedAt string         `json:"wmd-verified,omitempty"`
+	Protocol   string         `json:"wmd-protocol,omitempty"`
+	Origin     string         `json:"wmd-origin,omitempty"`
+	// Overrides are the values set by an admin. Name, content, author
+	// name and property are the values extracted from the source.
+	Overrides   *MentionOverrides `json:"wmd-overrides,omitempty"`
+	ModeratedAt string            `json:"wmd-moderated,omitempty"`
+	// DeletedAt and DeletedBy are set for mentions in the trash.
+	DeletedAt string `json:"wmd-deleted,omitempty"`
+	DeletedBy string `json:"wmd-deleted-by,omitempty"`
+	// PinnedRevision is the number of the pinned revision. Name,
+	// content, author name and property are its values in that case.
+	PinnedRevision int `json:"wmd-pinned-revision,omitempty"`
+	// Revisions start with the latest one.
+	Revisions []Revision `json:"wmd-revisions,omitempty"`
+}
+
+type ExportContent struct {
+	Text string `json:"text"`
+}
+
+type ExportAuthor struct {
+	Type  string `json:"type"`
+	Name  string `json:"name,omitempty"`
+	URL   string `json:"url,omitempty"`
+	Photo string `json:"photo,omitempty"`
+}
+
+// ImportOptions control how Import handles a document.
+type ImportOptions struct {
+	// DryRun only determines what would be changed.
+	DryRun bool
+	// KeepExisting leaves mentions with the same source and target as
+	// an imported one untouched instead of updating them.
+	KeepExisting bool
+}
+
+// ImportSummary describes the changes done (or planned in a dry run)
+// by Import.
+type ImportSummary struct {
+	DryRun            bool `json:"dry_run"`
+	Created           int  `json:"created"`
+	Updated           int  `json:"updated"`
+	Unchanged         int  `json:"unchanged"`
+	PoliciesCreated   int  `json:"policies_created"`
+	PoliciesUnchanged int  `json:"policies_unchanged"`
+	// Changes lists the created and updated mentions for the audit log.
+	Changes []AuditTarget `json:"-"`
+}
+
+// mentionProperties maps the mention types detected during
+// verification to the jf2 properties linking to the target.
+var mentionProperties = map[string]string{
+	"":         "mention-of",
+	"comment":  "in-reply-to",
+	"like":     "like-of",
+	"repost":   "repost-of",
+	"bookmark": "bookmark-of",
+	"rsvp":     "rsvp",
+}
+
+func mentionTypeForProperty(property string) string {
+	for typ, prop := range mentionProperties {
+		if prop == property {
+			return typ
+		}
+	}
+	return ""
+}
+
+func newExportEntry(m Mention) ExportEntry {
+	m = m.withoutOverrides()
+	e := ExportEntry{
+		Type:       "entry",
+		ID:         m.ID,
+		Source:     m.Source,
+		Target:     m.Target,
+		Property:   mentionProperties[m.Type],
+		Received:   m.CreatedAt,
+		Published:  m.PublishedAt,
+		URL:        m.Source,
+		Name:       m.Title,
+		RSVP:       m.RSVP,
+		Status:     m.Status,
+		VerifiedAt: m.VerifiedAt,
+		Protocol:   m.Protocol,
+		Origin:     m.Origin,
+
+		ModeratedAt:    m.ModeratedAt,
+		DeletedAt:      m.DeletedAt,
+		DeletedBy:      m.DeletedBy,
+		PinnedRevision: m.PinnedRevision,
+	}
+	if m.Overrides != nil && !m.Overrides.IsEmpty() {
+		o := *m.Overrides
+		e.Overrides = &o
+	}
+	if m.Content != "" {
+		e.Content = &ExportContent{Text: m.Content}
+	}
+	if m.AuthorName != "" || m.AuthorURL != "" || m.AuthorPhoto != "" {
+		e.Author = &ExportAuthor{Type: "card", Name: m.AuthorName, URL: m.AuthorURL, Photo: m.AuthorPhoto}
+	}
+	return e
+}
+
+// exportEntry returns the export entry of m including its revisions.
+func exportEntry(ctx context.Context, store MentionStore, m Mention) (ExportEntry, error) {
+	e := newExportEntry(m)
+	revisions, err := store.ListRevisions(ctx, m.ID)
+	if err != nil {
+		return e, err
+	}
+	e.setRevisions(revisions)
+	return e, nil
+}
+
+// setRevisions sets the revisions of e without the mention IDs, so that
+// entries can be compared.
+func (e *ExportEntry) setRevisions(revisions []Revision) {
+	e.Revisions = nil
+	for _, r := range revisions {
+		r.MentionID = ""
+		e.Revisions = append(e.Revisions, r)
+	}
+}
+
+// mention converts the entry back into a mention without an ID.
+func (e ExportEntry) mention() (Mention, error) {
+	m := Mention{
+		Source:         e.Source,
+		Target:         e.Target,
+		Status:         e.Status,
+		Title:          e.Name,
+		Type:           mentionTypeForProperty(e.Property),
+		RSVP:           e.RSVP,
+		Protocol:       e.Protocol,
+		Origin:         e.Origin,
+		DeletedBy:      e.DeletedBy,
+		PinnedRevision: e.PinnedRevision,
+	}
+	for _, u := range []string{e.Source, e.Target} {
+		parsed, err := url.Parse(u)
+		if err != nil || !parsed.IsAbs() {
+			return m, fmt.Errorf("invalid URL: %q", u)
+		}
+	}
+	switch m.Status {
+	case "":
+		m.Status = MentionStatusNew
+	case MentionStatusNew, MentionStatusVerified, MentionStatusApproved, MentionStatusRejected, MentionStatusInvalid:
+	default:
+		return m, fmt.Errorf("unsupported status: %s", m.Status)
+	}
+	if m.Origin != "" && m.Origin != MentionOriginManual {
+		return m, fmt.Errorf("unsupported origin: %s", m.Origin)
+	}
+	if m.Protocol == "" {
+		m.Protocol = "webmention"
+	}
+	if e.Overrides != nil && !e.Overrides.IsEmpty() {
+		o := *e.Overrides
+		m.Overrides = &o
+	}
+	if e.Content != nil {
+		m.Content = e.Content.Text
+	}
+	if e.Author != nil {
+		m.AuthorName = e.Author.Name
+		m.AuthorURL = e.Author.URL
+		m.AuthorPhoto = e.Author.Photo
+	}
+	var err error
+	if m.CreatedAt, err = normalizeTimestamp(e.Received, time.Now()); err != nil {
+		return m, err
+	}
+	if m.VerifiedAt, err = normalizeTimestamp(e.VerifiedAt, time.Time{}); err != nil {
+		return m, err
+	}
+	if m.PublishedAt, err = normalizeTimestamp(e.Published, time.Time{}); err != nil {
+		return m, err
+	}
+	if m.ModeratedAt, err = normalizeTimestamp(e.ModeratedAt, time.Time{}); err != nil {
+		return m, err
+	}
+	if m.DeletedAt, err = normalizeTimestamp(e.DeletedAt, time.Time{}); err != nil {
+		return m, err
+	}
+	if m.DeletedAt == "" && m.DeletedBy != "" {
+		return m, fmt.Errorf("wmd-deleted-by requires wmd-deleted")
+	}
+	return m, nil
+}
+
+// revisions validates the revisions of e and returns them with
+// normalized timestamps.
+func (e ExportEntry) revisions() ([]Revision, error) {
+	result := make([]Revision, 0, len(e.Revisions))
+	numbers := make(map[int]bool, len(e.Revisions))
+	for _, r := range e.Revisions {
+		if r.Number < 1 || numbers[r.Number] {
+			return nil, fmt.Errorf("invalid revision number: %d", r.Number)
+		}
+		numbers[r.Number] = true
+		var err error
+		if r.CreatedAt, err = normalizeTimestamp(r.CreatedAt, time.Time{}); err != nil {
+			return nil, err
+		}
+		r.MentionID = ""
+		result = append(result, r)
+	}
+	if e.PinnedRevision != 0 && !numbers[e.PinnedRevision] {
+		return nil, fmt.Errorf("pinned revision %d is missing", e.PinnedRevision)
+	}
+	return result, nil
+}
+
+// normalizeTimestamp converts an RFC3339 timestamp into the format used
+// for storing it. Empty values are replaced by fallback.
+func normalizeTimestamp(value string, fallback time.Time) (string, error) {
+	if value == "" {
+		return formatTimestamp(fallback), nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return "", fmt.Errorf("invalid timestamp: %w", err)
+	}
+	return formatTimestamp(t), nil
+}
+
+// Export collects all mentions and policies from the given stores.
+func Export(ctx context.Context, mentions MentionStore, pols PolicyStore) (*ExportDocument, error) {
+	doc := &ExportDocument{
+		Type:     "feed",
+		Name:     "webmentiond export",
+		Version:  ExportFormatVersion,
+		Exported: formatTimestamp(time.Now()),
+		Children: make([]ExportEntry, 0, 10),
+		Policies: make([]policy, 0, 10),
+	}
+	for _, trashed := range []bool{false, true} {
+		all, err := mentions.ListMentions(ctx, MentionFilter{OldestFirst: true, Trashed: trashed})
+		if err != nil {
+			return nil, err
+		}
+		for _, m := range all {
+			e, err := exportEntry(ctx, mentions, m)
+			if err != nil {
+				return nil, err
+			}
+			doc.Children = append(doc.Children, e)
+		}
+	}
+	loaded, err := pols.Load(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range loaded {
+		doc.Policies = append(doc.Policies, policy{
+			ID:         p.ID,
+			URLPattern: p.URLPattern.String(),
+			Weight:     p.Weight,
+			Policy:     string(p.Policy),
+		})
+	}
+	return doc, nil
+}
+
+// Import adds the mentions and policies of doc to the given stores.
+// Mentions with the same source and target as an existing one replace
+// it, even if that one is in the trash. The revisions of a mention are
+// only replaced if the entry has any. Policies that exist already are
+// skipped. The whole document is validated before anything is
+// written.
+func Import(ctx context.Context, mentions MentionStore, pols PolicyStore, doc *ExportDocument, opts ImportOptions) (*ImportSummary, error) {
+	if doc.Type != "feed" {
+		return nil, fmt.Errorf("%w: unsupported type %q", ErrInvalidImport, doc.Type)
+	}
+	if doc.Version > ExportFormatVersion {
+		return nil, fmt.Errorf("%w: unsupported version %d", ErrInvalidImport, doc.Version)
+	}
+	imported := make([]importedMention, 0, len(doc.Children))
+	for idx, e := range doc.Children {
+		m, err := e.mention()
+		if err != nil {
+			return nil, fmt.Errorf("%w: entry %d: %s", ErrInvalidImport, idx, err)
+		}
+		revisions, err := e.revisions()
+		if err != nil {
+			return nil, fmt.Errorf("%w: entry %d: %s", ErrInvalidImport, idx, err)
+		}
+		m.ID = e.ID
+		imported = append(imported, importedMention{mention: m, revisions: revisions})
+	}
+	importedPolicies := make([]policies.URLPolicy, 0, len(doc.Policies))
+	for idx, p := range doc.Policies {
+		pattern, err := regexp.Compile(p.URLPattern)
+		if err != nil {
+			return nil, fmt.Errorf("%w: policy %d: %s", ErrInvalidImport, idx, err)
+		}
+		if p.Policy != string(policies.APPROVE) {
+			return nil, fmt.Errorf("%w: policy %d: unsupported policy %q", ErrInvalidImport, idx, p.Policy)
+		}
+		importedPolicies = append(importedPolicies, policies.URLPolicy{
+			URLPattern: pattern,
+			Policy:     policies.Policy(p.Policy),
+			Weight:     p.Weight,
+		})
+	}
+
+	summary := &ImportSummary{DryRun: opts.DryRun}
+	for _, m := range imported {
+		result, change, err := upsertMention(ctx, mentions, m, opts)
+		if err != nil {
+			return summary, err
+		}
+		switch result {
+		case upsertCreated:
+			summary.Created++
+		case upsertUpdated:
+			summary.Updated++
+		default:
+			summary.Unchanged++
+			continue
+		}
+		summary.Changes = append(summary.Changes, change)
+	}
+	existingPolicies, err := pols.Load(ctx)
+	if err != nil {
+		return summary, err
+	}
+	for _, p := range importedPolicies {
+		if containsPolicy(existingPolicies, p) {
+			summary.PoliciesUnchanged++
+			continue
+		}
+		summary.PoliciesCreated++
+		if opts.DryRun {
+			continue
+		}
+		if _, err := pols.CreatePolicy(ctx, p); err != nil {
+			return summary, err
+		}
+		existingPolicies = append(existingPolicies, p)
+	}
+	return summary, nil
+}
+
+// importedMention is a mention of an imported document together with
+// its revisions.
+type importedMention struct {
+	mention   Mention
+	revisions []Revision
+}
+
+type upsertResult int
+
+const (
+	upsertUnchanged upsertResult = iota
+	upsertCreated
+	upsertUpdated
+)
+
+// upsertMention stores m unless a mention with the same source and
+// target exists, which might be in the trash. In that case, that one is
+// updated instead unless KeepExisting is set. The ID of m is only used
+// for new mentions and only if it isn't taken already. The returned
+// AuditTarget describes the change.
+func upsertMention(ctx context.Context, store MentionStore, imported importedMention, opts ImportOptions) (upsertResult, AuditTarget, error) {
+	m := imported.mention
+	change := AuditTarget{ID: m.ID, StatusAfter: m.Status}
+	existing, err := findMention(ctx, store, m.Source, m.Target)
+	if err != nil {
+		return upsertUnchanged, change, err
+	}
+	if existing != nil {
+		if opts.KeepExisting {
+			return upsertUnchanged, change, nil
+		}
+		m.ID = existing.ID
+		change.ID = existing.ID
+		change.StatusBefore = existing.Status
+		// Only the fields of an export entry can differ:
+		current, err := exportEntry(ctx, store, *existing)
+		if err != nil {
+			return upsertUnchanged, change, err
+		}
+		updated := newExportEntry(m)
+		updated.setRevisions(imported.revisions)
+		if len(imported.revisions) == 0 {
+			updated.Revisions = current.Revisions
+		}
+		if reflect.DeepEqual(updated, current) {
+			return upsertUnchanged, change, nil
+		}
+		if opts.DryRun {
+			return upsertUpdated, change, nil
+		}
+		if err := store.UpdateMention(ctx, m); err != nil {
+			return upsertUpdated, change, err
+		}
+	} else {
+		if opts.DryRun {
+			return upsertCreated, change, nil
+		}
+		if m.ID == "" {
+			m.ID = xid.New().String()
+		} else if taken, err := findMentionByID(ctx, store, m.ID); err != nil {
+			return upsertUnchanged, change, err
+		} else if taken {
+			m.ID = xid.New().String()
+		}
+		change.ID = m.ID
+		if err := store.CreateMention(ctx, m); err != nil {
+			return upsertCreated, change, err
+		}
+	}
+	result := upsertCreated
+	if existing != nil {
+		result = upsertUpdated
+	}
+	if len(imported.revisions) > 0 {
+		return result, change, store.ReplaceRevisions(ctx, m.ID, imported.revisions)
+	}
+	return result, change, nil
+}
+
+// findMention returns the mention with the given source and target,
+// even if it is in the trash, or nil if there is none.
+func findMention(ctx context.Context, store MentionStore, source string, target string) (*Mention, error) {
+	for _, trashed := range []bool{false, true} {
+		found, err := store.ListMentions(ctx, MentionFilter{Source: source, Target: target, Trashed: trashed, Limit: 1})
+		if err != nil {
+			return nil, err
+		}
+		if len(found) > 0 {
+			return &found[0], nil
+		}
+	}
+	return nil, nil
+}
+
+// findMentionByID reports whether a mention with the given ID exists,
+// even if it is in the trash.
+func findMentionByID(ctx context.Context, store MentionStore, id string) (bool, error) {
+	if _, err := store.GetMention(ctx, id); err == nil {
+		return true, nil
+	} else if !errors.Is(err, ErrMentionNotFound) {
+		return false, err
+	}
+	trashed, err := store.ListMentions(ctx, MentionFilter{Trashed: true})
+	if err != nil {
+		return false, err
+	}
+	for _, m := range trashed {
+		if m.ID == id {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func containsPolicy(pols []policies.URLPolicy, p policies.URLPolicy) bool {
+	for _, existing := range pols {
+		if existing.URLPattern.String() == p.URLPattern.String() && existing.Policy == p.Policy && existing.Weight == p.Weight {
+			return true
+		}
+	}
+	return false
+}
+
+// maxImportSize limits the size of documents uploaded to /manage/import.
+const maxImportSize = 64 << 20
+
+func (srv *Server) handleExport(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	doc, err := Export(ctx, srv.cfg.MentionStore, srv.cfg.PolicyStore)
+	if err != nil {
+		srv.sendError(ctx, w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Disposition", `attachment; filename="webmentiond-export.json"`)
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	encoder.Encode(doc)
+}
+
+// handleImport imports a document created by handleExport. If the
+// dry_run query parameter is set to true, nothing is changed.
+func (srv *Server) handleImport(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	doc := ExportDocument{}
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxImportSize)).Decode(&doc); err != nil {
+		srv.sendError(ctx, w, &HTTPError{StatusCode: http.StatusBadRequest, Err: err, Message: "Invalid document"})
+		return
+	}
+	dryRun := r.URL.Query().Get("dry_run") == "true"
+	summary, err := Import(ctx, srv.cfg.MentionStore, srv.cfg.PolicyStore, &doc, ImportOptions{
+		DryRun: dryRun,
+	})
+	if !dryRun {
+		// Even a failed import might have changed something already.
+		srv.getCache.Clear()
+		srv.reloadPolicies(ctx)
+		srv.UpdateGlobalMetrics(ctx)
+		var targets []AuditTarget
+		if summary != nil {
+			targets = summary.Changes
+		}
+		srv.audit(ctx, AuditActionImport, targets...)
+	}
+	if err != nil {
+		if errors.Is(err, ErrInvalidImport) {
+			err = &HTTPError{StatusCode: http.StatusBadRequest, Err: err, Message: err.Error()}
+		}
+		srv.sendError(ctx, w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(summary)
+}
@@ -0,0 +1,241 @@
+package server_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"slices"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/zerok/webmentiond/pkg/policies"
+	"github.com/zerok/webmentiond/pkg/server"
+)
+
+func TestExportImport(t *testing.T) {
+	for _, backend := range testBackends {
+		t.Run(backend.Name, func(t *testing.T) {
+			testExportImport(t, func(t *testing.T) store {
+				db, _ := setupBackend(t, backend)
+				s, err := server.NewSQLStore(db, backend.Driver)
+				require.NoError(t, err)
+				return s
+			})
+		})
+	}
+	t.Run("memory", func(t *testing.T) {
+		testExportImport(t, func(t *testing.T) store {
+			return server.NewMemoryStore()
+		})
+	})
+}
+
+func testExportImport(t *testing.T, newStore func(t *testing.T) store) {
+	ctx := context.Background()
+	src := newStore(t)
+	require.NoError(t, src.CreateMention(ctx, server.Mention{ID: "a", Source: "https://a.com/post", Target: "https://target.com/1", CreatedAt: "2024-01-01T00:00:00Z", Status: server.MentionStatusApproved, Title: "Title", Content: "Content", AuthorName: "Author", Type: "comment", Protocol: "webmention", VerifiedAt: "2024-01-01T00:01:00Z"}))
+	require.NoError(t, src.CreateMention(ctx, server.Mention{ID: "b", Source: "https://b.com/post", Target: "https://target.com/1", CreatedAt: "2024-01-02T00:00:00Z", Status: server.MentionStatusNew, Type: "rsvp", RSVP: "yes", Protocol: "pingback", Origin: server.MentionOriginManual}))
+	title := "Manual title"
+	require.NoError(t, src.SetMentionOverrides(ctx, "a", server.MentionOverrides{Title: &title}))
+	// A moderated mention with a pinned revision and one in the trash:
+	require.NoError(t, src.CreateMention(ctx, server.Mention{ID: "c", Source: "https://c.com/post", Target: "https://target.com/2", CreatedAt: "2024-01-03T00:00:00Z", Status: server.MentionStatusNew, Protocol: "webmention"}))
+	require.NoError(t, src.SaveVerification(ctx, server.Mention{ID: "c", Status: server.MentionStatusVerified, Title: "First", VerifiedAt: "2024-01-03T00:01:00Z"}))
+	require.NoError(t, src.SaveVerification(ctx, server.Mention{ID: "c", Status: server.MentionStatusVerified, Title: "Second", VerifiedAt: "2024-01-04T00:01:00Z"}))
+	require.NoError(t, src.PinRevision(ctx, "c", 1))
+	require.NoError(t, src.UpdateMentionStatus(ctx, "c", server.MentionStatusApproved))
+	require.NoError(t, src.CreateMention(ctx, server.Mention{ID: "d", Source: "https://d.com/post", Target: "https://target.com/2", CreatedAt: "2024-01-04T00:00:00Z", Status: server.MentionStatusRejected, Protocol: "webmention"}))
+	require.NoError(t, src.TrashMention(ctx, "d", "admin@example.org"))
+	_, err := src.CreatePolicy(ctx, policies.URLPolicy{URLPattern: regexp.MustCompile("^https://a.com"), Policy: policies.APPROVE, Weight: 1})
+	require.NoError(t, err)
+
+	exported, err := server.Export(ctx, src, src)
+	require.NoError(t, err)
+	require.Equal(t, "feed", exported.Type)
+	require.Len(t, exported.Children, 4)
+	require.Equal(t, "in-reply-to", exported.Children[0].Property)
+	require.Equal(t, "Author", exported.Children[0].Author.Name)
+	// Overrides are exported separately from the extracted values:
+	require.Equal(t, "Title", exported.Children[0].Name)
+	require.Equal(t, &server.MentionOverrides{Title: &title}, exported.Children[0].Overrides)
+	require.Equal(t, server.MentionOriginManual, exported.Children[1].Origin)
+	require.Equal(t, "First", exported.Children[2].Name)
+	require.Equal(t, 1, exported.Children[2].PinnedRevision)
+	require.Len(t, exported.Children[2].Revisions, 2)
+	require.NotEmpty(t, exported.Children[2].ModeratedAt)
+	require.Equal(t, "admin@example.org", exported.Children[3].DeletedBy)
+	require.Len(t, exported.Policies, 1)
+	data, err := json.Marshal(exported)
+	require.NoError(t, err)
+	doc := server.ExportDocument{}
+	require.NoError(t, json.Unmarshal(data, &doc))
+
+	// A dry run doesn't change anything:
+	dst := newStore(t)
+	summary, err := server.Import(ctx, dst, dst, &doc, server.ImportOptions{DryRun: true})
+	require.NoError(t, err)
+	created := []server.AuditTarget{
+		{ID: "a", StatusAfter: server.MentionStatusApproved},
+		{ID: "b", StatusAfter: server.MentionStatusNew},
+		{ID: "c", StatusAfter: server.MentionStatusApproved},
+		{ID: "d", StatusAfter: server.MentionStatusRejected},
+	}
+	require.Equal(t, server.ImportSummary{DryRun: true, Created: 4, PoliciesCreated: 1, Changes: created}, *summary)
+	count, err := dst.CountMentions(ctx, server.MentionFilter{})
+	require.NoError(t, err)
+	require.Equal(t, 0, count)
+
+	summary, err = server.Import(ctx, dst, dst, &doc, server.ImportOptions{})
+	require.NoError(t, err)
+	require.Equal(t, server.ImportSummary{Created: 4, PoliciesCreated: 1, Changes: created}, *summary)
+	for _, id := range []string{"a", "b", "c"} {
+		expected, err := src.GetMention(ctx, id)
+		require.NoError(t, err)
+		actual, err := dst.GetMention(ctx, id)
+		require.NoError(t, err)
+		require.Equal(t, expected, actual)
+		expectedRevisions, err := src.ListRevisions(ctx, id)
+		require.NoError(t, err)
+		actualRevisions, err := dst.ListRevisions(ctx, id)
+		require.NoError(t, err)
+		require.Equal(t, expectedRevisions, actualRevisions)
+	}
+	expectedTrash, err := src.ListMentions(ctx, server.MentionFilter{Trashed: true})
+	require.NoError(t, err)
+	actualTrash, err := dst.ListMentions(ctx, server.MentionFilter{Trashed: true})
+	require.NoError(t, err)
+	require.Equal(t, expectedTrash, actualTrash)
+	pols, err := dst.Load(ctx)
+	require.NoError(t, err)
+	require.Len(t, pols, 1)
+	require.Equal(t, "^https://a.com", pols[0].URLPattern.String())
+
+	// Verifying an imported mention again keeps its overrides:
+	require.NoError(t, dst.SaveVerification(ctx, server.Mention{ID: "a", Status: server.MentionStatusApproved, Title: "New title", Type: "comment"}))
+	m, err := dst.GetMention(ctx, "a")
+	require.NoError(t, err)
+	require.Equal(t, "Manual title", m.Title)
+	require.NoError(t, dst.SaveVerification(ctx, server.Mention{ID: "a", Status: server.MentionStatusApproved, Title: "Title", Content: "Content", AuthorName: "Author", Type: "comment", VerifiedAt: "2024-01-01T00:01:00Z"}))
+
+	// Importing the same document again is a no-op. Revisions are kept
+	// if the document has none:
+	summary, err = server.Import(ctx, dst, dst, &doc, server.ImportOptions{})
+	require.NoError(t, err)
+	require.Equal(t, server.ImportSummary{Unchanged: 4, PoliciesUnchanged: 1}, *summary)
+	revisions, err := dst.ListRevisions(ctx, "a")
+	require.NoError(t, err)
+	require.Len(t, revisions, 2)
+
+	// Everything else is replaced by the document, including the
+	// moderation time and the trash state:
+	require.NoError(t, dst.UpdateMentionStatus(ctx, "a", server.MentionStatusApproved))
+	require.NoError(t, dst.RestoreMention(ctx, "d"))
+	require.NoError(t, dst.PinRevision(ctx, "c", 0))
+	summary, err = server.Import(ctx, dst, dst, &doc, server.ImportOptions{})
+	require.NoError(t, err)
+	require.Equal(t, server.ImportSummary{Updated: 3, Unchanged: 1, PoliciesUnchanged: 1, Changes: []server.AuditTarget{
+		{ID: "a", StatusBefore: server.MentionStatusApproved, StatusAfter: server.MentionStatusApproved},
+		{ID: "c", StatusBefore: server.MentionStatusApproved, StatusAfter: server.MentionStatusApproved},
+		{ID: "d", StatusBefore: server.MentionStatusRejected, StatusAfter: server.MentionStatusRejected},
+	}}, *summary)
+	m, err = dst.GetMention(ctx, "a")
+	require.NoError(t, err)
+	require.Empty(t, m.ModeratedAt)
+	m, err = dst.GetMention(ctx, "c")
+	require.NoError(t, err)
+	require.Equal(t, "First", m.Title)
+	require.Equal(t, 1, m.PinnedRevision)
+	_, err = dst.GetMention(ctx, "d")
+	require.ErrorIs(t, err, server.ErrMentionNotFound)
+
+	// Changed mentions are updated based on source and target:
+	doc.Children[1].ID = "other"
+	doc.Children[1].Status = server.MentionStatusApproved
+	summary, err = server.Import(ctx, dst, dst, &doc, server.ImportOptions{})
+	require.NoError(t, err)
+	require.Equal(t, server.ImportSummary{Updated: 1, Unchanged: 3, PoliciesUnchanged: 1, Changes: []server.AuditTarget{{ID: "b", StatusBefore: server.MentionStatusNew, StatusAfter: server.MentionStatusApproved}}}, *summary)
+	m, err = dst.GetMention(ctx, "b")
+	require.NoError(t, err)
+	require.Equal(t, server.MentionStatusApproved, m.Status)
+	require.Equal(t, server.MentionOriginManual, m.Origin)
+
+	// Invalid documents are rejected before anything is written:
+	valid := server.ExportEntry{Type: "entry", Source: "https://e.com", Target: "https://target.com/1"}
+	for _, invalid := range []server.ExportEntry{
+		{Type: "entry", Source: "relative", Target: "https://target.com/1"},
+		{Type: "entry", Source: "https://f.com", Target: "https://target.com/1", PinnedRevision: 2, Revisions: []server.Revision{{Number: 1}}},
+		{Type: "entry", Source: "https://f.com", Target: "https://target.com/1", Revisions: []server.Revision{{Number: 1}, {Number: 1}}},
+		{Type: "entry", Source: "https://f.com", Target: "https://target.com/1", DeletedBy: "admin@example.org"},
+	} {
+		invalidDoc := doc
+		invalidDoc.Children = append(slices.Clone(doc.Children), valid, invalid)
+		_, err = server.Import(ctx, dst, dst, &invalidDoc, server.ImportOptions{})
+		require.ErrorIs(t, err, server.ErrInvalidImport)
+	}
+	count, err = dst.CountMentions(ctx, server.MentionFilter{})
+	require.NoError(t, err)
+	require.Equal(t, 3, count)
+}
+
+func TestExportImportEndpoints(t *testing.T) {
+	store := server.NewMemoryStore()
+	srv := server.New(func(c *server.Configuration) {
+		c.MentionStore = store
+		c.PolicyStore = store
+	})
+	ctx := context.Background()
+	require.NoError(t, store.CreateMention(ctx, server.Mention{ID: "a", Source: "https://a.com/post", Target: "https://target.com/1", CreatedAt: "2024-01-01T00:00:00Z", Status: server.MentionStatusApproved}))
+
+	r := httptest.NewRequest(http.MethodGet, "/manage/export", nil)
+	w := httptest.NewRecorder()
+	srv.ServeHTTP(w, r)
+	require.Equal(t, http.StatusUnauthorized, w.Code)
+	w = httptest.NewRecorder()
+	srv.ServeHTTP(w, r.WithContext(server.AuthorizeContext(r.Context())))
+	require.Equal(t, http.StatusOK, w.Code)
+	exported := w.Body.Bytes()
+
+	other := server.NewMemoryStore()
+	otherSrv := server.New(func(c *server.Configuration) {
+		c.MentionStore = other
+		c.PolicyStore = other
+		c.AuditStore = other
+	})
+	importDoc := func(body []byte, query string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodPost, "/manage/import"+query, bytes.NewReader(body))
+		w := httptest.NewRecorder()
+		otherSrv.ServeHTTP(w, r.WithContext(server.AuthorizeContext(r.Context())))
+		return w
+	}
+	summary := server.ImportSummary{}
+	w = importDoc(exported, "?dry_run=true")
+	require.Equal(t, http.StatusOK, w.Code)
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&summary))
+	require.Equal(t, server.ImportSummary{DryRun: true, Created: 1}, summary)
+	_, err := other.GetMention(ctx, "a")
+	require.ErrorIs(t, err, server.ErrMentionNotFound)
+
+	w = importDoc(exported, "")
+	require.Equal(t, http.StatusOK, w.Code)
+	_, err = other.GetMention(ctx, "a")
+	require.NoError(t, err)
+
+	// The audit log records which mentions were created or updated:
+	require.NoError(t, store.UpdateMentionStatus(ctx, "a", server.MentionStatusRejected))
+	w = httptest.NewRecorder()
+	srv.ServeHTTP(w, r.WithContext(server.AuthorizeContext(r.Context())))
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Equal(t, http.StatusOK, importDoc(w.Body.Bytes(), "").Code)
+	require.Equal(t, http.StatusOK, importDoc(w.Body.Bytes(), "").Code)
+	entries, err := other.ListAuditEntries(ctx, server.AuditFilter{Action: server.AuditActionImport})
+	require.NoError(t, err)
+	require.Len(t, entries, 3)
+	require.Empty(t, entries[0].Targets)
+	require.Equal(t, []server.AuditTarget{{ID: "a", StatusBefore: server.MentionStatusApproved, StatusAfter: server.MentionStatusRejected}}, entries[1].Targets)
+	require.Equal(t, []server.AuditTarget{{ID: "a", StatusAfter: server.MentionStatusApproved}}, entries[2].Targets)
+
+	require.Equal(t, http.StatusBadRequest, importDoc([]byte(`{"type": "entry"}`), "").Code)
+	require.Equal(t, http.StatusBadRequest, importDoc([]byte(`not json`), "").Code)
+}
@@ -0,0 +1,141 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/zerok/webmentiond/pkg/feeds"
+)
+
+// PollFeeds checks all configured feeds for new or updated entries and
+// sends mentions for the external links of each of them.
+func (srv *Server) PollFeeds(ctx context.Context) error {
+	logger := zerolog.Ctx(ctx)
+	var result error
+	for _, feedURL := range srv.cfg.Sender.Feeds {
+		if err := srv.PollFeed(ctx, feedURL); err != nil {
+			logger.Error().Err(err).Msgf("Failed to poll feed %s", feedURL)
+			result = err
+		}
+	}
+	return result
+}
+
+// maxFeedEntryAttempts is the number of polls after which an entry is
+// marked as sent even though some of its mentions couldn't be sent.
+const maxFeedEntryAttempts = 10
+
+// PollFeed fetches a single feed, records all new or updated entries
+// as pending and then sends mentions for every pending entry. Entries
+// are only marked as sent once mentions have been sent to all of their
+// targets successfully so that failed targets and interrupted runs are
+// picked up again by the next poll. Targets that were already notified
+// about the pending version of an entry are not notified again and
+// entries are given up after maxFeedEntryAttempts failed polls.
+func (srv *Server) PollFeed(ctx context.Context, feedURL string) error {
+	logger := zerolog.Ctx(ctx)
+	if err := srv.updateFeedEntries(ctx, feedURL); err != nil {
+		return err
+	}
+	pending, err := srv.cfg.SendStore.PendingFeedEntries(ctx, feedURL)
+	if err != nil {
+		return err
+	}
+	for _, entry := range pending {
+		// Retries leave out the targets that were notified since the
+		// entry became pending:
+		var delivered []string
+		if entry.Attempts > 0 && !entry.PendingSince.IsZero() {
+			delivered, err = srv.cfg.SendStore.DeliveredTargets(ctx, entry.URL, entry.PendingSince)
+			if err != nil {
+				return err
+			}
+		}
+		resp, err := srv.sendMentions(ctx, entry.URL, false, delivered)
+		switch {
+		case err != nil:
+			logger.Error().Err(err).Msgf("Failed to send mentions for %s", entry.URL)
+		case resp.Failed():
+			logger.Warn().Msgf("Sending some mentions for %s failed", entry.URL)
+		default:
+			if err := srv.cfg.SendStore.MarkFeedEntrySent(ctx, feedURL, entry.ID); err != nil {
+				return err
+			}
+			logger.Info().Msgf("Mentions for %s sent", entry.URL)
+			continue
+		}
+		if entry.Attempts+1 < maxFeedEntryAttempts {
+			if err := srv.cfg.SendStore.RecordFeedEntryFailure(ctx, feedURL, entry.ID); err != nil {
+				return err
+			}
+			continue
+		}
+		logger.Error().Msgf("Giving up sending mentions for %s after %d attempts", entry.URL, maxFeedEntryAttempts)
+		if err := srv.cfg.SendStore.MarkFeedEntrySent(ctx, feedURL, entry.ID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (srv *Server) updateFeedEntries(ctx context.Context, feedURL string) error {
+	logger := zerolog.Ctx(ctx)
+	state, err := srv.cfg.SendStore.GetFeedState(ctx, feedURL)
+	if err != nil {
+		return err
+	}
+	feed, err := feeds.Fetch(ctx, feedURL, func(o *feeds.FetchOptions) {
+		o.ETag = state.ETag
+		o.LastModified = state.LastModified
+	})
+	if errors.Is(err, feeds.ErrNotModified) {
+		logger.Debug().Msgf("Feed %s not modified", feedURL)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	state.ETag = feed.ETag
+	state.LastModified = feed.LastModified
+	if err := srv.cfg.SendStore.UpdateFeed(ctx, state, feed.Entries); err != nil {
+		return err
+	}
+	if state.Polled || srv.cfg.Sender.FeedBackfill {
+		return nil
+	}
+	// The entries found by the first poll have most likely been
+	// published long ago and are only recorded as sent:
+	for _, entry := range feed.Entries {
+		if err := srv.cfg.SendStore.MarkFeedEntrySent(ctx, feedURL, entry.ID); err != nil {
+			return err
+		}
+	}
+	logger.Info().Msgf("Recorded %d existing entries of %s without sending mentions", len(feed.Entries), feedURL)
+	return nil
+}
+
+// StartFeedPoller periodically polls all configured feeds in the
+// background until the given context is cancelled.
+func (srv *Server) StartFeedPoller(ctx context.Context) {
+	if len(srv.cfg.Sender.Feeds) == 0 {
+		return
+	}
+	interval := srv.cfg.Sender.FeedPollInterval
+	if interval <= 0 {
+		interval = time.Minute * 15
+	}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			srv.PollFeeds(ctx)
+			select {
+			case <-ticker.C:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
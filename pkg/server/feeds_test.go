@@ -0,0 +1,149 @@
+package server_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/require"
+	"github.com/zerok/webmentiond/pkg/server"
+)
+
+func TestPollFeed(t *testing.T) {
+	ctx := context.Background()
+	var lock sync.Mutex
+	received := make([]string, 0, 5)
+	failing := false
+	targetMux := chi.NewRouter()
+	targetMux.Get("/", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Link", `</endpoint>; rel="webmention"`)
+	})
+	targetMux.Post("/endpoint", func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		defer lock.Unlock()
+		if failing {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		r.ParseForm()
+		received = append(received, r.Form.Get("source"))
+		w.WriteHeader(http.StatusAccepted)
+	})
+	target := httptest.NewServer(targetMux)
+	defer target.Close()
+
+	items := []string{`{"id": "1", "url": "/posts/1", "date_modified": "2020-03-02T10:00:00Z"}`}
+	sourceMux := chi.NewRouter()
+	sourceMux.Get("/feed.json", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `{"version": "https://jsonfeed.org/version/1.1", "items": [%s]}`, strings.Join(items, ","))
+	})
+	sourceMux.Get("/posts/{id}", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `<html><body><a href="%s/">Target</a></body></html>`, target.URL)
+	})
+	source := httptest.NewServer(sourceMux)
+	defer source.Close()
+
+	newServer := func(backfill bool) *server.Server {
+		db := setupDatabase(t)
+		t.Cleanup(func() { db.Close() })
+		srv := server.New(func(c *server.Configuration) {
+			c.Database = db
+			c.MigrationsFolder = "migrations"
+			c.Sender.Feeds = []string{source.URL + "/feed.json"}
+			c.Sender.FeedBackfill = backfill
+		})
+		require.NoError(t, srv.MigrateDatabase(ctx))
+		return srv
+	}
+
+	t.Run("backfill", func(t *testing.T) {
+		received = received[:0]
+		srv := newServer(true)
+		require.NoError(t, srv.PollFeeds(ctx))
+		require.Equal(t, []string{source.URL + "/posts/1"}, received)
+
+		// Polling again must not resend anything:
+		require.NoError(t, srv.PollFeeds(ctx))
+		require.Len(t, received, 1)
+
+		// Once the entry has been updated, the mentions should be sent again:
+		items[0] = `{"id": "1", "url": "/posts/1", "date_modified": "2020-03-03T10:00:00Z"}`
+		require.NoError(t, srv.PollFeeds(ctx))
+		require.Len(t, received, 2)
+	})
+
+	t.Run("new-entries-only", func(t *testing.T) {
+		received = received[:0]
+		srv := newServer(false)
+		// Existing entries are only recorded on the first poll:
+		require.NoError(t, srv.PollFeeds(ctx))
+		require.Empty(t, received)
+
+		items = append(items, `{"id": "2", "url": "/posts/2", "date_modified": "2020-03-04T10:00:00Z"}`)
+		failing = true
+		require.NoError(t, srv.PollFeeds(ctx))
+		require.Empty(t, received)
+
+		// Entries whose mentions failed are retried with the next poll:
+		failing = false
+		require.NoError(t, srv.PollFeeds(ctx))
+		require.Equal(t, []string{source.URL + "/posts/2"}, received)
+		require.NoError(t, srv.PollFeeds(ctx))
+		require.Len(t, received, 1)
+	})
+}
+
+func TestPollFeedFailingTarget(t *testing.T) {
+	ctx := context.Background()
+	var lock sync.Mutex
+	attempts := map[string]int{}
+	targetMux := chi.NewRouter()
+	targetMux.Get("/{name}/", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Link", fmt.Sprintf(`</%s/endpoint>; rel="webmention"`, chi.URLParam(r, "name")))
+	})
+	targetMux.Post("/{name}/endpoint", func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		defer lock.Unlock()
+		name := chi.URLParam(r, "name")
+		attempts[name]++
+		if name == "dead" {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusAccepted)
+	})
+	target := httptest.NewServer(targetMux)
+	defer target.Close()
+
+	sourceMux := chi.NewRouter()
+	sourceMux.Get("/feed.json", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"version": "https://jsonfeed.org/version/1.1", "items": [{"id": "1", "url": "/posts/1"}]}`)
+	})
+	sourceMux.Get("/posts/{id}", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `<html><body><a href="%s/alive/">Alive</a><a href="%s/dead/">Dead</a></body></html>`, target.URL, target.URL)
+	})
+	source := httptest.NewServer(sourceMux)
+	defer source.Close()
+
+	db := setupDatabase(t)
+	defer db.Close()
+	srv := server.New(func(c *server.Configuration) {
+		c.Database = db
+		c.MigrationsFolder = "migrations"
+		c.Sender.Feeds = []string{source.URL + "/feed.json"}
+		c.Sender.FeedBackfill = true
+	})
+	require.NoError(t, srv.MigrateDatabase(ctx))
+
+	// Only the failing target is retried with the following polls until
+	// the entry is given up:
+	for i := 0; i < 12; i++ {
+		require.NoError(t, srv.PollFeeds(ctx))
+	}
+	require.Equal(t, map[string]int{"alive": 1, "dead": 10}, attempts)
+}
@@ -0,0 +1,134 @@
+package server
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"sync"
+	"time"
+)
+
+// DefaultGetCacheSize is the number of targets whose /get response is
+// cached if Configuration.GetCacheSize is not set.
+const DefaultGetCacheSize = 1000
+
+// DefaultGetCacheTTL is how long a /get response is cached at most if
+// Configuration.GetCacheTTL is not set.
+const DefaultGetCacheTTL = time.Minute
+
+// getResponse is a rendered response of the /get endpoint.
+type getResponse struct {
+	target       string
+	body         []byte
+	etag         string
+	lastModified time.Time
+	// created is used for expiring the response.
+	created time.Time
+}
+
+func newGetResponse(target string, body []byte) *getResponse {
+	sum := sha256.Sum256(body)
+	return &getResponse{
+		target: target,
+		body:   body,
+		etag:   `"` + hex.EncodeToString(sum[:16]) + `"`,
+		// HTTP dates only have a resolution of seconds.
+		lastModified: time.Now().UTC().Truncate(time.Second),
+		created:      time.Now(),
+	}
+}
+
+// getCache is a LRU cache of /get responses keyed by target. It only
+// knows about changes made through the server it belongs to, so every
+// code path that changes a mention has to invalidate its target.
+// Changes made by other processes sharing the same database are picked
+// up once a response expires after ttl.
+type getCache struct {
+	mu      sync.Mutex
+	size    int
+	ttl     time.Duration
+	order   *list.List
+	entries map[string]*list.Element
+	// generation is incremented on every invalidation so that a
+	// response rendered from data read before that is not stored.
+	generation uint64
+}
+
+// newGetCache creates a cache for up to size targets. A cache with a
+// size of 0 or less never stores anything.
+func newGetCache(size int, ttl time.Duration) *getCache {
+	return &getCache{
+		size:    size,
+		ttl:     ttl,
+		order:   list.New(),
+		entries: make(map[string]*list.Element),
+	}
+}
+
+// Get returns the cached response for target together with the current
+// generation that has to be passed on to Put.
+func (c *getCache) Get(target string) (*getResponse, uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	elem, ok := c.entries[target]
+	if !ok || time.Since(elem.Value.(*getResponse).created) > c.ttl {
+		getCacheMisses.Inc()
+		return nil, c.generation
+	}
+	getCacheHits.Inc()
+	c.order.MoveToFront(elem)
+	return elem.Value.(*getResponse), c.generation
+}
+
+// Put stores resp unless the cache was invalidated since generation was
+// returned by Get.
+func (c *getCache) Put(resp *getResponse, generation uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.size <= 0 || generation != c.generation {
+		return
+	}
+	if elem, ok := c.entries[resp.target]; ok {
+		// An expired response that is rendered again without any
+		// changes keeps its modification time:
+		if previous := elem.Value.(*getResponse); previous.etag == resp.etag {
+			resp.lastModified = previous.lastModified
+		}
+		elem.Value = resp
+		c.order.MoveToFront(elem)
+		return
+	}
+	c.entries[resp.target] = c.order.PushFront(resp)
+	for c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*getResponse).target)
+	}
+}
+
+// Invalidate removes the response for target.
+func (c *getCache) Invalidate(target string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.generation++
+	if elem, ok := c.entries[target]; ok {
+		c.order.Remove(elem)
+		delete(c.entries, target)
+	}
+}
+
+// Clear removes all responses.
+func (c *getCache) Clear() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.generation++
+	c.order.Init()
+	c.entries = make(map[string]*list.Element)
+}
+
+// Len returns the number of cached responses.
+func (c *getCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.order.Len()
+}
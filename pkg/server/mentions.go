@@ -1,14 +1,20 @@
 package server
 
 import (
-	"database/sql"
+	"context"
+	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"net/url"
+	"slices"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/go-chi/chi/v5"
+	"github.com/rs/xid"
 )
 
 const MentionStatusApproved = "approved"
@@ -17,98 +23,344 @@ const MentionStatusNew = "new"
 const MentionStatusVerified = "verified"
 const MentionStatusInvalid = "invalid"
 
+// mentionStatuses lists all statuses a mention can have.
+var mentionStatuses = []string{MentionStatusNew, MentionStatusVerified, MentionStatusApproved, MentionStatusRejected, MentionStatusInvalid}
+
 func (srv *Server) handleListMentions(w http.ResponseWriter, r *http.Request) {
-	var err error
 	ctx := r.Context()
-	var limit int64
-	var offset int64
-	rawLimit := r.URL.Query().Get("limit")
-	status := r.URL.Query().Get("status")
-	rawOffset := r.URL.Query().Get("offset")
-	if rawOffset != "" {
-		offset, err = strconv.ParseInt(rawOffset, 10, 64)
-		if err != nil {
-			srv.sendError(ctx, w, err)
-			return
+	filter, err := parseMentionFilter(r.URL.Query())
+	if err != nil {
+		srv.sendError(ctx, w, &HTTPError{StatusCode: http.StatusBadRequest, Err: err})
+		return
+	}
+	srv.sendMentionList(w, r, filter)
+}
+
+// sendMentionList responds with a page of the mentions matching filter
+// including the facets and the URL of the next page.
+func (srv *Server) sendMentionList(w http.ResponseWriter, r *http.Request, filter MentionFilter) {
+	ctx := r.Context()
+	var err error
+	if filter.Limit <= 0 {
+		filter.Limit = 50
+	}
+	result := PagedMentionList{}
+	if result.Total, err = srv.cfg.MentionStore.CountMentions(ctx, filter); err != nil {
+		srv.sendError(ctx, w, err)
+		return
+	}
+	// Facets show how many mentions each status would have with the
+	// other filters:
+	facetFilter := filter
+	facetFilter.Status = ""
+	counts, err := srv.cfg.MentionStore.CountMentionsByStatus(ctx, facetFilter)
+	if err != nil {
+		srv.sendError(ctx, w, err)
+		return
+	}
+	result.Facets = &MentionFacets{Status: make(map[string]int, len(mentionStatuses))}
+	for _, status := range mentionStatuses {
+		result.Facets.Status[status] = counts[status]
+	}
+	// Fetching one more mention than requested tells if there is a next
+	// page:
+	limit := filter.Limit
+	filter.Limit++
+	if result.Items, err = srv.cfg.MentionStore.ListMentions(ctx, filter); err != nil {
+		srv.sendError(ctx, w, err)
+		return
+	}
+	if len(result.Items) > limit {
+		result.Items = result.Items[:limit]
+		v := r.URL.Query()
+		v.Del("offset")
+		v.Set("cursor", encodeMentionCursor(filter.Cursor(result.Items[limit-1])))
+		result.Next = strings.TrimSuffix(srv.cfg.PublicURL, "/") + r.URL.Path + "?" + v.Encode()
+	}
+	if terms := searchTerms(filter.Query); len(terms) > 0 {
+		for i := range result.Items {
+			result.Items[i].Snippet = searchSnippet(result.Items[i], terms)
 		}
 	}
-	if rawLimit != "" {
-		limit, err = strconv.ParseInt(rawLimit, 10, 64)
-		if err != nil {
-			srv.sendError(ctx, w, err)
-			return
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
+
+// parseMentionFilter creates a filter from the query parameters of the
+// mention list endpoint.
+func parseMentionFilter(v url.Values) (MentionFilter, error) {
+	var err error
+	filter := MentionFilter{
+		Status:       v.Get("status"),
+		Target:       v.Get("target"),
+		TargetPrefix: v.Get("target_prefix"),
+		SourceHost:   strings.ToLower(v.Get("source_host")),
+		Type:         v.Get("type"),
+		Author:       v.Get("author"),
+		Query:        v.Get("q"),
+	}
+	if raw := v.Get("limit"); raw != "" {
+		if filter.Limit, err = strconv.Atoi(raw); err != nil {
+			return filter, fmt.Errorf("invalid limit: %s", raw)
+		}
+	}
+	if raw := v.Get("offset"); raw != "" {
+		if filter.Offset, err = strconv.Atoi(raw); err != nil {
+			return filter, fmt.Errorf("invalid offset: %s", raw)
+		}
+		filter.Offset = max(0, filter.Offset)
+	}
+	for param, t := range map[string]*time.Time{
+		"created_after":   &filter.CreatedAfter,
+		"created_before":  &filter.CreatedBefore,
+		"verified_after":  &filter.VerifiedAfter,
+		"verified_before": &filter.VerifiedBefore,
+	} {
+		if raw := v.Get(param); raw != "" {
+			if *t, err = parseFilterTime(raw); err != nil {
+				return filter, fmt.Errorf("invalid %s: %s", param, raw)
+			}
+		}
+	}
+	if sortBy := v.Get("sort"); sortBy != "" {
+		// A leading - sorts in descending order. The + of an
+		// ascending sort might arrive as space if it wasn't encoded:
+		if field, ok := strings.CutPrefix(sortBy, "-"); ok {
+			sortBy = field
+		} else {
+			sortBy = strings.TrimPrefix(strings.TrimSpace(sortBy), "+")
+			filter.OldestFirst = true
 		}
+		if !ValidSortField(sortBy) {
+			return filter, fmt.Errorf("mentions cannot be sorted by %s", sortBy)
+		}
+		filter.SortBy = sortBy
+	}
+	if raw := v.Get("cursor"); raw != "" {
+		if filter.Offset > 0 {
+			return filter, fmt.Errorf("cursor and offset cannot be combined")
+		}
+		if filter.After, err = decodeMentionCursor(raw); err != nil {
+			return filter, fmt.Errorf("invalid cursor: %s", raw)
+		}
+	}
+	return filter, nil
+}
+
+// parseFilterTime accepts RFC 3339 timestamps and dates.
+func parseFilterTime(raw string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, raw); err == nil {
+		return t, nil
 	}
-	if limit <= 0 {
-		limit = 50
+	return time.Parse(time.DateOnly, raw)
+}
+
+func encodeMentionCursor(c *MentionCursor) string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeMentionCursor(raw string) (*MentionCursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(raw)
+	if err != nil {
+		return nil, err
 	}
-	if offset < 0 {
-		offset = 0
+	c := &MentionCursor{}
+	if err := json.Unmarshal(data, c); err != nil {
+		return nil, err
 	}
+	return c, nil
+}
 
-	tx, err := srv.cfg.Database.BeginTx(ctx, &sql.TxOptions{
-		ReadOnly: true,
-	})
+func (srv *Server) handleGetMention(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	m, err := srv.cfg.MentionStore.GetMention(ctx, chi.URLParam(r, "id"))
 	if err != nil {
+		if errors.Is(err, ErrMentionNotFound) {
+			err = &HTTPError{StatusCode: http.StatusNotFound, Err: err}
+		}
 		srv.sendError(ctx, w, err)
 		return
 	}
-	defer tx.Rollback()
-	result := PagedMentionList{
-		Items: make([]Mention, 0, 10),
+	srv.sendMentionDetails(ctx, w, m, http.StatusOK)
+}
+
+// handleVerifyMention verifies a mention right away instead of waiting
+// for the sender to send it again.
+func (srv *Server) handleVerifyMention(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	m, err := srv.cfg.MentionStore.GetMention(ctx, chi.URLParam(r, "id"))
+	var verified *Mention
+	if err == nil {
+		verified, err = srv.verifyMention(ctx, *m, true)
 	}
-	var rows *sql.Rows
-	if status != "" {
-		query := "SELECT id, source, target, status, created_at, title, type, author_name, content, rsvp FROM webmentions WHERE status = ? ORDER BY created_at DESC LIMIT ? OFFSET ?"
-		if err := tx.QueryRowContext(ctx, "SELECT COUNT(id) FROM webmentions WHERE status = ?", status).Scan(&result.Total); err != nil {
-			srv.sendError(ctx, w, err)
-			return
+	if err != nil {
+		if errors.Is(err, ErrMentionNotFound) {
+			err = &HTTPError{StatusCode: http.StatusNotFound, Err: err}
 		}
-		rows, err = tx.QueryContext(ctx, query, status, limit, offset)
-	} else {
-		query := "SELECT id, source, target, status, created_at, title, type, author_name, content, rsvp FROM webmentions ORDER BY created_at DESC LIMIT ? OFFSET ?"
-		if err := tx.QueryRowContext(ctx, "SELECT COUNT(id) FROM webmentions").Scan(&result.Total); err != nil {
-			srv.sendError(ctx, w, err)
+		srv.sendError(ctx, w, err)
+		return
+	}
+	srv.audit(ctx, AuditActionVerifyMention, AuditTarget{ID: m.ID, StatusBefore: m.Status, StatusAfter: verified.Status})
+	srv.sendMentionDetails(ctx, w, verified, http.StatusOK)
+}
+
+func (srv *Server) sendMentionDetails(ctx context.Context, w http.ResponseWriter, m *Mention, status int) {
+	verifications, err := srv.cfg.MentionStore.ListVerifications(ctx, m.ID)
+	if err != nil {
+		srv.sendError(ctx, w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(MentionDetails{Mention: *m, Verifications: verifications})
+}
+
+// handleUpdateMention sets or removes the overrides of a mention. Fields
+// missing in the request are left as they are while null removes an
+// override.
+func (srv *Server) handleUpdateMention(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	fields := make(map[string]*string)
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxMentionRequestSize)).Decode(&fields); err != nil {
+		srv.sendError(ctx, w, &HTTPError{StatusCode: http.StatusBadRequest, Err: err, Message: "Invalid request"})
+		return
+	}
+	m, err := srv.cfg.MentionStore.GetMention(ctx, chi.URLParam(r, "id"))
+	if err != nil {
+		if errors.Is(err, ErrMentionNotFound) {
+			err = &HTTPError{StatusCode: http.StatusNotFound, Err: err}
+		}
+		srv.sendError(ctx, w, err)
+		return
+	}
+	o := MentionOverrides{}
+	if m.Overrides != nil {
+		o = *m.Overrides
+	}
+	for field, value := range fields {
+		switch field {
+		case "title":
+			o.Title = value
+		case "content":
+			o.Content = value
+		case "author_name":
+			o.AuthorName = value
+		case "type":
+			o.Type = value
+		default:
+			srv.sendError(ctx, w, &HTTPError{StatusCode: http.StatusBadRequest, Err: fmt.Errorf("%s cannot be changed", field)})
 			return
 		}
-		rows, err = tx.QueryContext(ctx, query, limit, offset)
 	}
-	if err != nil {
+	if err := srv.cfg.MentionStore.SetMentionOverrides(ctx, m.ID, o); err != nil {
+		srv.sendError(ctx, w, err)
+		return
+	}
+	srv.invalidateTarget(m.Target)
+	srv.audit(ctx, AuditActionUpdateMention, AuditTarget{ID: m.ID, StatusBefore: m.Status, StatusAfter: m.Status})
+	if m, err = srv.cfg.MentionStore.GetMention(ctx, m.ID); err != nil {
 		srv.sendError(ctx, w, err)
 		return
 	}
-	for rows.Next() {
-		m := Mention{}
-		if err := rows.Scan(&m.ID, &m.Source, &m.Target, &m.Status, &m.CreatedAt, &m.Title, &m.Type, &m.AuthorName, &m.Content, &m.RSVP); err != nil {
-			srv.sendError(ctx, w, err)
-			rows.Close()
+	srv.sendMentionDetails(ctx, w, m, http.StatusOK)
+}
+
+type createMentionRequest struct {
+	Source      string `json:"source"`
+	Target      string `json:"target"`
+	Status      string `json:"status"`
+	Title       string `json:"title"`
+	Content     string `json:"content"`
+	AuthorName  string `json:"author_name"`
+	AuthorURL   string `json:"author_url"`
+	AuthorPhoto string `json:"author_photo"`
+	Type        string `json:"type"`
+	RSVP        string `json:"rsvp"`
+	PublishedAt string `json:"published_at"`
+}
+
+// handleCreateMention adds a mention by hand, for example for a reply
+// on a platform that doesn't send webmentions. Title, content, author
+// name and type are stored as overrides so that they are kept if the
+// mention is verified.
+func (srv *Server) handleCreateMention(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	req := createMentionRequest{Status: MentionStatusApproved}
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxMentionRequestSize)).Decode(&req); err != nil {
+		srv.sendError(ctx, w, &HTTPError{StatusCode: http.StatusBadRequest, Err: err, Message: "Invalid request"})
+		return
+	}
+	for name, value := range map[string]string{"source": req.Source, "target": req.Target} {
+		if !isHTTPURL(value) {
+			srv.sendError(ctx, w, &HTTPError{StatusCode: http.StatusBadRequest, Err: fmt.Errorf("%s must be an HTTP(S) URL", name)})
 			return
 		}
-		result.Items = append(result.Items, m)
 	}
-	rows.Close()
-	if offset+limit < int64(result.Total) {
-		v := url.Values{}
-		v.Set("limit", r.URL.Query().Get("limit"))
-		v.Set("offset", fmt.Sprintf("%d", offset+limit))
-		u := url.URL{
-			Scheme:   r.URL.Scheme,
-			User:     r.URL.User,
-			Path:     r.URL.Path,
-			RawQuery: v.Encode(),
+	if !srv.targetAllowed(req.Target) {
+		srv.sendError(ctx, w, &HTTPError{StatusCode: http.StatusBadRequest, Err: fmt.Errorf("target domain not allowed")})
+		return
+	}
+	if !slices.Contains(mentionStatuses, req.Status) {
+		srv.sendError(ctx, w, &HTTPError{StatusCode: http.StatusBadRequest, Err: fmt.Errorf("invalid status: %s", req.Status)})
+		return
+	}
+	if req.PublishedAt != "" {
+		published, err := time.Parse(time.RFC3339, req.PublishedAt)
+		if err != nil {
+			srv.sendError(ctx, w, &HTTPError{StatusCode: http.StatusBadRequest, Err: fmt.Errorf("invalid published_at: %s", req.PublishedAt)})
+			return
 		}
-		result.Next = u.String()
+		req.PublishedAt = formatTimestamp(published)
+	}
+	m := Mention{
+		ID:          xid.New().String(),
+		Source:      req.Source,
+		Target:      req.Target,
+		CreatedAt:   formatTimestamp(time.Now()),
+		Status:      req.Status,
+		AuthorURL:   req.AuthorURL,
+		AuthorPhoto: req.AuthorPhoto,
+		RSVP:        req.RSVP,
+		PublishedAt: req.PublishedAt,
+		Origin:      MentionOriginManual,
+		Overrides: &MentionOverrides{
+			Title:      &req.Title,
+			Content:    &req.Content,
+			AuthorName: &req.AuthorName,
+			Type:       &req.Type,
+		},
 	}
+	if err := srv.cfg.MentionStore.CreateMention(ctx, m); err != nil {
+		if errors.Is(err, ErrMentionExists) {
+			err = &HTTPError{StatusCode: http.StatusConflict, Err: err, Message: "A mention with the same source and target exists already"}
+		}
+		srv.sendError(ctx, w, err)
+		return
+	}
+	srv.invalidateTarget(m.Target)
+	srv.UpdateGlobalMetrics(ctx)
+	srv.audit(ctx, AuditActionCreateMention, AuditTarget{ID: m.ID, StatusAfter: m.Status})
+	created, err := srv.cfg.MentionStore.GetMention(ctx, m.ID)
+	if err != nil {
+		srv.sendError(ctx, w, err)
+		return
+	}
+	srv.sendMentionDetails(ctx, w, created, http.StatusCreated)
+}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(result)
+// isHTTPURL reports whether raw is an absolute HTTP(S) URL.
+func isHTTPURL(raw string) bool {
+	u, err := url.Parse(raw)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
 }
 
 func (srv *Server) handleApproveMention(w http.ResponseWriter, r *http.Request) {
-	srv.handleMentionStatusUpdate(w, r, MentionStatusApproved)
+	srv.handleMentionStatusUpdate(w, r, MentionStatusApproved, AuditActionApproveMention)
 }
 
-func (srv *Server) handleMentionStatusUpdate(w http.ResponseWriter, r *http.Request, status string) {
+func (srv *Server) handleMentionStatusUpdate(w http.ResponseWriter, r *http.Request, status string, action string) {
 	ctx := r.Context()
 	id := chi.URLParam(r, "id")
 	if id == "" {
@@ -118,42 +370,27 @@ func (srv *Server) handleMentionStatusUpdate(w http.ResponseWriter, r *http.Requ
 		})
 		return
 	}
-	tx, err := srv.cfg.Database.BeginTx(ctx, &sql.TxOptions{
-		ReadOnly: false,
-	})
-	if err != nil {
-		srv.sendError(ctx, w, err)
-		return
-	}
-	res, err := tx.ExecContext(ctx, "UPDATE webmentions SET status = ? WHERE id = ?", status, id)
-	if err != nil {
-		srv.sendError(ctx, w, err)
-		tx.Rollback()
-		return
+	m, err := srv.cfg.MentionStore.GetMention(ctx, id)
+	if err == nil {
+		err = srv.cfg.MentionStore.UpdateMentionStatus(ctx, id, status)
 	}
-	num, err := res.RowsAffected()
 	if err != nil {
+		if errors.Is(err, ErrMentionNotFound) {
+			err = &HTTPError{StatusCode: http.StatusNotFound, Err: err}
+		}
 		srv.sendError(ctx, w, err)
-		tx.Rollback()
-		return
-	}
-	if num != 1 {
-		srv.sendError(ctx, w, &HTTPError{StatusCode: http.StatusNotFound})
-		tx.Rollback()
-		return
-	}
-	if err := tx.Commit(); err != nil {
-		srv.sendError(ctx, w, err)
-		tx.Rollback()
 		return
 	}
+	srv.invalidateTarget(m.Target)
 	srv.UpdateGlobalMetrics(ctx)
+	srv.audit(ctx, action, AuditTarget{ID: id, StatusBefore: m.Status, StatusAfter: status})
 }
 
 func (srv *Server) handleRejectMention(w http.ResponseWriter, r *http.Request) {
-	srv.handleMentionStatusUpdate(w, r, MentionStatusRejected)
+	srv.handleMentionStatusUpdate(w, r, MentionStatusRejected, AuditActionRejectMention)
 }
 
+// handleDeleteMention moves a mention into the trash.
 func (srv *Server) handleDeleteMention(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 	id := chi.URLParam(r, "id")
@@ -164,30 +401,107 @@ func (srv *Server) handleDeleteMention(w http.ResponseWriter, r *http.Request) {
 		})
 		return
 	}
-	tx, err := srv.cfg.Database.BeginTx(ctx, &sql.TxOptions{
-		ReadOnly: false,
-	})
-	if err != nil {
-		srv.sendError(ctx, w, err)
-		return
+	m, err := srv.cfg.MentionStore.GetMention(ctx, id)
+	if err == nil {
+		err = srv.cfg.MentionStore.TrashMention(ctx, id, Subject(ctx))
 	}
-	result, err := tx.ExecContext(ctx, "DELETE FROM webmentions WHERE id = ?", id)
 	if err != nil {
+		if errors.Is(err, ErrMentionNotFound) {
+			err = &HTTPError{
+				StatusCode: http.StatusBadRequest,
+				Err:        fmt.Errorf("no matching mention found"),
+			}
+		}
 		srv.sendError(ctx, w, err)
-		tx.Rollback()
 		return
 	}
+	srv.invalidateTarget(m.Target)
+	srv.UpdateGlobalMetrics(ctx)
+	srv.audit(ctx, AuditActionDeleteMention, AuditTarget{ID: id, StatusBefore: m.Status})
+}
 
-	if num, _ := result.RowsAffected(); num < 1 {
-		srv.sendError(ctx, w, &HTTPError{
-			StatusCode: http.StatusBadRequest,
-			Err:        fmt.Errorf("no matching mention found"),
-		})
-		tx.Rollback()
+// maxMentionRequestSize limits the size of request bodies sent to the
+// mention endpoints.
+const maxMentionRequestSize = 1 << 20
+
+// bulkAuditActions maps bulk actions to the actions recorded in the
+// audit log.
+var bulkAuditActions = map[string]string{
+	BulkActionApprove:  AuditActionApproveMention,
+	BulkActionReject:   AuditActionRejectMention,
+	BulkActionDelete:   AuditActionDeleteMention,
+	BulkActionReverify: AuditActionReverifyMention,
+}
+
+type bulkRequest struct {
+	Action string   `json:"action"`
+	IDs    []string `json:"ids"`
+	// Filter selects the mentions using the query parameters of the
+	// mention list, e.g. "status=new&source_host=spam.example".
+	Filter string `json:"filter"`
+}
+
+// handleBulkMentions applies a moderation action to many mentions at
+// once.
+func (srv *Server) handleBulkMentions(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	req := bulkRequest{}
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxMentionRequestSize)).Decode(&req); err != nil {
+		srv.sendError(ctx, w, &HTTPError{StatusCode: http.StatusBadRequest, Err: err, Message: "Invalid request"})
 		return
 	}
-	if err := tx.Commit(); err != nil {
+	if !ValidBulkAction(req.Action) {
+		srv.sendError(ctx, w, &HTTPError{StatusCode: http.StatusBadRequest, Err: fmt.Errorf("unsupported action: %s", req.Action)})
+		return
+	}
+	var results []BulkResult
+	var err error
+	switch {
+	case len(req.IDs) > 0 && req.Filter != "":
+		srv.sendError(ctx, w, &HTTPError{StatusCode: http.StatusBadRequest, Err: fmt.Errorf("either ids or filter must be set, not both")})
+		return
+	case req.Filter != "":
+		values, parseErr := url.ParseQuery(req.Filter)
+		if parseErr != nil {
+			srv.sendError(ctx, w, &HTTPError{StatusCode: http.StatusBadRequest, Err: fmt.Errorf("invalid filter: %w", parseErr)})
+			return
+		}
+		filter, parseErr := parseMentionFilter(values)
+		if parseErr != nil {
+			srv.sendError(ctx, w, &HTTPError{StatusCode: http.StatusBadRequest, Err: parseErr})
+			return
+		}
+		// A typo must not end up selecting all mentions:
+		if !filter.Restricted() {
+			srv.sendError(ctx, w, &HTTPError{StatusCode: http.StatusBadRequest, Err: fmt.Errorf("the filter must restrict the mentions: %s", req.Filter)})
+			return
+		}
+		results, err = srv.cfg.MentionStore.BulkUpdateMatchingMentions(ctx, req.Action, filter, Subject(ctx))
+	case len(req.IDs) == 0:
+		srv.sendError(ctx, w, &HTTPError{StatusCode: http.StatusBadRequest, Err: fmt.Errorf("no ids or filter provided")})
+		return
+	default:
+		results, err = srv.cfg.MentionStore.BulkUpdateMentions(ctx, req.Action, req.IDs, Subject(ctx))
+	}
+	if err != nil {
 		srv.sendError(ctx, w, err)
 		return
 	}
+	list := BulkResultList{Action: req.Action, Results: results}
+	targets := make([]AuditTarget, 0, len(results))
+	for _, result := range results {
+		if result.Error != "" {
+			list.Failed++
+			continue
+		}
+		list.Succeeded++
+		srv.invalidateTarget(result.Target)
+		targets = append(targets, AuditTarget{ID: result.ID, StatusBefore: result.PreviousStatus, StatusAfter: result.Status})
+	}
+	if list.Succeeded > 0 {
+		srv.UpdateGlobalMetrics(ctx)
+		srv.audit(ctx, bulkAuditActions[req.Action], targets...)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(list)
 }
@@ -6,6 +6,8 @@ import (
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"strings"
 	"testing"
 	"time"
 
@@ -163,6 +165,231 @@ func TestPagingMentions(t *testing.T) {
 	requireMetricValue(t, context.Background(), srv, "webmentiond_mentions{status=\verified\"}", 0)
 }
 
+func TestSearchingMentions(t *testing.T) {
+	db := setupDatabase(t)
+	defer db.Close()
+	srv := setupServer(t, db)
+	var fts5 bool
+	require.NoError(t, db.QueryRow("SELECT sqlite_compileoption_used('ENABLE_FTS5')").Scan(&fts5))
+	var tables int
+	require.NoError(t, db.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE name = 'webmentions_fts'").Scan(&tables))
+	require.Equal(t, fts5, tables == 1, "the search index is created if FTS5 is available")
+
+	createMention(t, db, "a", "https://a.com/", "https://target.com/")
+	setMentionTitle(t, db, "a", "A reply")
+	setMentionContent(t, db, "a", "I <b>really</b> liked your post about the Spring festival.")
+	createMention(t, db, "b", "https://b.com/", "https://target.com/")
+	setMentionTitle(t, db, "b", "Spring")
+	createMention(t, db, "c", "https://c.com/", "https://target.com/")
+	setMentionContent(t, db, "c", "Autumn")
+
+	list := func(u string) server.PagedMentionList {
+		t.Helper()
+		var res server.PagedMentionList
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodGet, u, nil)
+		srv.ServeHTTP(w, r.WithContext(server.AuthorizeContext(r.Context())))
+		require.Equal(t, http.StatusOK, w.Code)
+		require.NoError(t, json.NewDecoder(w.Body).Decode(&res))
+		return res
+	}
+	res := list("/manage/mentions?q=spring&limit=1")
+	require.Equal(t, 2, res.Total)
+	require.Len(t, res.Items, 1)
+	require.Equal(t, "<mark>Spring</mark>", res.Items[0].Snippet)
+	require.Contains(t, res.Next, "q=spring")
+	res = list(res.Next)
+	require.Len(t, res.Items, 1)
+	require.Equal(t, "I &lt;b&gt;really&lt;/b&gt; liked your post about the <mark>Spring</mark> festival.", res.Items[0].Snippet)
+	require.Empty(t, res.Next)
+
+	res = list("/manage/mentions?q=autumn")
+	require.Len(t, res.Items, 1)
+	require.Equal(t, "c", res.Items[0].ID)
+	res = list("/manage/mentions")
+	require.Equal(t, 3, res.Total)
+	require.Empty(t, res.Items[0].Snippet)
+}
+
+func TestFilteringMentions(t *testing.T) {
+	db := setupDatabase(t)
+	defer db.Close()
+	srv := setupServer(t, db)
+	for _, id := range []string{"a", "b", "c", "d"} {
+		createMention(t, db, id, "https://"+id+".com/", "https://target.com/posts/"+id)
+		setMentionType(t, db, id, "reply")
+	}
+	createMention(t, db, "e", "https://e.com/", "https://target.com/about")
+	setMentionStatus(t, db, "a", server.MentionStatusApproved)
+	setMentionStatus(t, db, "b", server.MentionStatusApproved)
+	setMentionStatus(t, db, "d", server.MentionStatusApproved)
+	setMentionStatus(t, db, "e", server.MentionStatusApproved)
+
+	list := func(u string, expectedStatus int) server.PagedMentionList {
+		t.Helper()
+		var res server.PagedMentionList
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodGet, u, nil)
+		srv.ServeHTTP(w, r.WithContext(server.AuthorizeContext(r.Context())))
+		require.Equal(t, expectedStatus, w.Code)
+		if expectedStatus == http.StatusOK {
+			require.NoError(t, json.NewDecoder(w.Body).Decode(&res))
+		}
+		return res
+	}
+
+	// The next URL keeps all filters and the sort order:
+	res := list("/manage/mentions?status=approved&target_prefix=https://target.com/posts/&type=reply&sort=source&limit=2", http.StatusOK)
+	require.Equal(t, 3, res.Total)
+	require.Equal(t, map[string]int{"new": 1, "verified": 0, "approved": 3, "rejected": 0, "invalid": 0}, res.Facets.Status)
+	require.Len(t, res.Items, 2)
+	require.Equal(t, "a", res.Items[0].ID)
+	require.Equal(t, "b", res.Items[1].ID)
+	next, err := url.Parse(res.Next)
+	require.NoError(t, err)
+	require.Equal(t, "approved", next.Query().Get("status"))
+	require.Equal(t, "https://target.com/posts/", next.Query().Get("target_prefix"))
+	require.Equal(t, "reply", next.Query().Get("type"))
+	require.Equal(t, "source", next.Query().Get("sort"))
+	require.NotEmpty(t, next.Query().Get("cursor"))
+
+	// New mentions don't shift the following page:
+	createMention(t, db, "0", "https://0.com/", "https://target.com/posts/0")
+	setMentionType(t, db, "0", "reply")
+	setMentionStatus(t, db, "0", server.MentionStatusApproved)
+	res = list(res.Next, http.StatusOK)
+	require.Len(t, res.Items, 1)
+	require.Equal(t, "d", res.Items[0].ID)
+	require.Empty(t, res.Next)
+
+	res = list("/manage/mentions?sort=-target&created_after=2000-01-01", http.StatusOK)
+	require.Equal(t, 6, res.Total)
+	require.Equal(t, "d", res.Items[0].ID)
+	res = list("/manage/mentions?created_before=2000-01-01T00:00:00Z", http.StatusOK)
+	require.Equal(t, 0, res.Total)
+
+	list("/manage/mentions?sort=status", http.StatusBadRequest)
+	list("/manage/mentions?created_after=yesterday", http.StatusBadRequest)
+	list("/manage/mentions?cursor=invalid", http.StatusBadRequest)
+	list("/manage/mentions?cursor="+next.Query().Get("cursor")+"&offset=1", http.StatusBadRequest)
+}
+
+func TestBulkMentions(t *testing.T) {
+	db := setupDatabase(t)
+	defer db.Close()
+	srv := setupServer(t, db)
+	createMention(t, db, "a", "https://spam.example/1", "https://target.com/1")
+	createMention(t, db, "b", "https://spam.example/2", "https://target.com/2")
+	createMention(t, db, "c", "https://friend.example/", "https://target.com/1")
+	setMentionStatus(t, db, "a", server.MentionStatusVerified)
+	setMentionStatus(t, db, "b", server.MentionStatusVerified)
+	setMentionStatus(t, db, "c", server.MentionStatusVerified)
+
+	bulk := func(body string, expectedStatus int) server.BulkResultList {
+		t.Helper()
+		var res server.BulkResultList
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodPost, "/manage/mentions/bulk", strings.NewReader(body))
+		srv.ServeHTTP(w, r.WithContext(server.AuthorizeContext(r.Context())))
+		require.Equal(t, expectedStatus, w.Code)
+		if expectedStatus == http.StatusOK {
+			require.NoError(t, json.NewDecoder(w.Body).Decode(&res))
+		}
+		return res
+	}
+
+	res := bulk(`{"action": "reject", "filter": "source_host=spam.example&status=verified"}`, http.StatusOK)
+	require.Equal(t, 2, res.Succeeded)
+	require.Equal(t, 0, res.Failed)
+	require.Len(t, res.Results, 2)
+	requireMetricValue(t, context.Background(), srv, "webmentiond_mentions{status=\"rejected\"}", 2)
+
+	res = bulk(`{"action": "approve", "ids": ["c", "unknown"]}`, http.StatusOK)
+	require.Equal(t, 1, res.Succeeded)
+	require.Equal(t, 1, res.Failed)
+	require.Equal(t, server.MentionStatusApproved, res.Results[0].Status)
+	require.Equal(t, "unknown", res.Results[1].ID)
+	require.NotEmpty(t, res.Results[1].Error)
+	requireMetricValue(t, context.Background(), srv, "webmentiond_mentions{status=\"approved\"}", 1)
+
+	res = bulk(`{"action": "delete", "filter": "status=rejected"}`, http.StatusOK)
+	require.Equal(t, 2, res.Succeeded)
+	requireMetricValue(t, context.Background(), srv, "webmentiond_mentions_total", 1)
+
+	bulk(`{"action": "archive", "ids": ["c"]}`, http.StatusBadRequest)
+	bulk(`{"action": "approve"}`, http.StatusBadRequest)
+	bulk(`{"action": "approve", "ids": ["c"], "filter": "status=new"}`, http.StatusBadRequest)
+	bulk(`{"action": "approve", "filter": "sort=status"}`, http.StatusBadRequest)
+	// Filters without a condition would select all mentions:
+	bulk(`{"action": "delete", "filter": "foo=bar"}`, http.StatusBadRequest)
+	bulk(`{"action": "delete", "filter": "limit=0"}`, http.StatusBadRequest)
+	bulk(`{"action": "delete", "filter": "q=%21%21"}`, http.StatusBadRequest)
+	requireMetricValue(t, context.Background(), srv, "webmentiond_mentions_total", 1)
+
+	res = bulk(`{"action": "reject", "filter": "target_prefix=https://target.com/&limit=5"}`, http.StatusOK)
+	require.Equal(t, 1, res.Succeeded)
+	require.Equal(t, "c", res.Results[0].ID)
+}
+
+func TestEditingMentions(t *testing.T) {
+	db := setupDatabase(t)
+	defer db.Close()
+	srv := setupServer(t, db)
+	createMention(t, db, "a", "https://a.com/", "https://target.com/")
+	setMentionTitle(t, db, "a", "Extracted")
+	setMentionContent(t, db, "a", "Extracted content")
+
+	send := func(method string, path string, body string, expectedStatus int) server.MentionDetails {
+		t.Helper()
+		var res server.MentionDetails
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(method, path, strings.NewReader(body))
+		srv.ServeHTTP(w, r.WithContext(server.AuthorizeContext(r.Context())))
+		require.Equal(t, expectedStatus, w.Code, w.Body.String())
+		if expectedStatus < 300 {
+			require.NoError(t, json.NewDecoder(w.Body).Decode(&res))
+		}
+		return res
+	}
+
+	res := send(http.MethodPatch, "/manage/mentions/a", `{"title": "Better title", "type": "reply"}`, http.StatusOK)
+	require.Equal(t, "Better title", res.Title)
+	require.Equal(t, "Extracted content", res.Content)
+	require.Equal(t, "reply", res.Type)
+	require.Equal(t, "Better title", *res.Overrides.Title)
+	require.Nil(t, res.Overrides.Content)
+
+	// A re-verification only changes the extracted values:
+	setMentionTitle(t, db, "a", "Extracted again")
+	res = send(http.MethodPatch, "/manage/mentions/a", `{"title": null, "content": ""}`, http.StatusOK)
+	require.Equal(t, "Extracted again", res.Title)
+	require.Equal(t, "", res.Content)
+	require.Equal(t, "reply", res.Type)
+
+	send(http.MethodPatch, "/manage/mentions/a", `{"source": "https://b.com/"}`, http.StatusBadRequest)
+	send(http.MethodPatch, "/manage/mentions/unknown", `{"title": "Title"}`, http.StatusNotFound)
+
+	res = send(http.MethodPost, "/manage/mentions", `{"source": "https://silo.example/replies/1", "target": "https://target.com/", "title": "Reply", "content": "Nice post!", "author_name": "Jane", "type": "reply", "published_at": "2024-01-01T12:00:00+01:00"}`, http.StatusCreated)
+	require.Equal(t, server.MentionOriginManual, res.Origin)
+	require.Equal(t, server.MentionStatusApproved, res.Status)
+	require.Equal(t, "Nice post!", res.Content)
+	require.Equal(t, "Jane", res.AuthorName)
+	require.Equal(t, "2024-01-01T11:00:00Z", res.PublishedAt)
+	requireMentionCount(t, db, 2)
+	requireMetricValue(t, context.Background(), srv, "webmentiond_mentions{status=\"approved\"}", 1)
+
+	// The public list contains manual mentions but not the overrides:
+	w := httptest.NewRecorder()
+	srv.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/get?target=https://target.com/", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Contains(t, w.Body.String(), `"content":"Nice post!"`)
+	require.NotContains(t, w.Body.String(), "overrides")
+
+	send(http.MethodPost, "/manage/mentions", `{"source": "https://silo.example/replies/1", "target": "https://target.com/"}`, http.StatusConflict)
+	send(http.MethodPost, "/manage/mentions", `{"source": "silo.example", "target": "https://target.com/"}`, http.StatusBadRequest)
+	send(http.MethodPost, "/manage/mentions", `{"source": "https://silo.example/2", "target": "https://target.com/", "status": "archived"}`, http.StatusBadRequest)
+}
+
 func TestApprovingMention(t *testing.T) {
 	db := setupDatabase(t)
 	defer db.Close()
@@ -216,5 +443,10 @@ func TestDeletingMention(t *testing.T) {
 	w := httptest.NewRecorder()
 	srv.ServeHTTP(w, r.WithContext(server.AuthorizeContext(r.Context())))
 	require.Equal(t, http.StatusOK, w.Code)
-	requireMentionNotExists(t, db, "a")
+	requireMentionStatus(t, db, "a", "new")
+
+	r = httptest.NewRequest(http.MethodGet, "/manage/mentions/a", nil)
+	w = httptest.NewRecorder()
+	srv.ServeHTTP(w, r.WithContext(server.AuthorizeContext(r.Context())))
+	require.Equal(t, http.StatusNotFound, w.Code)
 }
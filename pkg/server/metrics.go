@@ -11,7 +11,43 @@ var mentionsGauge = prometheus.NewGaugeVec(prometheus.GaugeOpts{
 	Name: "webmentiond_mentions",
 }, []string{"status"})
 
+var trashedMentionsGauge = prometheus.NewGauge(prometheus.GaugeOpts{
+	Name: "webmentiond_mentions_trashed",
+})
+
+var getCacheHits = prometheus.NewCounter(prometheus.CounterOpts{
+	Name: "webmentiond_get_cache_hits_total",
+})
+var getCacheMisses = prometheus.NewCounter(prometheus.CounterOpts{
+	Name: "webmentiond_get_cache_misses_total",
+})
+
+var backupLastSuccess = prometheus.NewGauge(prometheus.GaugeOpts{
+	Name: "webmentiond_backup_last_success_timestamp_seconds",
+})
+var backupFailures = prometheus.NewCounter(prometheus.CounterOpts{
+	Name: "webmentiond_backup_failures_total",
+})
+
+var purgedMentions = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "webmentiond_mentions_purged_total",
+}, []string{"status"})
+var tombstonedMentions = prometheus.NewCounter(prometheus.CounterOpts{
+	Name: "webmentiond_mentions_tombstoned_total",
+})
+var purgedTrash = prometheus.NewCounter(prometheus.CounterOpts{
+	Name: "webmentiond_trash_purged_total",
+})
+
 func init() {
 	prometheus.MustRegister(totalMentionsGauge)
 	prometheus.MustRegister(mentionsGauge)
+	prometheus.MustRegister(trashedMentionsGauge)
+	prometheus.MustRegister(getCacheHits)
+	prometheus.MustRegister(getCacheMisses)
+	prometheus.MustRegister(backupLastSuccess)
+	prometheus.MustRegister(backupFailures)
+	prometheus.MustRegister(purgedMentions)
+	prometheus.MustRegister(tombstonedMentions)
+	prometheus.MustRegister(purgedTrash)
 }
@@ -0,0 +1,15 @@
+CREATE TABLE IF NOT EXISTS feeds (
+    url TEXT PRIMARY KEY NOT NULL,
+    etag TEXT NOT NULL DEFAULT '',
+    last_modified TEXT NOT NULL DEFAULT '',
+    polled_at TEXT NOT NULL DEFAULT ''
+);
+
+CREATE TABLE IF NOT EXISTS feed_entries (
+    feed_url TEXT NOT NULL,
+    entry_id TEXT NOT NULL,
+    url TEXT NOT NULL,
+    updated_at TEXT NOT NULL DEFAULT '',
+    sent_at TEXT NOT NULL DEFAULT '',
+    PRIMARY KEY (feed_url, entry_id)
+);
@@ -0,0 +1,6 @@
+CREATE TABLE IF NOT EXISTS source_targets (
+    source TEXT NOT NULL,
+    target TEXT NOT NULL,
+    sent_at TEXT NOT NULL DEFAULT '',
+    PRIMARY KEY (source, target)
+);
@@ -0,0 +1,2 @@
+ALTER TABLE source_targets ADD COLUMN endpoint TEXT NOT NULL DEFAULT '';
+ALTER TABLE source_targets ADD COLUMN protocol TEXT NOT NULL DEFAULT '';
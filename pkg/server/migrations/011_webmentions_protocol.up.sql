@@ -0,0 +1 @@
+alter table webmentions add column protocol text not null default 'webmention';
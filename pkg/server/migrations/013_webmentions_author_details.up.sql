@@ -0,0 +1,3 @@
+alter table webmentions add column author_url text not null default '';
+alter table webmentions add column author_photo text not null default '';
+alter table webmentions add column published_at text not null default '';
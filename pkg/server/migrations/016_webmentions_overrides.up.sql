@@ -0,0 +1,5 @@
+alter table webmentions add column title_override text;
+alter table webmentions add column content_override text;
+alter table webmentions add column author_name_override text;
+alter table webmentions add column type_override text;
+alter table webmentions add column origin text not null default '';
@@ -0,0 +1,2 @@
+alter table webmentions add column deleted_at text not null default '';
+alter table webmentions add column deleted_by text not null default '';
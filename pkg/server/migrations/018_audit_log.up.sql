@@ -0,0 +1,18 @@
+CREATE TABLE IF NOT EXISTS audit_log (
+    id integer primary key,
+    created_at text not null,
+    actor text not null,
+    action text not null
+);
+
+CREATE INDEX IF NOT EXISTS audit_log_created_at ON audit_log (created_at);
+
+CREATE TABLE IF NOT EXISTS audit_log_targets (
+    entry_id integer not null,
+    target_id text not null,
+    status_before text not null default '',
+    status_after text not null default ''
+);
+
+CREATE INDEX IF NOT EXISTS audit_log_targets_entry ON audit_log_targets (entry_id);
+CREATE INDEX IF NOT EXISTS audit_log_targets_target ON audit_log_targets (target_id);
@@ -0,0 +1,9 @@
+ALTER TABLE webmentions ADD COLUMN moderated_at text not null default '';
+
+-- Mentions moderated before take the time of their first approval or
+-- rejection from the audit log:
+UPDATE webmentions SET moderated_at = COALESCE((
+    SELECT MIN(audit_log.created_at) FROM audit_log
+    JOIN audit_log_targets ON audit_log_targets.entry_id = audit_log.id
+    WHERE audit_log_targets.target_id = webmentions.id AND audit_log.action IN ('mention.approve', 'mention.reject')
+), '');
@@ -0,0 +1,14 @@
+CREATE TABLE IF NOT EXISTS deliveries (
+    source text not null,
+    target text not null,
+    endpoint text not null default '',
+    protocol text not null default '',
+    sent_at text not null default '',
+    primary key (source, target)
+);
+
+INSERT INTO deliveries (source, target, endpoint, protocol, sent_at)
+    SELECT source, target, endpoint, protocol, sent_at FROM source_targets WHERE protocol <> '';
+
+ALTER TABLE source_targets DROP COLUMN endpoint;
+ALTER TABLE source_targets DROP COLUMN protocol;
@@ -0,0 +1,9 @@
+-- Timestamps used to be written with the local offset of the server.
+-- They are only ordered and filtered correctly if all of them are in
+-- UTC:
+UPDATE webmentions SET created_at = strftime('%Y-%m-%dT%H:%M:%SZ', created_at)
+WHERE created_at NOT LIKE '%Z' AND strftime('%Y-%m-%dT%H:%M:%SZ', created_at) IS NOT NULL;
+UPDATE webmentions SET verified_at = strftime('%Y-%m-%dT%H:%M:%SZ', verified_at)
+WHERE verified_at NOT LIKE '%Z' AND strftime('%Y-%m-%dT%H:%M:%SZ', verified_at) IS NOT NULL;
+UPDATE webmention_revisions SET created_at = strftime('%Y-%m-%dT%H:%M:%SZ', created_at)
+WHERE created_at NOT LIKE '%Z' AND strftime('%Y-%m-%dT%H:%M:%SZ', created_at) IS NOT NULL;
@@ -0,0 +1,2 @@
+ALTER TABLE feed_entries ADD COLUMN pending_since text not null default '';
+ALTER TABLE feed_entries ADD COLUMN attempts integer not null default 0;
@@ -2,5 +2,13 @@ package migrations
 
 import "embed"
 
+// FS contains the migrations for SQLite.
+//
 //go:embed *.sql
 var FS embed.FS
+
+// PostgresFS contains the migrations for PostgreSQL inside the postgres
+// folder.
+//
+//go:embed postgres/*.sql
+var PostgresFS embed.FS
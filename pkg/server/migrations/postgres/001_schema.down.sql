@@ -0,0 +1,5 @@
+DROP TABLE IF EXISTS source_targets;
+DROP TABLE IF EXISTS feed_entries;
+DROP TABLE IF EXISTS feeds;
+DROP TABLE IF EXISTS url_policies;
+DROP TABLE IF EXISTS webmentions;
@@ -0,0 +1,48 @@
+CREATE TABLE IF NOT EXISTS webmentions (
+    id TEXT PRIMARY KEY NOT NULL,
+    source TEXT NOT NULL,
+    target TEXT NOT NULL,
+    created_at TEXT NOT NULL,
+    status TEXT NOT NULL DEFAULT 'new',
+    title TEXT NOT NULL DEFAULT '',
+    verified_at TEXT NOT NULL DEFAULT '',
+    content TEXT NOT NULL DEFAULT '',
+    author_name TEXT NOT NULL DEFAULT '',
+    type TEXT NOT NULL DEFAULT '',
+    rsvp TEXT NOT NULL DEFAULT '',
+    protocol TEXT NOT NULL DEFAULT 'webmention'
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS webmentions_source_target ON webmentions (source, target);
+
+CREATE TABLE IF NOT EXISTS url_policies (
+    id SERIAL PRIMARY KEY,
+    url_pattern TEXT,
+    policy TEXT,
+    weight INTEGER
+);
+
+CREATE TABLE IF NOT EXISTS feeds (
+    url TEXT PRIMARY KEY NOT NULL,
+    etag TEXT NOT NULL DEFAULT '',
+    last_modified TEXT NOT NULL DEFAULT '',
+    polled_at TEXT NOT NULL DEFAULT ''
+);
+
+CREATE TABLE IF NOT EXISTS feed_entries (
+    feed_url TEXT NOT NULL,
+    entry_id TEXT NOT NULL,
+    url TEXT NOT NULL,
+    updated_at TEXT NOT NULL DEFAULT '',
+    sent_at TEXT NOT NULL DEFAULT '',
+    PRIMARY KEY (feed_url, entry_id)
+);
+
+CREATE TABLE IF NOT EXISTS source_targets (
+    source TEXT NOT NULL,
+    target TEXT NOT NULL,
+    sent_at TEXT NOT NULL DEFAULT '',
+    endpoint TEXT NOT NULL DEFAULT '',
+    protocol TEXT NOT NULL DEFAULT '',
+    PRIMARY KEY (source, target)
+);
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS webmentions_status_created_at;
+DROP INDEX IF EXISTS webmentions_target_status_created_at;
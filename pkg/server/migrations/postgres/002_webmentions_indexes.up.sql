@@ -0,0 +1,2 @@
+CREATE INDEX IF NOT EXISTS webmentions_target_status_created_at ON webmentions (target, status, created_at);
+CREATE INDEX IF NOT EXISTS webmentions_status_created_at ON webmentions (status, created_at);
@@ -0,0 +1,3 @@
+ALTER TABLE webmentions DROP COLUMN published_at;
+ALTER TABLE webmentions DROP COLUMN author_photo;
+ALTER TABLE webmentions DROP COLUMN author_url;
@@ -0,0 +1,3 @@
+ALTER TABLE webmentions ADD COLUMN author_url TEXT NOT NULL DEFAULT '';
+ALTER TABLE webmentions ADD COLUMN author_photo TEXT NOT NULL DEFAULT '';
+ALTER TABLE webmentions ADD COLUMN published_at TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,7 @@
+CREATE TABLE IF NOT EXISTS webmention_tombstones (
+    source text not null,
+    target text not null,
+    status text not null,
+    purged_at text not null,
+    PRIMARY KEY (source, target)
+);
@@ -0,0 +1,13 @@
+CREATE TABLE IF NOT EXISTS webmention_verifications (
+    id serial primary key,
+    mention_id text not null,
+    verified_at text not null,
+    status text not null,
+    error text not null default '',
+    title text not null default '',
+    type text not null default '',
+    author_name text not null default '',
+    manual boolean not null default false
+);
+
+CREATE INDEX IF NOT EXISTS webmention_verifications_mention ON webmention_verifications (mention_id, verified_at);
@@ -0,0 +1,5 @@
+ALTER TABLE webmentions DROP COLUMN origin;
+ALTER TABLE webmentions DROP COLUMN type_override;
+ALTER TABLE webmentions DROP COLUMN author_name_override;
+ALTER TABLE webmentions DROP COLUMN content_override;
+ALTER TABLE webmentions DROP COLUMN title_override;
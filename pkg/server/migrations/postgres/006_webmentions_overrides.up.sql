@@ -0,0 +1,5 @@
+ALTER TABLE webmentions ADD COLUMN title_override TEXT;
+ALTER TABLE webmentions ADD COLUMN content_override TEXT;
+ALTER TABLE webmentions ADD COLUMN author_name_override TEXT;
+ALTER TABLE webmentions ADD COLUMN type_override TEXT;
+ALTER TABLE webmentions ADD COLUMN origin TEXT NOT NULL DEFAULT '';
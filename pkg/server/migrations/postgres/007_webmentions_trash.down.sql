@@ -0,0 +1,2 @@
+ALTER TABLE webmentions DROP COLUMN deleted_by;
+ALTER TABLE webmentions DROP COLUMN deleted_at;
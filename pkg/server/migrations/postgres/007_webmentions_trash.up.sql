@@ -0,0 +1,2 @@
+ALTER TABLE webmentions ADD COLUMN deleted_at TEXT NOT NULL DEFAULT '';
+ALTER TABLE webmentions ADD COLUMN deleted_by TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS audit_log_targets;
+DROP TABLE IF EXISTS audit_log;
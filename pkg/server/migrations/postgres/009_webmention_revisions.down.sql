@@ -0,0 +1,2 @@
+ALTER TABLE webmentions DROP COLUMN pinned_revision;
+DROP TABLE IF EXISTS webmention_revisions;
@@ -0,0 +1,19 @@
+CREATE TABLE IF NOT EXISTS webmention_revisions (
+    id serial primary key,
+    mention_id text not null,
+    revision integer not null,
+    created_at text not null,
+    title text not null default '',
+    content text not null default '',
+    author_name text not null default '',
+    type text not null default '',
+    rsvp text not null default '',
+    UNIQUE (mention_id, revision)
+);
+
+ALTER TABLE webmentions ADD COLUMN pinned_revision integer not null default 0;
+
+-- The data of mentions that have been verified successfully before
+-- becomes their first revision:
+INSERT INTO webmention_revisions (mention_id, revision, created_at, title, content, author_name, type, rsvp)
+SELECT id, 1, verified_at, title, content, author_name, type, rsvp FROM webmentions WHERE verified_at <> '' AND status <> 'invalid';
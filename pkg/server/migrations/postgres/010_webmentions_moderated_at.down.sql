@@ -0,0 +1 @@
+ALTER TABLE webmentions DROP COLUMN moderated_at;
@@ -0,0 +1,7 @@
+ALTER TABLE source_targets ADD COLUMN endpoint text not null default '';
+ALTER TABLE source_targets ADD COLUMN protocol text not null default '';
+
+UPDATE source_targets SET endpoint = d.endpoint, protocol = d.protocol
+    FROM deliveries d WHERE d.source = source_targets.source AND d.target = source_targets.target;
+
+DROP TABLE IF EXISTS deliveries;
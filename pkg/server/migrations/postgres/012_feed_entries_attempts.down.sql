@@ -0,0 +1,2 @@
+ALTER TABLE feed_entries DROP COLUMN attempts;
+ALTER TABLE feed_entries DROP COLUMN pending_since;
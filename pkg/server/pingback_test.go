@@ -0,0 +1,90 @@
+package server_test
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/require"
+	"github.com/zerok/webmentiond/pkg/server"
+	"github.com/zerok/webmentiond/pkg/webmention"
+)
+
+type xmlrpcResult struct {
+	Params []string `xml:"params>param>value>string"`
+	Fault  []struct {
+		Name  string `xml:"name"`
+		Value string `xml:"value>int"`
+	} `xml:"fault>value>struct>member"`
+}
+
+func (r xmlrpcResult) FaultCode() string {
+	for _, m := range r.Fault {
+		if m.Name == "faultCode" {
+			return m.Value
+		}
+	}
+	return ""
+}
+
+func (e *conformanceEnvironment) SendPingback(t *testing.T, method string, source string, target string) xmlrpcResult {
+	t.Helper()
+	body := fmt.Sprintf(`<?xml version="1.0"?>
+<methodCall><methodName>%s</methodName><params>
+<param><value><string>%s</string></value></param>
+<param><value><string>%s</string></value></param>
+</params></methodCall>`, method, source, target)
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/xmlrpc", bytes.NewBufferString(body))
+	req.Header.Set("Content-Type", "text/xml")
+	e.Srv.ServeHTTP(w, req.WithContext(e.Ctx))
+	require.Equal(t, http.StatusOK, w.Code)
+	result := xmlrpcResult{}
+	require.NoError(t, xml.NewDecoder(w.Body).Decode(&result))
+	return result
+}
+
+func TestReceivePingback(t *testing.T) {
+	for _, backend := range testBackends {
+		t.Run(backend.Name, func(t *testing.T) {
+			testReceivePingback(t, backend)
+		})
+	}
+}
+
+func testReceivePingback(t *testing.T, backend testBackend) {
+	e := createConformanceEnvironment(t, backend)
+	defer e.Destroy()
+	mux := chi.NewRouter()
+	mux.Get("/actual", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `<html><body><a href="https://allowed.com/">Target</a></body></html>`)
+	})
+	src := httptest.NewServer(mux)
+	defer src.Close()
+
+	res := e.SendPingback(t, "pingback.ping", src.URL+"/actual", "https://allowed.com/")
+	require.Empty(t, res.FaultCode())
+	require.Equal(t, []string{"Pingback accepted"}, res.Params)
+	requireMentionWithStatus(t, e.Ctx, e.Store, "https://allowed.com/", server.MentionStatusNew)
+	mentions, err := e.Store.ListMentions(e.Ctx, server.MentionFilter{Target: "https://allowed.com/"})
+	require.NoError(t, err)
+	require.Len(t, mentions, 1)
+	require.Equal(t, webmention.ProtocolPingback, mentions[0].Protocol)
+
+	e.VerifyNextMention(t)
+	requireMentionWithStatus(t, e.Ctx, e.Store, "https://allowed.com/", server.MentionStatusVerified)
+
+	res = e.SendPingback(t, "pingback.ping", src.URL+"/actual", "https://allowed.com/")
+	require.Equal(t, fmt.Sprint(webmention.PingbackFaultAlreadyRegistered), res.FaultCode())
+	requireMentionWithStatus(t, e.Ctx, e.Store, "https://allowed.com/", server.MentionStatusVerified)
+
+	res = e.SendPingback(t, "pingback.ping", src.URL+"/actual", "https://not-allowed.com/")
+	require.Equal(t, fmt.Sprint(webmention.PingbackFaultTargetInvalid), res.FaultCode())
+
+	res = e.SendPingback(t, "pingback.extensions.getPingbacks", src.URL+"/actual", "https://allowed.com/")
+	require.Equal(t, fmt.Sprint(webmention.XMLRPCFaultMethodNotFound), res.FaultCode())
+}
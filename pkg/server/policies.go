@@ -2,9 +2,13 @@ package server
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
+	"regexp"
+	"strconv"
 
 	"github.com/go-chi/chi/v5"
+	"github.com/zerok/webmentiond/pkg/policies"
 )
 
 type policy struct {
@@ -30,52 +34,52 @@ func (s *Server) handleListPolicies(w http.ResponseWriter, r *http.Request) {
 
 func (srv *Server) handleDeletePolicy(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
-	id := chi.URLParam(r, "id")
-	tx, err := srv.cfg.Database.BeginTx(ctx, nil)
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
 	if err != nil {
-		srv.sendError(ctx, w, &HTTPError{StatusCode: http.StatusInternalServerError, Err: err})
-		return
-	}
-	_, err = tx.ExecContext(ctx, "DELETE FROM url_policies WHERE id = ?", id)
-	if err != nil {
-		srv.sendError(ctx, w, &HTTPError{StatusCode: http.StatusInternalServerError, Err: err})
+		srv.sendError(ctx, w, &HTTPError{StatusCode: http.StatusBadRequest, Err: err})
 		return
 	}
-	if err := tx.Commit(); err != nil {
+	if err := srv.cfg.PolicyStore.DeletePolicy(ctx, id); err != nil {
+		if errors.Is(err, ErrPolicyNotFound) {
+			srv.sendError(ctx, w, &HTTPError{StatusCode: http.StatusNotFound, Err: err})
+			return
+		}
 		srv.sendError(ctx, w, &HTTPError{StatusCode: http.StatusInternalServerError, Err: err})
 		return
 	}
 	srv.reloadPolicies(ctx)
+	srv.audit(ctx, AuditActionDeletePolicy, AuditTarget{ID: strconv.Itoa(id)})
 }
 
 func (srv *Server) handleCreatePolicy(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
-	tx, err := srv.cfg.Database.BeginTx(ctx, nil)
-	if err != nil {
-		srv.sendError(ctx, w, &HTTPError{StatusCode: http.StatusInternalServerError, Err: err})
-		return
-	}
 	p := policy{}
 	if err := json.NewDecoder(r.Body).Decode(&p); err != nil {
 		srv.sendError(ctx, w, &HTTPError{StatusCode: http.StatusBadRequest, Err: err})
 		return
 	}
 	if p.URLPattern == "" {
-		srv.sendError(ctx, w, &HTTPError{Message: "No URL pattern provided", StatusCode: http.StatusBadRequest, Err: err})
+		srv.sendError(ctx, w, &HTTPError{Message: "No URL pattern provided", StatusCode: http.StatusBadRequest})
 		return
 	}
 	if p.Policy != "approve" {
-		srv.sendError(ctx, w, &HTTPError{Message: "Unsupported policy provided", StatusCode: http.StatusBadRequest, Err: err})
+		srv.sendError(ctx, w, &HTTPError{Message: "Unsupported policy provided", StatusCode: http.StatusBadRequest})
 		return
 	}
-	_, err = tx.ExecContext(ctx, "INSERT INTO url_policies (url_pattern, policy, weight) VALUES (?,?,?)", p.URLPattern, p.Policy, p.Weight)
+	pattern, err := regexp.Compile(p.URLPattern)
 	if err != nil {
-		srv.sendError(ctx, w, &HTTPError{StatusCode: http.StatusInternalServerError, Err: err})
+		srv.sendError(ctx, w, &HTTPError{Message: "Invalid URL pattern provided", StatusCode: http.StatusBadRequest, Err: err})
 		return
 	}
-	if err := tx.Commit(); err != nil {
+	id, err := srv.cfg.PolicyStore.CreatePolicy(ctx, policies.URLPolicy{
+		URLPattern: pattern,
+		Policy:     policies.Policy(p.Policy),
+		Weight:     p.Weight,
+	})
+	if err != nil {
 		srv.sendError(ctx, w, &HTTPError{StatusCode: http.StatusInternalServerError, Err: err})
 		return
 	}
 	srv.reloadPolicies(ctx)
+	srv.audit(ctx, AuditActionCreatePolicy, AuditTarget{ID: strconv.Itoa(id)})
 }
@@ -1,13 +1,15 @@
 package server
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"time"
 
-	"github.com/mattn/go-sqlite3"
 	"github.com/rs/xid"
+	"github.com/rs/zerolog"
 	"github.com/zerok/webmentiond/pkg/webmention"
 )
 
@@ -20,42 +22,91 @@ func (srv *Server) handleReceive(w http.ResponseWriter, r *http.Request) {
 		srv.sendError(ctx, w, &HTTPError{StatusCode: http.StatusBadRequest, Err: err})
 		return
 	}
-	if srv.cfg.Receiver.TargetPolicy != nil {
-		if !srv.cfg.Receiver.TargetPolicy(httptest.NewRequest(http.MethodGet, m.Target, nil)) {
-			srv.sendError(ctx, w, &HTTPError{StatusCode: http.StatusBadRequest, Err: fmt.Errorf("target domain not allowed")})
-			return
-		}
+	if !srv.targetAllowed(m.Target) {
+		srv.sendError(ctx, w, &HTTPError{StatusCode: http.StatusBadRequest, Err: fmt.Errorf("target domain not allowed")})
+		return
 	}
-	tx, err := srv.cfg.Database.BeginTx(ctx, nil)
-	if err != nil {
+	if err := srv.storeMention(ctx, m, webmention.ProtocolWebmention, true); err != nil {
 		srv.sendError(ctx, w, &HTTPError{StatusCode: http.StatusInternalServerError, Err: err})
 		return
 	}
-	now := time.Now()
-	id := xid.New()
-	if _, err = tx.ExecContext(ctx, "insert into webmentions (id, source, target, created_at, status) VALUES (?, ?, ?, ?, ?)", id.String(), m.Source, m.Target, now.Format(time.RFC3339), MentionStatusNew); err != nil {
-		if e, ok := err.(sqlite3.Error); ok && e.Code == sqlite3.ErrConstraint {
-			if _, err := tx.ExecContext(ctx, "UPDATE webmentions SET status = ? WHERE source = ? and target = ?", MentionStatusNew, m.Source, m.Target); err != nil {
-				srv.sendError(ctx, w, &HTTPError{StatusCode: http.StatusInternalServerError, Err: err})
-				tx.Rollback()
-				return
-			}
-			if err := tx.Commit(); err != nil {
-				tx.Rollback()
-				srv.sendError(ctx, w, &HTTPError{StatusCode: http.StatusInternalServerError, Err: err})
-			}
-			w.WriteHeader(http.StatusAccepted)
+	w.WriteHeader(http.StatusAccepted)
+	_, _ = fmt.Fprint(w, "Webmention accepted")
+}
+
+// handleXMLRPC implements the pingback.ping XML-RPC method. Accepted
+// pingbacks are stored just like webmentions and go through the same
+// verification process.
+func (srv *Server) handleXMLRPC(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	logger := zerolog.Ctx(ctx)
+	m, err := webmention.ExtractPingback(r)
+	if err != nil {
+		logger.Debug().Err(err).Msg("Invalid pingback received")
+		webmention.WritePingbackFault(w, err)
+		return
+	}
+	if !srv.targetAllowed(m.Target) {
+		webmention.WritePingbackFault(w, &webmention.PingbackFault{Code: webmention.PingbackFaultTargetInvalid, Message: "target domain not allowed"})
+		return
+	}
+	if err := srv.storeMention(ctx, m, webmention.ProtocolPingback, false); err != nil {
+		if errors.Is(err, ErrMentionExists) {
+			webmention.WritePingbackFault(w, &webmention.PingbackFault{Code: webmention.PingbackFaultAlreadyRegistered, Message: "pingback already registered"})
 			return
 		}
-		srv.sendError(ctx, w, &HTTPError{StatusCode: http.StatusInternalServerError, Err: err})
-		tx.Rollback()
+		logger.Error().Err(err).Msg("Failed to store pingback")
+		webmention.WritePingbackFault(w, &webmention.PingbackFault{Code: webmention.PingbackFaultGeneric, Message: "failed to store pingback"})
 		return
 	}
-	if err := tx.Commit(); err != nil {
-		tx.Rollback()
-		srv.sendError(ctx, w, &HTTPError{StatusCode: http.StatusInternalServerError, Err: err})
+	webmention.WritePingbackResponse(w, "Pingback accepted")
+}
+
+func (srv *Server) targetAllowed(target string) bool {
+	if srv.cfg.Receiver.TargetPolicy == nil {
+		return true
+	}
+	return srv.cfg.Receiver.TargetPolicy(httptest.NewRequest(http.MethodGet, target, nil))
+}
+
+// storeMention stores the mention in the "new" state. If it has been
+// received before, it is reset to "new" so that it gets verified again
+// unless resetExisting is false. In that case ErrMentionExists is
+// returned. Mentions that were rejected and pruned before or that are
+// in the trash are ignored.
+func (srv *Server) storeMention(ctx context.Context, m *webmention.Mention, protocol string, resetExisting bool) error {
+	tombstoned, err := srv.cfg.MentionStore.HasTombstone(ctx, m.Source, m.Target)
+	if err != nil {
+		return err
 	}
+	if tombstoned {
+		zerolog.Ctx(ctx).Info().Msgf("Ignoring previously rejected mention from %s", m.Source)
+		tombstonedMentions.Inc()
+		return nil
+	}
+	err = srv.cfg.MentionStore.CreateMention(ctx, Mention{
+		ID:        xid.New().String(),
+		Source:    m.Source,
+		Target:    m.Target,
+		CreatedAt: formatTimestamp(time.Now()),
+		Status:    MentionStatusNew,
+		Protocol:  protocol,
+	})
+	if errors.Is(err, ErrMentionExists) && resetExisting {
+		err = srv.cfg.MentionStore.ResetMention(ctx, m.Source, m.Target)
+		if errors.Is(err, ErrMentionNotFound) {
+			// Mentions in the trash stay there until they are
+			// restored or purged.
+			zerolog.Ctx(ctx).Info().Msgf("Ignoring deleted mention from %s", m.Source)
+			return nil
+		}
+		srv.invalidateTarget(m.Target)
+		return err
+	}
+	if err != nil {
+		return err
+	}
+	srv.invalidateTarget(m.Target)
 	srv.UpdateGlobalMetrics(ctx)
-	w.WriteHeader(http.StatusAccepted)
-	_, _ = fmt.Fprint(w, "Webmention accepted")
+	return nil
 }
@@ -1,7 +1,105 @@
 package server
 
 type PagedMentionList struct {
-	Items []Mention `json:"items"`
-	Total int       `json:"total"`
-	Next  string    `json:"next,omitempty"`
+	Items  []Mention      `json:"items"`
+	Total  int            `json:"total"`
+	Next   string         `json:"next,omitempty"`
+	Facets *MentionFacets `json:"facets,omitempty"`
+}
+
+// MentionFacets contain the number of mentions per status that match
+// all filters of a list request apart from the status.
+type MentionFacets struct {
+	Status map[string]int `json:"status"`
+}
+
+// BulkResultList is the response to a bulk moderation request.
+type BulkResultList struct {
+	Action    string       `json:"action"`
+	Results   []BulkResult `json:"results"`
+	Succeeded int          `json:"succeeded"`
+	Failed    int          `json:"failed"`
+}
+
+// MentionDetails is a mention together with its verification history,
+// starting with the latest verification.
+type MentionDetails struct {
+	Mention
+	Verifications []Verification `json:"verifications"`
+}
+
+// PagedAuditLog is a page of the audit log, starting with the latest
+// entry.
+type PagedAuditLog struct {
+	Items []AuditEntry `json:"items"`
+	Total int          `json:"total"`
+	Next  string       `json:"next,omitempty"`
+}
+
+// RevisionList contains the revisions of a mention starting with the
+// latest one.
+type RevisionList struct {
+	// PinnedRevision is the number of the revision shown for the
+	// mention if one has been pinned.
+	PinnedRevision int               `json:"pinned_revision,omitempty"`
+	Items          []RevisionDetails `json:"items"`
+}
+
+// RevisionDetails is a revision together with the changes compared to
+// the revision before it.
+type RevisionDetails struct {
+	Revision
+	Changes []RevisionChange `json:"changes"`
+}
+
+// RevisionChange is a single field that differs between two revisions.
+type RevisionChange struct {
+	Field  string `json:"field"`
+	Before string `json:"before"`
+	After  string `json:"after"`
+}
+
+// Stats summarize the mentions received within a time range.
+type Stats struct {
+	CreatedAfter  string `json:"created_after"`
+	CreatedBefore string `json:"created_before"`
+	// Interval is the length of the periods in Series, either "day" or
+	// "week".
+	Interval   string        `json:"interval"`
+	Total      int           `json:"total"`
+	Series     []StatsPeriod `json:"series"`
+	TopSources []StatsCount  `json:"top_sources"`
+	TopTargets []StatsCount  `json:"top_targets"`
+	// SourceApproval lists the source domains with the most approved
+	// or rejected mentions.
+	SourceApproval []SourceApproval `json:"source_approval"`
+	Moderated      int              `json:"moderated"`
+	// MedianModerationSeconds is the median time between receiving a
+	// mention and an admin approving or rejecting it. It is nil if no
+	// mention has been moderated.
+	MedianModerationSeconds *float64 `json:"median_moderation_seconds"`
+}
+
+// StatsPeriod contains the number of mentions received within a single
+// day or week of a time series.
+type StatsPeriod struct {
+	Start    string         `json:"start"`
+	Total    int            `json:"total"`
+	ByType   map[string]int `json:"by_type"`
+	ByStatus map[string]int `json:"by_status"`
+}
+
+// StatsCount is an entry of a top list.
+type StatsCount struct {
+	Name  string `json:"name"`
+	Count int    `json:"count"`
+}
+
+// SourceApproval is the share of approved mentions of a source domain
+// among all of its moderated mentions.
+type SourceApproval struct {
+	Domain   string  `json:"domain"`
+	Approved int     `json:"approved"`
+	Rejected int     `json:"rejected"`
+	Ratio    float64 `json:"ratio"`
 }
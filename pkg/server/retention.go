@@ -0,0 +1,116 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+// DefaultJanitorInterval is used by StartJanitor if no interval is
+// configured.
+const DefaultJanitorInterval = time.Hour
+
+// tombstoneStatuses lists the statuses for which tombstones are kept
+// when mentions are pruned. Rejected mentions are usually spam that
+// would otherwise show up again as new once it is sent again.
+var tombstoneStatuses = map[string]bool{
+	MentionStatusRejected: true,
+}
+
+// ValidateRetention checks that all statuses in periods exist and all
+// periods are positive.
+func ValidateRetention(periods map[string]time.Duration) error {
+	for status, period := range periods {
+		switch status {
+		case MentionStatusNew, MentionStatusVerified, MentionStatusApproved, MentionStatusRejected, MentionStatusInvalid:
+		default:
+			return fmt.Errorf("unknown mention status %s", status)
+		}
+		if period <= 0 {
+			return fmt.Errorf("retention period for %s mentions must be positive", status)
+		}
+	}
+	return nil
+}
+
+// PruneMentions removes all mentions that are older than the retention
+// period configured for their status and returns how many mentions
+// were removed per status. With dryRun, nothing is removed and the
+// mentions that would be removed are counted instead.
+func (srv *Server) PruneMentions(ctx context.Context, dryRun bool) (map[string]int, error) {
+	periods := srv.cfg.Retention.Periods
+	if err := ValidateRetention(periods); err != nil {
+		return nil, err
+	}
+	statuses := make([]string, 0, len(periods))
+	for status := range periods {
+		statuses = append(statuses, status)
+	}
+	sort.Strings(statuses)
+	now := time.Now()
+	result := make(map[string]int, len(statuses))
+	total := 0
+	for _, status := range statuses {
+		count, err := srv.cfg.MentionStore.PruneMentions(ctx, PruneOptions{
+			Status:    status,
+			Before:    now.Add(-periods[status]),
+			Tombstone: tombstoneStatuses[status],
+			DryRun:    dryRun,
+		})
+		if err != nil {
+			return result, fmt.Errorf("failed to prune %s mentions: %w", status, err)
+		}
+		result[status] = count
+		total += count
+		if !dryRun {
+			purgedMentions.WithLabelValues(status).Add(float64(count))
+		}
+	}
+	if !dryRun && total > 0 {
+		srv.getCache.Clear()
+		srv.UpdateGlobalMetrics(ctx)
+	}
+	return result, nil
+}
+
+// StartJanitor periodically prunes mentions according to the
+// configured retention periods and purges old mentions from the trash.
+// It does nothing if neither is configured.
+func (srv *Server) StartJanitor(ctx context.Context) {
+	if len(srv.cfg.Retention.Periods) == 0 && srv.cfg.Retention.Trash <= 0 {
+		return
+	}
+	logger := zerolog.Ctx(ctx)
+	interval := srv.cfg.Retention.Interval
+	if interval <= 0 {
+		interval = DefaultJanitorInterval
+	}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			pruned, err := srv.PruneMentions(ctx, false)
+			if err != nil {
+				logger.Error().Err(err).Msg("Failed to prune mentions")
+			}
+			for status, count := range pruned {
+				if count > 0 {
+					logger.Info().Msgf("Pruned %d %s mentions", count, status)
+				}
+			}
+			if purged, err := srv.PurgeTrash(ctx); err != nil {
+				logger.Error().Err(err).Msg("Failed to purge trash")
+			} else if purged > 0 {
+				logger.Info().Msgf("Purged %d mentions from the trash", purged)
+			}
+			select {
+			case <-ticker.C:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
@@ -0,0 +1,80 @@
+package server_test
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/zerok/webmentiond/pkg/server"
+)
+
+func TestPruneMentions(t *testing.T) {
+	ctx := context.Background()
+	store := server.NewMemoryStore()
+	srv := server.New(func(c *server.Configuration) {
+		c.MentionStore = store
+		c.ExposeMetrics = true
+		c.Retention.Periods = map[string]time.Duration{
+			server.MentionStatusInvalid:  30 * 24 * time.Hour,
+			server.MentionStatusRejected: 90 * 24 * time.Hour,
+		}
+	})
+	old := time.Now().Add(-100 * 24 * time.Hour).UTC().Format(time.RFC3339)
+	recent := time.Now().Add(-40 * 24 * time.Hour).UTC().Format(time.RFC3339)
+	for _, m := range []server.Mention{
+		{ID: "old-invalid", Source: "https://a.com", Target: "https://target.com/", CreatedAt: old, Status: server.MentionStatusInvalid},
+		{ID: "old-rejected", Source: "https://spam.com", Target: "https://target.com/", CreatedAt: old, Status: server.MentionStatusRejected},
+		{ID: "recent-rejected", Source: "https://c.com", Target: "https://target.com/", CreatedAt: recent, Status: server.MentionStatusRejected},
+		{ID: "old-approved", Source: "https://d.com", Target: "https://target.com/", CreatedAt: old, Status: server.MentionStatusApproved},
+	} {
+		require.NoError(t, store.CreateMention(ctx, m))
+	}
+
+	pruned, err := srv.PruneMentions(ctx, true)
+	require.NoError(t, err)
+	require.Equal(t, map[string]int{server.MentionStatusInvalid: 1, server.MentionStatusRejected: 1}, pruned)
+	count, err := store.CountMentions(ctx, server.MentionFilter{})
+	require.NoError(t, err)
+	require.Equal(t, 4, count)
+
+	pruned, err = srv.PruneMentions(ctx, false)
+	require.NoError(t, err)
+	require.Equal(t, map[string]int{server.MentionStatusInvalid: 1, server.MentionStatusRejected: 1}, pruned)
+	mentions, err := store.ListMentions(ctx, server.MentionFilter{OldestFirst: true})
+	require.NoError(t, err)
+	require.Len(t, mentions, 2)
+	requireMetricValue(t, ctx, srv, `webmentiond_mentions_purged_total{status="rejected"}`, 1)
+
+	// Pruned spam isn't accepted again while the purged invalid
+	// mention is:
+	receive := func(source string) {
+		data := url.Values{}
+		data.Set("source", source)
+		data.Set("target", "https://target.com/")
+		r := httptest.NewRequest(http.MethodPost, "/receive", bytes.NewBufferString(data.Encode()))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		w := httptest.NewRecorder()
+		srv.ServeHTTP(w, r)
+		require.Equal(t, http.StatusAccepted, w.Code)
+	}
+	receive("https://spam.com")
+	receive("https://a.com")
+	count, err = store.CountMentions(ctx, server.MentionFilter{Source: "https://spam.com"})
+	require.NoError(t, err)
+	require.Equal(t, 0, count)
+	count, err = store.CountMentions(ctx, server.MentionFilter{Source: "https://a.com", Status: server.MentionStatusNew})
+	require.NoError(t, err)
+	require.Equal(t, 1, count)
+
+	invalid := server.New(func(c *server.Configuration) {
+		c.MentionStore = store
+		c.Retention.Periods = map[string]time.Duration{"unknown": time.Hour}
+	})
+	_, err = invalid.PruneMentions(ctx, true)
+	require.Error(t, err)
+}
@@ -0,0 +1,106 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// handleListRevisions lists the revisions of a mention together with
+// what changed in each of them.
+func (srv *Server) handleListRevisions(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	m, err := srv.cfg.MentionStore.GetMention(ctx, chi.URLParam(r, "id"))
+	if err != nil {
+		if errors.Is(err, ErrMentionNotFound) {
+			err = &HTTPError{StatusCode: http.StatusNotFound, Err: err}
+		}
+		srv.sendError(ctx, w, err)
+		return
+	}
+	revisions, err := srv.cfg.MentionStore.ListRevisions(ctx, m.ID)
+	if err != nil {
+		srv.sendError(ctx, w, err)
+		return
+	}
+	list := RevisionList{
+		PinnedRevision: m.PinnedRevision,
+		Items:          make([]RevisionDetails, 0, len(revisions)),
+	}
+	for i, rev := range revisions {
+		// The first revision is compared with an empty one.
+		previous := Revision{}
+		if i+1 < len(revisions) {
+			previous = revisions[i+1]
+		}
+		list.Items = append(list.Items, RevisionDetails{Revision: rev, Changes: diffRevisions(previous, rev)})
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(list)
+}
+
+// diffRevisions returns the fields that differ between two revisions.
+func diffRevisions(before Revision, after Revision) []RevisionChange {
+	changes := make([]RevisionChange, 0, 5)
+	for _, c := range []RevisionChange{
+		{Field: "title", Before: before.Title, After: after.Title},
+		{Field: "content", Before: before.Content, After: after.Content},
+		{Field: "author_name", Before: before.AuthorName, After: after.AuthorName},
+		{Field: "type", Before: before.Type, After: after.Type},
+		{Field: "rsvp", Before: before.RSVP, After: after.RSVP},
+	} {
+		if c.Before != c.After {
+			changes = append(changes, c)
+		}
+	}
+	return changes
+}
+
+type pinRequest struct {
+	Revision int `json:"revision"`
+}
+
+// handlePinRevision shows the details of the given revision of a
+// mention even if its source changes afterwards.
+func (srv *Server) handlePinRevision(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	req := pinRequest{}
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxMentionRequestSize)).Decode(&req); err != nil {
+		srv.sendError(ctx, w, &HTTPError{StatusCode: http.StatusBadRequest, Err: err, Message: "Invalid request"})
+		return
+	}
+	if req.Revision < 1 {
+		srv.sendError(ctx, w, &HTTPError{StatusCode: http.StatusBadRequest, Err: fmt.Errorf("invalid revision: %d", req.Revision)})
+		return
+	}
+	srv.pinRevision(w, r, req.Revision, AuditActionPinRevision)
+}
+
+// handleUnpinRevision shows the details of the latest revision of a
+// mention again.
+func (srv *Server) handleUnpinRevision(w http.ResponseWriter, r *http.Request) {
+	srv.pinRevision(w, r, 0, AuditActionUnpinRevision)
+}
+
+func (srv *Server) pinRevision(w http.ResponseWriter, r *http.Request, number int, action string) {
+	ctx := r.Context()
+	id := chi.URLParam(r, "id")
+	if err := srv.cfg.MentionStore.PinRevision(ctx, id, number); err != nil {
+		if errors.Is(err, ErrMentionNotFound) || errors.Is(err, ErrRevisionNotFound) {
+			err = &HTTPError{StatusCode: http.StatusNotFound, Err: err}
+		}
+		srv.sendError(ctx, w, err)
+		return
+	}
+	m, err := srv.cfg.MentionStore.GetMention(ctx, id)
+	if err != nil {
+		srv.sendError(ctx, w, err)
+		return
+	}
+	srv.invalidateTarget(m.Target)
+	srv.audit(ctx, action, AuditTarget{ID: m.ID, StatusBefore: m.Status, StatusAfter: m.Status})
+	srv.sendMentionDetails(ctx, w, m, http.StatusOK)
+}
@@ -0,0 +1,210 @@
+package server
+
+import (
+	"context"
+	"database/sql"
+	"html"
+	"strings"
+	"unicode"
+)
+
+// searchSnippetLength is the maximum number of characters of a mention
+// included in a search snippet.
+const searchSnippetLength = 160
+
+// The search index is kept in sync with the webmentions table by the
+// triggers below. Their existence also tells the SQLStore that the
+// index can be used. The version in their names is increased whenever
+// the indexed values change so that existing indexes get rebuilt.
+const searchIndexTrigger = "webmentions_fts_insert_v2"
+
+var searchIndexSetup = append(searchIndexTeardown,
+	"CREATE VIRTUAL TABLE IF NOT EXISTS webmentions_fts USING fts5(id UNINDEXED, title, content, author_name, source, target, tokenize = 'unicode61 remove_diacritics 2')",
+	"DELETE FROM webmentions_fts",
+	"INSERT INTO webmentions_fts (id, title, content, author_name, source, target) SELECT id, "+mentionTitle+", "+mentionContent+", "+mentionAuthorName+", source, target FROM webmentions",
+	`CREATE TRIGGER IF NOT EXISTS webmentions_fts_insert_v2 AFTER INSERT ON webmentions BEGIN
+		INSERT INTO webmentions_fts (id, title, content, author_name, source, target) VALUES (new.id, COALESCE(new.title_override, new.title), COALESCE(new.content_override, new.content), COALESCE(new.author_name_override, new.author_name), new.source, new.target);
+	END`,
+	`CREATE TRIGGER IF NOT EXISTS webmentions_fts_update_v2 AFTER UPDATE OF title, content, author_name, title_override, content_override, author_name_override ON webmentions BEGIN
+		DELETE FROM webmentions_fts WHERE id = old.id;
+		INSERT INTO webmentions_fts (id, title, content, author_name, source, target) VALUES (new.id, COALESCE(new.title_override, new.title), COALESCE(new.content_override, new.content), COALESCE(new.author_name_override, new.author_name), new.source, new.target);
+	END`,
+	`CREATE TRIGGER IF NOT EXISTS webmentions_fts_delete_v2 AFTER DELETE ON webmentions BEGIN
+		DELETE FROM webmentions_fts WHERE id = old.id;
+	END`,
+)
+
+// searchIndexTeardown drops the triggers of all versions.
+var searchIndexTeardown = []string{
+	"DROP TRIGGER IF EXISTS webmentions_fts_insert",
+	"DROP TRIGGER IF EXISTS webmentions_fts_update",
+	"DROP TRIGGER IF EXISTS webmentions_fts_delete",
+	"DROP TRIGGER IF EXISTS webmentions_fts_insert_v2",
+	"DROP TRIGGER IF EXISTS webmentions_fts_update_v2",
+	"DROP TRIGGER IF EXISTS webmentions_fts_delete_v2",
+}
+
+// ensureSQLiteSearchIndex creates the FTS5 index of mentions if the
+// SQLite library supports it and reports whether the index is
+// available. As FTS5 is optional, the index isn't part of the
+// migrations. If the database is opened by a build without FTS5, the
+// triggers are removed as they would otherwise break all writes. The
+// index is rebuilt once FTS5 is available again.
+func ensureSQLiteSearchIndex(ctx context.Context, db *sql.DB) (bool, error) {
+	var fts5 bool
+	if err := db.QueryRowContext(ctx, "SELECT sqlite_compileoption_used('ENABLE_FTS5')").Scan(&fts5); err != nil {
+		return false, err
+	}
+	statements := searchIndexTeardown
+	if fts5 {
+		indexed, err := sqliteSearchIndexed(ctx, db)
+		if err != nil || indexed {
+			return indexed, err
+		}
+		statements = searchIndexSetup
+	}
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+	for _, stmt := range statements {
+		if _, err := tx.ExecContext(ctx, stmt); err != nil {
+			return false, err
+		}
+	}
+	return fts5, tx.Commit()
+}
+
+// sqliteSearchIndexed reports whether the FTS5 index of mentions is set
+// up.
+func sqliteSearchIndexed(ctx context.Context, db *sql.DB) (bool, error) {
+	var count int
+	err := db.QueryRowContext(ctx, "SELECT COUNT(*) FROM sqlite_master WHERE type = 'trigger' AND name = ?", searchIndexTrigger).Scan(&count)
+	return count > 0, err
+}
+
+// searchTerms splits a search query into lower-case terms consisting
+// of letters and digits only. This matches how FTS5 tokenizes text, so
+// that the search behaves the same with and without the index.
+func searchTerms(q string) []string {
+	fields := strings.FieldsFunc(strings.ToLower(q), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	terms := make([]string, 0, len(fields))
+	seen := make(map[string]bool, len(fields))
+	for _, field := range fields {
+		if !seen[field] {
+			seen[field] = true
+			terms = append(terms, field)
+		}
+	}
+	return terms
+}
+
+// ftsQuery turns terms into an FTS5 query matching all documents that
+// contain words starting with each of the terms. Quoting the terms
+// keeps FTS5 from interpreting words like OR as operators.
+func ftsQuery(terms []string) string {
+	quoted := make([]string, 0, len(terms))
+	for _, term := range terms {
+		quoted = append(quoted, `"`+term+`"*`)
+	}
+	return strings.Join(quoted, " ")
+}
+
+// searchFields returns the fields of a mention covered by the search in
+// the order they are considered for snippets.
+func searchFields(m Mention) []string {
+	return []string{m.Content, m.Title, m.AuthorName, m.Source, m.Target}
+}
+
+// matchesSearch reports whether every term is contained in one of the
+// searchable fields of m.
+func matchesSearch(m Mention, terms []string) bool {
+	fields := searchFields(m)
+	for i, field := range fields {
+		fields[i] = strings.ToLower(field)
+	}
+	for _, term := range terms {
+		found := false
+		for _, field := range fields {
+			if strings.Contains(field, term) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// searchSnippet returns an excerpt of the first field of m that
+// contains one of the terms. The excerpt is HTML-escaped with all
+// matches wrapped in <mark> elements.
+func searchSnippet(m Mention, terms []string) string {
+	for _, field := range searchFields(m) {
+		text := []rune(field)
+		lower := []rune(strings.ToLower(field))
+		if len(lower) != len(text) {
+			// Lower-casing changed the length, so fall back to
+			// a case-sensitive search.
+			lower = text
+		}
+		first := -1
+		for i := range lower {
+			if matchLength(lower, i, terms) > 0 {
+				first = i
+				break
+			}
+		}
+		if first < 0 {
+			continue
+		}
+		// Show some context before the first match but use the
+		// whole snippet length if the text is short enough:
+		start := max(0, min(first-searchSnippetLength/4, len(text)-searchSnippetLength))
+		end := min(len(text), start+searchSnippetLength)
+		var b strings.Builder
+		if start > 0 {
+			b.WriteString("…")
+		}
+		plain := start
+		for i := start; i < end; {
+			n := matchLength(lower, i, terms)
+			if n == 0 {
+				i++
+				continue
+			}
+			n = min(n, end-i)
+			b.WriteString(html.EscapeString(string(text[plain:i])))
+			b.WriteString("<mark>" + html.EscapeString(string(text[i:i+n])) + "</mark>")
+			i += n
+			plain = i
+		}
+		b.WriteString(html.EscapeString(string(text[plain:end])))
+		if end < len(text) {
+			b.WriteString("…")
+		}
+		return strings.TrimFunc(b.String(), unicode.IsSpace)
+	}
+	return ""
+}
+
+// matchLength returns the length of the longest term found at position
+// i of text or 0.
+func matchLength(text []rune, i int, terms []string) int {
+	longest := 0
+	for _, term := range terms {
+		t := []rune(term)
+		if len(t) <= longest || i+len(t) > len(text) {
+			continue
+		}
+		if string(text[i:i+len(t)]) == term {
+			longest = len(t)
+		}
+	}
+	return longest
+}
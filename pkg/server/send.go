@@ -1,19 +1,28 @@
 package server
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"net/http"
+	"slices"
 
 	"github.com/zerok/webmentiond/pkg/webmention"
 )
 
 type SendRequest struct {
 	Source string `json:"source"`
+	// Deleted indicates that the source has been removed and that all
+	// previously mentioned targets should be notified about it.
+	Deleted bool `json:"deleted"`
 }
 
 type SendResponseTargetStatus struct {
 	URL      string `json:"url"`
 	Endpoint string `json:"endpoint"`
+	// Protocol is either webmention or pingback depending on the kind
+	// of endpoint the mention was sent to.
+	Protocol string `json:"protocol"`
 	Error    string `json:"error"`
 }
 
@@ -22,6 +31,17 @@ type SendResponse struct {
 	Targets []SendResponseTargetStatus `json:"targets"`
 }
 
+// Failed returns true if sending the mention to at least one of the
+// targets failed.
+func (r *SendResponse) Failed() bool {
+	for _, t := range r.Targets {
+		if t.Error != "" {
+			return true
+		}
+	}
+	return false
+}
+
 // handleSend sends a mention based on the given source.
 func (srv *Server) handleSend(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
@@ -30,47 +50,94 @@ func (srv *Server) handleSend(w http.ResponseWriter, r *http.Request) {
 		srv.sendError(ctx, w, &HTTPError{Err: err, StatusCode: http.StatusBadRequest})
 		return
 	}
+	resp, err := srv.sendMentions(ctx, req.Source, req.Deleted, nil)
+	if err != nil {
+		srv.sendError(ctx, w, &HTTPError{Err: err, StatusCode: http.StatusBadRequest})
+		return
+	}
+	srv.audit(ctx, AuditActionSendMentions, AuditTarget{ID: req.Source})
+	if resp.Failed() {
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+	json.NewEncoder(w).Encode(resp)
+}
+
+// sendMentions fetches the given source and sends a mention to every
+// external link found in it as well as to every target it linked to
+// the last time. If deleted is set or the source responds with 410
+// Gone, only the previously linked targets are notified. Targets listed
+// in skip have already been notified and are left out.
+func (srv *Server) sendMentions(ctx context.Context, source string, deleted bool, skip []string) (*SendResponse, error) {
 	resp := SendResponse{
-		Source:  req.Source,
+		Source:  source,
 		Targets: make([]SendResponseTargetStatus, 0, 5),
 	}
-	doc, err := webmention.DocumentFromURL(ctx, req.Source)
+	current := []string{}
+	if !deleted {
+		doc, err := webmention.DocumentFromURL(ctx, source)
+		if err != nil && !errors.Is(err, webmention.ErrGone) {
+			return nil, err
+		}
+		if doc != nil {
+			current = doc.Targets(srv.targetSelection)
+		}
+	}
+	targets, err := webmention.ResolveTargets(ctx, srv.cfg.SendStore, source, current)
 	if err != nil {
-		srv.sendError(ctx, w, &HTTPError{Err: err, StatusCode: http.StatusBadRequest})
-		return
+		return nil, err
 	}
-	failed := false
-	for _, target := range doc.ExternalLinks() {
+	for _, target := range targets {
+		if slices.Contains(skip, target) {
+			continue
+		}
 		status := SendResponseTargetStatus{
 			URL: target,
 		}
 		mention := webmention.Mention{
-			Source: req.Source,
+			Source: source,
 			Target: target,
 		}
 		disc := webmention.NewEndpointDiscoverer()
-		ep, err := disc.DiscoverEndpoint(ctx, mention.Target)
+		endpoints, err := disc.DiscoverEndpoints(ctx, mention.Target)
 		if err != nil {
 			status.Error = err.Error()
-			failed = true
 			resp.Targets = append(resp.Targets, status)
 			continue
 		}
-		if ep == "" {
+		if endpoints.Empty() {
 			resp.Targets = append(resp.Targets, status)
 			continue
 		}
 		sender := webmention.NewSender()
-		status.Endpoint = ep
-		if err := sender.Send(ctx, ep, mention); err != nil {
-			failed = true
+		status.Protocol, status.Endpoint, err = webmention.SendWithFallback(ctx, sender, endpoints, mention)
+		if err != nil {
 			status.Error = err.Error()
 		}
 		resp.Targets = append(resp.Targets, status)
 	}
-
-	if failed {
-		w.WriteHeader(http.StatusInternalServerError)
+	// Removed targets that couldn't be notified are kept so that they
+	// are tried again the next time mentions are sent for the source.
+	retry := []string{}
+	for _, status := range resp.Targets {
+		if status.Error != "" {
+			retry = append(retry, status.URL)
+		}
 	}
-	json.NewEncoder(w).Encode(&resp)
+	if err := srv.cfg.SendStore.SaveTargets(ctx, source, webmention.MergeTargets(current, retry)); err != nil {
+		return nil, err
+	}
+	for _, status := range resp.Targets {
+		if status.Protocol == "" || status.Error != "" {
+			continue
+		}
+		if err := srv.cfg.SendStore.RecordDelivery(ctx, source, status.URL, status.Endpoint, status.Protocol); err != nil {
+			return nil, err
+		}
+	}
+	return &resp, nil
+}
+
+func (srv *Server) targetSelection(o *webmention.TargetSelectionOptions) {
+	o.EntryOnly = srv.cfg.Sender.EntryOnly
+	o.ExcludeHosts = srv.cfg.Sender.ExcludeHosts
 }
@@ -0,0 +1,157 @@
+package server_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/require"
+	"github.com/zerok/webmentiond/pkg/server"
+)
+
+func TestSendRemembersTargets(t *testing.T) {
+	var lock sync.Mutex
+	received := make([]string, 0, 5)
+	targetMux := chi.NewRouter()
+	targetMux.Get("/{page}", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Link", `</endpoint>; rel="webmention"`)
+	})
+	failing := ""
+	targetMux.Post("/endpoint", func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		defer lock.Unlock()
+		r.ParseForm()
+		if r.Form.Get("target") == failing {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		received = append(received, r.Form.Get("target"))
+		w.WriteHeader(http.StatusAccepted)
+	})
+	target := httptest.NewServer(targetMux)
+	defer target.Close()
+
+	links := []string{"a", "b"}
+	gone := false
+	source := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if gone {
+			http.Error(w, "Gone", http.StatusGone)
+			return
+		}
+		for _, l := range links {
+			fmt.Fprintf(w, `<a href="%s/%s">%s</a>`, target.URL, l, l)
+		}
+	}))
+	defer source.Close()
+
+	db := setupDatabase(t)
+	defer db.Close()
+	srv := setupServer(t, db)
+	send := func(deleted bool) server.SendResponse {
+		t.Helper()
+		received = received[:0]
+		body, _ := json.Marshal(server.SendRequest{Source: source.URL, Deleted: deleted})
+		r := httptest.NewRequest(http.MethodPost, "/manage/send", bytes.NewBuffer(body))
+		w := httptest.NewRecorder()
+		srv.ServeHTTP(w, r.WithContext(server.AuthorizeContext(r.Context())))
+		if failing != "" {
+			require.Equal(t, http.StatusInternalServerError, w.Code)
+		} else {
+			require.Equal(t, http.StatusOK, w.Code)
+		}
+		resp := server.SendResponse{}
+		require.NoError(t, json.NewDecoder(w.Body).Decode(&resp))
+		return resp
+	}
+
+	send(false)
+	require.ElementsMatch(t, []string{target.URL + "/a", target.URL + "/b"}, received)
+
+	// Once b has been removed from the source it still has to be notified:
+	links = []string{"a"}
+	resp := send(false)
+	require.ElementsMatch(t, []string{target.URL + "/a", target.URL + "/b"}, received)
+	require.Len(t, resp.Targets, 2)
+
+	// ... but only once:
+	send(false)
+	require.Equal(t, []string{target.URL + "/a"}, received)
+
+	// If the source responds with 410 Gone, all remaining targets have to be
+	// notified:
+	gone = true
+	send(false)
+	require.Equal(t, []string{target.URL + "/a"}, received)
+	send(false)
+	require.Empty(t, received)
+
+	// The same happens if the source is explicitly marked as deleted:
+	gone = false
+	send(false)
+	require.Equal(t, []string{target.URL + "/a"}, received)
+	send(true)
+	require.Equal(t, []string{target.URL + "/a"}, received)
+	send(true)
+	require.Empty(t, received)
+
+	// Removed targets that couldn't be notified are tried again:
+	links = []string{"a", "b"}
+	send(false)
+	links = []string{"a"}
+	failing = target.URL + "/b"
+	send(false)
+	require.Equal(t, []string{target.URL + "/a"}, received)
+	_, err := db.Exec("DELETE FROM deliveries")
+	require.NoError(t, err)
+	failing = ""
+	send(false)
+	require.ElementsMatch(t, []string{target.URL + "/a", target.URL + "/b"}, received)
+	// The delivery to a removed target is recorded as well:
+	var endpoint string
+	require.NoError(t, db.QueryRow("SELECT endpoint FROM deliveries WHERE source = ? AND target = ?", source.URL, target.URL+"/b").Scan(&endpoint))
+	require.Equal(t, target.URL+"/endpoint", endpoint)
+	send(false)
+	require.Equal(t, []string{target.URL + "/a"}, received)
+}
+
+func TestSendFallsBackToPingback(t *testing.T) {
+	pinged := false
+	targetMux := chi.NewRouter()
+	targetMux.Get("/{page}", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Pingback", "/xmlrpc")
+	})
+	targetMux.Post("/xmlrpc", func(w http.ResponseWriter, r *http.Request) {
+		pinged = true
+		fmt.Fprint(w, `<?xml version="1.0"?><methodResponse><params><param><value><string>OK</string></value></param></params></methodResponse>`)
+	})
+	target := httptest.NewServer(targetMux)
+	defer target.Close()
+	source := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `<a href="%s/a">a</a>`, target.URL)
+	}))
+	defer source.Close()
+
+	db := setupDatabase(t)
+	defer db.Close()
+	srv := setupServer(t, db)
+	body, _ := json.Marshal(server.SendRequest{Source: source.URL})
+	r := httptest.NewRequest(http.MethodPost, "/manage/send", bytes.NewBuffer(body))
+	w := httptest.NewRecorder()
+	srv.ServeHTTP(w, r.WithContext(server.AuthorizeContext(r.Context())))
+	require.Equal(t, http.StatusOK, w.Code)
+	resp := server.SendResponse{}
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&resp))
+	require.True(t, pinged)
+	require.Len(t, resp.Targets, 1)
+	require.Equal(t, "pingback", resp.Targets[0].Protocol)
+	require.Equal(t, target.URL+"/xmlrpc", resp.Targets[0].Endpoint)
+
+	var protocol string
+	require.NoError(t, db.QueryRow("SELECT protocol FROM deliveries WHERE source = ?", source.URL).Scan(&protocol))
+	require.Equal(t, "pingback", protocol)
+}
@@ -1,11 +1,13 @@
 package server
 
 import (
+	"bytes"
 	"context"
 	"database/sql"
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"path/filepath"
 	"strings"
 	"sync"
 	"time"
@@ -14,13 +16,16 @@ import (
 	"github.com/go-chi/chi/v5/middleware"
 	"github.com/go-chi/cors"
 	"github.com/golang-migrate/migrate/v4"
-	migrateDriver "github.com/golang-migrate/migrate/v4/database/sqlite3"
+	"github.com/golang-migrate/migrate/v4/database"
+	migratePostgres "github.com/golang-migrate/migrate/v4/database/postgres"
+	migrateSQLite "github.com/golang-migrate/migrate/v4/database/sqlite3"
 	"github.com/golang-migrate/migrate/v4/source"
 	_ "github.com/golang-migrate/migrate/v4/source/file"
 	iofs "github.com/golang-migrate/migrate/v4/source/iofs"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/rs/zerolog"
 	"github.com/zerok/webmentiond/pkg/mailer"
+	"github.com/zerok/webmentiond/pkg/policies"
 	"github.com/zerok/webmentiond/pkg/server/migrations"
 )
 
@@ -32,6 +37,7 @@ type Server struct {
 	validToken      map[string]string
 	validTokenMutex sync.RWMutex
 	mailer          mailer.Mailer
+	getCache        *getCache
 }
 
 func New(configurators ...Configurator) *Server {
@@ -43,12 +49,60 @@ func New(configurators ...Configurator) *Server {
 	for _, configurator := range configurators {
 		configurator(&cfg)
 	}
+	var defaultStore interface {
+		MentionStore
+		PolicyStore
+		SendStore
+		AuditStore
+	}
+	if cfg.DatabaseDriver == "" {
+		cfg.DatabaseDriver = DatabaseDriverSQLite
+	}
+	if cfg.Database != nil {
+		var sqlStore *SQLStore
+		if cfg.DatabaseDriver == DatabaseDriverPostgres {
+			sqlStore = NewPostgresStore(cfg.Database)
+		} else {
+			sqlStore = NewSQLiteStore(cfg.Database)
+		}
+		if cfg.ReadDatabase != nil {
+			sqlStore = sqlStore.WithReader(cfg.ReadDatabase)
+		}
+		defaultStore = sqlStore
+	} else {
+		defaultStore = NewMemoryStore()
+	}
+	if cfg.MentionStore == nil {
+		cfg.MentionStore = defaultStore
+	}
+	if cfg.PolicyStore == nil {
+		cfg.PolicyStore = defaultStore
+	}
+	if cfg.SendStore == nil {
+		cfg.SendStore = defaultStore
+	}
+	if cfg.AuditStore == nil {
+		cfg.AuditStore = defaultStore
+	}
+	if cfg.PolicyLoader == nil {
+		cfg.PolicyLoader = cfg.PolicyStore
+	}
+	if cfg.Policies == nil {
+		cfg.Policies = policies.NewRegistry(policies.DEFAULT)
+	}
+	if cfg.GetCacheSize == 0 {
+		cfg.GetCacheSize = DefaultGetCacheSize
+	}
+	if cfg.GetCacheTTL <= 0 {
+		cfg.GetCacheTTL = DefaultGetCacheTTL
+	}
 	logger := zerolog.Ctx(cfg.Context)
 	srv := &Server{
 		router:     chi.NewRouter(),
 		cfg:        cfg,
 		validToken: make(map[string]string),
 		mailer:     cfg.Mailer,
+		getCache:   newGetCache(cfg.GetCacheSize, cfg.GetCacheTTL),
 	}
 	cors := cors.New(cors.Options{
 		AllowedOrigins:   cfg.AllowedOrigins,
@@ -73,11 +127,20 @@ func New(configurators ...Configurator) *Server {
 		srv.router.With(middleware.NoCache).Handle("/metrics", promhttp.Handler())
 	}
 	srv.router.With(middleware.NoCache).Post("/receive", srv.handleReceive)
+	srv.router.With(middleware.NoCache).Post("/xmlrpc", srv.handleXMLRPC)
 	srv.router.With(middleware.NoCache).Post("/request-login", srv.handleLogin)
 	srv.router.With(middleware.NoCache).Post("/authenticate/access-key", srv.handleAuthenticateWithAccessKey)
 	srv.router.With(middleware.NoCache).Post("/authenticate", srv.handleAuthenticate)
 	srv.router.With(middleware.NoCache, srv.requireAuthMiddleware).Route("/manage", func(r chi.Router) {
 		r.Get("/mentions", srv.handleListMentions)
+		r.Post("/mentions/bulk", srv.handleBulkMentions)
+		r.Post("/mentions", srv.handleCreateMention)
+		r.Get("/mentions/{id}", srv.handleGetMention)
+		r.Patch("/mentions/{id}", srv.handleUpdateMention)
+		r.Post("/mentions/{id}/verify", srv.handleVerifyMention)
+		r.Get("/mentions/{id}/revisions", srv.handleListRevisions)
+		r.Put("/mentions/{id}/pin", srv.handlePinRevision)
+		r.Delete("/mentions/{id}/pin", srv.handleUnpinRevision)
 		r.Post("/mentions/{id}/approve", srv.handleApproveMention)
 		r.Post("/mentions/{id}/reject", srv.handleRejectMention)
 		r.Delete("/mentions/{id}", srv.handleDeleteMention)
@@ -85,32 +148,38 @@ func New(configurators ...Configurator) *Server {
 		r.Get("/policies", srv.handleListPolicies)
 		r.Delete("/policies/{id}", srv.handleDeletePolicy)
 		r.Post("/policies", srv.handleCreatePolicy)
+		r.Get("/trash", srv.handleListTrash)
+		r.Delete("/trash", srv.handleEmptyTrash)
+		r.Post("/trash/{id}/restore", srv.handleRestoreMention)
+		r.Delete("/trash/{id}", srv.handlePurgeMention)
+		r.Get("/audit", srv.handleListAudit)
+		r.Get("/stats", srv.handleStats)
+		r.Get("/export", srv.handleExport)
+		r.Post("/import", srv.handleImport)
 	})
-	srv.router.With(middleware.NoCache).Get("/get", srv.handleGet)
+	srv.router.Get("/get", srv.handleGet)
 	return srv
 }
 
 func (srv *Server) UpdateGlobalMetrics(ctx context.Context) error {
-	tx, err := srv.cfg.Database.BeginTx(ctx, &sql.TxOptions{
-		ReadOnly: true,
-	})
+	totalCount, err := srv.cfg.MentionStore.CountMentions(ctx, MentionFilter{})
 	if err != nil {
 		return err
 	}
-	defer tx.Rollback()
-	var totalCount int64
-	var count int64
-	if err := tx.QueryRowContext(ctx, "SELECT count(*) FROM webmentions").Scan(&totalCount); err != nil {
-		return err
-	}
 	var status = []string{"approved", "verified", "new", "invalid", "rejected"}
 	for _, s := range status {
-		if err := tx.QueryRowContext(ctx, "SELECT count(*) FROM webmentions WHERE status = ?", s).Scan(&count); err != nil {
+		count, err := srv.cfg.MentionStore.CountMentions(ctx, MentionFilter{Status: s})
+		if err != nil {
 			return err
 		}
 		mentionsGauge.With(map[string]string{"status": s}).Set(float64(count))
 	}
 	totalMentionsGauge.Set(float64(totalCount))
+	trashed, err := srv.cfg.MentionStore.CountMentions(ctx, MentionFilter{Trashed: true})
+	if err != nil {
+		return err
+	}
+	trashedMentionsGauge.Set(float64(trashed))
 	return nil
 }
 
@@ -123,33 +192,71 @@ func (srv *Server) handleIndex(w http.ResponseWriter, r *http.Request) {
 }
 
 // MigrateDatabase tries to update the underlying database to the
-// latest version.
+// latest version. It does nothing if no database is configured.
 func (srv *Server) MigrateDatabase(ctx context.Context) error {
-	driver, err := migrateDriver.WithInstance(srv.cfg.Database, &migrateDriver.Config{})
+	if srv.cfg.Database == nil {
+		return nil
+	}
+	m, err := newMigrate(srv.cfg.Database, srv.cfg.DatabaseDriver, srv.cfg.MigrationsFolder)
 	if err != nil {
-		return fmt.Errorf("failed to create sqlite3 driver for running migrations: %w", err)
+		return err
 	}
-	var m *migrate.Migrate
-	if srv.cfg.MigrationsFolder != "" {
-		m, err = migrate.NewWithDatabaseInstance(
-			"file://"+srv.cfg.MigrationsFolder,
-			"sqlite3", driver)
-	} else {
-		var embeddedMigrations source.Driver
-		embeddedMigrations, err = iofs.New(migrations.FS, ".")
-		if err != nil {
-			return err
-		}
-		m, err = migrate.NewWithInstance("iofs", embeddedMigrations, "sqlite3", driver)
+	if err := m.Up(); err != nil && err != migrate.ErrNoChange {
+		return err
+	}
+	if srv.cfg.DatabaseDriver != DatabaseDriverSQLite {
+		return nil
 	}
+	indexed, err := ensureSQLiteSearchIndex(ctx, srv.cfg.Database)
 	if err != nil {
-		return fmt.Errorf("failed to prepare migrations: %w", err)
+		return fmt.Errorf("failed to set up search index: %w", err)
 	}
-	err = m.Up()
-	if err == nil || err == migrate.ErrNoChange {
-		return nil
+	if !indexed {
+		zerolog.Ctx(ctx).Warn().Msg("SQLite was built without FTS5, searching mentions has to scan all of them. Build with -tags sqlite_fts5 to enable the search index.")
 	}
-	return err
+	return nil
+}
+
+// newMigrate prepares the migrations for db. If migrationsFolder is
+// empty, the embedded migrations are used.
+func newMigrate(db *sql.DB, driverName string, migrationsFolder string) (*migrate.Migrate, error) {
+	var driver database.Driver
+	var err error
+	switch driverName {
+	case DatabaseDriverPostgres:
+		driver, err = migratePostgres.WithInstance(db, &migratePostgres.Config{})
+	case DatabaseDriverSQLite:
+		driver, err = migrateSQLite.WithInstance(db, &migrateSQLite.Config{})
+	default:
+		return nil, fmt.Errorf("unsupported database driver: %s", driverName)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to create %s driver for running migrations: %w", driverName, err)
+	}
+	src, err := openMigrationSource(driverName, migrationsFolder)
+	if err != nil {
+		return nil, err
+	}
+	m, err := migrate.NewWithInstance("migrations", src, driverName, driver)
+	if err != nil {
+		return nil, fmt.Errorf("failed to prepare migrations: %w", err)
+	}
+	return m, nil
+}
+
+// openMigrationSource returns the migrations for the given driver
+// either from migrationsFolder or the embedded ones.
+func openMigrationSource(driverName string, migrationsFolder string) (source.Driver, error) {
+	embeddedFS := migrations.FS
+	embeddedPath := "."
+	if driverName == DatabaseDriverPostgres {
+		embeddedFS = migrations.PostgresFS
+		embeddedPath = "postgres"
+	}
+	if migrationsFolder != "" {
+		return source.Open("file://" + filepath.Join(migrationsFolder, embeddedPath))
+	}
+	return iofs.New(embeddedFS, embeddedPath)
 }
 
 func (srv *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
@@ -170,12 +277,41 @@ type Mention struct {
 	Title      string `json:"title,omitempty"`
 	Content    string `json:"content,omitempty"`
 	AuthorName string `json:"author_name,omitempty"`
-	Type       string `json:"type,omitempty"`
-	RSVP       string `json:"rsvp,omitempty"`
+	// AuthorURL and AuthorPhoto are only known for imported mentions.
+	AuthorURL   string `json:"author_url,omitempty"`
+	AuthorPhoto string `json:"author_photo,omitempty"`
+	Type        string `json:"type,omitempty"`
+	RSVP        string `json:"rsvp,omitempty"`
+	Protocol    string `json:"protocol,omitempty"`
+	VerifiedAt  string `json:"verified_at,omitempty"`
+	// PublishedAt is when the source was published if known.
+	PublishedAt string `json:"published_at,omitempty"`
+	// Origin is MentionOriginManual for mentions added by an admin and
+	// empty for all others.
+	Origin string `json:"origin,omitempty"`
+	// Overrides are the values set by an admin. Title, Content,
+	// AuthorName and Type already reflect them.
+	Overrides *MentionOverrides `json:"overrides,omitempty"`
+	// extracted are the values replaced by the overrides.
+	extracted *MentionOverrides
+	// ModeratedAt is when an admin approved or rejected the mention for
+	// the first time.
+	ModeratedAt string `json:"moderated_at,omitempty"`
+	// PinnedRevision is the number of the revision whose details are
+	// shown regardless of later changes to the source.
+	PinnedRevision int `json:"pinned_revision,omitempty"`
+	// DeletedAt and DeletedBy are only set for mentions in the trash.
+	DeletedAt string `json:"deleted_at,omitempty"`
+	DeletedBy string `json:"deleted_by,omitempty"`
+	// Snippet is only set in search results. It is an HTML excerpt of
+	// the mention with all matches wrapped in <mark> elements.
+	Snippet string `json:"snippet,omitempty"`
 }
 
 // handleGet allows a website to get a list of all mentions stored for
-// it in the database.
+// it in the database. Responses are cached until a mention of the
+// target changes or the cache TTL has passed and can be revalidated
+// through ETag and Last-Modified.
 func (srv *Server) handleGet(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 	if err := r.ParseForm(); err != nil {
@@ -187,29 +323,48 @@ func (srv *Server) handleGet(w http.ResponseWriter, r *http.Request) {
 		srv.sendError(ctx, w, &HTTPError{StatusCode: http.StatusBadRequest, Err: fmt.Errorf("no target specified")})
 		return
 	}
-	tx, err := srv.cfg.Database.BeginTx(ctx, &sql.TxOptions{
-		ReadOnly: true,
-	})
-	if err != nil {
-		srv.sendError(ctx, w, &HTTPError{StatusCode: http.StatusInternalServerError, Err: err})
-		return
-	}
-	defer tx.Rollback()
-	rows, err := tx.QueryContext(ctx, "select id, source, created_at, status, title, content, author_name, type, rsvp from webmentions where status = ? and target = ? order by created_at", MentionStatusApproved, target)
-	if err != nil {
-		srv.sendError(ctx, w, &HTTPError{StatusCode: http.StatusInternalServerError, Err: err})
-		return
-	}
-	defer rows.Close()
-	mentions := make([]Mention, 0, 10)
-	for rows.Next() {
-		m := Mention{}
-		if err := rows.Scan(&m.ID, &m.Source, &m.CreatedAt, &m.Status, &m.Title, &m.Content, &m.AuthorName, &m.Type, &m.RSVP); err != nil {
+	resp, generation := srv.getCache.Get(target)
+	if resp == nil {
+		mentions, err := srv.cfg.MentionStore.ListMentions(ctx, MentionFilter{
+			Status:      MentionStatusApproved,
+			Target:      target,
+			OldestFirst: true,
+		})
+		if err != nil {
 			srv.sendError(ctx, w, &HTTPError{StatusCode: http.StatusInternalServerError, Err: err})
 			return
 		}
-		mentions = append(mentions, m)
+		for idx := range mentions {
+			// The target is implied by the request. Everything else
+			// removed here is only relevant for moderation.
+			mentions[idx].Target = ""
+			mentions[idx].Protocol = ""
+			mentions[idx].VerifiedAt = ""
+			mentions[idx].ModeratedAt = ""
+			mentions[idx].Origin = ""
+			mentions[idx].Overrides = nil
+			mentions[idx].PinnedRevision = 0
+		}
+		body, err := json.Marshal(mentions)
+		if err != nil {
+			srv.sendError(ctx, w, err)
+			return
+		}
+		resp = newGetResponse(target, append(body, '\n'))
+		srv.getCache.Put(resp, generation)
 	}
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(mentions)
+	w.Header().Set("ETag", resp.etag)
+	if srv.cfg.GetMaxAge > 0 {
+		w.Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d", int(srv.cfg.GetMaxAge.Seconds())))
+	} else {
+		w.Header().Set("Cache-Control", "public, no-cache")
+	}
+	http.ServeContent(w, r, "", resp.lastModified, bytes.NewReader(resp.body))
+}
+
+// invalidateTarget has to be called whenever a mention of target is
+// created, changed or deleted.
+func (srv *Server) invalidateTarget(target string) {
+	srv.getCache.Invalidate(target)
 }
@@ -13,6 +13,7 @@ import (
 	"strconv"
 	"strings"
 	"testing"
+	"time"
 
 	_ "github.com/mattn/go-sqlite3"
 	"github.com/rs/zerolog"
@@ -21,21 +22,12 @@ import (
 	"github.com/zerok/webmentiond/pkg/webmention"
 )
 
-func requireMentionWithStatus(t *testing.T, ctx context.Context, db *sql.DB, target string, status string) {
+func requireMentionWithStatus(t *testing.T, ctx context.Context, store server.MentionStore, target string, status string) {
 	t.Helper()
-	tx, err := db.BeginTx(ctx, nil)
+	mentions, err := store.ListMentions(ctx, server.MentionFilter{Target: target})
 	require.NoError(t, err)
-	defer tx.Rollback()
-	res, err := tx.QueryContext(ctx, "SELECT id, status, source from webmentions WHERE target = ?", target)
-	require.NoError(t, err)
-	defer res.Close()
-	for res.Next() {
-		var id string
-		var stat string
-		var source string
-		err := res.Scan(&id, &stat, &source)
-		require.NoError(t, err)
-		if status == stat {
+	for _, m := range mentions {
+		if m.Status == status {
 			return
 		}
 	}
@@ -95,7 +87,7 @@ func TestReceiver(t *testing.T) {
 	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
 	srv.ServeHTTP(w, req.WithContext(ctx))
 	require.Equal(t, 202, w.Code)
-	requireMentionWithStatus(t, ctx, db, "https://target.zerokspot.com", "new")
+	requireMentionWithStatus(t, ctx, server.NewSQLiteStore(db), "https://target.zerokspot.com", "new")
 	requireMetricValue(t, ctx, srv, "webmentiond_mentions_total", 1)
 	requireMetricValue(t, ctx, srv, "webmentiond_mentions{status=\"new\"}", 1)
 	requireMetricValue(t, ctx, srv, "webmentiond_mentions{status=\"approved\"}", 0)
@@ -196,6 +188,9 @@ func TestGetMentions(t *testing.T) {
 	srv := server.New(func(c *server.Configuration) {
 		c.Database = db
 		c.MigrationsFolder = "./migrations"
+		// Mentions are modified directly inside the database which the
+		// cache wouldn't notice.
+		c.GetCacheSize = -1
 	})
 	require.NoError(t, srv.MigrateDatabase(ctx))
 
@@ -235,4 +230,92 @@ func TestGetMentions(t *testing.T) {
 	require.Len(t, mentions, 1)
 	require.Equal(t, "https://some-other-page.com", mentions[0].Source)
 	require.Equal(t, "sample title", mentions[0].Title)
+
+	// Details that are only relevant for moderation are not public:
+	_, err = db.Exec("UPDATE webmentions SET verified_at = '2024-01-01T00:00:00Z', moderated_at = '2024-01-01T00:00:00Z', protocol = 'pingback', origin = 'manual' WHERE id = 'a'")
+	require.NoError(t, err)
+	w = httptest.NewRecorder()
+	r = httptest.NewRequest(http.MethodGet, "/get?target=https://zerokspot.com", nil)
+	srv.ServeHTTP(w, r)
+	require.Equal(t, http.StatusOK, w.Code)
+	for _, field := range []string{"verified_at", "moderated_at", "protocol", "origin", "overrides", "pinned_revision"} {
+		require.NotContains(t, w.Body.String(), `"`+field+`"`)
+	}
+}
+
+func TestGetMentionsCache(t *testing.T) {
+	ctx := context.Background()
+	store := server.NewMemoryStore()
+	srv := server.New(func(c *server.Configuration) {
+		c.MentionStore = store
+	})
+	require.NoError(t, store.CreateMention(ctx, server.Mention{ID: "a", Source: "https://source.com/a", Target: "https://target.com", Status: server.MentionStatusVerified}))
+	get := func(header string, value string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, "/get?target=https://target.com", nil)
+		if header != "" {
+			r.Header.Set(header, value)
+		}
+		w := httptest.NewRecorder()
+		srv.ServeHTTP(w, r)
+		return w
+	}
+
+	w := get("", "")
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Len(t, requireListOfMentions(t, w), 0)
+	require.Equal(t, "public, no-cache", w.Header().Get("Cache-Control"))
+	etag := w.Header().Get("ETag")
+	require.NotEmpty(t, etag)
+	lastModified := w.Header().Get("Last-Modified")
+	require.NotEmpty(t, lastModified)
+
+	// Unchanged responses only have to be revalidated:
+	require.Equal(t, http.StatusNotModified, get("If-None-Match", etag).Code)
+	require.Equal(t, http.StatusNotModified, get("If-Modified-Since", lastModified).Code)
+
+	// Moderation invalidates the cached response:
+	r := httptest.NewRequest(http.MethodPost, "/manage/mentions/a/approve", nil)
+	srv.ServeHTTP(httptest.NewRecorder(), r.WithContext(server.AuthorizeContext(r.Context())))
+	w = get("If-None-Match", etag)
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Len(t, requireListOfMentions(t, w), 1)
+	require.NotEqual(t, etag, w.Header().Get("ETag"))
+	etag = w.Header().Get("ETag")
+
+	// ... and so does receiving a mention again:
+	data := url.Values{}
+	data.Set("source", "https://source.com/a")
+	data.Set("target", "https://target.com")
+	r = httptest.NewRequest(http.MethodPost, "/receive", bytes.NewBufferString(data.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w = httptest.NewRecorder()
+	srv.ServeHTTP(w, r)
+	require.Equal(t, http.StatusAccepted, w.Code)
+	w = get("If-None-Match", etag)
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Len(t, requireListOfMentions(t, w), 0)
+}
+
+func TestGetMentionsCacheTTL(t *testing.T) {
+	ctx := context.Background()
+	store := server.NewMemoryStore()
+	srv := server.New(func(c *server.Configuration) {
+		c.MentionStore = store
+		c.GetCacheTTL = 50 * time.Millisecond
+	})
+	require.NoError(t, store.CreateMention(ctx, server.Mention{ID: "a", Source: "https://source.com/a", Target: "https://target.com", Status: server.MentionStatusVerified}))
+	get := func() []webmention.Mention {
+		w := httptest.NewRecorder()
+		srv.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/get?target=https://target.com", nil))
+		require.Equal(t, http.StatusOK, w.Code)
+		return requireListOfMentions(t, w)
+	}
+	require.Len(t, get(), 0)
+
+	// Changes made outside of the server only show up once the cached
+	// response has expired:
+	require.NoError(t, store.UpdateMentionStatus(ctx, "a", server.MentionStatusApproved))
+	require.Len(t, get(), 0)
+	time.Sleep(60 * time.Millisecond)
+	require.Len(t, get(), 1)
 }
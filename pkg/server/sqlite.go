@@ -0,0 +1,102 @@
+package server
+
+import (
+	"database/sql"
+	"fmt"
+	"net/url"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// DefaultSQLiteBusyTimeout is used by OpenSQLite if no busy timeout is
+// configured.
+const DefaultSQLiteBusyTimeout = 5 * time.Second
+
+// SQLiteOptions configure the connection pools created by OpenSQLite.
+type SQLiteOptions struct {
+	// BusyTimeout is how long a connection waits for a lock held by
+	// another connection before failing with "database is locked".
+	BusyTimeout time.Duration
+	// MaxReaders limits the number of connections in the read-only
+	// pool. Defaults to the number of CPUs but at least 4.
+	MaxReaders int
+}
+
+// SQLiteDatabase bundles the two connection pools used for a SQLite
+// database: SQLite only allows a single writer at a time, so all writes
+// go through a pool with exactly one connection while reads are spread
+// over a read-only pool. Thanks to WAL mode readers don't block the
+// writer and vice versa.
+type SQLiteDatabase struct {
+	Writer *sql.DB
+	Reader *sql.DB
+}
+
+// OpenSQLite opens the SQLite database at path (or with the given DSN)
+// in WAL mode and returns the writer and reader pools for it.
+func OpenSQLite(path string, opts SQLiteOptions) (*SQLiteDatabase, error) {
+	if opts.BusyTimeout <= 0 {
+		opts.BusyTimeout = DefaultSQLiteBusyTimeout
+	}
+	if opts.MaxReaders <= 0 {
+		opts.MaxReaders = max(4, runtime.NumCPU())
+	}
+	params := url.Values{}
+	params.Set("_journal_mode", "WAL")
+	params.Set("_busy_timeout", fmt.Sprint(opts.BusyTimeout.Milliseconds()))
+	params.Set("_foreign_keys", "on")
+	// Immediate transactions take the write lock right away instead of
+	// failing when upgrading a read lock later on.
+	params.Set("_txlock", "immediate")
+	writer, err := sql.Open(DatabaseDriverSQLite, sqliteDSN(path, params))
+	if err != nil {
+		return nil, err
+	}
+	writer.SetMaxOpenConns(1)
+	// The journal mode is only switched once a connection is opened, so
+	// do that before any reader shows up.
+	if err := writer.Ping(); err != nil {
+		writer.Close()
+		return nil, fmt.Errorf("failed to open %s: %w", path, err)
+	}
+	params.Del("_journal_mode")
+	params.Del("_txlock")
+	params.Set("mode", "ro")
+	reader, err := sql.Open(DatabaseDriverSQLite, sqliteDSN(path, params))
+	if err != nil {
+		writer.Close()
+		return nil, err
+	}
+	reader.SetMaxOpenConns(opts.MaxReaders)
+	reader.SetMaxIdleConns(opts.MaxReaders)
+	return &SQLiteDatabase{Writer: writer, Reader: reader}, nil
+}
+
+// Store returns a SQLStore that writes through the writer pool and
+// reads through the reader pool.
+func (d *SQLiteDatabase) Store() *SQLStore {
+	return NewSQLiteStore(d.Writer).WithReader(d.Reader)
+}
+
+// Close closes both connection pools.
+func (d *SQLiteDatabase) Close() error {
+	rerr := d.Reader.Close()
+	if err := d.Writer.Close(); err != nil {
+		return err
+	}
+	return rerr
+}
+
+// sqliteDSN adds params to path. The path is turned into a file: URI as
+// otherwise the driver doesn't pass options like mode on to SQLite.
+func sqliteDSN(path string, params url.Values) string {
+	if !strings.HasPrefix(path, "file:") {
+		path = "file:" + path
+	}
+	sep := "?"
+	if strings.Contains(path, "?") {
+		sep = "&"
+	}
+	return path + sep + params.Encode()
+}
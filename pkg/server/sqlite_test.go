@@ -0,0 +1,236 @@
+package server_test
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/zerok/webmentiond/pkg/feeds"
+	"github.com/zerok/webmentiond/pkg/server"
+)
+
+func TestOpenSQLite(t *testing.T) {
+	db, err := server.OpenSQLite(filepath.Join(t.TempDir(), "webmentiond.sqlite"), server.SQLiteOptions{})
+	require.NoError(t, err)
+	defer db.Close()
+
+	var mode string
+	require.NoError(t, db.Writer.QueryRow("PRAGMA journal_mode").Scan(&mode))
+	require.Equal(t, "wal", mode)
+	var timeout int
+	require.NoError(t, db.Reader.QueryRow("PRAGMA busy_timeout").Scan(&timeout))
+	require.Equal(t, int(server.DefaultSQLiteBusyTimeout.Milliseconds()), timeout)
+	require.Equal(t, 1, db.Writer.Stats().MaxOpenConnections)
+
+	_, err = db.Writer.Exec("CREATE TABLE test (id INTEGER)")
+	require.NoError(t, err)
+	_, err = db.Reader.Exec("INSERT INTO test (id) VALUES (1)")
+	require.Error(t, err, "the reader pool must be read-only")
+}
+
+// TestSQLiteConcurrentLoad receives, verifies, moderates and serves
+// mentions at the same time and expects none of these to fail because
+// of a locked database.
+func TestSQLiteConcurrentLoad(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping load test in short mode")
+	}
+	const (
+		senders            = 8
+		mentionsPerSender  = 10
+		readers            = 8
+		expectedMentions   = senders * mentionsPerSender
+		target             = "https://allowed.com/"
+		verificationTimout = 30 * time.Second
+	)
+	ctx := context.Background()
+	db, err := server.OpenSQLite(filepath.Join(t.TempDir(), "webmentiond.sqlite"), server.SQLiteOptions{})
+	require.NoError(t, err)
+	defer db.Close()
+	store := db.Store()
+	srv := server.New(func(c *server.Configuration) {
+		c.Context = ctx
+		c.Database = db.Writer
+		c.ReadDatabase = db.Reader
+		c.MigrationsFolder = "./migrations"
+		c.Receiver.TargetPolicy = server.RequestPolicyAllowHost("allowed.com")
+	})
+	require.NoError(t, srv.MigrateDatabase(ctx))
+
+	source := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `<html><body><a href="%s">Target</a></body></html>`, target)
+	}))
+	defer source.Close()
+
+	var failures atomic.Int64
+	fail := func(format string, args ...any) {
+		failures.Add(1)
+		t.Errorf(format, args...)
+	}
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	defer func() {
+		close(done)
+		wg.Wait()
+	}()
+
+	// Senders:
+	var sendersWG sync.WaitGroup
+	for i := range senders {
+		sendersWG.Add(1)
+		go func() {
+			defer sendersWG.Done()
+			for j := range mentionsPerSender {
+				data := url.Values{}
+				data.Set("source", fmt.Sprintf("%s/%d/%d", source.URL, i, j))
+				data.Set("target", target)
+				req := httptest.NewRequest(http.MethodPost, "/receive", bytes.NewBufferString(data.Encode()))
+				req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+				w := httptest.NewRecorder()
+				srv.ServeHTTP(w, req)
+				if w.Code != http.StatusAccepted {
+					fail("receive failed with %d: %s", w.Code, w.Body.String())
+				}
+			}
+		}()
+	}
+
+	// Widgets reading the mentions:
+	for range readers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-done:
+					return
+				case <-time.After(time.Millisecond):
+				}
+				w := httptest.NewRecorder()
+				srv.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/get?target="+url.QueryEscape(target), nil))
+				if w.Code != http.StatusOK {
+					fail("get failed with %d: %s", w.Code, w.Body.String())
+				}
+			}
+		}()
+	}
+
+	// Feed pollers and senders writing inside of transactions:
+	for i := range 2 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			feedURL := fmt.Sprintf("https://example.org/feed/%d.xml", i)
+			for n := 0; ; n++ {
+				select {
+				case <-done:
+					return
+				case <-time.After(time.Millisecond):
+				}
+				entries := []feeds.Entry{{ID: fmt.Sprint(n), URL: fmt.Sprintf("https://example.org/%d/%d", i, n), Updated: time.Now()}}
+				if err := store.UpdateFeed(ctx, server.FeedState{URL: feedURL}, entries); err != nil {
+					fail("updating feed failed: %s", err)
+				}
+				if err := store.SaveTargets(ctx, entries[0].URL, []string{target}); err != nil {
+					fail("saving targets failed: %s", err)
+				}
+			}
+		}()
+	}
+
+	// Moderation approving everything that got verified:
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			select {
+			case <-done:
+				return
+			case <-time.After(10 * time.Millisecond):
+			}
+			mentions, err := store.ListMentions(ctx, server.MentionFilter{Status: server.MentionStatusVerified})
+			if err != nil {
+				fail("listing mentions failed: %s", err)
+				continue
+			}
+			for _, m := range mentions {
+				if err := store.UpdateMentionStatus(ctx, m.ID, server.MentionStatusApproved); err != nil {
+					fail("approving mention failed: %s", err)
+				}
+			}
+		}
+	}()
+
+	// Verifier:
+	deadline := time.Now().Add(verificationTimout)
+	for {
+		_, err := srv.VerifyNextMention(ctx)
+		if err != nil {
+			fail("verification failed: %s", err)
+		}
+		count, err := store.CountMentions(ctx, server.MentionFilter{Status: server.MentionStatusNew})
+		require.NoError(t, err)
+		total, err := store.CountMentions(ctx, server.MentionFilter{})
+		require.NoError(t, err)
+		if count == 0 && total == expectedMentions {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("not all mentions verified in time (%d of %d pending)", count, total)
+		}
+	}
+	sendersWG.Wait()
+	require.Zero(t, failures.Load())
+}
+
+func TestMigrateTimestampsToUTC(t *testing.T) {
+	ctx := context.Background()
+	db := setupDatabase(t)
+	defer db.Close()
+
+	// Start with a database as it was before timestamps were written
+	// in UTC:
+	migrations := t.TempDir()
+	files, err := filepath.Glob(filepath.Join("migrations", "0*.sql"))
+	require.NoError(t, err)
+	for _, file := range files {
+		if filepath.Base(file) >= "022" {
+			continue
+		}
+		data, err := os.ReadFile(file)
+		require.NoError(t, err)
+		require.NoError(t, os.WriteFile(filepath.Join(migrations, filepath.Base(file)), data, 0o600))
+	}
+	old := server.New(func(c *server.Configuration) {
+		c.Database = db
+		c.MigrationsFolder = migrations
+	})
+	require.NoError(t, old.MigrateDatabase(ctx))
+	_, err = db.Exec("INSERT INTO webmentions (id, source, target, created_at, verified_at, status) VALUES ('a', 'https://a.com', 'https://target.com', '2024-01-02T01:30:00+02:00', '2024-01-02T01:31:00+02:00', 'approved'), ('b', 'https://b.com', 'https://target.com', '2024-01-01T23:45:00Z', '', 'approved')")
+	require.NoError(t, err)
+
+	setupServer(t, db)
+	store := server.NewSQLiteStore(db)
+	m, err := store.GetMention(ctx, "a")
+	require.NoError(t, err)
+	require.Equal(t, "2024-01-01T23:30:00Z", m.CreatedAt)
+	require.Equal(t, "2024-01-01T23:31:00Z", m.VerifiedAt)
+	mentions, err := store.ListMentions(ctx, server.MentionFilter{OldestFirst: true})
+	require.NoError(t, err)
+	require.Len(t, mentions, 2)
+	require.Equal(t, "a", mentions[0].ID)
+	b, err := store.GetMention(ctx, "b")
+	require.NoError(t, err)
+	require.Equal(t, "2024-01-01T23:45:00Z", b.CreatedAt)
+	require.Equal(t, "", b.VerifiedAt)
+}
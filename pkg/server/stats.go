@@ -0,0 +1,220 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Intervals supported by the time series of the statistics.
+const (
+	StatsIntervalDay  = "day"
+	StatsIntervalWeek = "week"
+)
+
+// defaultStatsRange is the time range covered by the statistics unless
+// requested otherwise.
+const defaultStatsRange = 30 * 24 * time.Hour
+
+// statsTypeMention is used in the time series for mentions without a
+// more specific type.
+const statsTypeMention = "mention"
+
+// handleStats summarizes the mentions received within a time range.
+// Mentions in the trash are left out.
+func (srv *Server) handleStats(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	v := r.URL.Query()
+	var err error
+	var after, before time.Time
+	for param, t := range map[string]*time.Time{
+		"created_after":  &after,
+		"created_before": &before,
+	} {
+		if raw := v.Get(param); raw != "" {
+			if *t, err = parseFilterTime(raw); err != nil {
+				srv.sendError(ctx, w, &HTTPError{StatusCode: http.StatusBadRequest, Err: fmt.Errorf("invalid %s: %s", param, raw)})
+				return
+			}
+		}
+	}
+	if before.IsZero() {
+		// Include today:
+		before = time.Now().UTC().Truncate(24*time.Hour).AddDate(0, 0, 1)
+	}
+	if after.IsZero() {
+		after = before.Add(-defaultStatsRange)
+	}
+	if !after.Before(before) {
+		srv.sendError(ctx, w, &HTTPError{StatusCode: http.StatusBadRequest, Err: fmt.Errorf("created_after must be before created_before")})
+		return
+	}
+	interval := v.Get("interval")
+	if interval == "" {
+		interval = StatsIntervalDay
+	}
+	if interval != StatsIntervalDay && interval != StatsIntervalWeek {
+		srv.sendError(ctx, w, &HTTPError{StatusCode: http.StatusBadRequest, Err: fmt.Errorf("unsupported interval: %s", interval)})
+		return
+	}
+	limit := 10
+	if raw := v.Get("limit"); raw != "" {
+		if limit, err = strconv.Atoi(raw); err != nil || limit < 1 {
+			srv.sendError(ctx, w, &HTTPError{StatusCode: http.StatusBadRequest, Err: fmt.Errorf("invalid limit: %s", raw)})
+			return
+		}
+	}
+	mentions, err := srv.cfg.MentionStore.ListMentions(ctx, MentionFilter{
+		CreatedAfter:  after,
+		CreatedBefore: before,
+		OldestFirst:   true,
+	})
+	if err != nil {
+		srv.sendError(ctx, w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(computeStats(mentions, after, before, interval, limit))
+}
+
+// computeStats summarizes mentions, which have been received between
+// after and before.
+func computeStats(mentions []Mention, after time.Time, before time.Time, interval string, limit int) Stats {
+	stats := Stats{
+		CreatedAfter:  formatTimestamp(after),
+		CreatedBefore: formatTimestamp(before),
+		Interval:      interval,
+		Total:         len(mentions),
+		Series:        make([]StatsPeriod, 0, 31),
+	}
+	// The series includes periods without any mentions:
+	periods := make(map[string]*StatsPeriod)
+	for start := periodStart(after, interval); start.Before(before); start = nextPeriod(start, interval) {
+		stats.Series = append(stats.Series, StatsPeriod{
+			Start:    start.Format(time.DateOnly),
+			ByType:   make(map[string]int),
+			ByStatus: make(map[string]int),
+		})
+	}
+	for i := range stats.Series {
+		periods[stats.Series[i].Start] = &stats.Series[i]
+	}
+
+	sources := make(map[string]int)
+	targets := make(map[string]int)
+	approvals := make(map[string]*SourceApproval)
+	durations := make([]float64, 0, len(mentions))
+	for _, m := range mentions {
+		created, err := time.Parse(time.RFC3339, m.CreatedAt)
+		if err != nil {
+			continue
+		}
+		if p := periods[periodStart(created, interval).Format(time.DateOnly)]; p != nil {
+			typ := m.Type
+			if typ == "" {
+				typ = statsTypeMention
+			}
+			p.Total++
+			p.ByType[typ]++
+			p.ByStatus[m.Status]++
+		}
+		targets[m.Target]++
+		domain := sourceDomain(m.Source)
+		if domain != "" {
+			sources[domain]++
+			if m.Status == MentionStatusApproved || m.Status == MentionStatusRejected {
+				a := approvals[domain]
+				if a == nil {
+					a = &SourceApproval{Domain: domain}
+					approvals[domain] = a
+				}
+				if m.Status == MentionStatusApproved {
+					a.Approved++
+				} else {
+					a.Rejected++
+				}
+			}
+		}
+		if moderated, err := time.Parse(time.RFC3339, m.ModeratedAt); err == nil {
+			durations = append(durations, max(0, moderated.Sub(created).Seconds()))
+		}
+	}
+	stats.TopSources = topCounts(sources, limit)
+	stats.TopTargets = topCounts(targets, limit)
+
+	stats.SourceApproval = make([]SourceApproval, 0, len(approvals))
+	for _, a := range approvals {
+		a.Ratio = float64(a.Approved) / float64(a.Approved+a.Rejected)
+		stats.SourceApproval = append(stats.SourceApproval, *a)
+	}
+	sort.Slice(stats.SourceApproval, func(i, j int) bool {
+		a, b := stats.SourceApproval[i], stats.SourceApproval[j]
+		if a.Approved+a.Rejected != b.Approved+b.Rejected {
+			return a.Approved+a.Rejected > b.Approved+b.Rejected
+		}
+		return a.Domain < b.Domain
+	})
+	if len(stats.SourceApproval) > limit {
+		stats.SourceApproval = stats.SourceApproval[:limit]
+	}
+
+	stats.Moderated = len(durations)
+	if len(durations) > 0 {
+		sort.Float64s(durations)
+		median := durations[len(durations)/2]
+		if len(durations)%2 == 0 {
+			median = (durations[len(durations)/2-1] + median) / 2
+		}
+		stats.MedianModerationSeconds = &median
+	}
+	return stats
+}
+
+// periodStart returns the start of the day or week (starting on Monday)
+// t is in. Periods are always in UTC.
+func periodStart(t time.Time, interval string) time.Time {
+	t = t.UTC().Truncate(24 * time.Hour)
+	if interval == StatsIntervalWeek {
+		t = t.AddDate(0, 0, -((int(t.Weekday()) + 6) % 7))
+	}
+	return t
+}
+
+func nextPeriod(start time.Time, interval string) time.Time {
+	if interval == StatsIntervalWeek {
+		return start.AddDate(0, 0, 7)
+	}
+	return start.AddDate(0, 0, 1)
+}
+
+// sourceDomain returns the lowercase host of source.
+func sourceDomain(source string) string {
+	u, err := url.Parse(source)
+	if err != nil {
+		return ""
+	}
+	return strings.ToLower(u.Hostname())
+}
+
+// topCounts returns the limit entries of counts with the highest count.
+func topCounts(counts map[string]int, limit int) []StatsCount {
+	result := make([]StatsCount, 0, len(counts))
+	for name, count := range counts {
+		result = append(result, StatsCount{Name: name, Count: count})
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Count != result[j].Count {
+			return result[i].Count > result[j].Count
+		}
+		return result[i].Name < result[j].Name
+	})
+	if len(result) > limit {
+		result = result[:limit]
+	}
+	return result
+}
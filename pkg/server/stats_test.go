@@ -0,0 +1,92 @@
+package server_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/zerok/webmentiond/pkg/server"
+)
+
+func TestStats(t *testing.T) {
+	db := setupDatabase(t)
+	defer db.Close()
+	srv := setupServer(t, db)
+	for _, m := range []struct {
+		id, source, target, createdAt, status, typ, moderatedAt, deletedAt string
+	}{
+		{"a", "https://spam.example/1", "https://target.com/1", "2024-01-01T10:00:00Z", server.MentionStatusRejected, "", "2024-01-01T11:00:00Z", ""},
+		{"b", "https://spam.example/2", "https://target.com/1", "2024-01-02T10:00:00Z", server.MentionStatusRejected, "", "2024-01-02T13:00:00Z", ""},
+		{"c", "https://Friend.example/post", "https://target.com/2", "2024-01-02T12:00:00Z", server.MentionStatusApproved, "comment", "2024-01-03T12:00:00Z", ""},
+		{"d", "https://friend.example/like", "https://target.com/1", "2024-01-08T00:00:00Z", server.MentionStatusApproved, "like", "", ""},
+		{"e", "https://spam.example/3", "https://target.com/2", "2024-01-09T00:00:00Z", server.MentionStatusNew, "", "", ""},
+		// Mentions received outside of the range and those in the
+		// trash are left out:
+		{"f", "https://spam.example/4", "https://target.com/1", "2023-12-31T23:59:59Z", server.MentionStatusRejected, "", "2024-01-01T00:00:00Z", ""},
+		{"g", "https://spam.example/5", "https://target.com/1", "2024-01-03T00:00:00Z", server.MentionStatusRejected, "", "2024-01-03T00:00:00Z", "2024-01-04T00:00:00Z"},
+	} {
+		_, err := db.Exec("INSERT INTO webmentions (id, source, target, created_at, status, type, moderated_at, deleted_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?)", m.id, m.source, m.target, m.createdAt, m.status, m.typ, m.moderatedAt, m.deletedAt)
+		require.NoError(t, err)
+	}
+
+	stats := func(query string, expectedStatus int) server.Stats {
+		t.Helper()
+		var res server.Stats
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodGet, "/manage/stats"+query, nil)
+		srv.ServeHTTP(w, r.WithContext(server.AuthorizeContext(r.Context())))
+		require.Equal(t, expectedStatus, w.Code)
+		if expectedStatus == http.StatusOK {
+			require.NoError(t, json.NewDecoder(w.Body).Decode(&res))
+		}
+		return res
+	}
+
+	res := stats("?created_after=2024-01-01&created_before=2024-01-15", http.StatusOK)
+	require.Equal(t, "2024-01-01T00:00:00Z", res.CreatedAfter)
+	require.Equal(t, "2024-01-15T00:00:00Z", res.CreatedBefore)
+	require.Equal(t, server.StatsIntervalDay, res.Interval)
+	require.Equal(t, 5, res.Total)
+	require.Len(t, res.Series, 14)
+	require.Equal(t, server.StatsPeriod{
+		Start:    "2024-01-02",
+		Total:    2,
+		ByType:   map[string]int{"mention": 1, "comment": 1},
+		ByStatus: map[string]int{server.MentionStatusRejected: 1, server.MentionStatusApproved: 1},
+	}, res.Series[1])
+	require.Equal(t, 0, res.Series[2].Total)
+	require.Equal(t, []server.StatsCount{{Name: "spam.example", Count: 3}, {Name: "friend.example", Count: 2}}, res.TopSources)
+	require.Equal(t, []server.StatsCount{{Name: "https://target.com/1", Count: 3}, {Name: "https://target.com/2", Count: 2}}, res.TopTargets)
+	require.Equal(t, []server.SourceApproval{
+		{Domain: "friend.example", Approved: 2, Ratio: 1},
+		{Domain: "spam.example", Rejected: 2, Ratio: 0},
+	}, res.SourceApproval)
+	require.Equal(t, 3, res.Moderated)
+	require.NotNil(t, res.MedianModerationSeconds)
+	require.Equal(t, float64(3*60*60), *res.MedianModerationSeconds)
+
+	res = stats("?created_after=2024-01-01&created_before=2024-01-15&interval=week&limit=1", http.StatusOK)
+	require.Len(t, res.Series, 2)
+	require.Equal(t, "2024-01-08", res.Series[1].Start)
+	require.Equal(t, 3, res.Series[0].Total)
+	require.Equal(t, 2, res.Series[1].Total)
+	require.Equal(t, []server.StatsCount{{Name: "spam.example", Count: 3}}, res.TopSources)
+	require.Len(t, res.SourceApproval, 1)
+
+	res = stats("?created_after=2024-01-08&created_before=2024-01-15", http.StatusOK)
+	require.Equal(t, 2, res.Total)
+	require.Zero(t, res.Moderated)
+	require.Nil(t, res.MedianModerationSeconds)
+
+	// The last 30 days are used by default:
+	res = stats("", http.StatusOK)
+	require.Zero(t, res.Total)
+	require.Len(t, res.Series, 30)
+
+	stats("?interval=month", http.StatusBadRequest)
+	stats("?created_after=2024-01-15&created_before=2024-01-01", http.StatusBadRequest)
+	stats("?created_after=yesterday", http.StatusBadRequest)
+	stats("?limit=0", http.StatusBadRequest)
+}
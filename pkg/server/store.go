@@ -0,0 +1,537 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/zerok/webmentiond/pkg/feeds"
+	"github.com/zerok/webmentiond/pkg/policies"
+	"github.com/zerok/webmentiond/pkg/webmention"
+)
+
+// ErrMentionNotFound is returned by a MentionStore if no mention
+// matches the request.
+var ErrMentionNotFound = errors.New("mention not found")
+
+// ErrMentionExists is returned by MentionStore.CreateMention if a
+// mention with the same source and target has already been stored.
+var ErrMentionExists = errors.New("mention already exists")
+
+// ErrPolicyNotFound is returned by a PolicyStore if no policy with the
+// given ID exists.
+var ErrPolicyNotFound = errors.New("policy not found")
+
+// ErrRevisionNotFound is returned by MentionStore.PinRevision if the
+// mention has no revision with the given number.
+var ErrRevisionNotFound = errors.New("revision not found")
+
+// Fields mentions can be sorted by.
+const (
+	MentionSortCreatedAt  = "created_at"
+	MentionSortVerifiedAt = "verified_at"
+	MentionSortSource     = "source"
+	MentionSortTarget     = "target"
+	MentionSortDeletedAt  = "deleted_at"
+)
+
+// MentionCursor identifies the last mention of a page through its
+// value of the sort field and its ID.
+type MentionCursor struct {
+	Value string `json:"v"`
+	ID    string `json:"id"`
+}
+
+// MentionFilter restricts the mentions returned by a MentionStore.
+// Empty fields match all mentions.
+type MentionFilter struct {
+	Status string
+	Source string
+	Target string
+	// TargetPrefix matches all targets starting with it.
+	TargetPrefix string
+	// SourceHost matches all sources on the given host.
+	SourceHost string
+	Type       string
+	// Author matches the author name ignoring case.
+	Author string
+	// Query restricts the result to mentions whose title, content,
+	// author, source, or target contain all words of the query.
+	Query string
+	// The After times are inclusive, the Before times exclusive.
+	CreatedAfter   time.Time
+	CreatedBefore  time.Time
+	VerifiedAfter  time.Time
+	VerifiedBefore time.Time
+	// Trashed returns only mentions in the trash. Otherwise they are
+	// left out.
+	Trashed bool
+	// SortBy is one of the MentionSort fields and defaults to
+	// MentionSortCreatedAt. Mentions with the same value are sorted by
+	// their ID.
+	SortBy string
+	// OldestFirst sorts the result in ascending order instead of
+	// newest (or highest) first.
+	OldestFirst bool
+	// After continues the list right after the mention the cursor
+	// points to. It must have been created for the same SortBy and
+	// OldestFirst.
+	After *MentionCursor
+	// Limit, Offset and After are ignored by MentionStore.CountMentions
+	// and CountMentionsByStatus. A Limit of 0 means no limit.
+	Limit  int
+	Offset int
+}
+
+// Restricted reports whether f has at least one condition that limits
+// the mentions it matches. Sorting and paging don't count.
+func (f MentionFilter) Restricted() bool {
+	return f.Status != "" || f.Source != "" || f.Target != "" || f.TargetPrefix != "" ||
+		f.SourceHost != "" || f.Type != "" || f.Author != "" || len(searchTerms(f.Query)) > 0 ||
+		!f.CreatedAfter.IsZero() || !f.CreatedBefore.IsZero() || !f.VerifiedAfter.IsZero() || !f.VerifiedBefore.IsZero()
+}
+
+// errUnrestrictedFilter is returned by
+// MentionStore.BulkUpdateMatchingMentions for filters that would select
+// all mentions.
+var errUnrestrictedFilter = errors.New("the filter must restrict the mentions")
+
+// sortField returns the field the result is sorted by.
+func (f MentionFilter) sortField() string {
+	if f.SortBy == "" {
+		return MentionSortCreatedAt
+	}
+	return f.SortBy
+}
+
+// Cursor returns the cursor pointing to m for the sort order of f.
+func (f MentionFilter) Cursor(m Mention) *MentionCursor {
+	c := &MentionCursor{ID: m.ID}
+	switch f.sortField() {
+	case MentionSortVerifiedAt:
+		c.Value = m.VerifiedAt
+	case MentionSortSource:
+		c.Value = m.Source
+	case MentionSortTarget:
+		c.Value = m.Target
+	case MentionSortDeletedAt:
+		c.Value = m.DeletedAt
+	default:
+		c.Value = m.CreatedAt
+	}
+	return c
+}
+
+// ValidSortField reports whether mentions can be sorted by field.
+func ValidSortField(field string) bool {
+	switch field {
+	case MentionSortCreatedAt, MentionSortVerifiedAt, MentionSortSource, MentionSortTarget, MentionSortDeletedAt:
+		return true
+	}
+	return false
+}
+
+// PruneOptions select the mentions removed by
+// MentionStore.PruneMentions.
+type PruneOptions struct {
+	Status string
+	// Before is compared with the time a mention was last verified or,
+	// if it hasn't been verified yet, when it was received.
+	Before time.Time
+	// Tombstone records the source and target of all removed mentions
+	// so that they can be recognized if they are received again.
+	// Tombstones of mentions with the status that were recorded before
+	// Before expire and are removed as well.
+	Tombstone bool
+	// DryRun only counts the mentions that would be removed.
+	DryRun bool
+}
+
+// MentionStore persists received mentions.
+type MentionStore interface {
+	// CreateMention stores a new mention. ErrMentionExists is returned if
+	// a mention with the same source and target exists already, even if
+	// it is in the trash.
+	CreateMention(ctx context.Context, m Mention) error
+	// GetMention returns the mention with the given ID. Like all other
+	// methods apart from ListMentions with MentionFilter.Trashed and
+	// the trash methods, it ignores mentions in the trash.
+	GetMention(ctx context.Context, id string) (*Mention, error)
+	ListMentions(ctx context.Context, filter MentionFilter) ([]Mention, error)
+	CountMentions(ctx context.Context, filter MentionFilter) (int, error)
+	// CountMentionsByStatus counts the mentions matching filter per
+	// status. Statuses without mentions are omitted.
+	CountMentionsByStatus(ctx context.Context, filter MentionFilter) (map[string]int, error)
+	// UpdateMentionStatus sets the status of a mention. Approving or
+	// rejecting a mention for the first time also sets its ModeratedAt.
+	UpdateMentionStatus(ctx context.Context, id string, status string) error
+	// ResetMention puts the mention with the given source and target
+	// back into the "new" state so that it gets verified again.
+	ResetMention(ctx context.Context, source string, target string) error
+	// NextPendingMention returns a mention in the "new" state that hasn't
+	// been verified since the given time. ErrMentionNotFound is returned
+	// if there is none.
+	NextPendingMention(ctx context.Context, verifiedBefore time.Time) (*Mention, error)
+	// SaveVerification stores the status, verification time and the
+	// details extracted from the source while verifying a mention.
+	// Unless the mention is invalid, the details are recorded as new
+	// revision if they differ from the latest one. Mentions with a
+	// pinned revision keep their details and only get the new revision.
+	SaveVerification(ctx context.Context, m Mention) error
+	// ListRevisions returns the revisions of a mention starting with
+	// the latest one. They are removed together with the mention.
+	ListRevisions(ctx context.Context, mentionID string) ([]Revision, error)
+	// PinRevision replaces the details of a mention with those of the
+	// given revision and keeps them even if the source changes later
+	// on. Passing 0 unpins the mention and restores the details of the
+	// latest revision.
+	PinRevision(ctx context.Context, id string, number int) error
+	// ReplaceRevisions replaces all revisions of a mention, which might
+	// be in the trash, e.g. when importing them.
+	ReplaceRevisions(ctx context.Context, mentionID string, revisions []Revision) error
+	// RecordVerification adds v to the verification history of its
+	// mention. The history is removed together with the mention.
+	RecordVerification(ctx context.Context, v Verification) error
+	// ListVerifications returns the verification history of a mention
+	// starting with the latest verification.
+	ListVerifications(ctx context.Context, mentionID string) ([]Verification, error)
+	// UpdateMention replaces all fields of the mention with the same ID
+	// that are not part of its identity (ID, source and target). This
+	// includes its trash state, so mentions in the trash can be updated
+	// as well. Title, Content, AuthorName and Type are stored as
+	// extracted values and those of a mention returned by the store are
+	// reverted to them before.
+	UpdateMention(ctx context.Context, m Mention) error
+	// SetMentionOverrides replaces the overrides of a mention. Fields
+	// that are nil don't override the extracted values.
+	SetMentionOverrides(ctx context.Context, id string, o MentionOverrides) error
+	// TrashMention moves a mention into the trash, remembering who
+	// deleted it.
+	TrashMention(ctx context.Context, id string, deletedBy string) error
+	// RestoreMention moves a mention out of the trash.
+	RestoreMention(ctx context.Context, id string) error
+	// PurgeMention permanently removes a mention from the trash.
+	PurgeMention(ctx context.Context, id string) error
+	// PurgeTrash permanently removes all mentions that were moved into
+	// the trash before the given time and returns how many were
+	// removed. A zero time empties the whole trash.
+	PurgeTrash(ctx context.Context, deletedBefore time.Time) (int, error)
+	// BulkUpdateMentions applies one of the BulkAction values to all
+	// mentions with the given IDs in a single transaction. Unknown IDs
+	// don't abort the transaction but are reported as not found.
+	// Deleted mentions are moved into the trash on behalf of actor.
+	BulkUpdateMentions(ctx context.Context, action string, ids []string, actor string) ([]BulkResult, error)
+	// BulkUpdateMatchingMentions works like BulkUpdateMentions for all
+	// mentions matching filter. They are selected within the same
+	// transaction. The filter must be restricted, see
+	// MentionFilter.Restricted.
+	BulkUpdateMatchingMentions(ctx context.Context, action string, filter MentionFilter, actor string) ([]BulkResult, error)
+	// PruneMentions removes all mentions matching opts and returns how
+	// many were (or would be) removed. Mentions in the trash are not
+	// touched.
+	PruneMentions(ctx context.Context, opts PruneOptions) (int, error)
+	// HasTombstone reports whether a mention with the given source and
+	// target has been pruned with a tombstone.
+	HasTombstone(ctx context.Context, source string, target string) (bool, error)
+}
+
+// MentionOriginManual marks mentions that were added by an admin
+// instead of being received.
+const MentionOriginManual = "manual"
+
+// MentionOverrides replace values extracted from the source of a
+// mention. They are kept separately so that verifying a mention again
+// doesn't overwrite them.
+type MentionOverrides struct {
+	Title      *string `json:"title,omitempty"`
+	Content    *string `json:"content,omitempty"`
+	AuthorName *string `json:"author_name,omitempty"`
+	Type       *string `json:"type,omitempty"`
+}
+
+// IsEmpty reports whether no value is overridden.
+func (o MentionOverrides) IsEmpty() bool {
+	return o.Title == nil && o.Content == nil && o.AuthorName == nil && o.Type == nil
+}
+
+// withOverrides returns m with its overrides applied.
+func (m Mention) withOverrides() Mention {
+	if m.Overrides == nil {
+		return m
+	}
+	// Callers must not be able to change the overrides of the original:
+	o := *m.Overrides
+	m.Overrides = &o
+	m.extracted = &MentionOverrides{}
+	for _, field := range []struct {
+		value     *string
+		override  *string
+		extracted **string
+	}{
+		{&m.Title, m.Overrides.Title, &m.extracted.Title},
+		{&m.Content, m.Overrides.Content, &m.extracted.Content},
+		{&m.AuthorName, m.Overrides.AuthorName, &m.extracted.AuthorName},
+		{&m.Type, m.Overrides.Type, &m.extracted.Type},
+	} {
+		if field.override != nil {
+			value := *field.value
+			*field.extracted = &value
+			*field.value = *field.override
+		}
+	}
+	return m
+}
+
+// withoutOverrides reverts withOverrides so that m contains the
+// extracted values again.
+func (m Mention) withoutOverrides() Mention {
+	if m.extracted == nil {
+		return m
+	}
+	for _, field := range []struct {
+		value     *string
+		extracted *string
+	}{
+		{&m.Title, m.extracted.Title},
+		{&m.Content, m.extracted.Content},
+		{&m.AuthorName, m.extracted.AuthorName},
+		{&m.Type, m.extracted.Type},
+	} {
+		if field.extracted != nil {
+			*field.value = *field.extracted
+		}
+	}
+	m.extracted = nil
+	return m
+}
+
+// Verification is the outcome of a single verification of a mention
+// together with the details extracted from its source.
+type Verification struct {
+	MentionID  string `json:"-"`
+	VerifiedAt string `json:"verified_at"`
+	Status     string `json:"status"`
+	// Error explains why the mention was found to be invalid.
+	Error      string `json:"error,omitempty"`
+	Title      string `json:"title,omitempty"`
+	Type       string `json:"type,omitempty"`
+	AuthorName string `json:"author_name,omitempty"`
+	// Manual is set for verifications requested by an admin.
+	Manual bool `json:"manual,omitempty"`
+}
+
+// Revision is a version of the details extracted from the source of a
+// mention.
+type Revision struct {
+	MentionID string `json:"-"`
+	// Number counts the revisions of a mention starting with 1.
+	Number     int    `json:"number"`
+	CreatedAt  string `json:"created_at"`
+	Title      string `json:"title"`
+	Content    string `json:"content"`
+	AuthorName string `json:"author_name"`
+	Type       string `json:"type"`
+	RSVP       string `json:"rsvp"`
+}
+
+// newRevision returns the revision to record after verifying m or nil
+// if m is invalid or its details are the same as in latest. latest is
+// nil for mentions without revisions.
+func newRevision(m Mention, latest *Revision) *Revision {
+	if m.Status == MentionStatusInvalid {
+		return nil
+	}
+	r := Revision{
+		MentionID:  m.ID,
+		Number:     1,
+		CreatedAt:  m.VerifiedAt,
+		Title:      m.Title,
+		Content:    m.Content,
+		AuthorName: m.AuthorName,
+		Type:       m.Type,
+		RSVP:       m.RSVP,
+	}
+	if latest != nil {
+		if latest.Title == r.Title && latest.Content == r.Content && latest.AuthorName == r.AuthorName && latest.Type == r.Type && latest.RSVP == r.RSVP {
+			return nil
+		}
+		r.Number = latest.Number + 1
+	}
+	return &r
+}
+
+// moderatedAt returns the moderation time to remember for a mention
+// that an admin changed to status at now. Only approving and rejecting
+// a mention count as moderation.
+func moderatedAt(status string, now time.Time) string {
+	if status != MentionStatusApproved && status != MentionStatusRejected {
+		return ""
+	}
+	return formatTimestamp(now)
+}
+
+// Actions supported by MentionStore.BulkUpdateMentions. Deleting moves
+// a mention into the trash and re-verifying puts it back into the "new"
+// state.
+const (
+	BulkActionApprove  = "approve"
+	BulkActionReject   = "reject"
+	BulkActionDelete   = "delete"
+	BulkActionReverify = "reverify"
+)
+
+// bulkActionStatus maps all actions apart from deleting to the status
+// they set.
+var bulkActionStatus = map[string]string{
+	BulkActionApprove:  MentionStatusApproved,
+	BulkActionReject:   MentionStatusRejected,
+	BulkActionReverify: MentionStatusNew,
+}
+
+// ValidBulkAction reports whether action can be passed to
+// MentionStore.BulkUpdateMentions.
+func ValidBulkAction(action string) bool {
+	_, ok := bulkActionStatus[action]
+	return ok || action == BulkActionDelete
+}
+
+// BulkResult is the outcome of a bulk action for a single mention.
+type BulkResult struct {
+	ID     string `json:"id"`
+	Target string `json:"target,omitempty"`
+	// PreviousStatus is the status of the mention before the action.
+	PreviousStatus string `json:"previous_status,omitempty"`
+	// Status is the new status of the mention. It is empty for
+	// trashed mentions and if the action failed.
+	Status string `json:"status,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+// PolicyStore persists the URL policies applied to verified mentions.
+// It can be used as policies.Loader.
+type PolicyStore interface {
+	policies.Loader
+	// CreatePolicy stores a new policy and returns its ID.
+	CreatePolicy(ctx context.Context, p policies.URLPolicy) (int, error)
+	DeletePolicy(ctx context.Context, id int) error
+}
+
+// Actions recorded in the audit log.
+const (
+	AuditActionCreateMention   = "mention.create"
+	AuditActionUpdateMention   = "mention.update"
+	AuditActionVerifyMention   = "mention.verify"
+	AuditActionApproveMention  = "mention.approve"
+	AuditActionRejectMention   = "mention.reject"
+	AuditActionDeleteMention   = "mention.delete"
+	AuditActionReverifyMention = "mention.reverify"
+	AuditActionRestoreMention  = "mention.restore"
+	AuditActionPurgeMention    = "mention.purge"
+	AuditActionPinRevision     = "mention.pin"
+	AuditActionUnpinRevision   = "mention.unpin"
+	AuditActionSendMentions    = "mention.send"
+	AuditActionCreatePolicy    = "policy.create"
+	AuditActionDeletePolicy    = "policy.delete"
+	AuditActionImport          = "import"
+)
+
+// AuditEntry records who changed what through the admin API.
+type AuditEntry struct {
+	ID        int    `json:"id"`
+	CreatedAt string `json:"created_at"`
+	// Actor is the subject of the JWT the change was made with, i.e.
+	// an admin email address or "key:<name>" for access keys.
+	Actor   string        `json:"actor"`
+	Action  string        `json:"action"`
+	Targets []AuditTarget `json:"targets"`
+}
+
+// AuditTarget is a mention, policy or source URL affected by an
+// audited change. The statuses are only set for mentions and are empty
+// if the mention didn't exist before or doesn't exist anymore after the
+// change.
+type AuditTarget struct {
+	ID           string `json:"id"`
+	StatusBefore string `json:"status_before,omitempty"`
+	StatusAfter  string `json:"status_after,omitempty"`
+}
+
+// AuditFilter restricts the entries returned by
+// AuditStore.ListAuditEntries. Zero values are ignored.
+type AuditFilter struct {
+	Actor  string
+	Action string
+	// TargetID only returns entries that affected the given target.
+	TargetID      string
+	CreatedAfter  time.Time
+	CreatedBefore time.Time
+	Limit         int
+	Offset        int
+}
+
+// AuditStore persists the audit log.
+type AuditStore interface {
+	// RecordAuditEntry adds an entry to the log. ID is ignored and the
+	// targets are stored in order of their IDs.
+	RecordAuditEntry(ctx context.Context, e AuditEntry) error
+	// ListAuditEntries returns the entries matching filter, starting
+	// with the latest.
+	ListAuditEntries(ctx context.Context, filter AuditFilter) ([]AuditEntry, error)
+	CountAuditEntries(ctx context.Context, filter AuditFilter) (int, error)
+}
+
+// FeedState is what is remembered about a feed between two polls.
+type FeedState struct {
+	URL          string
+	ETag         string
+	LastModified string
+	// Polled is set once the feed has been polled successfully.
+	Polled bool
+}
+
+// FeedEntry is an entry of a polled feed whose mentions haven't been
+// sent yet.
+type FeedEntry struct {
+	feeds.Entry
+	// PendingSince is the time the entry was found to be new or
+	// updated. Deliveries to its targets after that time don't need to
+	// be repeated.
+	PendingSince time.Time
+	// Attempts counts the polls that failed to send all mentions of
+	// the entry.
+	Attempts int
+}
+
+// SendStore persists everything that is needed for sending mentions:
+// The targets each source linked to and the state of polled feeds.
+type SendStore interface {
+	webmention.TargetSnapshotStore
+	// RecordDelivery remembers the endpoint and protocol used for
+	// successfully sending a mention to a target, including targets
+	// that are no longer linked from the source.
+	RecordDelivery(ctx context.Context, source string, target string, endpoint string, protocol string) error
+	// DeliveredTargets returns the targets a mention from source has
+	// been delivered to successfully at or after since.
+	DeliveredTargets(ctx context.Context, source string, since time.Time) ([]string, error)
+	// GetFeedState returns the state of the last poll of the given feed
+	// or an empty state if it hasn't been polled yet.
+	GetFeedState(ctx context.Context, feedURL string) (FeedState, error)
+	// UpdateFeed stores the new state of a feed and records all new
+	// entries and all entries that were updated since the last poll as
+	// pending.
+	UpdateFeed(ctx context.Context, state FeedState, entries []feeds.Entry) error
+	PendingFeedEntries(ctx context.Context, feedURL string) ([]FeedEntry, error)
+	// RecordFeedEntryFailure increments the attempts of a pending
+	// entry.
+	RecordFeedEntryFailure(ctx context.Context, feedURL string, entryID string) error
+	MarkFeedEntrySent(ctx context.Context, feedURL string, entryID string) error
+}
+
+// formatTimestamp is used for all timestamps stored as text. RFC3339
+// timestamps in UTC can be compared lexicographically.
+func formatTimestamp(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339)
+}
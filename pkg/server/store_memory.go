@@ -0,0 +1,791 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/zerok/webmentiond/pkg/feeds"
+	"github.com/zerok/webmentiond/pkg/policies"
+)
+
+// MemoryStore implements MentionStore, PolicyStore, SendStore and
+// AuditStore by
+// keeping everything in memory. It is meant for tests and for
+// embedding the server into other programs where persistence isn't
+// required.
+type MemoryStore struct {
+	lock         sync.RWMutex
+	mentions     map[string]Mention
+	policies     []policies.URLPolicy
+	lastPolicyID int
+	targets      map[string][]string
+	deliveries   map[memoryDeliveryKey]memoryDelivery
+	feeds        map[string]FeedState
+	feedEntries  map[string][]memoryFeedEntry
+	tombstones   map[memoryTombstone]memoryTombstoneState
+	// verifications are kept per mention ID with the latest one last.
+	verifications map[string][]Verification
+	// revisions are kept per mention ID with the latest one last.
+	revisions map[string][]Revision
+	// auditLog has the latest entry last.
+	auditLog []AuditEntry
+}
+
+type memoryTombstone struct {
+	Source string
+	Target string
+}
+
+type memoryTombstoneState struct {
+	Status   string
+	PurgedAt string
+}
+
+type memoryDeliveryKey struct {
+	Source string
+	Target string
+}
+
+type memoryDelivery struct {
+	Endpoint string
+	Protocol string
+	SentAt   time.Time
+}
+
+type memoryFeedEntry struct {
+	FeedEntry
+	Sent bool
+}
+
+// NewMemoryStore creates a new empty store.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		mentions:      make(map[string]Mention),
+		policies:      make([]policies.URLPolicy, 0, 10),
+		targets:       make(map[string][]string),
+		deliveries:    make(map[memoryDeliveryKey]memoryDelivery),
+		feeds:         make(map[string]FeedState),
+		feedEntries:   make(map[string][]memoryFeedEntry),
+		tombstones:    make(map[memoryTombstone]memoryTombstoneState),
+		verifications: make(map[string][]Verification),
+		revisions:     make(map[string][]Revision),
+	}
+}
+
+func (s *MemoryStore) CreateMention(ctx context.Context, m Mention) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	for _, existing := range s.mentions {
+		if existing.Source == m.Source && existing.Target == m.Target {
+			return ErrMentionExists
+		}
+	}
+	if m.Status == "" {
+		m.Status = MentionStatusNew
+	}
+	if m.Overrides != nil {
+		o := *m.Overrides
+		m.Overrides = &o
+	}
+	s.mentions[m.ID] = m
+	return nil
+}
+
+// activeMention returns the mention with the given ID unless it is in
+// the trash.
+func (s *MemoryStore) activeMention(id string) (Mention, bool) {
+	m, ok := s.mentions[id]
+	return m, ok && m.DeletedAt == ""
+}
+
+func (s *MemoryStore) GetMention(ctx context.Context, id string) (*Mention, error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	m, ok := s.activeMention(id)
+	if !ok {
+		return nil, ErrMentionNotFound
+	}
+	m = m.withOverrides()
+	return &m, nil
+}
+
+func (s *MemoryStore) filterMentions(filter MentionFilter) []Mention {
+	result := make([]Mention, 0, 10)
+	terms := searchTerms(filter.Query)
+	for _, m := range s.mentions {
+		if filter.Trashed != (m.DeletedAt != "") {
+			continue
+		}
+		m = m.withOverrides()
+		if len(terms) > 0 && !matchesSearch(m, terms) {
+			continue
+		}
+		if filter.Status != "" && m.Status != filter.Status {
+			continue
+		}
+		if filter.Source != "" && m.Source != filter.Source {
+			continue
+		}
+		if filter.Target != "" && m.Target != filter.Target {
+			continue
+		}
+		if !strings.HasPrefix(m.Target, filter.TargetPrefix) {
+			continue
+		}
+		if filter.SourceHost != "" && !matchesHost(m.Source, filter.SourceHost) {
+			continue
+		}
+		if filter.Type != "" && m.Type != filter.Type {
+			continue
+		}
+		if filter.Author != "" && !strings.EqualFold(m.AuthorName, filter.Author) {
+			continue
+		}
+		if !filter.CreatedAfter.IsZero() && m.CreatedAt < formatTimestamp(filter.CreatedAfter) {
+			continue
+		}
+		if !filter.CreatedBefore.IsZero() && m.CreatedAt >= formatTimestamp(filter.CreatedBefore) {
+			continue
+		}
+		if !filter.VerifiedAfter.IsZero() && m.VerifiedAt < formatTimestamp(filter.VerifiedAfter) {
+			continue
+		}
+		if !filter.VerifiedBefore.IsZero() && (m.VerifiedAt == "" || m.VerifiedAt >= formatTimestamp(filter.VerifiedBefore)) {
+			continue
+		}
+		result = append(result, m)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return cursorBefore(filter, filter.Cursor(result[i]), filter.Cursor(result[j]))
+	})
+	return result
+}
+
+// cursorBefore reports whether a comes before b in the order requested
+// by filter.
+func cursorBefore(filter MentionFilter, a *MentionCursor, b *MentionCursor) bool {
+	if !filter.OldestFirst {
+		a, b = b, a
+	}
+	if a.Value == b.Value {
+		return a.ID < b.ID
+	}
+	return a.Value < b.Value
+}
+
+// matchesHost reports whether rawURL is an HTTP(S) URL on host.
+func matchesHost(rawURL string, host string) bool {
+	for _, scheme := range []string{"http://", "https://"} {
+		if rawURL == scheme+host || strings.HasPrefix(rawURL, scheme+host+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *MemoryStore) ListMentions(ctx context.Context, filter MentionFilter) ([]Mention, error) {
+	if !ValidSortField(filter.sortField()) {
+		return nil, fmt.Errorf("mentions cannot be sorted by %s", filter.sortField())
+	}
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	return s.listMentions(filter), nil
+}
+
+// listMentions returns the requested page of mentions matching filter.
+// The caller must hold the lock.
+func (s *MemoryStore) listMentions(filter MentionFilter) []Mention {
+	result := s.filterMentions(filter)
+	if filter.After != nil {
+		result = result[sort.Search(len(result), func(i int) bool {
+			return cursorBefore(filter, filter.After, filter.Cursor(result[i]))
+		}):]
+	}
+	if filter.Offset > 0 {
+		if filter.Offset >= len(result) {
+			return []Mention{}
+		}
+		result = result[filter.Offset:]
+	}
+	if filter.Limit > 0 && filter.Limit < len(result) {
+		result = result[:filter.Limit]
+	}
+	return result
+}
+
+func (s *MemoryStore) CountMentions(ctx context.Context, filter MentionFilter) (int, error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	return len(s.filterMentions(filter)), nil
+}
+
+func (s *MemoryStore) CountMentionsByStatus(ctx context.Context, filter MentionFilter) (map[string]int, error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	result := make(map[string]int)
+	for _, m := range s.filterMentions(filter) {
+		result[m.Status]++
+	}
+	return result, nil
+}
+
+func (s *MemoryStore) UpdateMentionStatus(ctx context.Context, id string, status string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	m, ok := s.activeMention(id)
+	if !ok {
+		return ErrMentionNotFound
+	}
+	m.Status = status
+	if m.ModeratedAt == "" {
+		m.ModeratedAt = moderatedAt(status, time.Now())
+	}
+	s.mentions[id] = m
+	return nil
+}
+
+func (s *MemoryStore) ResetMention(ctx context.Context, source string, target string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	for id, m := range s.mentions {
+		if m.Source == source && m.Target == target && m.DeletedAt == "" {
+			m.Status = MentionStatusNew
+			s.mentions[id] = m
+			return nil
+		}
+	}
+	return ErrMentionNotFound
+}
+
+func (s *MemoryStore) NextPendingMention(ctx context.Context, verifiedBefore time.Time) (*Mention, error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	before := formatTimestamp(verifiedBefore)
+	for _, m := range s.filterMentions(MentionFilter{Status: MentionStatusNew, OldestFirst: true}) {
+		if m.VerifiedAt == "" || m.VerifiedAt < before {
+			return &m, nil
+		}
+	}
+	return nil, ErrMentionNotFound
+}
+
+func (s *MemoryStore) SaveVerification(ctx context.Context, m Mention) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	existing, ok := s.activeMention(m.ID)
+	if !ok {
+		return ErrMentionNotFound
+	}
+	var latest *Revision
+	if revisions := s.revisions[m.ID]; len(revisions) > 0 {
+		latest = &revisions[len(revisions)-1]
+	}
+	if r := newRevision(m, latest); r != nil {
+		s.revisions[m.ID] = append(s.revisions[m.ID], *r)
+	}
+	existing.Status = m.Status
+	existing.VerifiedAt = m.VerifiedAt
+	if existing.PinnedRevision == 0 {
+		existing.Title = m.Title
+		existing.Type = m.Type
+		existing.Content = m.Content
+		existing.AuthorName = m.AuthorName
+		existing.RSVP = m.RSVP
+	}
+	s.mentions[m.ID] = existing
+	return nil
+}
+
+func (s *MemoryStore) ListRevisions(ctx context.Context, mentionID string) ([]Revision, error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	revisions := s.revisions[mentionID]
+	result := make([]Revision, 0, len(revisions))
+	for i := len(revisions) - 1; i >= 0; i-- {
+		result = append(result, revisions[i])
+	}
+	return result, nil
+}
+
+func (s *MemoryStore) PinRevision(ctx context.Context, id string, number int) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	m, ok := s.activeMention(id)
+	if !ok {
+		return ErrMentionNotFound
+	}
+	revisions := s.revisions[id]
+	var r *Revision
+	switch {
+	case number > 0:
+		for i := range revisions {
+			if revisions[i].Number == number {
+				r = &revisions[i]
+			}
+		}
+		if r == nil {
+			return ErrRevisionNotFound
+		}
+	case len(revisions) > 0:
+		// Unpinning restores the latest revision:
+		r = &revisions[len(revisions)-1]
+	}
+	m.PinnedRevision = number
+	if r != nil {
+		m.Title = r.Title
+		m.Content = r.Content
+		m.AuthorName = r.AuthorName
+		m.Type = r.Type
+		m.RSVP = r.RSVP
+	}
+	s.mentions[id] = m
+	return nil
+}
+
+func (s *MemoryStore) UpdateMention(ctx context.Context, m Mention) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	existing, ok := s.mentions[m.ID]
+	if !ok {
+		return ErrMentionNotFound
+	}
+	m = m.withoutOverrides()
+	if m.Overrides != nil {
+		if m.Overrides.IsEmpty() {
+			m.Overrides = nil
+		} else {
+			o := *m.Overrides
+			m.Overrides = &o
+		}
+	}
+	m.Source = existing.Source
+	m.Target = existing.Target
+	s.mentions[m.ID] = m
+	return nil
+}
+
+func (s *MemoryStore) ReplaceRevisions(ctx context.Context, mentionID string, revisions []Revision) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if _, ok := s.mentions[mentionID]; !ok {
+		return ErrMentionNotFound
+	}
+	replaced := make([]Revision, 0, len(revisions))
+	for _, r := range revisions {
+		r.MentionID = mentionID
+		replaced = append(replaced, r)
+	}
+	sort.Slice(replaced, func(i, j int) bool {
+		return replaced[i].Number < replaced[j].Number
+	})
+	s.revisions[mentionID] = replaced
+	return nil
+}
+
+func (s *MemoryStore) SetMentionOverrides(ctx context.Context, id string, o MentionOverrides) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	m, ok := s.activeMention(id)
+	if !ok {
+		return ErrMentionNotFound
+	}
+	m.Overrides = nil
+	if !o.IsEmpty() {
+		m.Overrides = &o
+	}
+	s.mentions[id] = m
+	return nil
+}
+
+func (s *MemoryStore) TrashMention(ctx context.Context, id string, deletedBy string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	m, ok := s.activeMention(id)
+	if !ok {
+		return ErrMentionNotFound
+	}
+	m.DeletedAt = formatTimestamp(time.Now())
+	m.DeletedBy = deletedBy
+	s.mentions[id] = m
+	return nil
+}
+
+func (s *MemoryStore) RestoreMention(ctx context.Context, id string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	m, ok := s.mentions[id]
+	if !ok || m.DeletedAt == "" {
+		return ErrMentionNotFound
+	}
+	m.DeletedAt = ""
+	m.DeletedBy = ""
+	s.mentions[id] = m
+	return nil
+}
+
+func (s *MemoryStore) PurgeMention(ctx context.Context, id string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	m, ok := s.mentions[id]
+	if !ok || m.DeletedAt == "" {
+		return ErrMentionNotFound
+	}
+	delete(s.mentions, id)
+	delete(s.verifications, id)
+	delete(s.revisions, id)
+	return nil
+}
+
+func (s *MemoryStore) PurgeTrash(ctx context.Context, deletedBefore time.Time) (int, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	before := formatTimestamp(deletedBefore)
+	count := 0
+	for id, m := range s.mentions {
+		if m.DeletedAt == "" || (before != "" && m.DeletedAt >= before) {
+			continue
+		}
+		delete(s.mentions, id)
+		delete(s.verifications, id)
+		delete(s.revisions, id)
+		count++
+	}
+	return count, nil
+}
+
+func (s *MemoryStore) RecordVerification(ctx context.Context, v Verification) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.verifications[v.MentionID] = append(s.verifications[v.MentionID], v)
+	return nil
+}
+
+func (s *MemoryStore) ListVerifications(ctx context.Context, mentionID string) ([]Verification, error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	result := make([]Verification, 0, len(s.verifications[mentionID]))
+	for i := len(s.verifications[mentionID]) - 1; i >= 0; i-- {
+		result = append(result, s.verifications[mentionID][i])
+	}
+	return result, nil
+}
+
+func (s *MemoryStore) BulkUpdateMentions(ctx context.Context, action string, ids []string, actor string) ([]BulkResult, error) {
+	if !ValidBulkAction(action) {
+		return nil, fmt.Errorf("unsupported bulk action: %s", action)
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.bulkUpdate(action, ids, actor), nil
+}
+
+func (s *MemoryStore) BulkUpdateMatchingMentions(ctx context.Context, action string, filter MentionFilter, actor string) ([]BulkResult, error) {
+	if !ValidBulkAction(action) {
+		return nil, fmt.Errorf("unsupported bulk action: %s", action)
+	}
+	if !filter.Restricted() || filter.Trashed {
+		return nil, errUnrestrictedFilter
+	}
+	if !ValidSortField(filter.sortField()) {
+		return nil, fmt.Errorf("mentions cannot be sorted by %s", filter.sortField())
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	mentions := s.listMentions(filter)
+	ids := make([]string, 0, len(mentions))
+	for _, m := range mentions {
+		ids = append(ids, m.ID)
+	}
+	return s.bulkUpdate(action, ids, actor), nil
+}
+
+// bulkUpdate applies action to the mentions with the given IDs. The
+// caller must hold the lock.
+func (s *MemoryStore) bulkUpdate(action string, ids []string, actor string) []BulkResult {
+	results := make([]BulkResult, 0, len(ids))
+	for _, id := range ids {
+		m, ok := s.activeMention(id)
+		if !ok {
+			results = append(results, BulkResult{ID: id, Error: ErrMentionNotFound.Error()})
+			continue
+		}
+		result := BulkResult{ID: id, Target: m.Target, PreviousStatus: m.Status}
+		if action == BulkActionDelete {
+			m.DeletedAt = formatTimestamp(time.Now())
+			m.DeletedBy = actor
+		} else {
+			m.Status = bulkActionStatus[action]
+			result.Status = m.Status
+			if m.ModeratedAt == "" {
+				m.ModeratedAt = moderatedAt(m.Status, time.Now())
+			}
+		}
+		s.mentions[id] = m
+		results = append(results, result)
+	}
+	return results
+}
+
+func (s *MemoryStore) PruneMentions(ctx context.Context, opts PruneOptions) (int, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	before := formatTimestamp(opts.Before)
+	if opts.Tombstone && !opts.DryRun {
+		for key, tombstone := range s.tombstones {
+			if tombstone.Status == opts.Status && tombstone.PurgedAt < before {
+				delete(s.tombstones, key)
+			}
+		}
+	}
+	purgedAt := formatTimestamp(time.Now())
+	count := 0
+	for id, m := range s.mentions {
+		age := m.CreatedAt
+		if m.VerifiedAt > age {
+			age = m.VerifiedAt
+		}
+		if m.Status != opts.Status || m.DeletedAt != "" || age >= before {
+			continue
+		}
+		count++
+		if opts.DryRun {
+			continue
+		}
+		if opts.Tombstone {
+			s.tombstones[memoryTombstone{Source: m.Source, Target: m.Target}] = memoryTombstoneState{Status: m.Status, PurgedAt: purgedAt}
+		}
+		delete(s.mentions, id)
+		delete(s.verifications, id)
+		delete(s.revisions, id)
+	}
+	return count, nil
+}
+
+func (s *MemoryStore) HasTombstone(ctx context.Context, source string, target string) (bool, error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	_, ok := s.tombstones[memoryTombstone{Source: source, Target: target}]
+	return ok, nil
+}
+
+func (s *MemoryStore) Load(ctx context.Context) ([]policies.URLPolicy, error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	result := append(make([]policies.URLPolicy, 0, len(s.policies)), s.policies...)
+	sort.SliceStable(result, func(i, j int) bool {
+		return result[i].Weight < result[j].Weight
+	})
+	return result, nil
+}
+
+func (s *MemoryStore) CreatePolicy(ctx context.Context, p policies.URLPolicy) (int, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.lastPolicyID++
+	p.ID = s.lastPolicyID
+	s.policies = append(s.policies, p)
+	return p.ID, nil
+}
+
+func (s *MemoryStore) DeletePolicy(ctx context.Context, id int) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	for idx, p := range s.policies {
+		if p.ID == id {
+			s.policies = append(s.policies[:idx], s.policies[idx+1:]...)
+			return nil
+		}
+	}
+	return ErrPolicyNotFound
+}
+
+func (s *MemoryStore) RecordAuditEntry(ctx context.Context, e AuditEntry) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	e.ID = len(s.auditLog) + 1
+	e.Targets = append(make([]AuditTarget, 0, len(e.Targets)), e.Targets...)
+	sort.SliceStable(e.Targets, func(i, j int) bool {
+		return e.Targets[i].ID < e.Targets[j].ID
+	})
+	s.auditLog = append(s.auditLog, e)
+	return nil
+}
+
+// filterAuditLog returns all entries matching filter with the latest
+// one first.
+func (s *MemoryStore) filterAuditLog(filter AuditFilter) []AuditEntry {
+	after := formatTimestamp(filter.CreatedAfter)
+	before := formatTimestamp(filter.CreatedBefore)
+	result := make([]AuditEntry, 0, 10)
+	for i := len(s.auditLog) - 1; i >= 0; i-- {
+		e := s.auditLog[i]
+		if filter.Actor != "" && e.Actor != filter.Actor {
+			continue
+		}
+		if filter.Action != "" && e.Action != filter.Action {
+			continue
+		}
+		if after != "" && e.CreatedAt < after {
+			continue
+		}
+		if before != "" && e.CreatedAt >= before {
+			continue
+		}
+		if filter.TargetID != "" && !hasAuditTarget(e, filter.TargetID) {
+			continue
+		}
+		result = append(result, e)
+	}
+	sort.SliceStable(result, func(i, j int) bool {
+		return result[i].CreatedAt > result[j].CreatedAt
+	})
+	return result
+}
+
+func hasAuditTarget(e AuditEntry, id string) bool {
+	for _, t := range e.Targets {
+		if t.ID == id {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *MemoryStore) ListAuditEntries(ctx context.Context, filter AuditFilter) ([]AuditEntry, error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	result := s.filterAuditLog(filter)
+	if filter.Offset > 0 {
+		if filter.Offset >= len(result) {
+			return []AuditEntry{}, nil
+		}
+		result = result[filter.Offset:]
+	}
+	if filter.Limit > 0 && filter.Limit < len(result) {
+		result = result[:filter.Limit]
+	}
+	return result, nil
+}
+
+func (s *MemoryStore) CountAuditEntries(ctx context.Context, filter AuditFilter) (int, error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	return len(s.filterAuditLog(filter)), nil
+}
+
+func (s *MemoryStore) LoadTargets(ctx context.Context, source string) ([]string, error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	return append(make([]string, 0, len(s.targets[source])), s.targets[source]...), nil
+}
+
+func (s *MemoryStore) SaveTargets(ctx context.Context, source string, targets []string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if len(targets) == 0 {
+		delete(s.targets, source)
+		return nil
+	}
+	sorted := append(make([]string, 0, len(targets)), targets...)
+	sort.Strings(sorted)
+	s.targets[source] = slices.Compact(sorted)
+	return nil
+}
+
+func (s *MemoryStore) RecordDelivery(ctx context.Context, source string, target string, endpoint string, protocol string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.deliveries[memoryDeliveryKey{Source: source, Target: target}] = memoryDelivery{Endpoint: endpoint, Protocol: protocol, SentAt: time.Now()}
+	return nil
+}
+
+func (s *MemoryStore) DeliveredTargets(ctx context.Context, source string, since time.Time) ([]string, error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	result := make([]string, 0, 10)
+	for key, delivery := range s.deliveries {
+		if key.Source == source && !delivery.SentAt.Before(since) {
+			result = append(result, key.Target)
+		}
+	}
+	sort.Strings(result)
+	return result, nil
+}
+
+func (s *MemoryStore) GetFeedState(ctx context.Context, feedURL string) (FeedState, error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	state, ok := s.feeds[feedURL]
+	if !ok {
+		return FeedState{URL: feedURL}, nil
+	}
+	state.Polled = true
+	return state, nil
+}
+
+func (s *MemoryStore) UpdateFeed(ctx context.Context, state FeedState, entries []feeds.Entry) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	stored := s.feedEntries[state.URL]
+	now := time.Now()
+outer:
+	for _, entry := range entries {
+		for idx, existing := range stored {
+			if existing.ID != entry.ID {
+				continue
+			}
+			if entry.Updated.After(existing.Updated) {
+				stored[idx] = memoryFeedEntry{FeedEntry: FeedEntry{Entry: entry, PendingSince: now}}
+			}
+			continue outer
+		}
+		stored = append(stored, memoryFeedEntry{FeedEntry: FeedEntry{Entry: entry, PendingSince: now}})
+	}
+	s.feedEntries[state.URL] = stored
+	s.feeds[state.URL] = state
+	return nil
+}
+
+func (s *MemoryStore) PendingFeedEntries(ctx context.Context, feedURL string) ([]FeedEntry, error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	result := make([]FeedEntry, 0, 10)
+	for _, entry := range s.feedEntries[feedURL] {
+		if !entry.Sent {
+			result = append(result, entry.FeedEntry)
+		}
+	}
+	return result, nil
+}
+
+func (s *MemoryStore) RecordFeedEntryFailure(ctx context.Context, feedURL string, entryID string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	for idx, entry := range s.feedEntries[feedURL] {
+		if entry.ID == entryID {
+			s.feedEntries[feedURL][idx].Attempts++
+		}
+	}
+	return nil
+}
+
+func (s *MemoryStore) MarkFeedEntrySent(ctx context.Context, feedURL string, entryID string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	for idx, entry := range s.feedEntries[feedURL] {
+		if entry.ID == entryID {
+			s.feedEntries[feedURL][idx].Sent = true
+		}
+	}
+	return nil
+}
+
+var _ MentionStore = &MemoryStore{}
+var _ PolicyStore = &MemoryStore{}
+var _ SendStore = &MemoryStore{}
+var _ AuditStore = &MemoryStore{}
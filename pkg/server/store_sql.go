@@ -0,0 +1,993 @@
+package server
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/zerok/webmentiond/pkg/feeds"
+	"github.com/zerok/webmentiond/pkg/policies"
+)
+
+// Supported database drivers.
+const (
+	DatabaseDriverSQLite   = "sqlite3"
+	DatabaseDriverPostgres = "postgres"
+)
+
+// SQLStore implements MentionStore, PolicyStore and SendStore on top of
+// a SQLite or PostgreSQL database. The schema is created by
+// Server.MigrateDatabase.
+type SQLStore struct {
+	db *sql.DB
+	// reader is used for queries that don't modify any data. It is the
+	// same as db unless a separate read-only pool was set through
+	// WithReader.
+	reader *sql.DB
+	driver string
+}
+
+// NewSQLiteStore creates a store using the given SQLite database.
+func NewSQLiteStore(db *sql.DB) *SQLStore {
+	return &SQLStore{db: db, reader: db, driver: DatabaseDriverSQLite}
+}
+
+// NewPostgresStore creates a store using the given PostgreSQL
+// database.
+func NewPostgresStore(db *sql.DB) *SQLStore {
+	return &SQLStore{db: db, reader: db, driver: DatabaseDriverPostgres}
+}
+
+// NewSQLStore creates a store for a database opened with one of the
+// supported drivers.
+func NewSQLStore(db *sql.DB, driver string) (*SQLStore, error) {
+	switch driver {
+	case DatabaseDriverSQLite, DatabaseDriverPostgres:
+		return &SQLStore{db: db, reader: db, driver: driver}, nil
+	}
+	return nil, fmt.Errorf("unsupported database driver: %s", driver)
+}
+
+// rebind replaces the ? placeholders used in all queries with $1, $2,
+// ... for PostgreSQL.
+func (s *SQLStore) rebind(query string) string {
+	if s.driver != DatabaseDriverPostgres {
+		return query
+	}
+	var b strings.Builder
+	n := 0
+	for _, c := range query {
+		if c == '?' {
+			n++
+			b.WriteString("$" + strconv.Itoa(n))
+			continue
+		}
+		b.WriteRune(c)
+	}
+	return b.String()
+}
+
+// WithReader returns a copy of the store that runs all read-only
+// queries against reader.
+func (s *SQLStore) WithReader(reader *sql.DB) *SQLStore {
+	c := *s
+	c.reader = reader
+	return &c
+}
+
+func (s *SQLStore) exec(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	return s.db.ExecContext(ctx, s.rebind(query), args...)
+}
+
+func (s *SQLStore) query(ctx context.Context, query string, args ...any) (*sql.Rows, error) {
+	return s.reader.QueryContext(ctx, s.rebind(query), args...)
+}
+
+func (s *SQLStore) queryRow(ctx context.Context, query string, args ...any) *sql.Row {
+	return s.reader.QueryRowContext(ctx, s.rebind(query), args...)
+}
+
+const mentionColumns = "id, source, target, created_at, status, title, content, author_name, author_url, author_photo, type, rsvp, protocol, verified_at, published_at, origin, title_override, content_override, author_name_override, type_override, deleted_at, deleted_by, pinned_revision, moderated_at"
+
+// Expressions for the values of mentions that can be overridden.
+const (
+	mentionTitle      = "COALESCE(title_override, title)"
+	mentionContent    = "COALESCE(content_override, content)"
+	mentionAuthorName = "COALESCE(author_name_override, author_name)"
+	mentionType       = "COALESCE(type_override, type)"
+)
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+// scanMention reads a row of mentionColumns and applies the overrides.
+func scanMention(row rowScanner) (*Mention, error) {
+	m := Mention{}
+	var title, content, authorName, typ sql.NullString
+	if err := row.Scan(&m.ID, &m.Source, &m.Target, &m.CreatedAt, &m.Status, &m.Title, &m.Content, &m.AuthorName, &m.AuthorURL, &m.AuthorPhoto, &m.Type, &m.RSVP, &m.Protocol, &m.VerifiedAt, &m.PublishedAt, &m.Origin, &title, &content, &authorName, &typ, &m.DeletedAt, &m.DeletedBy, &m.PinnedRevision, &m.ModeratedAt); err != nil {
+		return nil, err
+	}
+	o := MentionOverrides{
+		Title:      nullString(title),
+		Content:    nullString(content),
+		AuthorName: nullString(authorName),
+		Type:       nullString(typ),
+	}
+	if !o.IsEmpty() {
+		m.Overrides = &o
+	}
+	m = m.withOverrides()
+	return &m, nil
+}
+
+func nullString(s sql.NullString) *string {
+	if !s.Valid {
+		return nil
+	}
+	return &s.String
+}
+
+// mentionFilterClause returns the WHERE clause for filter. The cursor
+// is only taken into account if paged is true.
+func (s *SQLStore) mentionFilterClause(ctx context.Context, filter MentionFilter, paged bool) (string, []any, error) {
+	conditions := make([]string, 0, 4)
+	args := make([]any, 0, 4)
+	if filter.Trashed {
+		conditions = append(conditions, "deleted_at <> ''")
+	} else {
+		conditions = append(conditions, "deleted_at = ''")
+	}
+	if filter.Status != "" {
+		conditions = append(conditions, "status = ?")
+		args = append(args, filter.Status)
+	}
+	if filter.Source != "" {
+		conditions = append(conditions, "source = ?")
+		args = append(args, filter.Source)
+	}
+	if filter.Target != "" {
+		conditions = append(conditions, "target = ?")
+		args = append(args, filter.Target)
+	}
+	if filter.TargetPrefix != "" {
+		conditions = append(conditions, "SUBSTR(target, 1, ?) = ?")
+		args = append(args, len(filter.TargetPrefix), filter.TargetPrefix)
+	}
+	if filter.SourceHost != "" {
+		conditions = append(conditions, "(source IN (?, ?) OR SUBSTR(source, 1, ?) = ? OR SUBSTR(source, 1, ?) = ?)")
+		for _, scheme := range []string{"http://", "https://"} {
+			args = append(args, scheme+filter.SourceHost)
+		}
+		for _, scheme := range []string{"http://", "https://"} {
+			prefix := scheme + filter.SourceHost + "/"
+			args = append(args, len(prefix), prefix)
+		}
+	}
+	if filter.Type != "" {
+		conditions = append(conditions, mentionType+" = ?")
+		args = append(args, filter.Type)
+	}
+	if filter.Author != "" {
+		conditions = append(conditions, "LOWER("+mentionAuthorName+") = ?")
+		args = append(args, strings.ToLower(filter.Author))
+	}
+	if !filter.CreatedAfter.IsZero() {
+		conditions = append(conditions, "created_at >= ?")
+		args = append(args, formatTimestamp(filter.CreatedAfter))
+	}
+	if !filter.CreatedBefore.IsZero() {
+		conditions = append(conditions, "created_at < ?")
+		args = append(args, formatTimestamp(filter.CreatedBefore))
+	}
+	if !filter.VerifiedAfter.IsZero() {
+		conditions = append(conditions, "verified_at >= ?")
+		args = append(args, formatTimestamp(filter.VerifiedAfter))
+	}
+	if !filter.VerifiedBefore.IsZero() {
+		conditions = append(conditions, "verified_at < ? AND verified_at <> ''")
+		args = append(args, formatTimestamp(filter.VerifiedBefore))
+	}
+	if paged && filter.After != nil {
+		field := filter.sortField()
+		if !ValidSortField(field) {
+			return "", nil, fmt.Errorf("mentions cannot be sorted by %s", field)
+		}
+		op := "<"
+		if filter.OldestFirst {
+			op = ">"
+		}
+		conditions = append(conditions, fmt.Sprintf("(%[1]s %[2]s ? OR (%[1]s = ? AND id %[2]s ?))", field, op))
+		args = append(args, filter.After.Value, filter.After.Value, filter.After.ID)
+	}
+	if terms := searchTerms(filter.Query); len(terms) > 0 {
+		indexed := false
+		if s.driver == DatabaseDriverSQLite {
+			var err error
+			if indexed, err = sqliteSearchIndexed(ctx, s.reader); err != nil {
+				return "", nil, err
+			}
+		}
+		if indexed {
+			conditions = append(conditions, "id IN (SELECT id FROM webmentions_fts WHERE webmentions_fts MATCH ?)")
+			args = append(args, ftsQuery(terms))
+		} else {
+			for _, term := range terms {
+				// Terms don't contain any wildcards, see searchTerms.
+				pattern := "%" + term + "%"
+				conditions = append(conditions, "(LOWER("+mentionTitle+") LIKE ? OR LOWER("+mentionContent+") LIKE ? OR LOWER("+mentionAuthorName+") LIKE ? OR LOWER(source) LIKE ? OR LOWER(target) LIKE ?)")
+				args = append(args, pattern, pattern, pattern, pattern, pattern)
+			}
+		}
+	}
+	return " WHERE " + strings.Join(conditions, " AND "), args, nil
+}
+
+func (s *SQLStore) CreateMention(ctx context.Context, m Mention) error {
+	if m.Status == "" {
+		m.Status = MentionStatusNew
+	}
+	o := MentionOverrides{}
+	if m.Overrides != nil {
+		o = *m.Overrides
+	}
+	res, err := s.exec(ctx, "INSERT INTO webmentions ("+mentionColumns+") VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?) ON CONFLICT (source, target) DO NOTHING", m.ID, m.Source, m.Target, m.CreatedAt, m.Status, m.Title, m.Content, m.AuthorName, m.AuthorURL, m.AuthorPhoto, m.Type, m.RSVP, m.Protocol, m.VerifiedAt, m.PublishedAt, m.Origin, o.Title, o.Content, o.AuthorName, o.Type, m.DeletedAt, m.DeletedBy, m.PinnedRevision, m.ModeratedAt)
+	return requireAffected(res, err, ErrMentionExists)
+}
+
+func (s *SQLStore) GetMention(ctx context.Context, id string) (*Mention, error) {
+	m, err := scanMention(s.queryRow(ctx, "SELECT "+mentionColumns+" FROM webmentions WHERE id = ? AND deleted_at = ''", id))
+	if err == sql.ErrNoRows {
+		return nil, ErrMentionNotFound
+	}
+	return m, err
+}
+
+func (s *SQLStore) ListMentions(ctx context.Context, filter MentionFilter) ([]Mention, error) {
+	query, args, err := s.listMentionsQuery(ctx, mentionColumns, filter)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := s.query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	result := make([]Mention, 0, 10)
+	for rows.Next() {
+		m, err := scanMention(rows)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, *m)
+	}
+	return result, rows.Err()
+}
+
+// listMentionsQuery selects the given columns of all mentions matching
+// filter in the requested order and page.
+func (s *SQLStore) listMentionsQuery(ctx context.Context, columns string, filter MentionFilter) (string, []any, error) {
+	field := filter.sortField()
+	if !ValidSortField(field) {
+		return "", nil, fmt.Errorf("mentions cannot be sorted by %s", field)
+	}
+	where, args, err := s.mentionFilterClause(ctx, filter, true)
+	if err != nil {
+		return "", nil, err
+	}
+	direction := "DESC"
+	if filter.OldestFirst {
+		direction = "ASC"
+	}
+	query := "SELECT " + columns + " FROM webmentions" + where + fmt.Sprintf(" ORDER BY %[1]s %[2]s, id %[2]s", field, direction)
+	query, args = s.paginate(query, args, filter.Limit, filter.Offset)
+	return query, args, nil
+}
+
+// paginate appends LIMIT and OFFSET clauses. A limit of 0 means no
+// limit.
+func (s *SQLStore) paginate(query string, args []any, limit int, offset int) (string, []any) {
+	if limit > 0 {
+		query += " LIMIT ?"
+		args = append(args, limit)
+	} else if offset > 0 && s.driver == DatabaseDriverSQLite {
+		// SQLite doesn't support OFFSET without LIMIT.
+		query += " LIMIT -1"
+	}
+	if offset > 0 {
+		query += " OFFSET ?"
+		args = append(args, offset)
+	}
+	return query, args
+}
+
+func (s *SQLStore) CountMentions(ctx context.Context, filter MentionFilter) (int, error) {
+	where, args, err := s.mentionFilterClause(ctx, filter, false)
+	if err != nil {
+		return 0, err
+	}
+	var count int
+	err = s.queryRow(ctx, "SELECT COUNT(id) FROM webmentions"+where, args...).Scan(&count)
+	return count, err
+}
+
+func (s *SQLStore) CountMentionsByStatus(ctx context.Context, filter MentionFilter) (map[string]int, error) {
+	where, args, err := s.mentionFilterClause(ctx, filter, false)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := s.query(ctx, "SELECT status, COUNT(id) FROM webmentions"+where+" GROUP BY status", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	result := make(map[string]int)
+	for rows.Next() {
+		var status string
+		var count int
+		if err := rows.Scan(&status, &count); err != nil {
+			return nil, err
+		}
+		result[status] = count
+	}
+	return result, rows.Err()
+}
+
+func (s *SQLStore) UpdateMentionStatus(ctx context.Context, id string, status string) error {
+	res, err := s.exec(ctx, "UPDATE webmentions SET status = ?, moderated_at = CASE WHEN moderated_at = '' THEN ? ELSE moderated_at END WHERE id = ? AND deleted_at = ''", status, moderatedAt(status, time.Now()), id)
+	return requireAffected(res, err, ErrMentionNotFound)
+}
+
+func (s *SQLStore) ResetMention(ctx context.Context, source string, target string) error {
+	res, err := s.exec(ctx, "UPDATE webmentions SET status = ? WHERE source = ? AND target = ? AND deleted_at = ''", MentionStatusNew, source, target)
+	return requireAffected(res, err, ErrMentionNotFound)
+}
+
+func (s *SQLStore) NextPendingMention(ctx context.Context, verifiedBefore time.Time) (*Mention, error) {
+	m, err := scanMention(s.queryRow(ctx, "SELECT "+mentionColumns+" FROM webmentions WHERE status = ? AND deleted_at = '' AND (verified_at = '' OR verified_at < ?) ORDER BY created_at LIMIT 1", MentionStatusNew, formatTimestamp(verifiedBefore)))
+	if err == sql.ErrNoRows {
+		return nil, ErrMentionNotFound
+	}
+	return m, err
+}
+
+func (s *SQLStore) SaveVerification(ctx context.Context, m Mention) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	var pinned int
+	err = tx.QueryRowContext(ctx, s.rebind("SELECT pinned_revision FROM webmentions WHERE id = ? AND deleted_at = ''"), m.ID).Scan(&pinned)
+	if err == sql.ErrNoRows {
+		return ErrMentionNotFound
+	}
+	if err != nil {
+		return err
+	}
+	latest, err := scanRevision(tx.QueryRowContext(ctx, s.rebind("SELECT "+revisionColumns+" FROM webmention_revisions WHERE mention_id = ? ORDER BY revision DESC LIMIT 1"), m.ID))
+	if err == sql.ErrNoRows {
+		latest, err = nil, nil
+	}
+	if err != nil {
+		return err
+	}
+	if r := newRevision(m, latest); r != nil {
+		if _, err := tx.ExecContext(ctx, s.rebind("INSERT INTO webmention_revisions ("+revisionColumns+") VALUES (?, ?, ?, ?, ?, ?, ?, ?)"), r.MentionID, r.Number, r.CreatedAt, r.Title, r.Content, r.AuthorName, r.Type, r.RSVP); err != nil {
+			return err
+		}
+	}
+	if pinned > 0 {
+		_, err = tx.ExecContext(ctx, s.rebind("UPDATE webmentions SET status = ?, verified_at = ? WHERE id = ?"), m.Status, m.VerifiedAt, m.ID)
+	} else {
+		_, err = tx.ExecContext(ctx, s.rebind("UPDATE webmentions SET status = ?, title = ?, verified_at = ?, type = ?, content = ?, author_name = ?, rsvp = ? WHERE id = ?"), m.Status, m.Title, m.VerifiedAt, m.Type, m.Content, m.AuthorName, m.RSVP, m.ID)
+	}
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+const revisionColumns = "mention_id, revision, created_at, title, content, author_name, type, rsvp"
+
+func scanRevision(row rowScanner) (*Revision, error) {
+	r := Revision{}
+	if err := row.Scan(&r.MentionID, &r.Number, &r.CreatedAt, &r.Title, &r.Content, &r.AuthorName, &r.Type, &r.RSVP); err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+func (s *SQLStore) ListRevisions(ctx context.Context, mentionID string) ([]Revision, error) {
+	rows, err := s.query(ctx, "SELECT "+revisionColumns+" FROM webmention_revisions WHERE mention_id = ? ORDER BY revision DESC", mentionID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	result := make([]Revision, 0, 5)
+	for rows.Next() {
+		r, err := scanRevision(rows)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, *r)
+	}
+	return result, rows.Err()
+}
+
+func (s *SQLStore) ReplaceRevisions(ctx context.Context, mentionID string, revisions []Revision) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	var count int
+	if err := tx.QueryRowContext(ctx, s.rebind("SELECT COUNT(*) FROM webmentions WHERE id = ?"), mentionID).Scan(&count); err != nil {
+		return err
+	}
+	if count == 0 {
+		return ErrMentionNotFound
+	}
+	if _, err := tx.ExecContext(ctx, s.rebind("DELETE FROM webmention_revisions WHERE mention_id = ?"), mentionID); err != nil {
+		return err
+	}
+	for _, r := range revisions {
+		if _, err := tx.ExecContext(ctx, s.rebind("INSERT INTO webmention_revisions ("+revisionColumns+") VALUES (?, ?, ?, ?, ?, ?, ?, ?)"), mentionID, r.Number, r.CreatedAt, r.Title, r.Content, r.AuthorName, r.Type, r.RSVP); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (s *SQLStore) PinRevision(ctx context.Context, id string, number int) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	res, err := tx.ExecContext(ctx, s.rebind("UPDATE webmentions SET pinned_revision = ? WHERE id = ? AND deleted_at = ''"), number, id)
+	if err := requireAffected(res, err, ErrMentionNotFound); err != nil {
+		return err
+	}
+	// Unpinning restores the latest revision:
+	query := "SELECT " + revisionColumns + " FROM webmention_revisions WHERE mention_id = ? ORDER BY revision DESC LIMIT 1"
+	args := []any{id}
+	if number > 0 {
+		query = "SELECT " + revisionColumns + " FROM webmention_revisions WHERE mention_id = ? AND revision = ?"
+		args = append(args, number)
+	}
+	r, err := scanRevision(tx.QueryRowContext(ctx, s.rebind(query), args...))
+	switch {
+	case err == sql.ErrNoRows && number > 0:
+		return ErrRevisionNotFound
+	case err == sql.ErrNoRows:
+		return tx.Commit()
+	case err != nil:
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, s.rebind("UPDATE webmentions SET title = ?, content = ?, author_name = ?, type = ?, rsvp = ? WHERE id = ?"), r.Title, r.Content, r.AuthorName, r.Type, r.RSVP, id); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (s *SQLStore) UpdateMention(ctx context.Context, m Mention) error {
+	m = m.withoutOverrides()
+	o := MentionOverrides{}
+	if m.Overrides != nil {
+		o = *m.Overrides
+	}
+	res, err := s.exec(ctx, "UPDATE webmentions SET created_at = ?, status = ?, title = ?, content = ?, author_name = ?, author_url = ?, author_photo = ?, type = ?, rsvp = ?, protocol = ?, verified_at = ?, published_at = ?, origin = ?, title_override = ?, content_override = ?, author_name_override = ?, type_override = ?, deleted_at = ?, deleted_by = ?, pinned_revision = ?, moderated_at = ? WHERE id = ?", m.CreatedAt, m.Status, m.Title, m.Content, m.AuthorName, m.AuthorURL, m.AuthorPhoto, m.Type, m.RSVP, m.Protocol, m.VerifiedAt, m.PublishedAt, m.Origin, o.Title, o.Content, o.AuthorName, o.Type, m.DeletedAt, m.DeletedBy, m.PinnedRevision, m.ModeratedAt, m.ID)
+	return requireAffected(res, err, ErrMentionNotFound)
+}
+
+func (s *SQLStore) SetMentionOverrides(ctx context.Context, id string, o MentionOverrides) error {
+	res, err := s.exec(ctx, "UPDATE webmentions SET title_override = ?, content_override = ?, author_name_override = ?, type_override = ? WHERE id = ? AND deleted_at = ''", o.Title, o.Content, o.AuthorName, o.Type, id)
+	return requireAffected(res, err, ErrMentionNotFound)
+}
+
+func (s *SQLStore) TrashMention(ctx context.Context, id string, deletedBy string) error {
+	res, err := s.exec(ctx, "UPDATE webmentions SET deleted_at = ?, deleted_by = ? WHERE id = ? AND deleted_at = ''", formatTimestamp(time.Now()), deletedBy, id)
+	return requireAffected(res, err, ErrMentionNotFound)
+}
+
+func (s *SQLStore) RestoreMention(ctx context.Context, id string) error {
+	res, err := s.exec(ctx, "UPDATE webmentions SET deleted_at = '', deleted_by = '' WHERE id = ? AND deleted_at <> ''", id)
+	return requireAffected(res, err, ErrMentionNotFound)
+}
+
+func (s *SQLStore) PurgeMention(ctx context.Context, id string) error {
+	count, err := s.purge(ctx, "id = ? AND deleted_at <> ''", id)
+	if err == nil && count == 0 {
+		return ErrMentionNotFound
+	}
+	return err
+}
+
+func (s *SQLStore) PurgeTrash(ctx context.Context, deletedBefore time.Time) (int, error) {
+	if deletedBefore.IsZero() {
+		return s.purge(ctx, "deleted_at <> ''")
+	}
+	return s.purge(ctx, "deleted_at <> '' AND deleted_at < ?", formatTimestamp(deletedBefore))
+}
+
+// purge permanently removes all mentions matching the condition
+// together with their verification history.
+func (s *SQLStore) purge(ctx context.Context, condition string, args ...any) (int, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+	for _, table := range []string{"webmention_verifications", "webmention_revisions"} {
+		if _, err := tx.ExecContext(ctx, s.rebind("DELETE FROM "+table+" WHERE mention_id IN (SELECT id FROM webmentions WHERE "+condition+")"), args...); err != nil {
+			return 0, err
+		}
+	}
+	res, err := tx.ExecContext(ctx, s.rebind("DELETE FROM webmentions WHERE "+condition), args...)
+	if err != nil {
+		return 0, err
+	}
+	num, err := res.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	return int(num), tx.Commit()
+}
+
+func (s *SQLStore) RecordVerification(ctx context.Context, v Verification) error {
+	_, err := s.exec(ctx, "INSERT INTO webmention_verifications (mention_id, verified_at, status, error, title, type, author_name, manual) VALUES (?, ?, ?, ?, ?, ?, ?, ?)", v.MentionID, v.VerifiedAt, v.Status, v.Error, v.Title, v.Type, v.AuthorName, v.Manual)
+	return err
+}
+
+func (s *SQLStore) ListVerifications(ctx context.Context, mentionID string) ([]Verification, error) {
+	rows, err := s.query(ctx, "SELECT mention_id, verified_at, status, error, title, type, author_name, manual FROM webmention_verifications WHERE mention_id = ? ORDER BY verified_at DESC, id DESC", mentionID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	result := make([]Verification, 0, 5)
+	for rows.Next() {
+		v := Verification{}
+		if err := rows.Scan(&v.MentionID, &v.VerifiedAt, &v.Status, &v.Error, &v.Title, &v.Type, &v.AuthorName, &v.Manual); err != nil {
+			return nil, err
+		}
+		result = append(result, v)
+	}
+	return result, rows.Err()
+}
+
+func (s *SQLStore) BulkUpdateMentions(ctx context.Context, action string, ids []string, actor string) ([]BulkResult, error) {
+	if !ValidBulkAction(action) {
+		return nil, fmt.Errorf("unsupported bulk action: %s", action)
+	}
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+	results, err := s.bulkUpdate(ctx, tx, action, ids, actor)
+	if err != nil {
+		return nil, err
+	}
+	return results, tx.Commit()
+}
+
+func (s *SQLStore) BulkUpdateMatchingMentions(ctx context.Context, action string, filter MentionFilter, actor string) ([]BulkResult, error) {
+	if !ValidBulkAction(action) {
+		return nil, fmt.Errorf("unsupported bulk action: %s", action)
+	}
+	if !filter.Restricted() || filter.Trashed {
+		return nil, errUnrestrictedFilter
+	}
+	query, args, err := s.listMentionsQuery(ctx, "id", filter)
+	if err != nil {
+		return nil, err
+	}
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+	rows, err := tx.QueryContext(ctx, s.rebind(query), args...)
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]string, 0, 10)
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	results, err := s.bulkUpdate(ctx, tx, action, ids, actor)
+	if err != nil {
+		return nil, err
+	}
+	return results, tx.Commit()
+}
+
+// bulkUpdate applies action to the mentions with the given IDs within
+// tx.
+func (s *SQLStore) bulkUpdate(ctx context.Context, tx *sql.Tx, action string, ids []string, actor string) ([]BulkResult, error) {
+	status := bulkActionStatus[action]
+	results := make([]BulkResult, 0, len(ids))
+	for _, id := range ids {
+		result := BulkResult{ID: id}
+		err := tx.QueryRowContext(ctx, s.rebind("SELECT target, status FROM webmentions WHERE id = ? AND deleted_at = ''"), id).Scan(&result.Target, &result.PreviousStatus)
+		if err == sql.ErrNoRows {
+			result.Error = ErrMentionNotFound.Error()
+			results = append(results, result)
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if action == BulkActionDelete {
+			_, err = tx.ExecContext(ctx, s.rebind("UPDATE webmentions SET deleted_at = ?, deleted_by = ? WHERE id = ?"), formatTimestamp(time.Now()), actor, id)
+		} else {
+			_, err = tx.ExecContext(ctx, s.rebind("UPDATE webmentions SET status = ?, moderated_at = CASE WHEN moderated_at = '' THEN ? ELSE moderated_at END WHERE id = ?"), status, moderatedAt(status, time.Now()), id)
+			result.Status = status
+		}
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+// mentionAge is the timestamp PruneOptions.Before is compared with.
+const mentionAge = "CASE WHEN verified_at > created_at THEN verified_at ELSE created_at END"
+
+// prunable selects the mentions removed by PruneMentions. Mentions in
+// the trash are left to PurgeTrash.
+const prunable = "status = ? AND deleted_at = '' AND " + mentionAge + " < ?"
+
+func (s *SQLStore) PruneMentions(ctx context.Context, opts PruneOptions) (int, error) {
+	before := formatTimestamp(opts.Before)
+	if opts.DryRun {
+		var count int
+		err := s.queryRow(ctx, "SELECT COUNT(*) FROM webmentions WHERE "+prunable, opts.Status, before).Scan(&count)
+		return count, err
+	}
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+	if opts.Tombstone {
+		if _, err := tx.ExecContext(ctx, s.rebind("DELETE FROM webmention_tombstones WHERE status = ? AND purged_at < ?"), opts.Status, before); err != nil {
+			return 0, err
+		}
+		if _, err := tx.ExecContext(ctx, s.rebind("INSERT INTO webmention_tombstones (source, target, status, purged_at) SELECT source, target, status, ? FROM webmentions WHERE "+prunable+" ON CONFLICT (source, target) DO UPDATE SET status = excluded.status, purged_at = excluded.purged_at"), formatTimestamp(time.Now()), opts.Status, before); err != nil {
+			return 0, err
+		}
+	}
+	for _, table := range []string{"webmention_verifications", "webmention_revisions"} {
+		if _, err := tx.ExecContext(ctx, s.rebind("DELETE FROM "+table+" WHERE mention_id IN (SELECT id FROM webmentions WHERE "+prunable+")"), opts.Status, before); err != nil {
+			return 0, err
+		}
+	}
+	res, err := tx.ExecContext(ctx, s.rebind("DELETE FROM webmentions WHERE "+prunable), opts.Status, before)
+	if err != nil {
+		return 0, err
+	}
+	num, err := res.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	return int(num), tx.Commit()
+}
+
+func (s *SQLStore) HasTombstone(ctx context.Context, source string, target string) (bool, error) {
+	var count int
+	err := s.queryRow(ctx, "SELECT COUNT(*) FROM webmention_tombstones WHERE source = ? AND target = ?", source, target).Scan(&count)
+	return count > 0, err
+}
+
+// requireAffected turns an update that didn't affect any row into
+// notFound.
+func requireAffected(res sql.Result, err error, notFound error) error {
+	if err != nil {
+		return err
+	}
+	num, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if num < 1 {
+		return notFound
+	}
+	return nil
+}
+
+func (s *SQLStore) Load(ctx context.Context) ([]policies.URLPolicy, error) {
+	result, err := s.query(ctx, "SELECT id, url_pattern, policy, weight FROM url_policies ORDER BY weight ASC")
+	if err != nil {
+		return nil, err
+	}
+	defer result.Close()
+	pols := make([]policies.URLPolicy, 0, 10)
+	for result.Next() {
+		var id int
+		var pat string
+		var pol string
+		var weight int
+		if err := result.Scan(&id, &pat, &pol, &weight); err != nil {
+			return nil, err
+		}
+		urlp, err := regexp.Compile(pat)
+		if err != nil {
+			return nil, err
+		}
+		pols = append(pols, policies.URLPolicy{
+			ID:         id,
+			URLPattern: urlp,
+			Policy:     policies.Policy(pol),
+			Weight:     weight,
+		})
+	}
+	return pols, result.Err()
+}
+
+func (s *SQLStore) CreatePolicy(ctx context.Context, p policies.URLPolicy) (int, error) {
+	var id int
+	err := s.db.QueryRowContext(ctx, s.rebind("INSERT INTO url_policies (url_pattern, policy, weight) VALUES (?, ?, ?) RETURNING id"), p.URLPattern.String(), string(p.Policy), p.Weight).Scan(&id)
+	return id, err
+}
+
+func (s *SQLStore) DeletePolicy(ctx context.Context, id int) error {
+	res, err := s.exec(ctx, "DELETE FROM url_policies WHERE id = ?", id)
+	return requireAffected(res, err, ErrPolicyNotFound)
+}
+
+func (s *SQLStore) RecordAuditEntry(ctx context.Context, e AuditEntry) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	var id int
+	if err := tx.QueryRowContext(ctx, s.rebind("INSERT INTO audit_log (created_at, actor, action) VALUES (?, ?, ?) RETURNING id"), e.CreatedAt, e.Actor, e.Action).Scan(&id); err != nil {
+		return err
+	}
+	for _, t := range e.Targets {
+		if _, err := tx.ExecContext(ctx, s.rebind("INSERT INTO audit_log_targets (entry_id, target_id, status_before, status_after) VALUES (?, ?, ?, ?)"), id, t.ID, t.StatusBefore, t.StatusAfter); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func auditFilterClause(filter AuditFilter) (string, []any) {
+	conditions := make([]string, 0, 4)
+	args := make([]any, 0, 4)
+	if filter.Actor != "" {
+		conditions = append(conditions, "actor = ?")
+		args = append(args, filter.Actor)
+	}
+	if filter.Action != "" {
+		conditions = append(conditions, "action = ?")
+		args = append(args, filter.Action)
+	}
+	if filter.TargetID != "" {
+		conditions = append(conditions, "id IN (SELECT entry_id FROM audit_log_targets WHERE target_id = ?)")
+		args = append(args, filter.TargetID)
+	}
+	if !filter.CreatedAfter.IsZero() {
+		conditions = append(conditions, "created_at >= ?")
+		args = append(args, formatTimestamp(filter.CreatedAfter))
+	}
+	if !filter.CreatedBefore.IsZero() {
+		conditions = append(conditions, "created_at < ?")
+		args = append(args, formatTimestamp(filter.CreatedBefore))
+	}
+	if len(conditions) == 0 {
+		return "", args
+	}
+	return " WHERE " + strings.Join(conditions, " AND "), args
+}
+
+func (s *SQLStore) ListAuditEntries(ctx context.Context, filter AuditFilter) ([]AuditEntry, error) {
+	where, args := auditFilterClause(filter)
+	query, args := s.paginate("SELECT id, created_at, actor, action FROM audit_log"+where+" ORDER BY created_at DESC, id DESC", args, filter.Limit, filter.Offset)
+	rows, err := s.query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	result := make([]AuditEntry, 0, 10)
+	positions := make(map[int]int)
+	for rows.Next() {
+		e := AuditEntry{Targets: []AuditTarget{}}
+		if err := rows.Scan(&e.ID, &e.CreatedAt, &e.Actor, &e.Action); err != nil {
+			return nil, err
+		}
+		positions[e.ID] = len(result)
+		result = append(result, e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(result) == 0 {
+		return result, nil
+	}
+	placeholders := make([]string, 0, len(result))
+	ids := make([]any, 0, len(result))
+	for _, e := range result {
+		placeholders = append(placeholders, "?")
+		ids = append(ids, e.ID)
+	}
+	targetRows, err := s.query(ctx, "SELECT entry_id, target_id, status_before, status_after FROM audit_log_targets WHERE entry_id IN ("+strings.Join(placeholders, ", ")+") ORDER BY entry_id, target_id", ids...)
+	if err != nil {
+		return nil, err
+	}
+	defer targetRows.Close()
+	for targetRows.Next() {
+		var entryID int
+		t := AuditTarget{}
+		if err := targetRows.Scan(&entryID, &t.ID, &t.StatusBefore, &t.StatusAfter); err != nil {
+			return nil, err
+		}
+		e := &result[positions[entryID]]
+		e.Targets = append(e.Targets, t)
+	}
+	return result, targetRows.Err()
+}
+
+func (s *SQLStore) CountAuditEntries(ctx context.Context, filter AuditFilter) (int, error) {
+	where, args := auditFilterClause(filter)
+	var count int
+	err := s.queryRow(ctx, "SELECT COUNT(id) FROM audit_log"+where, args...).Scan(&count)
+	return count, err
+}
+
+func (s *SQLStore) LoadTargets(ctx context.Context, source string) ([]string, error) {
+	rows, err := s.query(ctx, "SELECT target FROM source_targets WHERE source = ? ORDER BY target", source)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	result := make([]string, 0, 10)
+	for rows.Next() {
+		var target string
+		if err := rows.Scan(&target); err != nil {
+			return nil, err
+		}
+		result = append(result, target)
+	}
+	return result, rows.Err()
+}
+
+func (s *SQLStore) SaveTargets(ctx context.Context, source string, targets []string) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.ExecContext(ctx, s.rebind("DELETE FROM source_targets WHERE source = ?"), source); err != nil {
+		return err
+	}
+	now := formatTimestamp(time.Now())
+	for _, target := range targets {
+		if _, err := tx.ExecContext(ctx, s.rebind("INSERT INTO source_targets (source, target, sent_at) VALUES (?, ?, ?) ON CONFLICT DO NOTHING"), source, target, now); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (s *SQLStore) RecordDelivery(ctx context.Context, source string, target string, endpoint string, protocol string) error {
+	_, err := s.exec(ctx, "INSERT INTO deliveries (source, target, endpoint, protocol, sent_at) VALUES (?, ?, ?, ?, ?) ON CONFLICT (source, target) DO UPDATE SET endpoint = excluded.endpoint, protocol = excluded.protocol, sent_at = excluded.sent_at", source, target, endpoint, protocol, formatTimestamp(time.Now()))
+	return err
+}
+
+func (s *SQLStore) DeliveredTargets(ctx context.Context, source string, since time.Time) ([]string, error) {
+	rows, err := s.query(ctx, "SELECT target FROM deliveries WHERE source = ? AND sent_at >= ? ORDER BY target", source, formatTimestamp(since))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	result := make([]string, 0, 10)
+	for rows.Next() {
+		var target string
+		if err := rows.Scan(&target); err != nil {
+			return nil, err
+		}
+		result = append(result, target)
+	}
+	return result, rows.Err()
+}
+
+func (s *SQLStore) GetFeedState(ctx context.Context, feedURL string) (FeedState, error) {
+	state := FeedState{URL: feedURL}
+	err := s.queryRow(ctx, "SELECT etag, last_modified FROM feeds WHERE url = ?", feedURL).Scan(&state.ETag, &state.LastModified)
+	if err == sql.ErrNoRows {
+		return state, nil
+	}
+	state.Polled = err == nil
+	return state, err
+}
+
+func (s *SQLStore) UpdateFeed(ctx context.Context, state FeedState, entries []feeds.Entry) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	now := formatTimestamp(time.Now())
+	for _, entry := range entries {
+		updated := formatTimestamp(entry.Updated)
+		var storedUpdated string
+		err := tx.QueryRowContext(ctx, s.rebind("SELECT updated_at FROM feed_entries WHERE feed_url = ? AND entry_id = ?"), state.URL, entry.ID).Scan(&storedUpdated)
+		if err == sql.ErrNoRows {
+			if _, err := tx.ExecContext(ctx, s.rebind("INSERT INTO feed_entries (feed_url, entry_id, url, updated_at, pending_since) VALUES (?, ?, ?, ?, ?)"), state.URL, entry.ID, entry.URL, updated, now); err != nil {
+				return err
+			}
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if updated > storedUpdated {
+			if _, err := tx.ExecContext(ctx, s.rebind("UPDATE feed_entries SET url = ?, updated_at = ?, sent_at = '', pending_since = ?, attempts = 0 WHERE feed_url = ? AND entry_id = ?"), entry.URL, updated, now, state.URL, entry.ID); err != nil {
+				return err
+			}
+		}
+	}
+	if _, err := tx.ExecContext(ctx, s.rebind("INSERT INTO feeds (url, etag, last_modified, polled_at) VALUES (?, ?, ?, ?) ON CONFLICT (url) DO UPDATE SET etag = excluded.etag, last_modified = excluded.last_modified, polled_at = excluded.polled_at"), state.URL, state.ETag, state.LastModified, now); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (s *SQLStore) PendingFeedEntries(ctx context.Context, feedURL string) ([]FeedEntry, error) {
+	rows, err := s.query(ctx, "SELECT entry_id, url, pending_since, attempts FROM feed_entries WHERE feed_url = ? AND sent_at = ''", feedURL)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	result := make([]FeedEntry, 0, 10)
+	for rows.Next() {
+		e := FeedEntry{}
+		var pendingSince string
+		if err := rows.Scan(&e.ID, &e.URL, &pendingSince, &e.Attempts); err != nil {
+			return nil, err
+		}
+		// Entries that became pending before the column was added have
+		// no time and are sent to all of their targets again:
+		if pendingSince != "" {
+			if e.PendingSince, err = time.Parse(time.RFC3339, pendingSince); err != nil {
+				return nil, err
+			}
+		}
+		result = append(result, e)
+	}
+	return result, rows.Err()
+}
+
+func (s *SQLStore) RecordFeedEntryFailure(ctx context.Context, feedURL string, entryID string) error {
+	_, err := s.exec(ctx, "UPDATE feed_entries SET attempts = attempts + 1 WHERE feed_url = ? AND entry_id = ?", feedURL, entryID)
+	return err
+}
+
+func (s *SQLStore) MarkFeedEntrySent(ctx context.Context, feedURL string, entryID string) error {
+	_, err := s.exec(ctx, "UPDATE feed_entries SET sent_at = ? WHERE feed_url = ? AND entry_id = ?", formatTimestamp(time.Now()), feedURL, entryID)
+	return err
+}
+
+var _ MentionStore = &SQLStore{}
+var _ PolicyStore = &SQLStore{}
+var _ SendStore = &SQLStore{}
+var _ AuditStore = &SQLStore{}
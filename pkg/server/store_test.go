@@ -0,0 +1,826 @@
+package server_test
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/require"
+	"github.com/zerok/webmentiond/pkg/feeds"
+	"github.com/zerok/webmentiond/pkg/policies"
+	"github.com/zerok/webmentiond/pkg/server"
+)
+
+type store interface {
+	server.MentionStore
+	server.PolicyStore
+	server.SendStore
+	server.AuditStore
+}
+
+func TestStores(t *testing.T) {
+	for _, backend := range testBackends {
+		t.Run(backend.Name, func(t *testing.T) {
+			newStore := func(t *testing.T) store {
+				db, _ := setupBackend(t, backend)
+				s, err := server.NewSQLStore(db, backend.Driver)
+				require.NoError(t, err)
+				return s
+			}
+			t.Run("mentions", func(t *testing.T) {
+				testMentionStore(t, newStore(t))
+			})
+			t.Run("filter", func(t *testing.T) {
+				testFilterMentions(t, newStore(t))
+			})
+			t.Run("overrides", func(t *testing.T) {
+				testMentionOverrides(t, newStore(t))
+			})
+			t.Run("verifications", func(t *testing.T) {
+				testVerifications(t, newStore(t))
+			})
+			t.Run("revisions", func(t *testing.T) {
+				testRevisions(t, newStore(t))
+			})
+			t.Run("bulk", func(t *testing.T) {
+				testBulkUpdateMentions(t, newStore(t))
+			})
+			t.Run("trash", func(t *testing.T) {
+				testTrash(t, newStore(t))
+			})
+			t.Run("prune", func(t *testing.T) {
+				testPruneMentions(t, newStore(t))
+			})
+			t.Run("search", func(t *testing.T) {
+				testSearchMentions(t, newStore(t))
+			})
+			t.Run("policies", func(t *testing.T) {
+				testPolicyStore(t, newStore(t))
+			})
+			t.Run("send", func(t *testing.T) {
+				testSendStore(t, newStore(t))
+			})
+			t.Run("audit", func(t *testing.T) {
+				testAuditStore(t, newStore(t))
+			})
+		})
+	}
+	t.Run("memory", func(t *testing.T) {
+		t.Run("mentions", func(t *testing.T) {
+			testMentionStore(t, server.NewMemoryStore())
+		})
+		t.Run("filter", func(t *testing.T) {
+			testFilterMentions(t, server.NewMemoryStore())
+		})
+		t.Run("overrides", func(t *testing.T) {
+			testMentionOverrides(t, server.NewMemoryStore())
+		})
+		t.Run("verifications", func(t *testing.T) {
+			testVerifications(t, server.NewMemoryStore())
+		})
+		t.Run("revisions", func(t *testing.T) {
+			testRevisions(t, server.NewMemoryStore())
+		})
+		t.Run("bulk", func(t *testing.T) {
+			testBulkUpdateMentions(t, server.NewMemoryStore())
+		})
+		t.Run("trash", func(t *testing.T) {
+			testTrash(t, server.NewMemoryStore())
+		})
+		t.Run("prune", func(t *testing.T) {
+			testPruneMentions(t, server.NewMemoryStore())
+		})
+		t.Run("search", func(t *testing.T) {
+			testSearchMentions(t, server.NewMemoryStore())
+		})
+		t.Run("policies", func(t *testing.T) {
+			testPolicyStore(t, server.NewMemoryStore())
+		})
+		t.Run("send", func(t *testing.T) {
+			testSendStore(t, server.NewMemoryStore())
+		})
+		t.Run("audit", func(t *testing.T) {
+			testAuditStore(t, server.NewMemoryStore())
+		})
+	})
+}
+
+func testMentionStore(t *testing.T, s server.MentionStore) {
+	ctx := context.Background()
+	require.NoError(t, s.CreateMention(ctx, server.Mention{ID: "a", Source: "https://a.com", Target: "https://target.com/1", CreatedAt: "2024-01-01T00:00:00Z", Protocol: "webmention"}))
+	require.NoError(t, s.CreateMention(ctx, server.Mention{ID: "b", Source: "https://b.com", Target: "https://target.com/1", CreatedAt: "2024-01-02T00:00:00Z", Protocol: "pingback"}))
+	require.NoError(t, s.CreateMention(ctx, server.Mention{ID: "c", Source: "https://c.com", Target: "https://target.com/2", CreatedAt: "2024-01-03T00:00:00Z", Protocol: "webmention"}))
+	require.ErrorIs(t, s.CreateMention(ctx, server.Mention{ID: "d", Source: "https://a.com", Target: "https://target.com/1", CreatedAt: "2024-01-04T00:00:00Z"}), server.ErrMentionExists)
+
+	m, err := s.GetMention(ctx, "b")
+	require.NoError(t, err)
+	require.Equal(t, server.MentionStatusNew, m.Status)
+	require.Equal(t, "pingback", m.Protocol)
+	_, err = s.GetMention(ctx, "unknown")
+	require.ErrorIs(t, err, server.ErrMentionNotFound)
+
+	mentionIDs := func(filter server.MentionFilter) []string {
+		t.Helper()
+		mentions, err := s.ListMentions(ctx, filter)
+		require.NoError(t, err)
+		ids := make([]string, 0, len(mentions))
+		for _, m := range mentions {
+			ids = append(ids, m.ID)
+		}
+		return ids
+	}
+	require.Equal(t, []string{"c", "b", "a"}, mentionIDs(server.MentionFilter{}))
+	require.Equal(t, []string{"b"}, mentionIDs(server.MentionFilter{Limit: 1, Offset: 1}))
+	require.Equal(t, []string{"a", "b"}, mentionIDs(server.MentionFilter{Target: "https://target.com/1", OldestFirst: true}))
+
+	// Pending mentions are verified starting with the oldest one:
+	pending, err := s.NextPendingMention(ctx, time.Now())
+	require.NoError(t, err)
+	require.Equal(t, "a", pending.ID)
+	verifiedAt := time.Now()
+	require.NoError(t, s.SaveVerification(ctx, server.Mention{ID: "a", Status: server.MentionStatusVerified, Title: "Title", VerifiedAt: verifiedAt.UTC().Format(time.RFC3339)}))
+	m, err = s.GetMention(ctx, "a")
+	require.NoError(t, err)
+	require.Equal(t, server.MentionStatusVerified, m.Status)
+	require.Equal(t, "Title", m.Title)
+
+	require.NoError(t, s.UpdateMentionStatus(ctx, "b", server.MentionStatusApproved))
+	require.ErrorIs(t, s.UpdateMentionStatus(ctx, "unknown", server.MentionStatusApproved), server.ErrMentionNotFound)
+	require.Equal(t, []string{"b"}, mentionIDs(server.MentionFilter{Status: server.MentionStatusApproved}))
+	count, err := s.CountMentions(ctx, server.MentionFilter{Status: server.MentionStatusNew})
+	require.NoError(t, err)
+	require.Equal(t, 1, count)
+
+	// A reset mention isn't picked up again before the given time has
+	// passed:
+	require.NoError(t, s.ResetMention(ctx, "https://a.com", "https://target.com/1"))
+	require.ErrorIs(t, s.ResetMention(ctx, "https://unknown.com", "https://target.com/1"), server.ErrMentionNotFound)
+	pending, err = s.NextPendingMention(ctx, verifiedAt.Add(-time.Minute))
+	require.NoError(t, err)
+	require.Equal(t, "c", pending.ID)
+
+	require.Equal(t, []string{"b"}, mentionIDs(server.MentionFilter{Source: "https://b.com", Target: "https://target.com/1"}))
+	b, err := s.GetMention(ctx, "b")
+	require.NoError(t, err)
+	b.Title = "Updated"
+	b.AuthorName = "Author"
+	b.AuthorURL = "https://b.com/"
+	b.PublishedAt = "2024-01-01T12:00:00Z"
+	b.Target = "https://ignored.com"
+	require.NoError(t, s.UpdateMention(ctx, *b))
+	m, err = s.GetMention(ctx, "b")
+	require.NoError(t, err)
+	require.Equal(t, "Updated", m.Title)
+	require.Equal(t, "Author", m.AuthorName)
+	require.Equal(t, "https://b.com/", m.AuthorURL)
+	require.Equal(t, "2024-01-01T12:00:00Z", m.PublishedAt)
+	require.Equal(t, "https://target.com/1", m.Target)
+	require.Equal(t, server.MentionStatusApproved, m.Status)
+	require.ErrorIs(t, s.UpdateMention(ctx, server.Mention{ID: "unknown"}), server.ErrMentionNotFound)
+
+	require.NoError(t, s.TrashMention(ctx, "c", "admin@example.org"))
+	require.ErrorIs(t, s.TrashMention(ctx, "c", "admin@example.org"), server.ErrMentionNotFound)
+	_, err = s.NextPendingMention(ctx, verifiedAt.Add(-time.Minute))
+	require.ErrorIs(t, err, server.ErrMentionNotFound)
+}
+
+func testFilterMentions(t *testing.T, s server.MentionStore) {
+	ctx := context.Background()
+	for _, m := range []server.Mention{
+		{ID: "a", Source: "https://a.com/1", Target: "https://target.com/posts/1", CreatedAt: "2024-01-01T00:00:00Z", Type: "reply", AuthorName: "Alice", Status: server.MentionStatusApproved, VerifiedAt: "2024-01-05T00:00:00Z"},
+		{ID: "b", Source: "https://www.a.com/2", Target: "https://target.com/posts/2", CreatedAt: "2024-01-02T00:00:00Z", Type: "like", AuthorName: "Bob", Status: server.MentionStatusApproved, VerifiedAt: "2024-01-03T00:00:00Z"},
+		{ID: "c", Source: "https://b.com/1", Target: "https://target.com/about", CreatedAt: "2024-01-02T00:00:00Z", Type: "reply", AuthorName: "alice", Status: server.MentionStatusRejected, VerifiedAt: "2024-01-04T00:00:00Z"},
+		{ID: "d", Source: "https://a.com.evil/1", Target: "https://target.com/posts/1", CreatedAt: "2024-01-04T00:00:00Z"},
+	} {
+		require.NoError(t, s.CreateMention(ctx, m))
+	}
+	mentionIDs := func(filter server.MentionFilter) []string {
+		t.Helper()
+		mentions, err := s.ListMentions(ctx, filter)
+		require.NoError(t, err)
+		ids := make([]string, 0, len(mentions))
+		for _, m := range mentions {
+			ids = append(ids, m.ID)
+		}
+		return ids
+	}
+	day := func(d int) time.Time {
+		return time.Date(2024, 1, d, 0, 0, 0, 0, time.UTC)
+	}
+
+	require.Equal(t, []string{"d", "a"}, mentionIDs(server.MentionFilter{TargetPrefix: "https://target.com/posts/1"}))
+	require.Equal(t, []string{"d", "b", "a"}, mentionIDs(server.MentionFilter{TargetPrefix: "https://target.com/posts/"}))
+	require.Equal(t, []string{"a"}, mentionIDs(server.MentionFilter{SourceHost: "a.com"}))
+	require.Equal(t, []string{"b"}, mentionIDs(server.MentionFilter{SourceHost: "www.a.com"}))
+	require.Equal(t, []string{"c", "a"}, mentionIDs(server.MentionFilter{Type: "reply"}))
+	require.Equal(t, []string{"c", "a"}, mentionIDs(server.MentionFilter{Author: "ALICE"}))
+	require.Equal(t, []string{"c", "b"}, mentionIDs(server.MentionFilter{CreatedAfter: day(2), CreatedBefore: day(4)}))
+	require.Equal(t, []string{"c", "b"}, mentionIDs(server.MentionFilter{VerifiedBefore: day(5)}))
+	require.Equal(t, []string{"a"}, mentionIDs(server.MentionFilter{VerifiedAfter: day(5)}))
+
+	// Mentions with the same value are sorted by their ID:
+	require.Equal(t, []string{"a", "b", "c", "d"}, mentionIDs(server.MentionFilter{OldestFirst: true}))
+	require.Equal(t, []string{"d", "c", "b", "a"}, mentionIDs(server.MentionFilter{}))
+	require.Equal(t, []string{"b", "c", "a", "d"}, mentionIDs(server.MentionFilter{SortBy: server.MentionSortSource}))
+	require.Equal(t, []string{"a", "c", "b", "d"}, mentionIDs(server.MentionFilter{SortBy: server.MentionSortVerifiedAt}))
+	_, err := s.ListMentions(ctx, server.MentionFilter{SortBy: "status"})
+	require.Error(t, err)
+
+	// Following the cursor of the last mention returns the rest of the
+	// list no matter whether other mentions share its value:
+	for _, filter := range []server.MentionFilter{
+		{Limit: 2},
+		{Limit: 1, OldestFirst: true},
+		{Limit: 3, SortBy: server.MentionSortVerifiedAt},
+		{Limit: 1, SortBy: server.MentionSortTarget, OldestFirst: true},
+	} {
+		all := filter
+		all.Limit = 0
+		expected := mentionIDs(all)
+		var ids []string
+		for {
+			mentions, err := s.ListMentions(ctx, filter)
+			require.NoError(t, err)
+			if len(mentions) == 0 {
+				break
+			}
+			for _, m := range mentions {
+				ids = append(ids, m.ID)
+			}
+			filter.After = filter.Cursor(mentions[len(mentions)-1])
+		}
+		require.Equal(t, expected, ids)
+	}
+
+	counts, err := s.CountMentionsByStatus(ctx, server.MentionFilter{TargetPrefix: "https://target.com/posts/"})
+	require.NoError(t, err)
+	require.Equal(t, map[string]int{server.MentionStatusApproved: 2, server.MentionStatusNew: 1}, counts)
+	count, err := s.CountMentions(ctx, server.MentionFilter{Type: "reply", Limit: 1, After: &server.MentionCursor{Value: "2024-01-02T00:00:00Z", ID: "c"}})
+	require.NoError(t, err)
+	require.Equal(t, 2, count)
+}
+
+func testMentionOverrides(t *testing.T, s server.MentionStore) {
+	ctx := context.Background()
+	title := "Manual title"
+	require.NoError(t, s.CreateMention(ctx, server.Mention{ID: "a", Source: "https://a.com", Target: "https://target.com/1", CreatedAt: "2024-01-01T00:00:00Z", Title: "Extracted", Type: "mention", Origin: server.MentionOriginManual, Overrides: &server.MentionOverrides{Title: &title}}))
+	m, err := s.GetMention(ctx, "a")
+	require.NoError(t, err)
+	require.Equal(t, "Manual title", m.Title)
+	require.Equal(t, "mention", m.Type)
+	require.Equal(t, server.MentionOriginManual, m.Origin)
+	require.Equal(t, &server.MentionOverrides{Title: &title}, m.Overrides)
+
+	// Verifying the mention again doesn't touch the overrides:
+	require.NoError(t, s.SaveVerification(ctx, server.Mention{ID: "a", Status: server.MentionStatusVerified, Title: "New title", Type: "reply", AuthorName: "Extracted author"}))
+	m, err = s.GetMention(ctx, "a")
+	require.NoError(t, err)
+	require.Equal(t, "Manual title", m.Title)
+	require.Equal(t, "reply", m.Type)
+
+	// Filters and the search use the overridden values:
+	author := "Jane"
+	typ := "like"
+	require.NoError(t, s.SetMentionOverrides(ctx, "a", server.MentionOverrides{AuthorName: &author, Type: &typ}))
+	m, err = s.GetMention(ctx, "a")
+	require.NoError(t, err)
+	require.Equal(t, "New title", m.Title)
+	require.Equal(t, "Jane", m.AuthorName)
+	for _, filter := range []server.MentionFilter{{Type: "like"}, {Author: "jane"}, {Query: "jane"}} {
+		count, err := s.CountMentions(ctx, filter)
+		require.NoError(t, err)
+		require.Equal(t, 1, count, "%+v", filter)
+	}
+	for _, filter := range []server.MentionFilter{{Type: "reply"}, {Query: "extracted"}} {
+		count, err := s.CountMentions(ctx, filter)
+		require.NoError(t, err)
+		require.Equal(t, 0, count, "%+v", filter)
+	}
+
+	// Updating a mention as returned by the store keeps the extracted
+	// values apart from the overrides:
+	m.PublishedAt = "2024-01-02T00:00:00Z"
+	require.NoError(t, s.UpdateMention(ctx, *m))
+	m, err = s.GetMention(ctx, "a")
+	require.NoError(t, err)
+	require.Equal(t, "Jane", m.AuthorName)
+	require.Equal(t, server.MentionOriginManual, m.Origin)
+
+	require.NoError(t, s.SetMentionOverrides(ctx, "a", server.MentionOverrides{}))
+	m, err = s.GetMention(ctx, "a")
+	require.NoError(t, err)
+	require.Nil(t, m.Overrides)
+	require.Equal(t, "Extracted author", m.AuthorName)
+	require.Equal(t, "reply", m.Type)
+	require.ErrorIs(t, s.SetMentionOverrides(ctx, "unknown", server.MentionOverrides{}), server.ErrMentionNotFound)
+}
+
+func testVerifications(t *testing.T, s server.MentionStore) {
+	ctx := context.Background()
+	require.NoError(t, s.CreateMention(ctx, server.Mention{ID: "a", Source: "https://a.com", Target: "https://target.com/1", CreatedAt: "2024-01-01T00:00:00Z"}))
+	require.NoError(t, s.CreateMention(ctx, server.Mention{ID: "b", Source: "https://b.com", Target: "https://target.com/1", CreatedAt: "2024-01-01T00:00:00Z"}))
+	first := server.Verification{MentionID: "a", VerifiedAt: "2024-01-01T00:01:00Z", Status: server.MentionStatusVerified, Title: "Title", Type: "reply", AuthorName: "Author"}
+	second := server.Verification{MentionID: "a", VerifiedAt: "2024-01-02T00:00:00Z", Status: server.MentionStatusInvalid, Error: "target not found in content", Manual: true}
+	require.NoError(t, s.RecordVerification(ctx, first))
+	require.NoError(t, s.RecordVerification(ctx, second))
+	require.NoError(t, s.RecordVerification(ctx, server.Verification{MentionID: "b", VerifiedAt: "2024-01-01T00:01:00Z", Status: server.MentionStatusVerified}))
+
+	verifications, err := s.ListVerifications(ctx, "a")
+	require.NoError(t, err)
+	require.Equal(t, []server.Verification{second, first}, verifications)
+	verifications, err = s.ListVerifications(ctx, "unknown")
+	require.NoError(t, err)
+	require.Empty(t, verifications)
+
+	// The history is removed together with the mention:
+	require.NoError(t, s.TrashMention(ctx, "a", ""))
+	require.NoError(t, s.PurgeMention(ctx, "a"))
+	verifications, err = s.ListVerifications(ctx, "a")
+	require.NoError(t, err)
+	require.Empty(t, verifications)
+	_, err = s.BulkUpdateMentions(ctx, server.BulkActionDelete, []string{"b"}, "")
+	require.NoError(t, err)
+	_, err = s.PurgeTrash(ctx, time.Time{})
+	require.NoError(t, err)
+	verifications, err = s.ListVerifications(ctx, "b")
+	require.NoError(t, err)
+	require.Empty(t, verifications)
+}
+
+func testRevisions(t *testing.T, s server.MentionStore) {
+	ctx := context.Background()
+	require.NoError(t, s.CreateMention(ctx, server.Mention{ID: "a", Source: "https://a.com", Target: "https://target.com/1", CreatedAt: "2024-01-01T00:00:00Z"}))
+	verify := func(verifiedAt string, status string, title string, content string) *server.Mention {
+		t.Helper()
+		require.NoError(t, s.SaveVerification(ctx, server.Mention{ID: "a", Status: status, VerifiedAt: verifiedAt, Title: title, Content: content, AuthorName: "Alice", Type: "reply"}))
+		m, err := s.GetMention(ctx, "a")
+		require.NoError(t, err)
+		return m
+	}
+	numbers := func() []int {
+		t.Helper()
+		revisions, err := s.ListRevisions(ctx, "a")
+		require.NoError(t, err)
+		result := make([]int, 0, len(revisions))
+		for _, r := range revisions {
+			result = append(result, r.Number)
+		}
+		return result
+	}
+
+	verify("2024-01-01T00:01:00Z", server.MentionStatusVerified, "Great post", "I agree")
+	verify("2024-01-02T00:00:00Z", server.MentionStatusApproved, "Great post", "I agree")
+	require.Equal(t, []int{1}, numbers())
+	verify("2024-01-03T00:00:00Z", server.MentionStatusApproved, "Great post", "I agree, mostly")
+	require.Equal(t, []int{2, 1}, numbers())
+	revisions, err := s.ListRevisions(ctx, "a")
+	require.NoError(t, err)
+	require.Equal(t, server.Revision{MentionID: "a", Number: 2, CreatedAt: "2024-01-03T00:00:00Z", Title: "Great post", Content: "I agree, mostly", AuthorName: "Alice", Type: "reply"}, revisions[0])
+
+	// Invalid mentions have nothing to record:
+	m := verify("2024-01-04T00:00:00Z", server.MentionStatusInvalid, "", "")
+	require.Empty(t, m.Title)
+	require.Equal(t, []int{2, 1}, numbers())
+
+	require.NoError(t, s.PinRevision(ctx, "a", 1))
+	m, err = s.GetMention(ctx, "a")
+	require.NoError(t, err)
+	require.Equal(t, 1, m.PinnedRevision)
+	require.Equal(t, "I agree", m.Content)
+
+	// Pinned mentions keep their details while new revisions are still
+	// recorded:
+	m = verify("2024-01-05T00:00:00Z", server.MentionStatusApproved, "Cheap pills", "Buy now")
+	require.Equal(t, server.MentionStatusApproved, m.Status)
+	require.Equal(t, "2024-01-05T00:00:00Z", m.VerifiedAt)
+	require.Equal(t, "Great post", m.Title)
+	require.Equal(t, "I agree", m.Content)
+	require.Equal(t, []int{3, 2, 1}, numbers())
+
+	require.ErrorIs(t, s.PinRevision(ctx, "a", 4), server.ErrRevisionNotFound)
+	require.ErrorIs(t, s.PinRevision(ctx, "unknown", 1), server.ErrMentionNotFound)
+	m, err = s.GetMention(ctx, "a")
+	require.NoError(t, err)
+	require.Equal(t, 1, m.PinnedRevision)
+
+	require.NoError(t, s.PinRevision(ctx, "a", 0))
+	m, err = s.GetMention(ctx, "a")
+	require.NoError(t, err)
+	require.Zero(t, m.PinnedRevision)
+	require.Equal(t, "Cheap pills", m.Title)
+
+	// The revisions are removed together with the mention:
+	require.NoError(t, s.TrashMention(ctx, "a", ""))
+	require.NoError(t, s.PurgeMention(ctx, "a"))
+	require.Empty(t, numbers())
+}
+
+func testBulkUpdateMentions(t *testing.T, s server.MentionStore) {
+	ctx := context.Background()
+	require.NoError(t, s.CreateMention(ctx, server.Mention{ID: "a", Source: "https://a.com", Target: "https://target.com/1", CreatedAt: "2024-01-01T00:00:00Z", Status: server.MentionStatusVerified}))
+	require.NoError(t, s.CreateMention(ctx, server.Mention{ID: "b", Source: "https://b.com", Target: "https://target.com/2", CreatedAt: "2024-01-02T00:00:00Z", Status: server.MentionStatusVerified}))
+	require.NoError(t, s.CreateMention(ctx, server.Mention{ID: "c", Source: "https://c.com", Target: "https://target.com/3", CreatedAt: "2024-01-03T00:00:00Z", Status: server.MentionStatusRejected}))
+
+	results, err := s.BulkUpdateMentions(ctx, server.BulkActionApprove, []string{"a", "unknown", "b"}, "")
+	require.NoError(t, err)
+	require.Equal(t, []server.BulkResult{
+		{ID: "a", Target: "https://target.com/1", PreviousStatus: server.MentionStatusVerified, Status: server.MentionStatusApproved},
+		{ID: "unknown", Error: server.ErrMentionNotFound.Error()},
+		{ID: "b", Target: "https://target.com/2", PreviousStatus: server.MentionStatusVerified, Status: server.MentionStatusApproved},
+	}, results)
+	count, err := s.CountMentions(ctx, server.MentionFilter{Status: server.MentionStatusApproved})
+	require.NoError(t, err)
+	require.Equal(t, 2, count)
+
+	m, err := s.GetMention(ctx, "a")
+	require.NoError(t, err)
+	moderatedAt := m.ModeratedAt
+	require.NotEmpty(t, moderatedAt)
+
+	results, err = s.BulkUpdateMentions(ctx, server.BulkActionReverify, []string{"c"}, "")
+	require.NoError(t, err)
+	require.Equal(t, server.MentionStatusNew, results[0].Status)
+	m, err = s.GetMention(ctx, "c")
+	require.NoError(t, err)
+	require.Equal(t, server.MentionStatusNew, m.Status)
+	require.Empty(t, m.ModeratedAt)
+
+	// Only the first moderation is remembered:
+	require.NoError(t, s.UpdateMentionStatus(ctx, "c", server.MentionStatusRejected))
+	require.NoError(t, s.UpdateMentionStatus(ctx, "a", server.MentionStatusRejected))
+	m, err = s.GetMention(ctx, "a")
+	require.NoError(t, err)
+	require.Equal(t, moderatedAt, m.ModeratedAt)
+	m, err = s.GetMention(ctx, "c")
+	require.NoError(t, err)
+	require.NotEmpty(t, m.ModeratedAt)
+
+	results, err = s.BulkUpdateMentions(ctx, server.BulkActionDelete, []string{"a", "c"}, "admin@example.org")
+	require.NoError(t, err)
+	require.Equal(t, []server.BulkResult{{ID: "a", Target: "https://target.com/1", PreviousStatus: server.MentionStatusRejected}, {ID: "c", Target: "https://target.com/3", PreviousStatus: server.MentionStatusRejected}}, results)
+	count, err = s.CountMentions(ctx, server.MentionFilter{})
+	require.NoError(t, err)
+	require.Equal(t, 1, count)
+	trashed, err := s.ListMentions(ctx, server.MentionFilter{Trashed: true})
+	require.NoError(t, err)
+	require.Len(t, trashed, 2)
+	require.Equal(t, "admin@example.org", trashed[0].DeletedBy)
+
+	// Mentions in the trash can't be changed:
+	results, err = s.BulkUpdateMentions(ctx, server.BulkActionApprove, []string{"a"}, "")
+	require.NoError(t, err)
+	require.Equal(t, server.ErrMentionNotFound.Error(), results[0].Error)
+
+	_, err = s.BulkUpdateMentions(ctx, "archive", []string{"b"}, "")
+	require.Error(t, err)
+
+	// Mentions can also be selected by a filter but not all at once:
+	require.NoError(t, s.CreateMention(ctx, server.Mention{ID: "d", Source: "https://d.com", Target: "https://target.com/4", CreatedAt: "2024-01-04T00:00:00Z", Status: server.MentionStatusVerified}))
+	results, err = s.BulkUpdateMatchingMentions(ctx, server.BulkActionReject, server.MentionFilter{Status: server.MentionStatusApproved, OldestFirst: true}, "")
+	require.NoError(t, err)
+	require.Equal(t, []server.BulkResult{{ID: "b", Target: "https://target.com/2", PreviousStatus: server.MentionStatusApproved, Status: server.MentionStatusRejected}}, results)
+	results, err = s.BulkUpdateMatchingMentions(ctx, server.BulkActionApprove, server.MentionFilter{TargetPrefix: "https://target.com/", Limit: 1}, "")
+	require.NoError(t, err)
+	require.Len(t, results, 1)
+	require.Equal(t, "d", results[0].ID)
+	_, err = s.BulkUpdateMatchingMentions(ctx, server.BulkActionDelete, server.MentionFilter{Limit: 10}, "")
+	require.Error(t, err)
+	count, err = s.CountMentions(ctx, server.MentionFilter{})
+	require.NoError(t, err)
+	require.Equal(t, 2, count)
+}
+
+func testTrash(t *testing.T, s server.MentionStore) {
+	ctx := context.Background()
+	require.NoError(t, s.CreateMention(ctx, server.Mention{ID: "a", Source: "https://a.com", Target: "https://target.com/1", CreatedAt: "2024-01-01T00:00:00Z", Status: server.MentionStatusApproved}))
+	require.NoError(t, s.CreateMention(ctx, server.Mention{ID: "b", Source: "https://b.com", Target: "https://target.com/1", CreatedAt: "2024-01-02T00:00:00Z", Status: server.MentionStatusApproved}))
+	require.NoError(t, s.RecordVerification(ctx, server.Verification{MentionID: "a", VerifiedAt: "2024-01-01T00:00:00Z", Status: server.MentionStatusVerified}))
+
+	require.NoError(t, s.TrashMention(ctx, "a", "admin@example.org"))
+	require.ErrorIs(t, s.TrashMention(ctx, "a", "admin@example.org"), server.ErrMentionNotFound)
+	require.ErrorIs(t, s.TrashMention(ctx, "unknown", ""), server.ErrMentionNotFound)
+	_, err := s.GetMention(ctx, "a")
+	require.ErrorIs(t, err, server.ErrMentionNotFound)
+	require.ErrorIs(t, s.UpdateMentionStatus(ctx, "a", server.MentionStatusRejected), server.ErrMentionNotFound)
+	count, err := s.CountMentions(ctx, server.MentionFilter{})
+	require.NoError(t, err)
+	require.Equal(t, 1, count)
+
+	trashed, err := s.ListMentions(ctx, server.MentionFilter{Trashed: true})
+	require.NoError(t, err)
+	require.Len(t, trashed, 1)
+	require.Equal(t, "a", trashed[0].ID)
+	require.Equal(t, "admin@example.org", trashed[0].DeletedBy)
+	require.NotEmpty(t, trashed[0].DeletedAt)
+
+	// Only mentions in the trash can be restored or purged:
+	require.ErrorIs(t, s.RestoreMention(ctx, "b"), server.ErrMentionNotFound)
+	require.ErrorIs(t, s.PurgeMention(ctx, "b"), server.ErrMentionNotFound)
+
+	require.NoError(t, s.RestoreMention(ctx, "a"))
+	m, err := s.GetMention(ctx, "a")
+	require.NoError(t, err)
+	require.Equal(t, server.MentionStatusApproved, m.Status)
+	require.Empty(t, m.DeletedAt)
+	require.Empty(t, m.DeletedBy)
+
+	require.NoError(t, s.TrashMention(ctx, "a", ""))
+	require.NoError(t, s.PurgeMention(ctx, "a"))
+	require.ErrorIs(t, s.RestoreMention(ctx, "a"), server.ErrMentionNotFound)
+	verifications, err := s.ListVerifications(ctx, "a")
+	require.NoError(t, err)
+	require.Empty(t, verifications)
+
+	require.NoError(t, s.TrashMention(ctx, "b", ""))
+	purged, err := s.PurgeTrash(ctx, time.Now().Add(-time.Hour))
+	require.NoError(t, err)
+	require.Equal(t, 0, purged)
+	purged, err = s.PurgeTrash(ctx, time.Now().Add(time.Minute))
+	require.NoError(t, err)
+	require.Equal(t, 1, purged)
+	count, err = s.CountMentions(ctx, server.MentionFilter{Trashed: true})
+	require.NoError(t, err)
+	require.Equal(t, 0, count)
+}
+
+func testSearchMentions(t *testing.T, s server.MentionStore) {
+	ctx := context.Background()
+	for _, m := range []server.Mention{
+		{ID: "a", Source: "https://a.com/spring", Target: "https://target.com/1", CreatedAt: "2024-01-01T00:00:00Z", Status: server.MentionStatusApproved, Title: "Spring cleaning", Content: "Some thoughts about gardening", AuthorName: "Alice"},
+		{ID: "b", Source: "https://b.com/post", Target: "https://target.com/1", CreatedAt: "2024-01-02T00:00:00Z", Status: server.MentionStatusNew},
+		{ID: "c", Source: "https://c.com/post", Target: "https://target.com/2", CreatedAt: "2024-01-03T00:00:00Z", Status: server.MentionStatusApproved, Content: "100% agree with the spring gardening tips", AuthorName: "Carol"},
+	} {
+		require.NoError(t, s.CreateMention(ctx, m))
+	}
+	search := func(filter server.MentionFilter) []string {
+		t.Helper()
+		mentions, err := s.ListMentions(ctx, filter)
+		require.NoError(t, err)
+		ids := make([]string, 0, len(mentions))
+		for _, m := range mentions {
+			ids = append(ids, m.ID)
+		}
+		return ids
+	}
+	require.Equal(t, []string{"c", "a"}, search(server.MentionFilter{Query: "spring"}))
+	require.Equal(t, []string{"c", "a"}, search(server.MentionFilter{Query: "SPRING Garden"}))
+	require.Equal(t, []string{"a"}, search(server.MentionFilter{Query: "alice"}))
+	require.Equal(t, []string{"a"}, search(server.MentionFilter{Query: "spring", Limit: 1, Offset: 1}))
+	require.Equal(t, []string{"c"}, search(server.MentionFilter{Query: "spring", Target: "https://target.com/2"}))
+	require.Empty(t, search(server.MentionFilter{Query: "spring winter"}))
+	require.Equal(t, []string{"c", "a"}, search(server.MentionFilter{Query: `"spring!`}))
+	require.Equal(t, []string{"c"}, search(server.MentionFilter{Query: "100%"}))
+	count, err := s.CountMentions(ctx, server.MentionFilter{Query: "spring"})
+	require.NoError(t, err)
+	require.Equal(t, 2, count)
+
+	// The search covers changes made after mentions were created:
+	b, err := s.GetMention(ctx, "b")
+	require.NoError(t, err)
+	b.Status = server.MentionStatusVerified
+	b.Title = "Spring is coming"
+	require.NoError(t, s.SaveVerification(ctx, *b))
+	require.Equal(t, []string{"c", "b", "a"}, search(server.MentionFilter{Query: "spring"}))
+	require.NoError(t, s.TrashMention(ctx, "a", ""))
+	require.Equal(t, []string{"c", "b"}, search(server.MentionFilter{Query: "spring"}))
+	require.Equal(t, []string{"a"}, search(server.MentionFilter{Query: "spring", Trashed: true}))
+	require.NoError(t, s.PurgeMention(ctx, "a"))
+	require.Empty(t, search(server.MentionFilter{Query: "spring", Trashed: true}))
+	require.Equal(t, []string{"c", "b"}, search(server.MentionFilter{}))
+}
+
+func testPruneMentions(t *testing.T, s server.MentionStore) {
+	ctx := context.Background()
+	for _, m := range []server.Mention{
+		{ID: "old-invalid", Source: "https://a.com", Target: "https://target.com/", CreatedAt: "2024-01-01T00:00:00Z", Status: server.MentionStatusInvalid},
+		{ID: "reverified-invalid", Source: "https://b.com", Target: "https://target.com/", CreatedAt: "2024-01-01T00:00:00Z", VerifiedAt: "2024-03-01T00:00:00Z", Status: server.MentionStatusInvalid},
+		{ID: "new-invalid", Source: "https://c.com", Target: "https://target.com/", CreatedAt: "2024-03-01T00:00:00Z", Status: server.MentionStatusInvalid},
+		{ID: "old-rejected", Source: "https://d.com", Target: "https://target.com/", CreatedAt: "2024-01-01T00:00:00Z", Status: server.MentionStatusRejected},
+		{ID: "old-approved", Source: "https://e.com", Target: "https://target.com/", CreatedAt: "2024-01-01T00:00:00Z", Status: server.MentionStatusApproved},
+		{ID: "trashed-invalid", Source: "https://f.com", Target: "https://target.com/", CreatedAt: "2024-01-01T00:00:00Z", Status: server.MentionStatusInvalid},
+	} {
+		require.NoError(t, s.CreateMention(ctx, m))
+	}
+	// Mentions in the trash are only purged from there:
+	require.NoError(t, s.TrashMention(ctx, "trashed-invalid", ""))
+	before := time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC)
+	count, err := s.PruneMentions(ctx, server.PruneOptions{Status: server.MentionStatusInvalid, Before: before, DryRun: true})
+	require.NoError(t, err)
+	require.Equal(t, 1, count)
+	_, err = s.GetMention(ctx, "old-invalid")
+	require.NoError(t, err)
+
+	count, err = s.PruneMentions(ctx, server.PruneOptions{Status: server.MentionStatusInvalid, Before: before})
+	require.NoError(t, err)
+	require.Equal(t, 1, count)
+	_, err = s.GetMention(ctx, "old-invalid")
+	require.ErrorIs(t, err, server.ErrMentionNotFound)
+	for _, id := range []string{"reverified-invalid", "new-invalid", "old-rejected", "old-approved"} {
+		_, err = s.GetMention(ctx, id)
+		require.NoError(t, err)
+	}
+	trashed, err := s.ListMentions(ctx, server.MentionFilter{Trashed: true})
+	require.NoError(t, err)
+	require.Len(t, trashed, 1)
+
+	count, err = s.PruneMentions(ctx, server.PruneOptions{Status: server.MentionStatusRejected, Before: before, Tombstone: true})
+	require.NoError(t, err)
+	require.Equal(t, 1, count)
+	found, err := s.HasTombstone(ctx, "https://d.com", "https://target.com/")
+	require.NoError(t, err)
+	require.True(t, found)
+	found, err = s.HasTombstone(ctx, "https://a.com", "https://target.com/")
+	require.NoError(t, err)
+	require.False(t, found)
+
+	// Tombstones are kept for the retention period as well:
+	_, err = s.PruneMentions(ctx, server.PruneOptions{Status: server.MentionStatusRejected, Before: time.Now().Add(-time.Hour), Tombstone: true, DryRun: true})
+	require.NoError(t, err)
+	_, err = s.PruneMentions(ctx, server.PruneOptions{Status: server.MentionStatusRejected, Before: time.Now().Add(-time.Hour), Tombstone: true})
+	require.NoError(t, err)
+	found, err = s.HasTombstone(ctx, "https://d.com", "https://target.com/")
+	require.NoError(t, err)
+	require.True(t, found)
+	_, err = s.PruneMentions(ctx, server.PruneOptions{Status: server.MentionStatusRejected, Before: time.Now().Add(time.Hour), Tombstone: true, DryRun: true})
+	require.NoError(t, err)
+	found, err = s.HasTombstone(ctx, "https://d.com", "https://target.com/")
+	require.NoError(t, err)
+	require.True(t, found, "dry runs must not remove tombstones")
+	_, err = s.PruneMentions(ctx, server.PruneOptions{Status: server.MentionStatusRejected, Before: time.Now().Add(time.Hour), Tombstone: true})
+	require.NoError(t, err)
+	found, err = s.HasTombstone(ctx, "https://d.com", "https://target.com/")
+	require.NoError(t, err)
+	require.False(t, found)
+}
+
+func testPolicyStore(t *testing.T, s server.PolicyStore) {
+	ctx := context.Background()
+	heavy, err := s.CreatePolicy(ctx, policies.URLPolicy{URLPattern: regexp.MustCompile("^https://a.com"), Policy: policies.APPROVE, Weight: 10})
+	require.NoError(t, err)
+	_, err = s.CreatePolicy(ctx, policies.URLPolicy{URLPattern: regexp.MustCompile("^https://b.com"), Policy: policies.APPROVE, Weight: 1})
+	require.NoError(t, err)
+	loaded, err := s.Load(ctx)
+	require.NoError(t, err)
+	require.Len(t, loaded, 2)
+	require.Equal(t, "^https://b.com", loaded[0].URLPattern.String())
+	require.Equal(t, heavy, loaded[1].ID)
+	require.Equal(t, policies.APPROVE, loaded[1].Policy)
+
+	require.NoError(t, s.DeletePolicy(ctx, heavy))
+	require.ErrorIs(t, s.DeletePolicy(ctx, heavy), server.ErrPolicyNotFound)
+	loaded, err = s.Load(ctx)
+	require.NoError(t, err)
+	require.Len(t, loaded, 1)
+}
+
+func testSendStore(t *testing.T, s server.SendStore) {
+	ctx := context.Background()
+	require.NoError(t, s.SaveTargets(ctx, "https://source.com", []string{"https://b.com", "https://a.com"}))
+	require.NoError(t, s.RecordDelivery(ctx, "https://source.com", "https://a.com", "https://a.com/endpoint", "webmention"))
+	targets, err := s.LoadTargets(ctx, "https://source.com")
+	require.NoError(t, err)
+	require.Equal(t, []string{"https://a.com", "https://b.com"}, targets)
+	delivered, err := s.DeliveredTargets(ctx, "https://source.com", time.Now().Add(-time.Minute))
+	require.NoError(t, err)
+	require.Equal(t, []string{"https://a.com"}, delivered)
+	delivered, err = s.DeliveredTargets(ctx, "https://source.com", time.Now().Add(time.Minute))
+	require.NoError(t, err)
+	require.Empty(t, delivered)
+
+	feedURL := "https://source.com/feed.xml"
+	state, err := s.GetFeedState(ctx, feedURL)
+	require.NoError(t, err)
+	require.Equal(t, server.FeedState{URL: feedURL}, state)
+
+	updated := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	entries := []feeds.Entry{
+		{ID: "1", URL: "https://source.com/1", Updated: updated},
+		{ID: "2", URL: "https://source.com/2", Updated: updated},
+	}
+	require.NoError(t, s.UpdateFeed(ctx, server.FeedState{URL: feedURL, ETag: "v1"}, entries))
+	state, err = s.GetFeedState(ctx, feedURL)
+	require.NoError(t, err)
+	require.Equal(t, "v1", state.ETag)
+	require.True(t, state.Polled)
+	pending, err := s.PendingFeedEntries(ctx, feedURL)
+	require.NoError(t, err)
+	require.Len(t, pending, 2)
+
+	require.NoError(t, s.MarkFeedEntrySent(ctx, feedURL, "1"))
+	require.NoError(t, s.MarkFeedEntrySent(ctx, feedURL, "2"))
+	pending, err = s.PendingFeedEntries(ctx, feedURL)
+	require.NoError(t, err)
+	require.Empty(t, pending)
+
+	// Only updated entries become pending again:
+	entries[1].Updated = updated.Add(time.Hour)
+	require.NoError(t, s.UpdateFeed(ctx, server.FeedState{URL: feedURL, ETag: "v2"}, entries))
+	pending, err = s.PendingFeedEntries(ctx, feedURL)
+	require.NoError(t, err)
+	require.Len(t, pending, 1)
+	require.Equal(t, "2", pending[0].ID)
+	require.False(t, pending[0].PendingSince.IsZero())
+	require.Equal(t, 0, pending[0].Attempts)
+
+	require.NoError(t, s.RecordFeedEntryFailure(ctx, feedURL, "2"))
+	require.NoError(t, s.RecordFeedEntryFailure(ctx, feedURL, "2"))
+	pending, err = s.PendingFeedEntries(ctx, feedURL)
+	require.NoError(t, err)
+	require.Equal(t, 2, pending[0].Attempts)
+
+	// Another update resets the attempts:
+	entries[1].Updated = updated.Add(2 * time.Hour)
+	require.NoError(t, s.UpdateFeed(ctx, server.FeedState{URL: feedURL, ETag: "v3"}, entries))
+	pending, err = s.PendingFeedEntries(ctx, feedURL)
+	require.NoError(t, err)
+	require.Equal(t, 0, pending[0].Attempts)
+}
+
+func TestServerWithMemoryStore(t *testing.T) {
+	ctx := context.Background()
+	mux := chi.NewRouter()
+	mux.Get("/", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `<html><body><a href="https://target.com/">Target</a></body></html>`)
+	})
+	src := httptest.NewServer(mux)
+	defer src.Close()
+
+	store := server.NewMemoryStore()
+	srv := server.New(func(c *server.Configuration) {
+		c.MentionStore = store
+	})
+	require.NoError(t, srv.MigrateDatabase(ctx))
+
+	data := url.Values{}
+	data.Set("source", src.URL+"/")
+	data.Set("target", "https://target.com/")
+	req := httptest.NewRequest(http.MethodPost, "/receive", bytes.NewBufferString(data.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+	srv.ServeHTTP(w, req)
+	require.Equal(t, http.StatusAccepted, w.Code)
+
+	verified, err := srv.VerifyNextMention(ctx)
+	require.NoError(t, err)
+	require.True(t, verified)
+	mentions, err := store.ListMentions(ctx, server.MentionFilter{Status: server.MentionStatusVerified})
+	require.NoError(t, err)
+	require.Len(t, mentions, 1)
+	require.Equal(t, src.URL+"/", mentions[0].Source)
+}
+
+func testAuditStore(t *testing.T, s server.AuditStore) {
+	ctx := context.Background()
+	for _, e := range []server.AuditEntry{
+		{CreatedAt: "2024-01-01T00:00:00Z", Actor: "alice@example.org", Action: server.AuditActionApproveMention, Targets: []server.AuditTarget{{ID: "b", StatusBefore: server.MentionStatusVerified, StatusAfter: server.MentionStatusApproved}, {ID: "a", StatusBefore: server.MentionStatusNew, StatusAfter: server.MentionStatusApproved}}},
+		{CreatedAt: "2024-01-02T00:00:00Z", Actor: "key:ci", Action: server.AuditActionCreatePolicy, Targets: []server.AuditTarget{{ID: "1"}}},
+		{CreatedAt: "2024-01-03T00:00:00Z", Actor: "bob@example.org", Action: server.AuditActionDeleteMention, Targets: []server.AuditTarget{{ID: "a", StatusBefore: server.MentionStatusApproved}}},
+		{CreatedAt: "2024-01-03T00:00:00Z", Actor: "bob@example.org", Action: server.AuditActionImport},
+	} {
+		require.NoError(t, s.RecordAuditEntry(ctx, e))
+	}
+	actions := func(filter server.AuditFilter) []string {
+		t.Helper()
+		entries, err := s.ListAuditEntries(ctx, filter)
+		require.NoError(t, err)
+		result := make([]string, 0, len(entries))
+		for _, e := range entries {
+			result = append(result, e.Action)
+		}
+		return result
+	}
+
+	entries, err := s.ListAuditEntries(ctx, server.AuditFilter{})
+	require.NoError(t, err)
+	require.Len(t, entries, 4)
+	require.Equal(t, server.AuditActionImport, entries[0].Action)
+	require.Empty(t, entries[0].Targets)
+	require.NotNil(t, entries[0].Targets)
+	last := entries[3]
+	require.Equal(t, "2024-01-01T00:00:00Z", last.CreatedAt)
+	require.Equal(t, "alice@example.org", last.Actor)
+	require.Equal(t, []server.AuditTarget{
+		{ID: "a", StatusBefore: server.MentionStatusNew, StatusAfter: server.MentionStatusApproved},
+		{ID: "b", StatusBefore: server.MentionStatusVerified, StatusAfter: server.MentionStatusApproved},
+	}, last.Targets)
+
+	require.Equal(t, []string{server.AuditActionImport, server.AuditActionDeleteMention}, actions(server.AuditFilter{Actor: "bob@example.org"}))
+	require.Equal(t, []string{server.AuditActionCreatePolicy}, actions(server.AuditFilter{Action: server.AuditActionCreatePolicy}))
+	require.Equal(t, []string{server.AuditActionDeleteMention, server.AuditActionApproveMention}, actions(server.AuditFilter{TargetID: "a"}))
+	require.Equal(t, []string{server.AuditActionCreatePolicy}, actions(server.AuditFilter{
+		CreatedAfter:  time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC),
+		CreatedBefore: time.Date(2024, 1, 3, 0, 0, 0, 0, time.UTC),
+	}))
+	require.Equal(t, []string{server.AuditActionDeleteMention, server.AuditActionCreatePolicy}, actions(server.AuditFilter{Limit: 2, Offset: 1}))
+	count, err := s.CountAuditEntries(ctx, server.AuditFilter{TargetID: "a", Limit: 1})
+	require.NoError(t, err)
+	require.Equal(t, 2, count)
+	require.Empty(t, actions(server.AuditFilter{Actor: "carol@example.org"}))
+}
@@ -0,0 +1,114 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// handleListTrash lists the mentions in the trash with the same
+// parameters as handleListMentions. The most recently deleted mentions
+// come first unless another sort order is requested.
+func (srv *Server) handleListTrash(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	filter, err := parseMentionFilter(r.URL.Query())
+	if err != nil {
+		srv.sendError(ctx, w, &HTTPError{StatusCode: http.StatusBadRequest, Err: err})
+		return
+	}
+	filter.Trashed = true
+	if r.URL.Query().Get("sort") == "" {
+		filter.SortBy = MentionSortDeletedAt
+	}
+	srv.sendMentionList(w, r, filter)
+}
+
+// handleRestoreMention moves a mention out of the trash again.
+func (srv *Server) handleRestoreMention(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	id := chi.URLParam(r, "id")
+	if err := srv.cfg.MentionStore.RestoreMention(ctx, id); err != nil {
+		if errors.Is(err, ErrMentionNotFound) {
+			err = &HTTPError{StatusCode: http.StatusNotFound, Err: err}
+		}
+		srv.sendError(ctx, w, err)
+		return
+	}
+	m, err := srv.cfg.MentionStore.GetMention(ctx, id)
+	if err != nil {
+		srv.sendError(ctx, w, err)
+		return
+	}
+	srv.invalidateTarget(m.Target)
+	srv.UpdateGlobalMetrics(ctx)
+	srv.audit(ctx, AuditActionRestoreMention, AuditTarget{ID: m.ID, StatusAfter: m.Status})
+	srv.sendMentionDetails(ctx, w, m, http.StatusOK)
+}
+
+// handlePurgeMention permanently removes a single mention from the
+// trash.
+func (srv *Server) handlePurgeMention(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	id := chi.URLParam(r, "id")
+	if err := srv.cfg.MentionStore.PurgeMention(ctx, id); err != nil {
+		if errors.Is(err, ErrMentionNotFound) {
+			err = &HTTPError{StatusCode: http.StatusNotFound, Err: err}
+		}
+		srv.sendError(ctx, w, err)
+		return
+	}
+	purgedTrash.Inc()
+	srv.UpdateGlobalMetrics(ctx)
+	srv.audit(ctx, AuditActionPurgeMention, AuditTarget{ID: id})
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleEmptyTrash permanently removes all mentions from the trash.
+func (srv *Server) handleEmptyTrash(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	// The audit log lists the mentions that were in the trash right
+	// before emptying it.
+	trashed, err := srv.cfg.MentionStore.ListMentions(ctx, MentionFilter{Trashed: true})
+	if err != nil {
+		srv.sendError(ctx, w, err)
+		return
+	}
+	count, err := srv.cfg.MentionStore.PurgeTrash(ctx, time.Time{})
+	if err != nil {
+		srv.sendError(ctx, w, err)
+		return
+	}
+	purgedTrash.Add(float64(count))
+	srv.UpdateGlobalMetrics(ctx)
+	if count > 0 {
+		targets := make([]AuditTarget, 0, len(trashed))
+		for _, m := range trashed {
+			targets = append(targets, AuditTarget{ID: m.ID})
+		}
+		srv.audit(ctx, AuditActionPurgeMention, targets...)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]int{"purged": count})
+}
+
+// PurgeTrash permanently removes all mentions that have been in the
+// trash for longer than the configured period and returns how many
+// were removed.
+func (srv *Server) PurgeTrash(ctx context.Context) (int, error) {
+	if srv.cfg.Retention.Trash <= 0 {
+		return 0, nil
+	}
+	count, err := srv.cfg.MentionStore.PurgeTrash(ctx, time.Now().Add(-srv.cfg.Retention.Trash))
+	if err != nil {
+		return 0, err
+	}
+	if count > 0 {
+		purgedTrash.Add(float64(count))
+		srv.UpdateGlobalMetrics(ctx)
+	}
+	return count, nil
+}
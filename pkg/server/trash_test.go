@@ -0,0 +1,108 @@
+package server_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/zerok/webmentiond/pkg/server"
+)
+
+func TestTrash(t *testing.T) {
+	db := setupDatabase(t)
+	defer db.Close()
+	srv := setupServer(t, db)
+	createMention(t, db, "a", "https://a.com/", "https://target.com/")
+	createMention(t, db, "b", "https://b.com/", "https://target.com/")
+	createMention(t, db, "c", "https://c.com/", "https://target.com/")
+	ctx := server.AuthorizeContextAs(context.Background(), "admin@example.org")
+
+	send := func(method string, path string, expectedStatus int) *httptest.ResponseRecorder {
+		t.Helper()
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(method, path, nil)
+		srv.ServeHTTP(w, r.WithContext(ctx))
+		require.Equal(t, expectedStatus, w.Code)
+		return w
+	}
+	listTrash := func() server.PagedMentionList {
+		t.Helper()
+		var res server.PagedMentionList
+		w := send(http.MethodGet, "/manage/trash", http.StatusOK)
+		require.NoError(t, json.NewDecoder(w.Body).Decode(&res))
+		return res
+	}
+
+	send(http.MethodDelete, "/manage/mentions/a", http.StatusOK)
+	send(http.MethodDelete, "/manage/mentions/b", http.StatusOK)
+	send(http.MethodDelete, "/manage/mentions/a", http.StatusBadRequest)
+	requireMetricValue(t, ctx, srv, "webmentiond_mentions_total", 1)
+	requireMetricValue(t, ctx, srv, "webmentiond_mentions_trashed", 2)
+
+	trash := listTrash()
+	require.Equal(t, 2, trash.Total)
+	require.Len(t, trash.Items, 2)
+	require.Equal(t, "admin@example.org", trash.Items[0].DeletedBy)
+	require.NotEmpty(t, trash.Items[0].DeletedAt)
+
+	// Resending a mention from the trash doesn't bring it back:
+	data := url.Values{}
+	data.Set("source", "https://a.com/")
+	data.Set("target", "https://target.com/")
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodPost, "/receive", bytes.NewBufferString(data.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	srv.ServeHTTP(w, r)
+	require.Equal(t, http.StatusAccepted, w.Code)
+	require.Equal(t, 2, listTrash().Total)
+
+	var details server.MentionDetails
+	w = send(http.MethodPost, "/manage/trash/a/restore", http.StatusOK)
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&details))
+	require.Equal(t, "a", details.ID)
+	require.Empty(t, details.DeletedBy)
+	send(http.MethodGet, "/manage/mentions/a", http.StatusOK)
+	send(http.MethodPost, "/manage/trash/a/restore", http.StatusNotFound)
+
+	send(http.MethodDelete, "/manage/trash/c", http.StatusNotFound)
+	send(http.MethodDelete, "/manage/trash/b", http.StatusNoContent)
+	requireMentionNotExists(t, db, "b")
+
+	send(http.MethodDelete, "/manage/mentions/c", http.StatusOK)
+	var purged map[string]int
+	w = send(http.MethodDelete, "/manage/trash", http.StatusOK)
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&purged))
+	require.Equal(t, map[string]int{"purged": 1}, purged)
+	requireMentionNotExists(t, db, "c")
+	requireMetricValue(t, ctx, srv, "webmentiond_mentions_trashed", 0)
+}
+
+func TestPurgeTrash(t *testing.T) {
+	db := setupDatabase(t)
+	defer db.Close()
+	srv := server.New(func(c *server.Configuration) {
+		c.Database = db
+		c.MigrationsFolder = "migrations"
+		c.Retention.Trash = time.Hour
+	})
+	ctx := context.Background()
+	require.NoError(t, srv.MigrateDatabase(ctx))
+	createMention(t, db, "a", "https://a.com/", "https://target.com/")
+	createMention(t, db, "b", "https://b.com/", "https://target.com/")
+	_, err := db.Exec("UPDATE webmentions SET deleted_at = ? WHERE id = ?", time.Now().Add(-2*time.Hour).UTC().Format(time.RFC3339), "a")
+	require.NoError(t, err)
+	_, err = db.Exec("UPDATE webmentions SET deleted_at = ? WHERE id = ?", time.Now().UTC().Format(time.RFC3339), "b")
+	require.NoError(t, err)
+
+	count, err := srv.PurgeTrash(ctx)
+	require.NoError(t, err)
+	require.Equal(t, 1, count)
+	requireMentionNotExists(t, db, "a")
+	requireMentionStatus(t, db, "b", "new")
+}
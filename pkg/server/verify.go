@@ -2,7 +2,7 @@ package server
 
 import (
 	"context"
-	"database/sql"
+	"errors"
 	"time"
 
 	"github.com/rs/zerolog"
@@ -15,11 +15,6 @@ import (
 func (srv *Server) VerifyNextMention(ctx context.Context) (bool, error) {
 	logger := zerolog.Ctx(ctx)
 	logger.Debug().Msg("Checking for new mentions.")
-	tx, err := srv.cfg.Database.BeginTx(ctx, nil)
-	if err != nil {
-		return false, err
-	}
-	m := Mention{}
 	// The last verification must be at least a minute in the past
 	valid_last_verification := time.Now()
 	if srv.cfg.VerificationTimeoutDuration != 0 {
@@ -27,21 +22,59 @@ func (srv *Server) VerifyNextMention(ctx context.Context) (bool, error) {
 	} else {
 		valid_last_verification = valid_last_verification.Add(time.Second)
 	}
-	if err := tx.QueryRowContext(ctx, "SELECT id, source, target FROM webmentions WHERE status = ? AND (verified_at = '' OR verified_at) < ? LIMIT 1", MentionStatusNew, valid_last_verification.Format(time.RFC3339)).Scan(&m.ID, &m.Source, &m.Target); err != nil {
-		tx.Rollback()
-		if err == sql.ErrNoRows {
+	m, err := srv.cfg.MentionStore.NextPendingMention(ctx, valid_last_verification)
+	if err != nil {
+		if errors.Is(err, ErrMentionNotFound) {
 			return false, nil
 		}
 		return false, err
 	}
+	verified, err := srv.verifyMention(ctx, *m, false)
+	if err != nil {
+		return true, err
+	}
+	logger.Debug().Msgf("%s -> %s checked: %v", m.Source, m.Target, verified.Status)
+	if srv.cfg.NotifyOnVerification {
+		if err := srv.sendNotificationMail(ctx, webmention.Mention{Source: m.Source, Target: m.Target}, verified.Status); err != nil {
+			logger.Error().Err(err).Msg("Failed to send notification email")
+		}
+	}
+	return true, nil
+}
+
+// verifyMention fetches the source of m, stores the outcome together
+// with the extracted details and records it in the verification
+// history. If an admin requested the verification, approved and
+// rejected mentions keep their status unless they turn out to be
+// invalid.
+//
+// Mentions added by an admin usually come from sites that don't link
+// to the target. Their source is therefore not fetched and they keep
+// their status and details unless they are still new.
+func (srv *Server) verifyMention(ctx context.Context, m Mention, manual bool) (*Mention, error) {
+	logger := zerolog.Ctx(ctx)
 	newStatus := MentionStatusVerified
 	mention := webmention.Mention{
 		Source: m.Source,
 		Target: m.Target,
 	}
-	if err := webmention.Verify(ctx, &mention, func(c *webmention.VerifyOptions) {
-		c.MaxRedirects = srv.cfg.VerificationMaxRedirects
-	}); err != nil {
+	var verifyErr error
+	if m.Origin == MentionOriginManual {
+		extracted := m.withoutOverrides()
+		mention.Title = extracted.Title
+		mention.Type = extracted.Type
+		mention.Content = extracted.Content
+		mention.AuthorName = extracted.AuthorName
+		mention.RSVP = extracted.RSVP
+		if m.Status != MentionStatusNew {
+			newStatus = m.Status
+		}
+	} else {
+		verifyErr = webmention.Verify(ctx, &mention, func(c *webmention.VerifyOptions) {
+			c.MaxRedirects = srv.cfg.VerificationMaxRedirects
+		})
+	}
+	if verifyErr != nil {
 		newStatus = MentionStatusInvalid
 	}
 	if srv.cfg.Policies != nil {
@@ -53,27 +86,50 @@ func (srv *Server) VerifyNextMention(ctx context.Context) (bool, error) {
 			}
 		}
 	}
-	if len(mention.Content) > 500 {
-		mention.Content = mention.Content[0:497] + "…"
+	if manual && newStatus != MentionStatusInvalid && (m.Status == MentionStatusApproved || m.Status == MentionStatusRejected) {
+		newStatus = m.Status
 	}
+	mention.Content = truncateContent(mention.Content)
 	logger.Debug().Msgf("title: %s", mention.Title)
-	if _, err := tx.ExecContext(ctx, "UPDATE webmentions SET status = ? , title = ? , verified_at = ?, type = ?, content = ?, author_name = ?, rsvp = ? WHERE id = ?", newStatus, mention.Title, time.Now().Format(time.RFC3339), mention.Type, mention.Content, mention.AuthorName, mention.RSVP, m.ID); err != nil {
-		tx.Rollback()
-		return true, err
-	} else {
-		if err := tx.Commit(); err != nil {
-			tx.Rollback()
-			return true, err
-		}
-		logger.Debug().Msgf("%s -> %s checked: %v", m.Source, m.Target, newStatus)
-		srv.UpdateGlobalMetrics(ctx)
-		if srv.cfg.NotifyOnVerification {
-			if err := srv.sendNotificationMail(ctx, mention, newStatus); err != nil {
-				logger.Error().Err(err).Msg("Failed to send notification email")
-			}
-		}
-		return true, nil
+	m.Status = newStatus
+	m.Title = mention.Title
+	m.VerifiedAt = formatTimestamp(time.Now())
+	m.Type = mention.Type
+	m.Content = mention.Content
+	m.AuthorName = mention.AuthorName
+	m.RSVP = mention.RSVP
+	if err := srv.cfg.MentionStore.SaveVerification(ctx, m); err != nil {
+		return nil, err
+	}
+	v := Verification{
+		MentionID:  m.ID,
+		VerifiedAt: m.VerifiedAt,
+		Status:     newStatus,
+		Title:      m.Title,
+		Type:       m.Type,
+		AuthorName: m.AuthorName,
+		Manual:     manual,
+	}
+	if verifyErr != nil {
+		v.Error = verifyErr.Error()
+	}
+	if err := srv.cfg.MentionStore.RecordVerification(ctx, v); err != nil {
+		return nil, err
+	}
+	srv.invalidateTarget(m.Target)
+	srv.UpdateGlobalMetrics(ctx)
+	// The stored mention might differ from m due to overrides or a
+	// pinned revision:
+	return srv.cfg.MentionStore.GetMention(ctx, m.ID)
+}
+
+// truncateContent shortens the content stored for a mention to 500
+// bytes.
+func truncateContent(content string) string {
+	if len(content) > 500 {
+		return content[0:497] + "…"
 	}
+	return content
 }
 
 func (srv *Server) StartVerifier(ctx context.Context) {
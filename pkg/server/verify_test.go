@@ -3,10 +3,12 @@ package server_test
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"strings"
 	"testing"
 
 	"github.com/rs/zerolog"
@@ -105,3 +107,181 @@ func requireMentionCount(t *testing.T, db *sql.DB, expected int) {
 	}
 
 }
+
+func TestVerifyManually(t *testing.T) {
+	db := setupDatabase(t)
+	defer db.Close()
+	srv := setupServer(t, db)
+	linked := true
+	h := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		if linked {
+			fmt.Fprint(w, "<html><head><title>title</title></head><body><a href=\"http://test.com\">target</a></body></html>")
+		} else {
+			fmt.Fprint(w, "<html><head><title>title</title></head><body></body></html>")
+		}
+	}))
+	defer h.Close()
+	createMention(t, db, "a", h.URL, "http://test.com")
+	setMentionStatus(t, db, "a", server.MentionStatusApproved)
+
+	send := func(method string, path string, expectedStatus int) server.MentionDetails {
+		t.Helper()
+		var res server.MentionDetails
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(method, path, nil)
+		srv.ServeHTTP(w, r.WithContext(server.AuthorizeContext(r.Context())))
+		require.Equal(t, expectedStatus, w.Code)
+		if expectedStatus == http.StatusOK {
+			require.NoError(t, json.NewDecoder(w.Body).Decode(&res))
+		}
+		return res
+	}
+
+	res := send(http.MethodGet, "/manage/mentions/a", http.StatusOK)
+	require.Equal(t, h.URL, res.Source)
+	require.Empty(t, res.Verifications)
+
+	// Approved mentions stay approved as long as they are valid:
+	res = send(http.MethodPost, "/manage/mentions/a/verify", http.StatusOK)
+	require.Equal(t, server.MentionStatusApproved, res.Status)
+	require.Equal(t, "title", res.Title)
+	require.Len(t, res.Verifications, 1)
+	require.Equal(t, server.MentionStatusApproved, res.Verifications[0].Status)
+	require.True(t, res.Verifications[0].Manual)
+
+	linked = false
+	res = send(http.MethodPost, "/manage/mentions/a/verify", http.StatusOK)
+	require.Equal(t, server.MentionStatusInvalid, res.Status)
+	require.Len(t, res.Verifications, 2)
+	require.Equal(t, server.MentionStatusInvalid, res.Verifications[0].Status)
+	require.NotEmpty(t, res.Verifications[0].Error)
+	requireMentionStatus(t, db, "a", server.MentionStatusInvalid)
+	require.Len(t, send(http.MethodGet, "/manage/mentions/a", http.StatusOK).Verifications, 2)
+
+	send(http.MethodGet, "/manage/mentions/unknown", http.StatusNotFound)
+	send(http.MethodPost, "/manage/mentions/unknown/verify", http.StatusNotFound)
+}
+
+func TestMentionRevisions(t *testing.T) {
+	db := setupDatabase(t)
+	defer db.Close()
+	srv := setupServer(t, db)
+	title := "Nice post"
+	h := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprintf(w, "<html><head><title>%s</title></head><body><a href=\"http://test.com\">target</a></body></html>", title)
+	}))
+	defer h.Close()
+	createMention(t, db, "a", h.URL, "http://test.com")
+	setMentionStatus(t, db, "a", server.MentionStatusApproved)
+
+	send := func(method string, path string, body string, expectedStatus int) *httptest.ResponseRecorder {
+		t.Helper()
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(method, path, strings.NewReader(body))
+		srv.ServeHTTP(w, r.WithContext(server.AuthorizeContext(r.Context())))
+		require.Equal(t, expectedStatus, w.Code)
+		return w
+	}
+	revisions := func() server.RevisionList {
+		t.Helper()
+		var res server.RevisionList
+		w := send(http.MethodGet, "/manage/mentions/a/revisions", "", http.StatusOK)
+		require.NoError(t, json.NewDecoder(w.Body).Decode(&res))
+		return res
+	}
+	published := func() string {
+		t.Helper()
+		var mentions []server.Mention
+		w := httptest.NewRecorder()
+		srv.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/get?target=http://test.com", nil))
+		require.Equal(t, http.StatusOK, w.Code)
+		require.NoError(t, json.NewDecoder(w.Body).Decode(&mentions))
+		require.Len(t, mentions, 1)
+		require.Zero(t, mentions[0].PinnedRevision)
+		return mentions[0].Title
+	}
+
+	send(http.MethodPost, "/manage/mentions/a/verify", "", http.StatusOK)
+	send(http.MethodPost, "/manage/mentions/a/verify", "", http.StatusOK)
+	list := revisions()
+	require.Len(t, list.Items, 1)
+	require.Equal(t, []server.RevisionChange{{Field: "title", After: "Nice post"}}, list.Items[0].Changes)
+
+	send(http.MethodPut, "/manage/mentions/a/pin", `{"revision": 1}`, http.StatusOK)
+
+	// Later changes of the source are recorded but not published:
+	title = "Cheap pills"
+	var details server.MentionDetails
+	w := send(http.MethodPost, "/manage/mentions/a/verify", "", http.StatusOK)
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&details))
+	require.Equal(t, "Nice post", details.Title)
+	require.Equal(t, 1, details.PinnedRevision)
+	require.Equal(t, "Nice post", published())
+	list = revisions()
+	require.Equal(t, 1, list.PinnedRevision)
+	require.Len(t, list.Items, 2)
+	require.Equal(t, 2, list.Items[0].Number)
+	require.Equal(t, []server.RevisionChange{{Field: "title", Before: "Nice post", After: "Cheap pills"}}, list.Items[0].Changes)
+
+	send(http.MethodPut, "/manage/mentions/a/pin", `{"revision": 3}`, http.StatusNotFound)
+	send(http.MethodPut, "/manage/mentions/a/pin", `{"revision": 0}`, http.StatusBadRequest)
+	send(http.MethodPut, "/manage/mentions/unknown/pin", `{"revision": 1}`, http.StatusNotFound)
+	send(http.MethodGet, "/manage/mentions/unknown/revisions", "", http.StatusNotFound)
+
+	send(http.MethodDelete, "/manage/mentions/a/pin", "", http.StatusOK)
+	require.Equal(t, "Cheap pills", published())
+	require.Zero(t, revisions().PinnedRevision)
+}
+
+func TestVerifyManualMention(t *testing.T) {
+	db := setupDatabase(t)
+	defer db.Close()
+	srv := setupServer(t, db)
+	ctx := context.Background()
+	fetched := false
+	h := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetched = true
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprint(w, "<html><head><title>title</title></head><body></body></html>")
+	}))
+	defer h.Close()
+
+	send := func(method string, path string, body string, expectedStatus int) server.MentionDetails {
+		t.Helper()
+		var res server.MentionDetails
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(method, path, strings.NewReader(body))
+		srv.ServeHTTP(w, r.WithContext(server.AuthorizeContext(r.Context())))
+		require.Equal(t, expectedStatus, w.Code, w.Body.String())
+		if expectedStatus < 300 {
+			require.NoError(t, json.NewDecoder(w.Body).Decode(&res))
+		}
+		return res
+	}
+
+	created := send(http.MethodPost, "/manage/mentions", fmt.Sprintf(`{"source": "%s/replies/1", "target": "http://test.com", "title": "Reply", "author_name": "Jane"}`, h.URL), http.StatusCreated)
+
+	// Verifying a manual mention keeps it approved even though its
+	// source doesn't link to the target:
+	res := send(http.MethodPost, "/manage/mentions/"+created.ID+"/verify", "", http.StatusOK)
+	require.Equal(t, server.MentionStatusApproved, res.Status)
+	require.Equal(t, "Reply", res.Title)
+	require.Equal(t, "Jane", res.AuthorName)
+	require.Len(t, res.Verifications, 1)
+	require.Empty(t, res.Verifications[0].Error)
+
+	// Re-verifying it in bulk doesn't make it invalid either:
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodPost, "/manage/mentions/bulk", strings.NewReader(fmt.Sprintf(`{"action": "reverify", "ids": ["%s"]}`, created.ID)))
+	srv.ServeHTTP(w, r.WithContext(server.AuthorizeContext(r.Context())))
+	require.Equal(t, http.StatusOK, w.Code)
+	requireMentionStatus(t, db, created.ID, server.MentionStatusNew)
+	_, err := srv.VerifyNextMention(ctx)
+	require.NoError(t, err)
+	requireMentionStatus(t, db, created.ID, server.MentionStatusVerified)
+	res = send(http.MethodGet, "/manage/mentions/"+created.ID, "", http.StatusOK)
+	require.Equal(t, "Reply", res.Title)
+	require.False(t, fetched)
+}
@@ -0,0 +1,103 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+)
+
+// webmentionIOFeed is the jf2 feed returned by the mentions API of
+// webmention.io (https://webmention.io/api/mentions.jf2).
+type webmentionIOFeed struct {
+	Type     string              `json:"type"`
+	Children []webmentionIOEntry `json:"children"`
+}
+
+type webmentionIOEntry struct {
+	Type      string        `json:"type"`
+	Author    *ExportAuthor `json:"author"`
+	URL       string        `json:"url"`
+	Published string        `json:"published"`
+	Received  string        `json:"wm-received"`
+	Source    string        `json:"wm-source"`
+	Target    string        `json:"wm-target"`
+	Protocol  string        `json:"wm-protocol"`
+	Property  string        `json:"wm-property"`
+	Private   bool          `json:"wm-private"`
+	Name      string        `json:"name"`
+	Content   *struct {
+		Text string `json:"text"`
+		HTML string `json:"html"`
+	} `json:"content"`
+	RSVP string `json:"rsvp"`
+}
+
+// webmentionIOTimeLayouts are tried for timestamps coming from
+// webmention.io as published dates are taken from the source as is.
+var webmentionIOTimeLayouts = []string{time.RFC3339, "2006-01-02T15:04:05", "2006-01-02T15:04", "2006-01-02"}
+
+// ParseWebmentionIOExport converts a jf2 feed exported from
+// webmention.io into a document that can be passed to Import. All
+// mentions get the given status which has to be either "approved" or
+// "new" so that they are verified again. Private mentions are never
+// approved right away.
+func ParseWebmentionIOExport(r io.Reader, status string) (*ExportDocument, error) {
+	if status != MentionStatusApproved && status != MentionStatusNew {
+		return nil, fmt.Errorf("unsupported initial status: %s", status)
+	}
+	feed := webmentionIOFeed{}
+	if err := json.NewDecoder(r).Decode(&feed); err != nil {
+		return nil, err
+	}
+	if feed.Type != "feed" {
+		return nil, fmt.Errorf("%w: unsupported type %q", ErrInvalidImport, feed.Type)
+	}
+	doc := &ExportDocument{
+		Type:     "feed",
+		Name:     "webmention.io",
+		Version:  ExportFormatVersion,
+		Children: make([]ExportEntry, 0, len(feed.Children)),
+	}
+	for _, e := range feed.Children {
+		entry := ExportEntry{
+			Type:      "entry",
+			Source:    e.Source,
+			Target:    e.Target,
+			Property:  e.Property,
+			Received:  webmentionIOTimestamp(e.Received),
+			Published: webmentionIOTimestamp(e.Published),
+			URL:       e.URL,
+			Name:      e.Name,
+			Author:    e.Author,
+			RSVP:      e.RSVP,
+			Status:    status,
+			Protocol:  e.Protocol,
+		}
+		if e.Private {
+			entry.Status = MentionStatusNew
+		}
+		if entry.Protocol != "pingback" {
+			entry.Protocol = "webmention"
+		}
+		if e.Content != nil && e.Content.Text != "" {
+			entry.Content = &ExportContent{Text: truncateContent(e.Content.Text)}
+		}
+		if entry.Author != nil {
+			entry.Author.Type = "card"
+		}
+		doc.Children = append(doc.Children, entry)
+	}
+	return doc, nil
+}
+
+// webmentionIOTimestamp converts value into RFC3339. Unknown formats
+// are dropped.
+func webmentionIOTimestamp(value string) string {
+	for _, layout := range webmentionIOTimeLayouts {
+		if t, err := time.Parse(layout, value); err == nil {
+			return formatTimestamp(t)
+		}
+	}
+	return ""
+}
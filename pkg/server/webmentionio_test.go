@@ -0,0 +1,72 @@
+package server_test
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/zerok/webmentiond/pkg/server"
+)
+
+func TestImportWebmentionIO(t *testing.T) {
+	ctx := context.Background()
+	load := func(status string) *server.ExportDocument {
+		fp, err := os.Open("testdata/webmentionio.jf2")
+		require.NoError(t, err)
+		defer fp.Close()
+		doc, err := server.ParseWebmentionIOExport(fp, status)
+		require.NoError(t, err)
+		return doc
+	}
+	_, err := server.ParseWebmentionIOExport(nil, server.MentionStatusRejected)
+	require.Error(t, err)
+
+	store := server.NewMemoryStore()
+	summary, err := server.Import(ctx, store, store, load(server.MentionStatusApproved), server.ImportOptions{KeepExisting: true})
+	require.NoError(t, err)
+	require.Len(t, summary.Changes, 3)
+	summary.Changes = nil
+	require.Equal(t, server.ImportSummary{Created: 3}, *summary)
+
+	mentions, err := store.ListMentions(ctx, server.MentionFilter{Target: "https://example.org/posts/hello/", OldestFirst: true})
+	require.NoError(t, err)
+	require.Len(t, mentions, 2)
+	reply := mentions[0]
+	require.Equal(t, "https://jane.example/notes/1", reply.Source)
+	require.Equal(t, "comment", reply.Type)
+	require.Equal(t, server.MentionStatusApproved, reply.Status)
+	require.Equal(t, "Jane Doe", reply.AuthorName)
+	require.Equal(t, "https://jane.example/", reply.AuthorURL)
+	require.Equal(t, "https://webmention.io/avatar/jane.example/abc.jpg", reply.AuthorPhoto)
+	require.Equal(t, "Great post!", reply.Content)
+	require.Equal(t, "2023-05-01T08:00:00Z", reply.PublishedAt)
+	require.Equal(t, "2023-05-01T08:05:12Z", reply.CreatedAt)
+	like := mentions[1]
+	require.Equal(t, "like", like.Type)
+	require.Empty(t, like.PublishedAt)
+
+	// Private mentions have to be moderated:
+	mentions, err = store.ListMentions(ctx, server.MentionFilter{Target: "https://example.org/posts/other/"})
+	require.NoError(t, err)
+	require.Len(t, mentions, 1)
+	require.Equal(t, "repost", mentions[0].Type)
+	require.Equal(t, server.MentionStatusNew, mentions[0].Status)
+	require.Equal(t, "2023-05-03T00:00:00Z", mentions[0].PublishedAt)
+
+	// Running the import again doesn't touch mentions that have been
+	// moderated in the meantime:
+	require.NoError(t, store.UpdateMentionStatus(ctx, like.ID, server.MentionStatusRejected))
+	summary, err = server.Import(ctx, store, store, load(server.MentionStatusNew), server.ImportOptions{KeepExisting: true})
+	require.NoError(t, err)
+	require.Equal(t, server.ImportSummary{Unchanged: 3}, *summary)
+	m, err := store.GetMention(ctx, like.ID)
+	require.NoError(t, err)
+	require.Equal(t, server.MentionStatusRejected, m.Status)
+
+	// Imported details survive an export:
+	doc, err := server.Export(ctx, store, store)
+	require.NoError(t, err)
+	require.Equal(t, "https://jane.example/", doc.Children[0].Author.URL)
+	require.Equal(t, "2023-05-01T08:00:00Z", doc.Children[0].Published)
+}
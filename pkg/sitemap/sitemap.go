@@ -0,0 +1,143 @@
+// Package sitemap retrieves the page URLs listed in sitemaps as
+// described on <https://www.sitemaps.org/protocol.html>.
+package sitemap
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// maxDepth limits how deep sitemap indexes may be nested.
+const maxDepth = 5
+
+// URL is a single page listed in a sitemap.
+type URL struct {
+	Loc string
+	// LastMod is the zero time if the sitemap doesn't specify when the
+	// page was last modified.
+	LastMod time.Time
+}
+
+// Options configure the Fetch function.
+type Options struct {
+	HTTPClient *http.Client
+	// Since filters out all pages that have a lastmod value before the
+	// given time. Pages without lastmod are always included.
+	Since time.Time
+}
+
+type document struct {
+	XMLName xml.Name
+	URLs    []struct {
+		Loc     string `xml:"loc"`
+		LastMod string `xml:"lastmod"`
+	} `xml:"url"`
+	Sitemaps []struct {
+		Loc     string `xml:"loc"`
+		LastMod string `xml:"lastmod"`
+	} `xml:"sitemap"`
+}
+
+// Fetch retrieves the sitemap at the given URL and returns all pages
+// listed in it. If the sitemap is a sitemap index, all referenced
+// sitemaps are fetched as well.
+func Fetch(ctx context.Context, u string, configurators ...func(*Options)) ([]URL, error) {
+	opts := &Options{
+		HTTPClient: &http.Client{},
+	}
+	for _, c := range configurators {
+		c(opts)
+	}
+	result := make([]URL, 0, 50)
+	seen := make(map[string]struct{})
+	if err := fetch(ctx, opts, u, 0, seen, &result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func fetch(ctx context.Context, opts *Options, u string, depth int, seen map[string]struct{}, result *[]URL) error {
+	if depth > maxDepth {
+		return fmt.Errorf("sitemap indexes nested too deeply")
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := opts.HTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("failed to fetch %s: unexpected status code %v", u, resp.StatusCode)
+	}
+	doc, err := parse(resp.Body)
+	if err != nil {
+		return fmt.Errorf("failed to parse %s: %w", u, err)
+	}
+	for _, sm := range doc.Sitemaps {
+		loc := strings.TrimSpace(sm.Loc)
+		lastMod := parseTime(sm.LastMod)
+		if !opts.Since.IsZero() && !lastMod.IsZero() && lastMod.Before(opts.Since) {
+			continue
+		}
+		if err := fetch(ctx, opts, loc, depth+1, seen, result); err != nil {
+			return err
+		}
+	}
+	for _, entry := range doc.URLs {
+		loc := strings.TrimSpace(entry.Loc)
+		if _, ok := seen[loc]; ok || loc == "" {
+			continue
+		}
+		lastMod := parseTime(entry.LastMod)
+		if !opts.Since.IsZero() && !lastMod.IsZero() && lastMod.Before(opts.Since) {
+			continue
+		}
+		seen[loc] = struct{}{}
+		*result = append(*result, URL{Loc: loc, LastMod: lastMod})
+	}
+	return nil
+}
+
+// parse decodes a (optionally gzip-compressed) sitemap or sitemap
+// index.
+func parse(r io.Reader) (*document, error) {
+	br := bufio.NewReader(r)
+	if magic, err := br.Peek(2); err == nil && magic[0] == 0x1f && magic[1] == 0x8b {
+		gr, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, err
+		}
+		defer gr.Close()
+		r = gr
+	} else {
+		r = br
+	}
+	doc := &document{}
+	if err := xml.NewDecoder(r).Decode(doc); err != nil {
+		return nil, err
+	}
+	if doc.XMLName.Local != "urlset" && doc.XMLName.Local != "sitemapindex" {
+		return nil, fmt.Errorf("unexpected root element %s", doc.XMLName.Local)
+	}
+	return doc, nil
+}
+
+func parseTime(value string) time.Time {
+	value = strings.TrimSpace(value)
+	for _, layout := range []string{time.RFC3339, "2006-01-02T15:04-07:00", "2006-01-02"} {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t
+		}
+	}
+	return time.Time{}
+}
@@ -0,0 +1,67 @@
+package sitemap_test
+
+import (
+	"compress/gzip"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/zerok/webmentiond/pkg/sitemap"
+)
+
+func TestFetch(t *testing.T) {
+	var srv *httptest.Server
+	mux := http.NewServeMux()
+	mux.HandleFunc("/sitemap.xml", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `<?xml version="1.0" encoding="UTF-8"?>
+<sitemapindex xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">
+  <sitemap><loc>%[1]s/posts.xml</loc><lastmod>2020-03-03</lastmod></sitemap>
+  <sitemap><loc>%[1]s/old.xml.gz</loc><lastmod>2019-01-01</lastmod></sitemap>
+</sitemapindex>`, srv.URL)
+	})
+	mux.HandleFunc("/posts.xml", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `<?xml version="1.0" encoding="UTF-8"?>
+<urlset xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">
+  <url><loc>https://example.com/posts/2/</loc><lastmod>2020-03-03T10:00:00+00:00</lastmod></url>
+  <url><loc>https://example.com/posts/1/</loc><lastmod>2020-03-01</lastmod></url>
+  <url><loc>https://example.com/about/</loc></url>
+</urlset>`)
+	})
+	mux.HandleFunc("/old.xml.gz", func(w http.ResponseWriter, r *http.Request) {
+		gw := gzip.NewWriter(w)
+		defer gw.Close()
+		fmt.Fprint(gw, `<?xml version="1.0" encoding="UTF-8"?>
+<urlset xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">
+  <url><loc>https://example.com/posts/0/</loc><lastmod>2019-01-01</lastmod></url>
+</urlset>`)
+	})
+	srv = httptest.NewServer(mux)
+	defer srv.Close()
+	ctx := context.Background()
+
+	urls, err := sitemap.Fetch(ctx, srv.URL+"/sitemap.xml")
+	require.NoError(t, err)
+	locs := make([]string, 0, len(urls))
+	for _, u := range urls {
+		locs = append(locs, u.Loc)
+	}
+	require.Equal(t, []string{"https://example.com/posts/2/", "https://example.com/posts/1/", "https://example.com/about/", "https://example.com/posts/0/"}, locs)
+	require.Equal(t, time.Date(2020, 3, 3, 10, 0, 0, 0, time.UTC), urls[0].LastMod.UTC())
+
+	// Only pages modified after the given time (or without lastmod) should be
+	// returned:
+	urls, err = sitemap.Fetch(ctx, srv.URL+"/sitemap.xml", func(o *sitemap.Options) {
+		o.Since = time.Date(2020, 3, 2, 0, 0, 0, 0, time.UTC)
+	})
+	require.NoError(t, err)
+	require.Len(t, urls, 2)
+	require.Equal(t, "https://example.com/posts/2/", urls[0].Loc)
+	require.Equal(t, "https://example.com/about/", urls[1].Loc)
+
+	_, err = sitemap.Fetch(ctx, srv.URL+"/missing.xml")
+	require.Error(t, err)
+}
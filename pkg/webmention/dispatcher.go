@@ -0,0 +1,135 @@
+package webmention
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"sync"
+)
+
+// ErrNoEndpoint is reported if a target exposes neither a Webmention
+// nor a usable Pingback endpoint.
+var ErrNoEndpoint = errors.New("no webmention endpoint found")
+
+// DispatcherConfiguration allows to configure a new Dispatcher.
+type DispatcherConfiguration struct {
+	// Concurrency limits the number of mentions processed in parallel.
+	Concurrency int
+	// PerHostConcurrency limits the number of mentions processed in
+	// parallel for targets on the same host.
+	PerHostConcurrency int
+	Discoverer         EndpointDiscoverer
+	Sender             Sender
+}
+
+// DispatcherConfigurator is passed to NewDispatcher to configure it.
+type DispatcherConfigurator func(*DispatcherConfiguration)
+
+// DispatchResult contains the outcome of sending a single mention.
+type DispatchResult struct {
+	Mention Mention
+	// Protocol is either ProtocolWebmention or ProtocolPingback
+	// depending on the endpoint used.
+	Protocol string
+	Endpoint string
+	Err      error
+}
+
+// Dispatcher discovers endpoints and sends mentions concurrently while
+// limiting the number of requests in total and per target host. A
+// single dispatcher can be used from multiple goroutines at once.
+type Dispatcher struct {
+	cfg       DispatcherConfiguration
+	slots     chan struct{}
+	hostSlots map[string]chan struct{}
+	lock      sync.Mutex
+}
+
+// NewDispatcher creates a new Dispatcher. By default at most 4
+// mentions are sent in parallel and only one at a time per host.
+func NewDispatcher(configurators ...DispatcherConfigurator) *Dispatcher {
+	cfg := DispatcherConfiguration{
+		Concurrency:        4,
+		PerHostConcurrency: 1,
+	}
+	for _, c := range configurators {
+		c(&cfg)
+	}
+	if cfg.Concurrency < 1 {
+		cfg.Concurrency = 1
+	}
+	if cfg.PerHostConcurrency < 1 {
+		cfg.PerHostConcurrency = 1
+	}
+	if cfg.Discoverer == nil {
+		cfg.Discoverer = NewEndpointDiscoverer()
+	}
+	if cfg.Sender == nil {
+		cfg.Sender = NewSender()
+	}
+	return &Dispatcher{
+		cfg:       cfg,
+		slots:     make(chan struct{}, cfg.Concurrency),
+		hostSlots: make(map[string]chan struct{}),
+	}
+}
+
+func (d *Dispatcher) hostSlot(target string) chan struct{} {
+	host := target
+	if u, err := url.Parse(target); err == nil {
+		host = u.Host
+	}
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	slot, ok := d.hostSlots[host]
+	if !ok {
+		slot = make(chan struct{}, d.cfg.PerHostConcurrency)
+		d.hostSlots[host] = slot
+	}
+	return slot
+}
+
+// Dispatch sends all the given mentions and returns their results in
+// the same order once all of them have been processed.
+func (d *Dispatcher) Dispatch(ctx context.Context, mentions []Mention) []DispatchResult {
+	results := make([]DispatchResult, len(mentions))
+	var wg sync.WaitGroup
+	for idx, m := range mentions {
+		wg.Add(1)
+		go func(idx int, m Mention) {
+			defer wg.Done()
+			results[idx] = d.dispatch(ctx, m)
+		}(idx, m)
+	}
+	wg.Wait()
+	return results
+}
+
+func (d *Dispatcher) dispatch(ctx context.Context, m Mention) DispatchResult {
+	res := DispatchResult{Mention: m}
+	hostSlot := d.hostSlot(m.Target)
+	// The host slot is acquired first so that mentions waiting for a busy
+	// host don't block mentions for other hosts.
+	select {
+	case hostSlot <- struct{}{}:
+	case <-ctx.Done():
+		res.Err = ctx.Err()
+		return res
+	}
+	defer func() { <-hostSlot }()
+	select {
+	case d.slots <- struct{}{}:
+	case <-ctx.Done():
+		res.Err = ctx.Err()
+		return res
+	}
+	defer func() { <-d.slots }()
+
+	endpoints, err := discoverEndpoints(ctx, d.cfg.Discoverer, m.Target)
+	if err != nil {
+		res.Err = err
+		return res
+	}
+	res.Protocol, res.Endpoint, res.Err = SendWithFallback(ctx, d.cfg.Sender, endpoints, m)
+	return res
+}
@@ -0,0 +1,78 @@
+package webmention_test
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/zerok/webmentiond/pkg/webmention"
+)
+
+type staticDiscoverer struct{}
+
+func (d *staticDiscoverer) DiscoverEndpoint(ctx context.Context, u string) (string, error) {
+	pu, _ := url.Parse(u)
+	if pu.Host == "none.com" {
+		return "", nil
+	}
+	return "https://" + pu.Host + "/endpoint", nil
+}
+
+type countingSender struct {
+	lock       sync.Mutex
+	active     map[string]int
+	maxPerHost int
+	maxTotal   int
+	total      int
+}
+
+func (s *countingSender) Send(ctx context.Context, endpoint string, mention webmention.Mention) error {
+	s.lock.Lock()
+	s.active[endpoint]++
+	s.total++
+	s.maxPerHost = max(s.maxPerHost, s.active[endpoint])
+	s.maxTotal = max(s.maxTotal, s.total)
+	s.lock.Unlock()
+	time.Sleep(time.Millisecond * 5)
+	s.lock.Lock()
+	s.active[endpoint]--
+	s.total--
+	s.lock.Unlock()
+	if mention.Target == "https://fail.com/" {
+		return fmt.Errorf("failed")
+	}
+	return nil
+}
+
+func TestDispatcher(t *testing.T) {
+	sender := &countingSender{active: make(map[string]int)}
+	d := webmention.NewDispatcher(func(c *webmention.DispatcherConfiguration) {
+		c.Concurrency = 3
+		c.PerHostConcurrency = 2
+		c.Discoverer = &staticDiscoverer{}
+		c.Sender = sender
+	})
+	mentions := make([]webmention.Mention, 0, 20)
+	for i := 0; i < 6; i++ {
+		mentions = append(mentions, webmention.Mention{Source: "https://source.com", Target: fmt.Sprintf("https://a.com/%d", i)})
+		mentions = append(mentions, webmention.Mention{Source: "https://source.com", Target: fmt.Sprintf("https://b.com/%d", i)})
+	}
+	mentions = append(mentions, webmention.Mention{Source: "https://source.com", Target: "https://none.com/"})
+	mentions = append(mentions, webmention.Mention{Source: "https://source.com", Target: "https://fail.com/"})
+
+	results := d.Dispatch(context.Background(), mentions)
+	require.Len(t, results, len(mentions))
+	for idx, res := range results {
+		require.Equal(t, mentions[idx], res.Mention)
+	}
+	require.NoError(t, results[0].Err)
+	require.Equal(t, "https://a.com/endpoint", results[0].Endpoint)
+	require.ErrorIs(t, results[12].Err, webmention.ErrNoEndpoint)
+	require.Error(t, results[13].Err)
+	require.LessOrEqual(t, sender.maxPerHost, 2)
+	require.LessOrEqual(t, sender.maxTotal, 3)
+}
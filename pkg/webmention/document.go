@@ -2,41 +2,286 @@ package webmention
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"io"
 	"net/http"
 	"net/url"
+	"strings"
 
 	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+	"willnorris.com/go/microformats"
 )
 
+// ErrGone is returned by DocumentFromURL if the document has been
+// deleted and the server responded with 410 Gone.
+var ErrGone = errors.New("document is gone")
+
+// Document represents an HTML document that might link to other
+// documents that should receive a mention.
 type Document struct {
 	u     *url.URL
 	title string
+	// links contains all absolute, normalized and de-duplicated URLs
+	// referenced by the document through anchors or media elements.
 	links []string
+	// excluded contains all links that are marked with rel=nofollow or
+	// are placed inside an element with a data-no-webmention attribute.
+	excluded map[string]struct{}
+	// included contains all links that are present at least once
+	// without being marked as excluded.
+	included map[string]struct{}
+	mf       *microformats.Data
+}
+
+// URL returns the URL of the document. If the document was retrieved
+// through redirects, this is the final URL.
+func (d *Document) URL() string {
+	return d.u.String()
+}
+
+// Title returns the content of the document's title element.
+func (d *Document) Title() string {
+	return d.title
+}
+
+// HEntry returns the first h-entry found inside the document or nil
+// if there is none.
+func (d *Document) HEntry() *microformats.Microformat {
+	return findHEntry(d.mf)
 }
 
+// Links returns all absolute URLs that are referenced by the document
+// through anchors or img, video, audio, and source elements.
 func (d *Document) Links() []string {
 	return d.links
 }
 
+// ExternalLinks returns all HTTP(S) links that point to another host.
+// Hosts are compared ignoring case, default ports, and a "www."
+// prefix.
 func (d *Document) ExternalLinks() []string {
 	es := make([]string, 0, 10)
 	for _, l := range d.links {
-		lu, err := url.Parse(l)
-		if err != nil || lu == nil {
-			continue
+		if d.isExternal(l) {
+			es = append(es, l)
 		}
-		if lu.Scheme != "http" && lu.Scheme != "https" {
+	}
+	return es
+}
+
+// TargetSelectionOptions configure which links of a document are
+// considered as targets for sending mentions.
+type TargetSelectionOptions struct {
+	// EntryOnly restricts the targets to links inside the e-content of
+	// the document's h-entry and its in-reply-to, like-of, repost-of
+	// and bookmark-of properties.
+	EntryOnly bool
+	// ExcludeHosts contains hostnames that should never receive a
+	// mention. Subdomains of these hosts are excluded as well.
+	ExcludeHosts []string
+}
+
+// TargetSelectionConfigurator is passed to Document.Targets in order
+// to configure the target selection.
+type TargetSelectionConfigurator func(*TargetSelectionOptions)
+
+// entryProperties are the h-entry properties whose URLs are always
+// considered targets if EntryOnly is set.
+var entryProperties = []string{"in-reply-to", "like-of", "repost-of", "bookmark-of"}
+
+// Targets returns all external links of the document that should
+// receive a mention. Links marked with rel=nofollow or placed inside
+// an element with a data-no-webmention attribute are skipped.
+func (d *Document) Targets(configurators ...TargetSelectionConfigurator) []string {
+	opts := &TargetSelectionOptions{}
+	for _, c := range configurators {
+		c(opts)
+	}
+	var candidates []string
+	if opts.EntryOnly {
+		candidates = d.entryLinks()
+	} else {
+		candidates = d.ExternalLinks()
+	}
+	result := make([]string, 0, len(candidates))
+	seen := make(map[string]struct{})
+	for _, c := range candidates {
+		if _, ok := seen[c]; ok {
 			continue
 		}
-		if lu.Host == d.u.Host {
+		seen[c] = struct{}{}
+		if _, ok := d.excluded[c]; ok {
+			if _, ok := d.included[c]; !ok {
+				continue
+			}
+		}
+		if isExcludedHost(c, opts.ExcludeHosts) {
 			continue
 		}
-		es = append(es, l)
+		result = append(result, c)
 	}
-	return es
+	return result
 }
 
+func isExcludedHost(link string, hosts []string) bool {
+	lu, err := url.Parse(link)
+	if err != nil {
+		return true
+	}
+	host := strings.ToLower(lu.Hostname())
+	for _, h := range hosts {
+		h = strings.ToLower(h)
+		if host == h || strings.HasSuffix(host, "."+h) {
+			return true
+		}
+	}
+	return false
+}
+
+// entryLinks returns the external links that are part of the e-content
+// of the document's h-entry as well as the URLs referenced by its
+// response properties.
+func (d *Document) entryLinks() []string {
+	entry := findHEntry(d.mf)
+	if entry == nil {
+		return []string{}
+	}
+	inEntry := make(map[string]struct{})
+	result := make([]string, 0, 10)
+	for _, prop := range entryProperties {
+		for _, u := range mfURLs(entry.Properties[prop]) {
+			link, err := resolveLink(d.u, u)
+			if err == nil && d.isExternal(link) {
+				result = append(result, link)
+			}
+		}
+	}
+	if contents, ok := entry.Properties["content"]; ok {
+		for _, c := range contents {
+			content, ok := c.(map[string]string)
+			if !ok {
+				continue
+			}
+			node, err := html.Parse(strings.NewReader(content["html"]))
+			if err != nil {
+				continue
+			}
+			walkElements(node, func(n *html.Node) bool {
+				if ref := linkAttr(n); ref != "" {
+					if link, err := resolveLink(d.u, attr(n, ref)); err == nil {
+						inEntry[link] = struct{}{}
+					}
+				}
+				return true
+			})
+		}
+	}
+	for _, l := range d.ExternalLinks() {
+		if _, ok := inEntry[l]; ok {
+			result = append(result, l)
+		}
+	}
+	return result
+}
+
+func (d *Document) isExternal(link string) bool {
+	lu, err := url.Parse(link)
+	if err != nil {
+		return false
+	}
+	if lu.Scheme != "http" && lu.Scheme != "https" {
+		return false
+	}
+	return siteHost(lu) != siteHost(d.u)
+}
+
+// siteHost returns the host of the given URL in a form that can be used
+// to check if two URLs belong to the same site.
+func siteHost(u *url.URL) string {
+	host := strings.ToLower(u.Hostname())
+	host = strings.TrimPrefix(host, "www.")
+	port := u.Port()
+	if port == "" || (u.Scheme == "http" && port == "80") || (u.Scheme == "https" && port == "443") {
+		return host
+	}
+	return host + ":" + port
+}
+
+// resolveLink turns the given reference into an absolute URL relative
+// to base and normalizes it: Scheme and host are lower-cased, default
+// ports and fragments removed.
+func resolveLink(base *url.URL, ref string) (string, error) {
+	ru, err := url.Parse(strings.TrimSpace(ref))
+	if err != nil {
+		return "", err
+	}
+	u := base.ResolveReference(ru)
+	u.Scheme = strings.ToLower(u.Scheme)
+	u.Host = strings.ToLower(u.Host)
+	if (u.Scheme == "http" && u.Port() == "80") || (u.Scheme == "https" && u.Port() == "443") {
+		u.Host = u.Hostname()
+	}
+	u.Fragment = ""
+	u.RawFragment = ""
+	return u.String(), nil
+}
+
+// linkAttr returns the name of the attribute holding the referenced
+// URL if the given node is an element that can be the target of a
+// mention.
+func linkAttr(n *html.Node) string {
+	switch n.DataAtom {
+	case atom.A:
+		return "href"
+	case atom.Img, atom.Video, atom.Audio, atom.Source:
+		return "src"
+	}
+	return ""
+}
+
+func findHEntry(data *microformats.Data) *microformats.Microformat {
+	if data == nil {
+		return nil
+	}
+	var find func(items []*microformats.Microformat) *microformats.Microformat
+	find = func(items []*microformats.Microformat) *microformats.Microformat {
+		for _, item := range items {
+			if mfHasType(item, "h-entry") {
+				return item
+			}
+			if found := find(item.Children); found != nil {
+				return found
+			}
+		}
+		return nil
+	}
+	return find(data.Items)
+}
+
+// mfURLs returns the URLs of property values that are either plain
+// URLs or embedded microformats like h-cite with a url property.
+func mfURLs(values []interface{}) []string {
+	result := make([]string, 0, len(values))
+	for _, v := range values {
+		switch value := v.(type) {
+		case string:
+			result = append(result, value)
+		case *microformats.Microformat:
+			if urls, ok := value.Properties["url"]; ok && len(urls) > 0 {
+				if u, ok := urls[0].(string); ok {
+					result = append(result, u)
+				}
+			}
+		}
+	}
+	return result
+}
+
+// DocumentFromURL retrieves the given URL and parses the response.
+// Redirects are followed and the final URL is used to resolve relative
+// links. If the server responds with 410 Gone, ErrGone is returned.
 func DocumentFromURL(ctx context.Context, u string) (*Document, error) {
 	client := http.Client{}
 	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
@@ -48,40 +293,117 @@ func DocumentFromURL(ctx context.Context, u string) (*Document, error) {
 		return nil, err
 	}
 	defer resp.Body.Close()
-	return DocumentFromReader(ctx, resp.Body, u)
+	if resp.StatusCode == http.StatusGone {
+		return nil, ErrGone
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, fmt.Errorf("unexpected status code returned: %v", resp.StatusCode)
+	}
+	return DocumentFromReader(ctx, resp.Body, resp.Request.URL.String())
 }
 
+// DocumentFromReader parses the HTML document provided by reader. u is
+// the URL the document was retrieved from and is used to resolve
+// relative links unless the document specifies a base URL itself.
 func DocumentFromReader(ctx context.Context, reader io.Reader, u string) (*Document, error) {
 	pu, err := url.Parse(u)
 	if err != nil {
 		return nil, err
 	}
 	doc := &Document{
-		u:     pu,
-		links: make([]string, 0, 10),
-	}
-	tokenizer := html.NewTokenizer(reader)
-loop:
-	for {
-		tt := tokenizer.Next()
-		switch tt {
-		case html.ErrorToken:
-			err := tokenizer.Err()
-			if err == io.EOF {
-				break loop
+		u:        pu,
+		links:    make([]string, 0, 10),
+		excluded: make(map[string]struct{}),
+		included: make(map[string]struct{}),
+	}
+	root, err := html.Parse(reader)
+	if err != nil {
+		return nil, err
+	}
+	type rawLink struct {
+		ref      string
+		excluded bool
+	}
+	rawLinks := make([]rawLink, 0, 10)
+	base := pu
+	baseFound := false
+	var walk func(n *html.Node, noWebmention bool)
+	walk = func(n *html.Node, noWebmention bool) {
+		if n.Type == html.ElementNode {
+			noWebmention = noWebmention || hasAttr(n, "data-no-webmention")
+			switch n.DataAtom {
+			case atom.Base:
+				if href := attr(n, "href"); href != "" && !baseFound {
+					if bu, err := url.Parse(href); err == nil {
+						base = pu.ResolveReference(bu)
+						baseFound = true
+					}
+				}
+			case atom.Title:
+				if doc.title == "" && n.FirstChild != nil {
+					doc.title = strings.TrimSpace(n.FirstChild.Data)
+				}
 			}
-			return nil, err
-		case html.SelfClosingTagToken:
-			fallthrough
-		case html.StartTagToken:
-			name, _ := tokenizer.TagName()
-			if string(name) == "a" {
-				link := getAttr(tokenizer, "href")
-				if link != "" {
-					doc.links = append(doc.links, link)
+			if ref := linkAttr(n); ref != "" {
+				if link := attr(n, ref); link != "" {
+					rawLinks = append(rawLinks, rawLink{
+						ref:      link,
+						excluded: noWebmention || (n.DataAtom == atom.A && hasRel(attr(n, "rel"), "nofollow")),
+					})
 				}
 			}
 		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c, noWebmention)
+		}
+	}
+	walk(root, false)
+	seen := make(map[string]struct{})
+	for _, raw := range rawLinks {
+		link, err := resolveLink(base, raw.ref)
+		if err != nil {
+			continue
+		}
+		if raw.excluded {
+			doc.excluded[link] = struct{}{}
+		} else {
+			doc.included[link] = struct{}{}
+		}
+		if _, ok := seen[link]; ok {
+			continue
+		}
+		seen[link] = struct{}{}
+		doc.links = append(doc.links, link)
 	}
+	// The microformats parser rewrites the URLs inside the node tree and
+	// therefore has to run after the links have been collected.
+	doc.mf = microformats.ParseNode(root, base)
 	return doc, nil
 }
+
+func walkElements(n *html.Node, fn func(*html.Node) bool) {
+	if n.Type == html.ElementNode && !fn(n) {
+		return
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		walkElements(c, fn)
+	}
+}
+
+func attr(n *html.Node, name string) string {
+	for _, a := range n.Attr {
+		if a.Key == name {
+			return a.Val
+		}
+	}
+	return ""
+}
+
+func hasAttr(n *html.Node, name string) bool {
+	for _, a := range n.Attr {
+		if a.Key == name {
+			return true
+		}
+	}
+	return false
+}
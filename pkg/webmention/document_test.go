@@ -31,3 +31,92 @@ func TestDocumentFromReader(t *testing.T) {
 	require.Equal(t, doc.Links(), []string{"https://test1.com", "https://test2.com"})
 	require.Equal(t, doc.ExternalLinks(), []string{"https://test2.com"})
 }
+
+func TestDocumentTargets(t *testing.T) {
+	fp, err := os.Open("testdata/entry.html")
+	require.NoError(t, err)
+	defer fp.Close()
+	doc, err := webmention.DocumentFromReader(context.Background(), fp, "https://source.com/entry")
+	require.NoError(t, err)
+
+	// By default all external links are considered except for those that
+	// are explicitly marked as not to be mentioned:
+	require.Equal(t, []string{
+		"https://blogroll.com/",
+		"https://social.example.org/@me",
+		"https://reply.com/post",
+		"https://content.com/",
+		"https://sub.excluded.com/",
+		"https://liked.com/post",
+	}, doc.Targets())
+
+	// Only looking at the h-entry should skip the navigation:
+	require.Equal(t, []string{
+		"https://reply.com/post",
+		"https://liked.com/post",
+		"https://content.com/",
+	}, doc.Targets(func(o *webmention.TargetSelectionOptions) {
+		o.EntryOnly = true
+		o.ExcludeHosts = []string{"excluded.com"}
+	}))
+}
+
+func TestDocumentLinkNormalization(t *testing.T) {
+	fp, err := os.Open("testdata/relative.html")
+	require.NoError(t, err)
+	defer fp.Close()
+	doc, err := webmention.DocumentFromReader(context.Background(), fp, "https://source.com/blog/entry")
+	require.NoError(t, err)
+	require.Equal(t, []string{
+		"https://source.com/blog/post-1",
+		"https://source.com/about",
+		"https://www.source.com/contact",
+		"https://other.com/page",
+		"https://other.com:8443/page",
+		"mailto:someone@example.com",
+		"https://images.com/image.png",
+		"https://videos.com/video.mp4",
+		"https://videos.com/video.webm",
+		"https://source.com/audio.mp3",
+	}, doc.Links())
+	require.Equal(t, []string{
+		"https://other.com/page",
+		"https://other.com:8443/page",
+		"https://images.com/image.png",
+		"https://videos.com/video.mp4",
+		"https://videos.com/video.webm",
+	}, doc.ExternalLinks())
+	require.Equal(t, "Relative links", doc.Title())
+	require.NotNil(t, doc.HEntry())
+	require.Equal(t, []interface{}{"Entry name"}, doc.HEntry().Properties["name"])
+}
+
+func TestDocumentFromURLFollowsRedirects(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/old", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/new/", http.StatusMovedPermanently)
+	})
+	mux.HandleFunc("/new/", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`<a href="page">Page</a>`))
+	})
+	mux.HandleFunc("/missing", func(w http.ResponseWriter, r *http.Request) {
+		http.NotFound(w, r)
+	})
+	mux.HandleFunc("/gone", func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "Gone", http.StatusGone)
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+	ctx := context.Background()
+
+	doc, err := webmention.DocumentFromURL(ctx, srv.URL+"/old")
+	require.NoError(t, err)
+	require.Equal(t, srv.URL+"/new/", doc.URL())
+	require.Equal(t, []string{srv.URL + "/new/page"}, doc.Links())
+
+	_, err = webmention.DocumentFromURL(ctx, srv.URL+"/missing")
+	require.Error(t, err)
+
+	_, err = webmention.DocumentFromURL(ctx, srv.URL+"/gone")
+	require.ErrorIs(t, err, webmention.ErrGone)
+}
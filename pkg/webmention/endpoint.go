@@ -28,6 +28,26 @@ type EndpointDiscoverer interface {
 	DiscoverEndpoint(ctx context.Context, url string) (string, error)
 }
 
+// Endpoints lists all the endpoints a URL exposes for receiving
+// mentions. Empty fields indicate that no such endpoint was found.
+type Endpoints struct {
+	Webmention string
+	Pingback   string
+}
+
+// Empty returns true if neither a Webmention nor a Pingback endpoint
+// was found.
+func (e Endpoints) Empty() bool {
+	return e.Webmention == "" && e.Pingback == ""
+}
+
+// EndpointsDiscoverer also reports Pingback endpoints which can be
+// used as fallback if a URL doesn't support Webmention.
+type EndpointsDiscoverer interface {
+	EndpointDiscoverer
+	DiscoverEndpoints(ctx context.Context, url string) (Endpoints, error)
+}
+
 type simpleEndpointDiscoverer struct {
 	client *http.Client
 }
@@ -35,15 +55,25 @@ type simpleEndpointDiscoverer struct {
 var linkHeaderRe = regexp.MustCompile("<([^>]+)>;\\s*rel=\"?webmention\"?")
 
 func (ed *simpleEndpointDiscoverer) DiscoverEndpoint(ctx context.Context, u string) (string, error) {
+	endpoints, err := ed.DiscoverEndpoints(ctx, u)
+	if err != nil {
+		return "", err
+	}
+	return endpoints.Webmention, nil
+}
+
+func (ed *simpleEndpointDiscoverer) DiscoverEndpoints(ctx context.Context, u string) (Endpoints, error) {
 	logger := zerolog.Ctx(ctx)
+	result := Endpoints{}
 	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
 	if err != nil {
-		return "", err
+		return result, err
 	}
 	resp, err := ed.client.Do(req)
 	if err != nil {
-		return "", err
+		return result, err
 	}
+	defer resp.Body.Close()
 	var endpointCandidate string
 	var candidateFound bool
 	logger.Debug().Msg("Checking for endpoint in header")
@@ -55,7 +85,8 @@ func (ed *simpleEndpointDiscoverer) DiscoverEndpoint(ctx context.Context, u stri
 			break
 		}
 	}
-	if !candidateFound {
+	pingbackCandidate := strings.TrimSpace(resp.Header.Get("X-Pingback"))
+	if !candidateFound || pingbackCandidate == "" {
 		logger.Debug().Msg("Checking for endpoint in content")
 		tokenizer := html.NewTokenizer(resp.Body)
 	tokenloop:
@@ -67,7 +98,7 @@ func (ed *simpleEndpointDiscoverer) DiscoverEndpoint(ctx context.Context, u stri
 				if err == io.EOF {
 					break tokenloop
 				}
-				return "", err
+				return result, err
 			case html.SelfClosingTagToken:
 				fallthrough
 			case html.EndTagToken:
@@ -95,22 +126,36 @@ func (ed *simpleEndpointDiscoverer) DiscoverEndpoint(ctx context.Context, u stri
 							break
 						}
 					}
-					if hrefPresent && isCorrectRel(rel) {
+					if hrefPresent && !candidateFound && hasRel(rel, "webmention") {
 						endpointCandidate = href
 						candidateFound = true
+					}
+					if string(tn) == "link" && pingbackCandidate == "" && hasRel(rel, "pingback") {
+						pingbackCandidate = strings.TrimSpace(href)
+					}
+					if candidateFound && pingbackCandidate != "" {
 						break tokenloop
 					}
 				}
 			}
 		}
-		defer resp.Body.Close()
 	}
 	if endpointCandidate == "" && candidateFound {
 		endpointCandidate = u
 	}
-	if strings.HasPrefix(endpointCandidate, "/") {
-		baseURL := *req.URL
-		path, err := url.Parse(endpointCandidate)
+	if result.Webmention, err = resolveEndpoint(req.URL, endpointCandidate); err != nil {
+		return result, err
+	}
+	if result.Pingback, err = resolveEndpoint(req.URL, pingbackCandidate); err != nil {
+		return result, err
+	}
+	return result, nil
+}
+
+func resolveEndpoint(base *url.URL, endpoint string) (string, error) {
+	if strings.HasPrefix(endpoint, "/") {
+		baseURL := *base
+		path, err := url.Parse(endpoint)
 		if err != nil {
 			return "", err
 		}
@@ -118,13 +163,13 @@ func (ed *simpleEndpointDiscoverer) DiscoverEndpoint(ctx context.Context, u stri
 		baseURL.RawQuery = path.RawQuery
 		return baseURL.String(), nil
 	}
-	return endpointCandidate, nil
+	return endpoint, nil
 }
 
-func isCorrectRel(rel string) bool {
+func hasRel(rel string, expected string) bool {
 	rels := strings.Split(rel, " ")
 	for _, r := range rels {
-		if strings.TrimSpace(r) == "webmention" {
+		if strings.TrimSpace(r) == expected {
 			return true
 		}
 	}
@@ -133,7 +178,7 @@ func isCorrectRel(rel string) bool {
 
 // NewEndpointDiscoverer creates a new EndpointDiscoverer configured
 // with the given configurators.
-func NewEndpointDiscoverer(configurators ...EndpointDiscoveryConfigurator) EndpointDiscoverer {
+func NewEndpointDiscoverer(configurators ...EndpointDiscoveryConfigurator) EndpointsDiscoverer {
 	cfg := &EndpointDiscoveryConfiguration{
 		HTTPClient: &http.Client{},
 	}
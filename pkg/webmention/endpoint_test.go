@@ -170,4 +170,44 @@ func TestDiscoverEndpoint(t *testing.T) {
 		require.NoError(t, err)
 		require.Equal(t, srv.URL+"/endpoint/", discovered)
 	})
+
+	t.Run("discover pingback endpoints", func(t *testing.T) {
+		ctx := context.Background()
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "text/html")
+			if r.URL.Path == "/header" {
+				w.Header().Set("X-Pingback", "https://example.com/xmlrpc.php")
+			}
+			w.WriteHeader(200)
+			fmt.Fprintf(w, "<html><head><link rel=\"pingback\" href=\"/xmlrpc.php\"></head><body></body></html>")
+		}))
+		disc := webmention.NewEndpointDiscoverer(func(c *webmention.EndpointDiscoveryConfiguration) {
+			c.HTTPClient = srv.Client()
+		})
+		discovered, err := disc.DiscoverEndpoints(ctx, srv.URL+"/header")
+		require.NoError(t, err)
+		require.Equal(t, webmention.Endpoints{Pingback: "https://example.com/xmlrpc.php"}, discovered)
+		discovered, err = disc.DiscoverEndpoints(ctx, srv.URL+"/content")
+		require.NoError(t, err)
+		require.Equal(t, webmention.Endpoints{Pingback: srv.URL + "/xmlrpc.php"}, discovered)
+		ep, err := disc.DiscoverEndpoint(ctx, srv.URL+"/content")
+		require.NoError(t, err)
+		require.Empty(t, ep)
+	})
+
+	t.Run("discover webmention and pingback endpoints", func(t *testing.T) {
+		ctx := context.Background()
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "text/html")
+			w.Header().Set("Link", "</endpoint/>; rel=\"webmention\"")
+			w.WriteHeader(200)
+			fmt.Fprintf(w, "<html><head><link rel=\"pingback\" href=\"/xmlrpc.php\"></head><body></body></html>")
+		}))
+		disc := webmention.NewEndpointDiscoverer(func(c *webmention.EndpointDiscoveryConfiguration) {
+			c.HTTPClient = srv.Client()
+		})
+		discovered, err := disc.DiscoverEndpoints(ctx, srv.URL)
+		require.NoError(t, err)
+		require.Equal(t, webmention.Endpoints{Webmention: srv.URL + "/endpoint/", Pingback: srv.URL + "/xmlrpc.php"}, discovered)
+	})
 }
@@ -0,0 +1,253 @@
+package webmention
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/rs/zerolog"
+)
+
+// Protocols that can be used for sending mentions.
+const (
+	ProtocolWebmention = "webmention"
+	ProtocolPingback   = "pingback"
+)
+
+// PingbackFault is returned if a Pingback endpoint responds with an
+// XML-RPC fault. The codes are defined in
+// <http://www.hixie.ch/specs/pingback/pingback#return>.
+type PingbackFault struct {
+	Code    int
+	Message string
+}
+
+func (f *PingbackFault) Error() string {
+	return fmt.Sprintf("pingback fault %d: %s", f.Code, f.Message)
+}
+
+// PingbackSender sends mentions using the XML-RPC based Pingback
+// protocol.
+type PingbackSender interface {
+	SendPingback(ctx context.Context, endpoint string, mention Mention) error
+}
+
+type xmlrpcValue struct {
+	Text   string        `xml:",chardata"`
+	String *string       `xml:"string"`
+	Int    *string       `xml:"int"`
+	I4     *string       `xml:"i4"`
+	Struct *xmlrpcStruct `xml:"struct"`
+}
+
+// string returns the string representation of scalar values.
+func (v xmlrpcValue) string() string {
+	switch {
+	case v.String != nil:
+		return *v.String
+	case v.Int != nil:
+		return strings.TrimSpace(*v.Int)
+	case v.I4 != nil:
+		return strings.TrimSpace(*v.I4)
+	}
+	return v.Text
+}
+
+type xmlrpcStruct struct {
+	Members []xmlrpcMember `xml:"member"`
+}
+
+func (s *xmlrpcStruct) member(name string) xmlrpcValue {
+	for _, m := range s.Members {
+		if m.Name == name {
+			return m.Value
+		}
+	}
+	return xmlrpcValue{}
+}
+
+type xmlrpcMember struct {
+	Name  string      `xml:"name"`
+	Value xmlrpcValue `xml:"value"`
+}
+
+type xmlrpcParam struct {
+	Value xmlrpcValue `xml:"value"`
+}
+
+type xmlrpcMethodCall struct {
+	XMLName    xml.Name      `xml:"methodCall"`
+	MethodName string        `xml:"methodName"`
+	Params     []xmlrpcParam `xml:"params>param"`
+}
+
+type xmlrpcMethodResponse struct {
+	XMLName xml.Name      `xml:"methodResponse"`
+	Params  []xmlrpcParam `xml:"params>param"`
+	Fault   *struct {
+		Value xmlrpcValue `xml:"value"`
+	} `xml:"fault"`
+}
+
+func stringParam(value string) xmlrpcParam {
+	return xmlrpcParam{Value: xmlrpcValue{String: &value}}
+}
+
+func (s *simpleSender) SendPingback(ctx context.Context, endpoint string, mention Mention) error {
+	logger := zerolog.Ctx(ctx)
+	call := xmlrpcMethodCall{
+		MethodName: "pingback.ping",
+		Params:     []xmlrpcParam{stringParam(mention.Source), stringParam(mention.Target)},
+	}
+	body := bytes.NewBufferString(xml.Header)
+	if err := xml.NewEncoder(body).Encode(call); err != nil {
+		return err
+	}
+	r, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, body)
+	if err != nil {
+		return err
+	}
+	logger.Debug().Msgf("Sending pingback: %v", r)
+	r.Header.Set("Content-Type", "text/xml")
+	resp, err := s.client.Do(r)
+	if err != nil {
+		return fmt.Errorf("pingback request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status code returned: %v", resp.StatusCode)
+	}
+	result := xmlrpcMethodResponse{}
+	if err := xml.NewDecoder(io.LimitReader(resp.Body, 1024*1024)).Decode(&result); err != nil {
+		return fmt.Errorf("invalid pingback response: %w", err)
+	}
+	if result.Fault != nil {
+		fault := &PingbackFault{}
+		if s := result.Fault.Value.Struct; s != nil {
+			fault.Code, _ = strconv.Atoi(s.member("faultCode").string())
+			fault.Message = s.member("faultString").string()
+		}
+		return fault
+	}
+	return nil
+}
+
+// SendWithFallback sends the mention to the Webmention endpoint if
+// there is one. Otherwise it falls back to Pingback if the sender
+// supports it. The protocol and endpoint used are returned.
+// ErrNoEndpoint is returned if none of the endpoints can be used.
+func SendWithFallback(ctx context.Context, sender Sender, endpoints Endpoints, mention Mention) (string, string, error) {
+	if endpoints.Webmention != "" {
+		return ProtocolWebmention, endpoints.Webmention, sender.Send(ctx, endpoints.Webmention, mention)
+	}
+	if ps, ok := sender.(PingbackSender); ok && endpoints.Pingback != "" {
+		return ProtocolPingback, endpoints.Pingback, ps.SendPingback(ctx, endpoints.Pingback, mention)
+	}
+	return "", "", ErrNoEndpoint
+}
+
+// discoverEndpoints uses the given discoverer to look up all endpoints
+// if it supports that and only the Webmention endpoint otherwise.
+func discoverEndpoints(ctx context.Context, d EndpointDiscoverer, u string) (Endpoints, error) {
+	if ed, ok := d.(EndpointsDiscoverer); ok {
+		return ed.DiscoverEndpoints(ctx, u)
+	}
+	ep, err := d.DiscoverEndpoint(ctx, u)
+	return Endpoints{Webmention: ep}, err
+}
+
+// Fault codes defined by the Pingback specification as well as the
+// XML-RPC fault code interoperability specification.
+const (
+	PingbackFaultGeneric           = 0
+	PingbackFaultSourceNotFound    = 16
+	PingbackFaultSourceMissingLink = 17
+	PingbackFaultTargetNotFound    = 32
+	PingbackFaultTargetInvalid     = 33
+	PingbackFaultAlreadyRegistered = 48
+	PingbackFaultAccessDenied      = 49
+	PingbackFaultUpstreamError     = 50
+
+	XMLRPCFaultParseError     = -32700
+	XMLRPCFaultInvalidRequest = -32600
+	XMLRPCFaultMethodNotFound = -32601
+	XMLRPCFaultInvalidParams  = -32602
+)
+
+// ExtractPingback parses a pingback.ping XML-RPC call. All errors
+// returned are of type *PingbackFault.
+func ExtractPingback(r *http.Request) (*Mention, error) {
+	if r.Method != http.MethodPost {
+		return nil, &PingbackFault{Code: XMLRPCFaultInvalidRequest, Message: "XML-RPC requests have to use POST"}
+	}
+	defer r.Body.Close()
+	call := xmlrpcMethodCall{}
+	if err := xml.NewDecoder(io.LimitReader(r.Body, 1024*1024)).Decode(&call); err != nil {
+		return nil, &PingbackFault{Code: XMLRPCFaultParseError, Message: "parse error"}
+	}
+	if strings.TrimSpace(call.MethodName) != "pingback.ping" {
+		return nil, &PingbackFault{Code: XMLRPCFaultMethodNotFound, Message: fmt.Sprintf("method %s not supported", call.MethodName)}
+	}
+	if len(call.Params) != 2 {
+		return nil, &PingbackFault{Code: XMLRPCFaultInvalidParams, Message: "pingback.ping requires a source and a target"}
+	}
+	source := strings.TrimSpace(call.Params[0].Value.string())
+	target := strings.TrimSpace(call.Params[1].Value.string())
+	if !isAbsoluteURL(source) {
+		return nil, &PingbackFault{Code: PingbackFaultSourceNotFound, Message: "source is not a valid URL"}
+	}
+	if !isAbsoluteURL(target) {
+		return nil, &PingbackFault{Code: PingbackFaultTargetInvalid, Message: "target is not a valid URL"}
+	}
+	return &Mention{
+		Source: source,
+		Target: target,
+	}, nil
+}
+
+// WritePingbackResponse writes a successful XML-RPC response containing
+// the given message.
+func WritePingbackResponse(w http.ResponseWriter, message string) error {
+	return writeXMLRPC(w, xmlrpcMethodResponse{
+		Params: []xmlrpcParam{stringParam(message)},
+	})
+}
+
+// WritePingbackFault writes an XML-RPC fault response. Errors that are
+// not a *PingbackFault are reported as generic faults.
+func WritePingbackFault(w http.ResponseWriter, err error) error {
+	var fault *PingbackFault
+	if !errors.As(err, &fault) {
+		fault = &PingbackFault{Code: PingbackFaultGeneric, Message: err.Error()}
+	}
+	code := strconv.Itoa(fault.Code)
+	resp := xmlrpcMethodResponse{}
+	resp.Fault = &struct {
+		Value xmlrpcValue `xml:"value"`
+	}{
+		Value: xmlrpcValue{
+			Struct: &xmlrpcStruct{
+				Members: []xmlrpcMember{
+					{Name: "faultCode", Value: xmlrpcValue{Int: &code}},
+					{Name: "faultString", Value: xmlrpcValue{String: &fault.Message}},
+				},
+			},
+		},
+	}
+	return writeXMLRPC(w, resp)
+}
+
+func writeXMLRPC(w http.ResponseWriter, resp xmlrpcMethodResponse) error {
+	w.Header().Set("Content-Type", "text/xml; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	return xml.NewEncoder(w).Encode(resp)
+}
@@ -0,0 +1,114 @@
+package webmention_test
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/zerok/webmentiond/pkg/webmention"
+)
+
+func TestSendPingback(t *testing.T) {
+	var call struct {
+		MethodName string   `xml:"methodName"`
+		Params     []string `xml:"params>param>value>string"`
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "text/xml", r.Header.Get("Content-Type"))
+		call.Params = nil
+		require.NoError(t, xml.NewDecoder(r.Body).Decode(&call))
+		if call.Params[1] == "https://target.com/unknown" {
+			fmt.Fprint(w, `<?xml version="1.0"?>
+<methodResponse><fault><value><struct>
+<member><name>faultCode</name><value><int>32</int></value></member>
+<member><name>faultString</name><value><string>target does not exist</string></value></member>
+</struct></value></fault></methodResponse>`)
+			return
+		}
+		fmt.Fprint(w, `<?xml version="1.0"?><methodResponse><params><param><value>Thanks!</value></param></params></methodResponse>`)
+	}))
+	defer srv.Close()
+	ctx := context.Background()
+	sender := webmention.NewSender(func(c *webmention.SenderConfiguration) {
+		c.HTTPClient = srv.Client()
+	})
+
+	protocol, ep, err := webmention.SendWithFallback(ctx, sender, webmention.Endpoints{Pingback: srv.URL}, webmention.Mention{
+		Source: "https://source.com",
+		Target: "https://target.com",
+	})
+	require.NoError(t, err)
+	require.Equal(t, webmention.ProtocolPingback, protocol)
+	require.Equal(t, srv.URL, ep)
+	require.Equal(t, "pingback.ping", call.MethodName)
+	require.Equal(t, []string{"https://source.com", "https://target.com"}, call.Params)
+
+	_, _, err = webmention.SendWithFallback(ctx, sender, webmention.Endpoints{Pingback: srv.URL}, webmention.Mention{
+		Source: "https://source.com",
+		Target: "https://target.com/unknown",
+	})
+	var fault *webmention.PingbackFault
+	require.ErrorAs(t, err, &fault)
+	require.Equal(t, 32, fault.Code)
+	require.Equal(t, "target does not exist", fault.Message)
+
+	_, _, err = webmention.SendWithFallback(ctx, sender, webmention.Endpoints{}, webmention.Mention{})
+	require.ErrorIs(t, err, webmention.ErrNoEndpoint)
+}
+
+func TestExtractPingback(t *testing.T) {
+	call := func(body string) *http.Request {
+		return httptest.NewRequest(http.MethodPost, "/xmlrpc", strings.NewReader(body))
+	}
+	requireFault := func(t *testing.T, err error, code int) {
+		t.Helper()
+		var fault *webmention.PingbackFault
+		require.ErrorAs(t, err, &fault)
+		require.Equal(t, code, fault.Code)
+	}
+
+	m, err := webmention.ExtractPingback(call(`<?xml version="1.0"?>
+<methodCall><methodName>pingback.ping</methodName><params>
+<param><value><string>https://source.com</string></value></param>
+<param><value>https://target.com</value></param>
+</params></methodCall>`))
+	require.NoError(t, err)
+	require.Equal(t, "https://source.com", m.Source)
+	require.Equal(t, "https://target.com", m.Target)
+
+	_, err = webmention.ExtractPingback(httptest.NewRequest(http.MethodGet, "/xmlrpc", nil))
+	requireFault(t, err, webmention.XMLRPCFaultInvalidRequest)
+	_, err = webmention.ExtractPingback(call(`<methodCall>`))
+	requireFault(t, err, webmention.XMLRPCFaultParseError)
+	_, err = webmention.ExtractPingback(call(`<methodCall><methodName>system.listMethods</methodName></methodCall>`))
+	requireFault(t, err, webmention.XMLRPCFaultMethodNotFound)
+	_, err = webmention.ExtractPingback(call(`<methodCall><methodName>pingback.ping</methodName><params><param><value>https://source.com</value></param></params></methodCall>`))
+	requireFault(t, err, webmention.XMLRPCFaultInvalidParams)
+	_, err = webmention.ExtractPingback(call(`<methodCall><methodName>pingback.ping</methodName><params><param><value>source</value></param><param><value>https://target.com</value></param></params></methodCall>`))
+	requireFault(t, err, webmention.PingbackFaultSourceNotFound)
+	_, err = webmention.ExtractPingback(call(`<methodCall><methodName>pingback.ping</methodName><params><param><value>https://source.com</value></param><param><value>target</value></param></params></methodCall>`))
+	requireFault(t, err, webmention.PingbackFaultTargetInvalid)
+}
+
+func TestWritePingbackFault(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		webmention.WritePingbackFault(w, &webmention.PingbackFault{Code: webmention.PingbackFaultAlreadyRegistered, Message: "already registered"})
+	}))
+	defer srv.Close()
+	sender := webmention.NewSender(func(c *webmention.SenderConfiguration) {
+		c.HTTPClient = srv.Client()
+	})
+	_, _, err := webmention.SendWithFallback(context.Background(), sender, webmention.Endpoints{Pingback: srv.URL}, webmention.Mention{
+		Source: "https://source.com",
+		Target: "https://target.com",
+	})
+	var fault *webmention.PingbackFault
+	require.ErrorAs(t, err, &fault)
+	require.Equal(t, webmention.PingbackFaultAlreadyRegistered, fault.Code)
+	require.Equal(t, "already registered", fault.Message)
+}
@@ -0,0 +1,125 @@
+package webmention
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+)
+
+// TargetSnapshotStore remembers which targets a source linked to the
+// last time mentions were sent for it. This is necessary so that
+// targets that have been removed from a source are notified about the
+// update as well.
+type TargetSnapshotStore interface {
+	// LoadTargets returns the targets previously stored for the given
+	// source or an empty list if there is no snapshot yet.
+	LoadTargets(ctx context.Context, source string) ([]string, error)
+	// SaveTargets replaces the snapshot of the given source.
+	SaveTargets(ctx context.Context, source string, targets []string) error
+}
+
+// ResolveTargets returns the union of the targets the source
+// previously linked to and the ones it links to right now. Sending a
+// mention to each of them is what the specification requires when a
+// source document was updated or deleted.
+func ResolveTargets(ctx context.Context, store TargetSnapshotStore, source string, current []string) ([]string, error) {
+	if store == nil {
+		return MergeTargets(nil, current), nil
+	}
+	previous, err := store.LoadTargets(ctx, source)
+	if err != nil {
+		return nil, err
+	}
+	return MergeTargets(previous, current), nil
+}
+
+// MergeTargets returns the de-duplicated union of both lists while
+// preserving the order in which targets were found.
+func MergeTargets(previous, current []string) []string {
+	seen := make(map[string]struct{})
+	result := make([]string, 0, len(previous)+len(current))
+	for _, list := range [][]string{current, previous} {
+		for _, t := range list {
+			if _, ok := seen[t]; ok {
+				continue
+			}
+			seen[t] = struct{}{}
+			result = append(result, t)
+		}
+	}
+	return result
+}
+
+type fileTargetSnapshotStore struct {
+	path string
+	lock sync.Mutex
+}
+
+// NewFileTargetSnapshotStore creates a TargetSnapshotStore that keeps
+// all snapshots inside a single JSON file.
+func NewFileTargetSnapshotStore(path string) TargetSnapshotStore {
+	return &fileTargetSnapshotStore{path: path}
+}
+
+func (s *fileTargetSnapshotStore) read() (map[string][]string, error) {
+	data := make(map[string][]string)
+	fp, err := os.Open(s.path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return data, nil
+		}
+		return nil, err
+	}
+	defer fp.Close()
+	if err := json.NewDecoder(fp).Decode(&data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+func (s *fileTargetSnapshotStore) LoadTargets(ctx context.Context, source string) ([]string, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	data, err := s.read()
+	if err != nil {
+		return nil, err
+	}
+	return data[source], nil
+}
+
+func (s *fileTargetSnapshotStore) SaveTargets(ctx context.Context, source string, targets []string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	data, err := s.read()
+	if err != nil {
+		return err
+	}
+	if len(targets) == 0 {
+		delete(data, source)
+	} else {
+		sorted := append(make([]string, 0, len(targets)), targets...)
+		sort.Strings(sorted)
+		data[source] = sorted
+	}
+	// Write into a temporary file first so that an interrupted run
+	// doesn't leave a broken snapshot file behind.
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	enc := json.NewEncoder(tmp)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), s.path)
+}
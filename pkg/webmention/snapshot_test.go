@@ -0,0 +1,47 @@
+package webmention_test
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/zerok/webmentiond/pkg/webmention"
+)
+
+func TestMergeTargets(t *testing.T) {
+	require.Equal(t, []string{"b", "c", "a"}, webmention.MergeTargets([]string{"a", "b"}, []string{"b", "c"}))
+	require.Equal(t, []string{}, webmention.MergeTargets(nil, nil))
+}
+
+func TestFileTargetSnapshotStore(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "state.json")
+	store := webmention.NewFileTargetSnapshotStore(path)
+
+	targets, err := store.LoadTargets(ctx, "https://source.com")
+	require.NoError(t, err)
+	require.Empty(t, targets)
+
+	require.NoError(t, store.SaveTargets(ctx, "https://source.com", []string{"https://b.com", "https://a.com"}))
+	require.NoError(t, store.SaveTargets(ctx, "https://other.com", []string{"https://c.com"}))
+
+	// A new store instance should see the previous state:
+	store = webmention.NewFileTargetSnapshotStore(path)
+	targets, err = store.LoadTargets(ctx, "https://source.com")
+	require.NoError(t, err)
+	require.Equal(t, []string{"https://a.com", "https://b.com"}, targets)
+
+	// Removed targets have to be part of the resolved targets:
+	resolved, err := webmention.ResolveTargets(ctx, store, "https://source.com", []string{"https://a.com", "https://d.com"})
+	require.NoError(t, err)
+	require.Equal(t, []string{"https://a.com", "https://d.com", "https://b.com"}, resolved)
+
+	require.NoError(t, store.SaveTargets(ctx, "https://source.com", nil))
+	targets, err = store.LoadTargets(ctx, "https://source.com")
+	require.NoError(t, err)
+	require.Empty(t, targets)
+	targets, err = store.LoadTargets(ctx, "https://other.com")
+	require.NoError(t, err)
+	require.Equal(t, []string{"https://c.com"}, targets)
+}